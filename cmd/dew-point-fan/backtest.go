@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/controller"
+	"github.com/aluedtke7/dew_point_fan/internal/storage"
+)
+
+// replays historical readings through the automatic control, to tune the thresholds offline
+func backtestCmd(args []string) int {
+	fs := flag.NewFlagSet("backtest", flag.ExitOnError)
+	inputPtr := fs.String("input", "", "CSV file with the readings, e.g. created with the export command")
+	applyFlags := controlFlags(fs)
+	_ = fs.Parse(args)
+	if *inputPtr == "" {
+		fmt.Fprintln(os.Stderr, "Usage: dew-point-fan backtest -input data.csv [-diff-min 4] [-hysteresis 1.5]")
+		return EXIT_USAGE
+	}
+
+	homePath := getHomePath()
+	initToolLog(homePath)
+	cfg := controller.LoadConfig(filepath.Join(homePath, controller.CONFIG_FILE))
+	applyFlags(&cfg)
+
+	f, err := os.Open(*inputPtr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_ERROR
+	}
+	records, err := readCsvRecords(f)
+	_ = f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", *inputPtr, err)
+		return EXIT_ERROR
+	}
+	if len(records) == 0 {
+		fmt.Fprintf(os.Stderr, "%s contains no readings\n", *inputPtr)
+		return EXIT_ERROR
+	}
+	res, err := controller.Backtest(cfg, records)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_ERROR
+	}
+	printBacktest(cfg, res)
+	return EXIT_OK
+}
+
+// defines the flags for the thresholds of the automatic control, the returned function sets the
+// thresholds of the flags that were given in the configuration
+func controlFlags(fs *flag.FlagSet) func(cfg *controller.Config) {
+	diffMinPtr := fs.Float64("diff-min", 0, "minimal dew point difference, default from the configuration")
+	hysteresisPtr := fs.Float64("hysteresis", 0, "hysteresis, default from the configuration")
+	humMinPtr := fs.Float64("hum-min", 0, "minimal inside humidity, default from the configuration")
+	tempInsidePtr := fs.Float64("temp-inside-min", 0, "minimal inside temperature, default from the configuration")
+	tempOutsidePtr := fs.Float64("temp-outside-min", 0, "minimal outside temperature, default from the configuration")
+	predictPtr := fs.Bool("predict", false, "use the predictive switching, default from the configuration")
+	strategyPtr := fs.String("strategy", "", "control strategy (dew_point, abs_humidity, target_rh, schedule or rule), default from the configuration")
+	return func(cfg *controller.Config) {
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "diff-min":
+				cfg.Control.DiffMin = float32(*diffMinPtr)
+			case "hysteresis":
+				cfg.Control.Hysteresis = float32(*hysteresisPtr)
+			case "hum-min":
+				cfg.Control.HumInsideMin = float32(*humMinPtr)
+			case "temp-inside-min":
+				cfg.Control.TempInsideMin = float32(*tempInsidePtr)
+			case "temp-outside-min":
+				cfg.Control.TempOutsideMin = float32(*tempOutsidePtr)
+			case "predict":
+				cfg.Predict.Enabled = *predictPtr
+			case "strategy":
+				cfg.Strategy.Type = *strategyPtr
+			}
+		})
+	}
+}
+
+// reads the readings from a CSV file with a header. The columns time, temp_i, temp_o, hum_i
+// and hum_o are needed, valid and fan_status are used if they exist.
+func readCsvRecords(r io.Reader) ([]storage.Record, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[name] = i
+	}
+	for _, name := range []string{"time", "temp_i", "temp_o", "hum_i", "hum_o"} {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("column '%s' is missing", name)
+		}
+	}
+	var records []storage.Record
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rec := storage.Record{Valid: true}
+		if rec.Time, err = parseCsvTime(row[cols["time"]]); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		for name, v := range map[string]*float32{"temp_i": &rec.TempInside, "temp_o": &rec.TempOutside,
+			"hum_i": &rec.HumInside, "hum_o": &rec.HumOutside} {
+			f, err := strconv.ParseFloat(row[cols[name]], 32)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s: %w", line, name, err)
+			}
+			*v = float32(f)
+		}
+		for name, v := range map[string]*bool{"valid": &rec.Valid, "fan_status": &rec.FanStatus} {
+			if i, ok := cols[name]; ok {
+				if *v, err = strconv.ParseBool(row[i]); err != nil {
+					return nil, fmt.Errorf("line %d: %s: %w", line, name, err)
+				}
+			}
+		}
+		records = append(records, rec)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+	return records, nil
+}
+
+func parseCsvTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local); err == nil {
+		return t, nil
+	}
+	return parseDate(s)
+}
+
+func printBacktest(cfg controller.Config, res controller.BacktestResult) {
+	c := cfg.Control
+	fmt.Printf("Period:            %s - %s\n", res.From.Format("2006-01-02 15:04"), res.To.Format("2006-01-02 15:04"))
+	fmt.Printf("Readings:          %d (%d valid)\n", res.Records, res.Valid)
+	strategy := cfg.Strategy.Type
+	if strategy == "" {
+		strategy = controller.STRATEGY_DEW_POINT
+	}
+	fmt.Printf("Strategy:          %s\n", strategy)
+	fmt.Printf("Thresholds:        diff_min %.1f, hysteresis %.1f, hum_inside_min %.1f, temp_inside_min %.1f, temp_outside_min %.1f, predict %t\n",
+		c.DiffMin, c.Hysteresis, c.HumInsideMin, c.TempInsideMin, c.TempOutsideMin, cfg.Predict.Enabled)
+	fmt.Printf("Fan runtime:       %.1f h (recorded %.1f h)\n", res.RuntimeHours, res.ActualRuntimeHours)
+	fmt.Printf("Switch operations: %d (recorded %d), %d skipped by dead_time/max_per_hour\n",
+		res.Switches, res.ActualSwitches, res.Skipped)
+	fmt.Printf("Short runs:        %d (less than %s)\n", res.ShortRuns, controller.SHORT_RUN)
+	fmt.Printf("Moisture removed:  %.0f g (estimated)\n", res.MoistureRemoved)
+	fmt.Printf("Inside humidity:   min %.1f%%, max %.1f%%, avg %.1f%%\n", res.HumInside.Min, res.HumInside.Max, res.HumInside.Avg)
+	fmt.Printf("  while venting:   min %.1f%%, max %.1f%%, avg %.1f%%\n",
+		res.HumInsideVenting.Min, res.HumInsideVenting.Max, res.HumInsideVenting.Avg)
+	fmt.Printf("Inside abs. hum.:  min %.1f, max %.1f, avg %.1f g/m³\n", res.AbsHumInside.Min, res.AbsHumInside.Max, res.AbsHumInside.Avg)
+}
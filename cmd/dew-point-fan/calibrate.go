@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/controller"
+	"github.com/aluedtke7/dew_point_fan/internal/sensor"
+)
+
+// interactive wizard for the correction values: the sensors are read several times and
+// the averages are compared with the values of a reference thermometer/hygrometer. With
+// -curve a point of the correction curves is set at the current temperature, repeated at
+// different temperatures (e.g. summer and winter) this builds the curves.
+func calibrateCmd(args []string) int {
+	fs := flag.NewFlagSet("calibrate", flag.ExitOnError)
+	samplesPtr := fs.Int("samples", 5, "number of readings per sensor")
+	curvePtr := fs.Bool("curve", false, "set a point of the correction curves instead of the offsets")
+	pairPtr := fs.Bool("side-by-side", false, "compare the sensors placed side by side instead of asking for reference values")
+	hoursPtr := fs.Float64("hours", 6, "duration of the side by side comparison in hours")
+	intervalPtr := fs.Int("interval", 60, "time between the readings of the side by side comparison in s")
+	refPtr := fs.Int("reference", 0, "index of the reference sensor of the side by side comparison (0 is inside)")
+	yesPtr := fs.Bool("yes", false, "save the proposed offsets of the side by side comparison without asking")
+	_ = fs.Parse(args)
+	if *samplesPtr < 1 {
+		*samplesPtr = 1
+	}
+
+	homePath := getHomePath()
+	initToolLog(homePath)
+	path := filepath.Join(homePath, controller.CONFIG_FILE)
+	// the offsets are saved in the config file, so a broken file must not be replaced by the defaults
+	cfg, err := controller.ReadConfig(path)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Config file %s: %s\n", path, err)
+		return EXIT_ERROR
+	}
+	sensors, err := controller.OpenSensors(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_ERROR
+	}
+	if *pairPtr {
+		if *intervalPtr < 5 {
+			*intervalPtr = 5
+		}
+		return sideBySide(cfg, sensors, path, *hoursPtr, time.Duration(*intervalPtr)*time.Second, *refPtr, *yesPtr)
+	}
+	fmt.Println("Place a reference thermometer/hygrometer next to each sensor. Make sure the fan")
+	fmt.Println("controller is stopped, otherwise the sensor readings may fail.")
+
+	in := bufio.NewReader(os.Stdin)
+	changed := false
+	for i, s := range sensors {
+		fmt.Printf("\nReading sensor %s %d times...\n", s.Name(), *samplesPtr)
+		var sumT, sumH float32
+		n := 0
+		for j := 0; j < *samplesPtr; j++ {
+			t, h, _, err := s.Read()
+			if err != nil {
+				fmt.Printf("  reading failed: %s\n", err)
+				continue
+			}
+			fmt.Printf("  %5.1f°C %5.1f%%\n", t, h)
+			sumT += t
+			sumH += h
+			n++
+		}
+		if n == 0 {
+			fmt.Printf("No valid readings, sensor %s is skipped\n", s.Name())
+			continue
+		}
+		avgT, avgH := sumT/float32(n), sumH/float32(n)
+		sc := &cfg.Sensors[i]
+		ct, ch := sc.Correct(avgT, avgH)
+		fmt.Printf("Average raw values: %.1f°C %.1f%%, current corrections: %.1f°C %.1f%%\n", avgT, avgH, ct-avgT, ch-avgH)
+		if *curvePtr {
+			at := roundOffset(avgT)
+			if ref, ok := askFloat(in, "Reference temperature in °C (empty to keep the curve): "); ok {
+				sc.TempCurve = sensor.SetCurvePoint(sc.TempCurve, sensor.CurvePoint{Temp: at, Offset: roundOffset(ref - avgT)})
+				changed = true
+			}
+			if ref, ok := askFloat(in, "Reference humidity in % (empty to keep the curve): "); ok {
+				sc.HumCurve = sensor.SetCurvePoint(sc.HumCurve, sensor.CurvePoint{Temp: at, Offset: roundOffset(ref - avgH)})
+				changed = true
+			}
+			tc, _ := json.Marshal(sc.TempCurve)
+			hc, _ := json.Marshal(sc.HumCurve)
+			fmt.Printf("Curves of %s: temp_curve %s, hum_curve %s\n", s.Name(), tc, hc)
+			continue
+		}
+		if len(sc.TempCurve) > 0 || len(sc.HumCurve) > 0 {
+			fmt.Println("The sensor has correction curves, they are used instead of the offsets (see -curve)")
+		}
+		if ref, ok := askFloat(in, "Reference temperature in °C (empty to keep the offset): "); ok {
+			sc.TempOffset = roundOffset(ref - avgT)
+			changed = true
+		}
+		if ref, ok := askFloat(in, "Reference humidity in % (empty to keep the offset): "); ok {
+			sc.HumOffset = roundOffset(ref - avgH)
+			changed = true
+		}
+		fmt.Printf("Offsets of %s: temp_offset %.1f, hum_offset %.1f\n", s.Name(), sc.TempOffset, sc.HumOffset)
+	}
+	if !changed {
+		fmt.Println("\nNothing changed")
+		return EXIT_OK
+	}
+	fmt.Printf("\nWrite the new offsets to %s? [y/N] ", path)
+	answer, _ := in.ReadString('\n')
+	if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+		fmt.Println("Not saved")
+		return EXIT_OK
+	}
+	if err = controller.SaveSensorCorrections(path, cfg.Sensors); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_ERROR
+	}
+	fmt.Println("Saved, restart the fan controller to use the new corrections")
+	return EXIT_OK
+}
+
+// asks for a number until the input is valid or empty
+func askFloat(in *bufio.Reader, prompt string) (float32, bool) {
+	for {
+		fmt.Print(prompt)
+		line, err := in.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return 0, false
+		}
+		v, perr := strconv.ParseFloat(strings.Replace(line, ",", ".", 1), 32)
+		if perr == nil {
+			return float32(v), true
+		}
+		if err != nil {
+			return 0, false
+		}
+		fmt.Println("Please enter a number")
+	}
+}
+
+func roundOffset(v float32) float32 {
+	return float32(math.Round(float64(v)*10) / 10)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aluedtke7/dew_point_fan/internal/controller"
+)
+
+// reads the sensors once and prints the values, e.g. for cron jobs or monitoring scripts
+func checkCmd(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	jsonPtr := fs.Bool("json", false, "print the values as JSON")
+	_ = fs.Parse(args)
+
+	homePath := getHomePath()
+	initToolLog(homePath)
+	cfg := controller.LoadConfig(filepath.Join(homePath, controller.CONFIG_FILE))
+	data, err := controller.ReadSensors(cfg)
+	if data == nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_ERROR
+	}
+	if *jsonPtr {
+		j, _ := json.MarshalIndent(data, "", "  ")
+		fmt.Println(string(j))
+	} else {
+		for _, d := range data {
+			if d.Error != "" {
+				fmt.Printf("%-10s failed: %s\n", d.Name, d.Error)
+				continue
+			}
+			fmt.Printf("%-10s DP: %6.1f, Temp: %5.1f°C, Humidity: %5.1f%%\n", d.Name, d.DewPoint, d.Temperature, d.Humidity)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_ERROR
+	}
+	return EXIT_OK
+}
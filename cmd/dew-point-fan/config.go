@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aluedtke7/dew_point_fan/internal/controller"
+)
+
+// commands for the configuration file
+func configCmd(args []string) int {
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Fprintf(os.Stderr, "Usage: dew-point-fan config validate [-config file]\n")
+		return EXIT_USAGE
+	}
+	fs := flag.NewFlagSet("config validate", flag.ExitOnError)
+	pathPtr := fs.String("config", "", "configuration file, default is ~/.dew_point_fan/"+controller.CONFIG_FILE)
+	_ = fs.Parse(args[1:])
+	path := *pathPtr
+	if path == "" {
+		path = filepath.Join(getHomePath(), controller.CONFIG_FILE)
+	}
+
+	errs := controller.ValidateFile(path)
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+	}
+	if len(errs) > 0 {
+		return EXIT_ERROR
+	}
+	fmt.Printf("%s is valid\n", path)
+	return EXIT_OK
+}
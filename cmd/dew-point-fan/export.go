@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/controller"
+	"github.com/aluedtke7/dew_point_fan/internal/storage"
+)
+
+const (
+	EXPORT_CSV  = "csv"
+	EXPORT_JSON = "json"
+)
+
+// exports the local measurement history
+func exportCmd(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	fromPtr := fs.String("from", "", "start date (2006-01-02 or 2006-01-02T15:04:05), default is -hours before now")
+	toPtr := fs.String("to", "", "end date (2006-01-02 or 2006-01-02T15:04:05), default is now")
+	hoursPtr := fs.Int("hours", 24, "number of hours to export, if -from is not set")
+	formatPtr := fs.String("format", EXPORT_CSV, "output format: csv or json")
+	outPtr := fs.String("o", "", "output file, default is stdout")
+	_ = fs.Parse(args)
+
+	to := time.Now()
+	var err error
+	if *toPtr != "" {
+		if to, err = parseDate(*toPtr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return EXIT_USAGE
+		}
+	}
+	from := to.Add(-time.Duration(*hoursPtr) * time.Hour)
+	if *fromPtr != "" {
+		if from, err = parseDate(*fromPtr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return EXIT_USAGE
+		}
+	}
+	if *formatPtr != EXPORT_CSV && *formatPtr != EXPORT_JSON {
+		fmt.Fprintf(os.Stderr, "unknown format '%s'\n", *formatPtr)
+		return EXIT_USAGE
+	}
+
+	homePath := getHomePath()
+	initToolLog(homePath)
+	cfg := controller.LoadConfig(filepath.Join(homePath, controller.CONFIG_FILE))
+	path := filepath.Join(cfg.Paths.DataDir(homePath), controller.HISTORY_FILE)
+	if _, err = os.Stat(path); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_ERROR
+	}
+	store, err := storage.OpenLocal(path, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't open %s (while the fan controller is running use /api/v1/history): %s\n", path, err)
+		return EXIT_ERROR
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+	records, err := store.Range(from, to)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_ERROR
+	}
+
+	var w io.Writer = os.Stdout
+	if *outPtr != "" {
+		f, err := os.Create(*outPtr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return EXIT_ERROR
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		w = f
+	}
+	if *formatPtr == EXPORT_JSON {
+		err = writeJsonRecords(w, records)
+	} else {
+		err = writeCsvRecords(w, records)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_ERROR
+	}
+	return EXIT_OK
+}
+
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02T15:04:05", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
+
+func writeJsonRecords(w io.Writer, records []storage.Record) error {
+	j, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(j))
+	return err
+}
+
+func writeCsvRecords(w io.Writer, records []storage.Record) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"time", "valid", "temp_i", "temp_o", "hum_i", "hum_o",
+		"dewpoint_i", "dewpoint_o", "venting", "fan_status", "source", "maintenance"})
+	f := func(v float32) string {
+		return strconv.FormatFloat(float64(v), 'f', 1, 32)
+	}
+	for _, r := range records {
+		_ = cw.Write([]string{
+			r.Time.Format(time.RFC3339),
+			strconv.FormatBool(r.Valid),
+			f(r.TempInside), f(r.TempOutside),
+			f(r.HumInside), f(r.HumOutside),
+			f(r.DewPointInside), f(r.DewPointOutside),
+			strconv.FormatBool(r.Venting),
+			strconv.FormatBool(r.FanStatus),
+			r.Source,
+			strconv.FormatBool(r.Maintenance),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aluedtke7/dew_point_fan/internal/controller"
+)
+
+// prints a Grafana dashboard for the configured InfluxDB backend
+func grafanaCmd(args []string) int {
+	fs := flag.NewFlagSet("grafana", flag.ExitOnError)
+	outPtr := fs.String("o", "", "output file, default is stdout")
+	_ = fs.Parse(args)
+
+	homePath := getHomePath()
+	initToolLog(homePath)
+	cfg := controller.LoadConfig(filepath.Join(homePath, controller.CONFIG_FILE))
+	j, err := controller.Dashboard(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_ERROR
+	}
+	if *outPtr == "" {
+		fmt.Print(string(j))
+		return EXIT_OK
+	}
+	if err = os.WriteFile(*outPtr, j, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_ERROR
+	}
+	return EXIT_OK
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	d2r2log "github.com/d2r2/go-logger"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"github.com/aluedtke7/dew_point_fan/internal/version"
+)
+
+// exit codes of the commands
+const (
+	EXIT_OK    = 0
+	EXIT_ERROR = 1
+	EXIT_USAGE = 2
+)
+
+const usage = `Usage: dew-point-fan [command] [flags]
+
+Commands:
+  run              run the fan controller (default)
+  check            read the sensors once, the exit code is 1 if a sensor fails
+  calibrate        determine the correction values of the sensors
+  export           export the local measurement history as CSV or JSON
+  backtest         replay readings from a CSV file with other thresholds
+  replay           replay readings from InfluxDB with other thresholds
+  config validate  check the configuration file
+  grafana          print a Grafana dashboard for the InfluxDB data
+  version          print the version
+
+Use "dew-point-fan <command> -h" for the flags of a command.
+`
+
+func getHomeDir() string {
+	usr, err := user.Current()
+	if err != nil {
+		return "~/"
+	}
+	return usr.HomeDir
+}
+
+// returns the directory with the configuration and the data files, DPF_HOME overrides
+// ~/.dew_point_fan, e.g. with /etc/dew-point-fan for a system service
+func getHomePath() string {
+	homePath, ok := os.LookupEnv("DPF_HOME")
+	if !ok {
+		homePath = filepath.Join(getHomeDir(), ".dew_point_fan")
+	}
+	_ = os.MkdirAll(homePath, os.ModePerm)
+	return homePath
+}
+
+// initializes the log for the commands besides run: the log file only, stdout is used for the results
+func initToolLog(homePath string) {
+	_ = logger.Init(logger.Config{Dir: filepath.Join(homePath, "log"), File: true})
+	_ = d2r2log.ChangePackageLogLevel("dht", d2r2log.FatalLevel)
+}
+
+func versionCmd(_ []string) int {
+	fmt.Println("dew-point-fan", version.String())
+	return EXIT_OK
+}
+
+func main() {
+	cmd, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+	var code int
+	switch cmd {
+	case "run":
+		code = runCmd(args)
+	case "check":
+		code = checkCmd(args)
+	case "calibrate":
+		code = calibrateCmd(args)
+	case "export":
+		code = exportCmd(args)
+	case "backtest":
+		code = backtestCmd(args)
+	case "replay":
+		code = replayCmd(args)
+	case "config":
+		code = configCmd(args)
+	case "grafana":
+		code = grafanaCmd(args)
+	case "version":
+		code = versionCmd(args)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command '%s'\n\n%s", cmd, usage)
+		code = EXIT_USAGE
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/controller"
+)
+
+// replays the readings of the configured InfluxDB through the automatic control, like backtest
+func replayCmd(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	fromPtr := fs.String("from", "", "start date (2006-01-02 or 2006-01-02T15:04:05), default is -days before now")
+	toPtr := fs.String("to", "", "end date (2006-01-02 or 2006-01-02T15:04:05), default is now")
+	daysPtr := fs.Int("days", 7, "number of days to replay, if -from is not set")
+	applyFlags := controlFlags(fs)
+	_ = fs.Parse(args)
+
+	to := time.Now()
+	var err error
+	if *toPtr != "" {
+		if to, err = parseDate(*toPtr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return EXIT_USAGE
+		}
+	}
+	from := to.Add(-time.Duration(*daysPtr) * 24 * time.Hour)
+	if *fromPtr != "" {
+		if from, err = parseDate(*fromPtr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return EXIT_USAGE
+		}
+	}
+
+	homePath := getHomePath()
+	initToolLog(homePath)
+	cfg := controller.LoadConfig(filepath.Join(homePath, controller.CONFIG_FILE))
+	applyFlags(&cfg)
+	records, err := controller.LoadInfluxRecords(cfg, from, to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't query InfluxDB: %s\n", err)
+		return EXIT_ERROR
+	}
+	if len(records) == 0 {
+		fmt.Fprintln(os.Stderr, "InfluxDB contains no readings in this period")
+		return EXIT_ERROR
+	}
+	res, err := controller.Backtest(cfg, records)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_ERROR
+	}
+	printBacktest(cfg, res)
+	return EXIT_OK
+}
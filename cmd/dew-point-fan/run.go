@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	d2r2log "github.com/d2r2/go-logger"
+
+	"github.com/aluedtke7/dew_point_fan/internal/controller"
+	"github.com/aluedtke7/dew_point_fan/internal/display"
+	"github.com/aluedtke7/dew_point_fan/internal/display/console"
+	"github.com/aluedtke7/dew_point_fan/internal/display/lcd"
+	"github.com/aluedtke7/dew_point_fan/internal/httpapi"
+	"github.com/aluedtke7/dew_point_fan/internal/i18n"
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"github.com/aluedtke7/dew_point_fan/internal/shutdown"
+	"github.com/aluedtke7/dew_point_fan/internal/version"
+)
+
+// runs the fan controller, this is the default command
+func runCmd(args []string) (code int) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	lcdDelayPtr := fs.Int("lcdDelay", 3, "initial delay for LCD in s (1s...10s)")
+	scrollSpeedPtr := fs.Int("scrollSpeed", 500, "scroll speed in ms (100ms...10000ms)")
+	versionPtr := fs.Bool("version", false, "print the version and exit")
+	gpioPtr := fs.String("gpio", "", "GPIO backend: periph, gpiod or fake, overrides the config file")
+	dryRunPtr := fs.Bool("dry-run", false, "run the control, but never switch the fan relais (GPIO25)")
+	_ = fs.Parse(args)
+	if *versionPtr {
+		return versionCmd(nil)
+	}
+
+	defer func() {
+		_ = d2r2log.FinalizeLogger()
+	}()
+
+	homePath := getHomePath()
+	// until the configuration is loaded, the log is written to the default directory, if possible
+	_ = logger.Init(logger.Config{Dir: filepath.Join(homePath, "log"), File: controller.CheckWritable(filepath.Join(homePath, "log")) == nil, Console: true})
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Error("Panic occurred:", err)
+			shutdown.Run()
+			// systemd restarts the program with Restart=on-failure
+			code = 1
+		}
+	}()
+	logger.Infof("Starting Dew Point Fan %s...", version.String())
+	cfg := controller.LoadConfig(filepath.Join(homePath, controller.CONFIG_FILE))
+	cfg.Log.Dir = cfg.Paths.LogDir(homePath)
+	cfg.Plugins.Dir = cfg.Paths.PluginDir(homePath)
+	if cfg.Log.File {
+		if err := controller.CheckWritable(cfg.Log.Dir); err != nil {
+			// without log files the log goes to journald, if it's running
+			logger.Warnf("No log files, %s isn't writable: %s", cfg.Log.Dir, err)
+			cfg.Log.File = false
+			cfg.Log.Journal = cfg.Log.Journal || logger.JournalAvailable()
+		}
+	}
+	dataDir := cfg.Paths.DataDir(homePath)
+	if err := controller.CheckWritable(dataDir); err != nil {
+		logger.Warnf("The state, the InfluxDB queue and the history aren't saved, %s isn't writable: %s", dataDir, err)
+	}
+	if *dryRunPtr {
+		cfg.DryRun = true
+	}
+	if *gpioPtr != "" {
+		cfg.Gpio.Backend = *gpioPtr
+	}
+	if err := logger.Init(cfg.Log); err != nil {
+		fmt.Printf("Couldn't initialize the log: %s\n", err)
+	}
+	// the exit handlers run in reverse order, so the buffer of the low-write mode is written last
+	shutdown.OnExit(logger.Flush)
+
+	_ = d2r2log.ChangePackageLogLevel("dht", d2r2log.ErrorLevel)
+	if err := i18n.SetLanguage(cfg.Language); err != nil {
+		logger.Error(err)
+	}
+
+	if *scrollSpeedPtr < 100 {
+		*scrollSpeedPtr = 100
+	}
+	if *scrollSpeedPtr > 10000 {
+		*scrollSpeedPtr = 10000
+	}
+	if *lcdDelayPtr < 1 {
+		*lcdDelayPtr = 1
+	}
+	if *lcdDelayPtr > 10 {
+		*lcdDelayPtr = 10
+	}
+
+	disp := openDisplays(cfg.Display.Outputs, *scrollSpeedPtr, *lcdDelayPtr)
+	if disp != nil {
+		disp.Backlight(true)
+		shutdown.OnExit(func() {
+			disp.Clear()
+			disp.Backlight(false)
+			disp.Close()
+		})
+	}
+
+	ctrl, err := controller.New(cfg, dataDir, display.NewPager(disp))
+	if err != nil {
+		fatal(err)
+	}
+
+	var ctrlChan = make(chan os.Signal, 1)
+	signal.Notify(ctrlChan, os.Interrupt, syscall.SIGTERM)
+	// this goroutine is waiting for being stopped
+	go func() {
+		<-ctrlChan
+		logger.Info("Ctrl+C received... Exiting")
+		shutdown.Run()
+		os.Exit(1)
+	}()
+
+	// a little http server to show current values, on every configured address
+	handler := httpapi.New(ctrl)
+	for _, addr := range cfg.Http.Listen {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			fatal(err)
+		}
+		logger.Infof("Web server listening on %s", ln.Addr())
+		shutdown.Go(func() {
+			fatal(http.Serve(ln, handler))
+		})
+	}
+	if cfg.Http.Tls.Listen != "" {
+		tlsCfg, err := cfg.Http.Tls.Config(dataDir)
+		if err != nil {
+			fatal(err)
+		}
+		srv := &http.Server{Addr: cfg.Http.Tls.Listen, Handler: handler, TLSConfig: tlsCfg}
+		logger.Infof("HTTPS server listening on %s", cfg.Http.Tls.Listen)
+		shutdown.Go(func() {
+			fatal(srv.ListenAndServeTLS("", ""))
+		})
+	}
+
+	ctrl.Run()
+	return 0
+}
+
+// logs the error and exits after the fan was switched to the safe state
+func fatal(err error) {
+	logger.Error(err)
+	shutdown.Exit(1)
+}
+
+// opens the displays of the configuration, several displays show the same lines. Returns nil
+// without a display.
+func openDisplays(outputs []controller.DisplayOutput, scrollSpeed, lcdDelay int) display.Display {
+	if len(outputs) == 0 {
+		outputs = []controller.DisplayOutput{{Type: controller.DISPLAY_LCD}}
+	}
+	var list []display.Display
+	for _, o := range outputs {
+		switch o.Type {
+		case controller.DISPLAY_LCD:
+			lcdDisp, err := lcd.New(false, scrollSpeed, lcdDelay)
+			if err != nil {
+				logger.Errorf("Couldn't initialize display: %s", err)
+				continue
+			}
+			list = append(list, lcdDisp)
+		case controller.DISPLAY_CONSOLE:
+			list = append(list, console.New(os.Stdout, o.Width, o.Rows))
+		default:
+			logger.Errorf("Unknown display '%s'", o.Type)
+		}
+	}
+	switch len(list) {
+	case 0:
+		return nil
+	case 1:
+		return list[0]
+	}
+	return display.NewMulti(list...)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/controller"
+	"github.com/aluedtke7/dew_point_fan/internal/sensor"
+)
+
+// at least this number of samples is needed for a proposal
+const SIDE_BY_SIDE_MIN_SAMPLES = 10
+
+// sums of the differences between the reference sensor and another sensor
+type diffSums struct {
+	n                      int
+	sumT, sumH, sqrT, sqrH float64
+}
+
+func (d *diffSums) add(dt, dh float32) {
+	d.n++
+	d.sumT += float64(dt)
+	d.sumH += float64(dh)
+	d.sqrT += float64(dt) * float64(dt)
+	d.sqrH += float64(dh) * float64(dh)
+}
+
+// returns the mean and the standard deviation
+func (d *diffSums) stats(sum, sqr float64) (float32, float32) {
+	mean := sum / float64(d.n)
+	return float32(mean), float32(math.Sqrt(math.Max(sqr/float64(d.n)-mean*mean, 0)))
+}
+
+// the sensors are placed side by side for some hours and read every interval. The mean
+// difference between the corrected values of the reference sensor and the raw values of
+// another sensor is the proposed offset of that sensor. Ctrl+C ends the recording early.
+func sideBySide(cfg controller.Config, sensors []sensor.Sensor, path string, hours float64, interval time.Duration, ref int, yes bool) int {
+	if ref < 0 || ref >= len(sensors) {
+		fmt.Fprintf(os.Stderr, "reference must be between 0 and %d\n", len(sensors)-1)
+		return EXIT_USAGE
+	}
+	fmt.Printf("Place all sensors side by side. They are read every %s for %.1f h, the\n", interval, hours)
+	fmt.Printf("reference is %s. Make sure the fan controller is stopped. Ctrl+C ends the\n", sensors[ref].Name())
+	fmt.Println("recording early, the samples so far are used.")
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	defer signal.Stop(stop)
+	sums := make([]diffSums, len(sensors))
+	deadline := time.Now().Add(time.Duration(hours * float64(time.Hour)))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+record:
+	for time.Now().Before(deadline) {
+		t := make([]float32, len(sensors))
+		h := make([]float32, len(sensors))
+		ok := true
+		for i, s := range sensors {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Sensors[i].ReadTimeout())
+			var err error
+			t[i], h[i], _, err = sensor.ReadContext(ctx, s)
+			cancel()
+			if err != nil {
+				fmt.Printf("%s  reading of %s failed: %s\n", time.Now().Format("15:04:05"), s.Name(), err)
+				ok = false
+				break
+			}
+		}
+		if ok {
+			refT, refH := cfg.Sensors[ref].Correct(t[ref], h[ref])
+			line := fmt.Sprintf("%s  %s %5.1f°C %5.1f%%", time.Now().Format("15:04:05"), sensors[ref].Name(), refT, refH)
+			for i := range sensors {
+				if i != ref {
+					sums[i].add(refT-t[i], refH-h[i])
+					line += fmt.Sprintf(", %s %5.1f°C %5.1f%%", sensors[i].Name(), t[i], h[i])
+				}
+			}
+			fmt.Println(line)
+		}
+		select {
+		case <-stop:
+			fmt.Println()
+			break record
+		case <-ticker.C:
+		}
+	}
+
+	changed := false
+	for i, s := range sensors {
+		if i == ref {
+			continue
+		}
+		if sums[i].n < SIDE_BY_SIDE_MIN_SAMPLES {
+			fmt.Printf("%s: only %d samples, at least %d are needed\n", s.Name(), sums[i].n, SIDE_BY_SIDE_MIN_SAMPLES)
+			continue
+		}
+		meanT, devT := sums[i].stats(sums[i].sumT, sums[i].sqrT)
+		meanH, devH := sums[i].stats(sums[i].sumH, sums[i].sqrH)
+		sc := &cfg.Sensors[i]
+		fmt.Printf("%s: %d samples, difference %.2f°C (±%.2f) %.2f%% (±%.2f)\n", s.Name(), sums[i].n, meanT, devT, meanH, devH)
+		fmt.Printf("  proposed offsets: temp_offset %.1f, hum_offset %.1f (current %.1f, %.1f)\n",
+			roundOffset(meanT), roundOffset(meanH), sc.TempOffset, sc.HumOffset)
+		if len(sc.TempCurve) > 0 || len(sc.HumCurve) > 0 {
+			fmt.Println("  the sensor has correction curves, they are used instead of the offsets")
+		}
+		sc.TempOffset, sc.HumOffset = roundOffset(meanT), roundOffset(meanH)
+		changed = true
+	}
+	if !changed {
+		fmt.Println("Nothing changed")
+		return EXIT_OK
+	}
+	if !yes {
+		fmt.Printf("\nWrite the proposed offsets to %s? [y/N] ", path)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			fmt.Println("Not saved")
+			return EXIT_OK
+		}
+	}
+	if err := controller.SaveSensorCorrections(path, cfg.Sensors); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return EXIT_ERROR
+	}
+	fmt.Println("Saved, restart the fan controller to use the new corrections")
+	return EXIT_OK
+}
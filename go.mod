@@ -8,7 +8,14 @@ require (
 	github.com/d2r2/go-hd44780 v0.0.0-20181002113701-74cc28c83a3e
 	github.com/d2r2/go-i2c v0.0.0-20191123181816-73a8a799d6bc
 	github.com/d2r2/go-logger v0.0.0-20210606094344-60e9d1233e22
+	github.com/eclipse/paho.mqtt.golang v1.4.3
 	github.com/influxdata/influxdb-client-go/v2 v2.12.3
+	github.com/warthog618/gpiod v0.8.2
+	github.com/yuin/gopher-lua v1.1.0
+	go.etcd.io/bbolt v1.3.9
+	golang.org/x/crypto v0.11.0
+	golang.org/x/net v0.10.0
+	golang.org/x/sys v0.10.0
 	periph.io/x/conn/v3 v3.7.0
 	periph.io/x/host/v3 v3.8.2
 )
@@ -17,8 +24,10 @@ require (
 	github.com/d2r2/go-shell v0.0.0-20211022052110-f591c27e3e2e // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/deepmap/oapi-codegen v1.8.2 // indirect
+	github.com/gorilla/websocket v1.5.0 // indirect
 	github.com/influxdata/line-protocol v0.0.0-20200327222509-2487e7298839 // indirect
 	github.com/op/go-logging v0.0.0-20160315200505-970db520ece7 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
-	golang.org/x/net v0.7.0 // indirect
+	golang.org/x/sync v0.5.0 // indirect
+	golang.org/x/text v0.11.0 // indirect
 )
@@ -0,0 +1,155 @@
+// Package actuator switches the fan. The controller only knows the Actuator interface, the
+// implementations drive a GPIO relais, a PWM output, an output of an I2C expander, a smart
+// plug or an MQTT switch. A dry run uses an actuator that only logs.
+package actuator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	d2r2log "github.com/d2r2/go-logger"
+)
+
+const (
+	TypeGPIO     = "gpio"
+	TypePWM      = "pwm"
+	TypePCF8574  = "pcf8574"
+	TypePCA9554  = "pca9554"
+	TypeMCP23017 = "mcp23017"
+	TypeShelly   = "shelly"
+	TypeTasmota  = "tasmota"
+	TypeMQTT     = "mqtt"
+	DEF_PIN      = "GPIO25"
+)
+
+var lg = d2r2log.NewPackageLogger("actuator", d2r2log.InfoLevel)
+
+// ErrNoFeedback is returned by State, if the actuator can't report its actual state
+var ErrNoFeedback = errors.New("the actuator doesn't report its state")
+
+// Actuator switches a fan
+type Actuator interface {
+	// Name describes the actuator for the log, e.g. "gpio GPIO25"
+	Name() string
+	Set(on bool) error
+	// State returns the actual state of the fan, e.g. reported by a smart plug, or ErrNoFeedback
+	State() (bool, error)
+}
+
+// Config is the part of the configuration that selects and sets up the actuator
+type Config struct {
+	Type       string `json:"type"`        // "gpio" (default), "pwm", "pcf8574", "pca9554", "mcp23017", "shelly", "tasmota" or "mqtt"
+	Pin        string `json:"pin"`         // GPIO of the relais (active low) for type "gpio", default GPIO25
+	I2CBus     int    `json:"i2c_bus"`     // I2C bus of the expander
+	I2CAddress uint8  `json:"i2c_address"` // I2C address of the expander, default 32 (0x20)
+	Channel    int    `json:"channel"`     // output of the expander, 0...7 (0...15 for the MCP23017), relay of the plug or PWM channel
+	ActiveLow  bool   `json:"active_low"`  // the relais of the expander is switched on with a low level
+	// hardware PWM (sysfs), e.g. for 4 pin fans
+	PwmChip   int `json:"pwm_chip"`  // number of /sys/class/pwm/pwmchipN
+	Frequency int `json:"frequency"` // in Hz, default 25000
+	Duty      int `json:"duty"`      // duty cycle in % when the fan is on, default 100
+	// smart plug
+	Url      string `json:"url"` // e.g. "http://192.168.0.40"
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// MQTT switch
+	Broker     string `json:"broker"`      // e.g. "tcp://192.168.0.22:1883"
+	Topic      string `json:"topic"`       // command topic, e.g. "cmnd/fan/POWER"
+	StateTopic string `json:"state_topic"` // topic of the reported state, e.g. "stat/fan/POWER"
+	PayloadOn  string `json:"payload_on"`  // default "ON"
+	PayloadOff string `json:"payload_off"` // default "OFF"
+}
+
+// New creates the actuator of the configuration, in a dry run an actuator that only logs
+func New(cfg Config, dryRun bool) (Actuator, error) {
+	if dryRun {
+		return &dryRunActuator{name: cfg.Name()}, nil
+	}
+	switch strings.ToLower(cfg.Type) {
+	case "", TypeGPIO:
+		return newGpioRelay(cfg)
+	case TypePWM:
+		return newPwmOutput(cfg)
+	case TypePCF8574, TypePCA9554, TypeMCP23017:
+		return newExpanderRelay(cfg)
+	case TypeShelly, TypeTasmota:
+		return newPlug(cfg)
+	case TypeMQTT:
+		return newMqttSwitch(cfg)
+	}
+	return nil, fmt.Errorf("unknown actuator type '%s'", cfg.Type)
+}
+
+// Name describes the configured actuator, e.g. "gpio GPIO25"
+func (cfg Config) Name() string {
+	switch strings.ToLower(cfg.Type) {
+	case "", TypeGPIO:
+		pin := cfg.Pin
+		if pin == "" {
+			pin = DEF_PIN
+		}
+		return TypeGPIO + " " + pin
+	case TypePWM:
+		return fmt.Sprintf("pwm %d/%d", cfg.PwmChip, cfg.Channel)
+	case TypeShelly, TypeTasmota:
+		return fmt.Sprintf("%s %s/%d", strings.ToLower(cfg.Type), cfg.Url, cfg.Channel)
+	case TypeMQTT:
+		return "mqtt " + cfg.Topic
+	}
+	return fmt.Sprintf("%s %d/%#x/%d", strings.ToLower(cfg.Type), cfg.I2CBus, cfg.I2CAddress, cfg.Channel)
+}
+
+// Validate checks the settings of the actuator type
+func (cfg Config) Validate() error {
+	switch strings.ToLower(cfg.Type) {
+	case "", TypeGPIO, TypePCF8574, TypePCA9554, TypeMCP23017:
+	case TypePWM:
+		if cfg.Duty < 0 || cfg.Duty > 100 {
+			return errors.New("duty must be between 0 and 100")
+		}
+	case TypeShelly, TypeTasmota:
+		if cfg.Url == "" {
+			return errors.New("the smart plug needs an url")
+		}
+	case TypeMQTT:
+		if cfg.Broker == "" || cfg.Topic == "" {
+			return errors.New("the MQTT switch needs broker and topic")
+		}
+	default:
+		return fmt.Errorf("unknown type '%s'", cfg.Type)
+	}
+	return nil
+}
+
+// UsesGpio returns true if the fan is switched with a GPIO pin
+func (cfg Config) UsesGpio() bool {
+	return cfg.Type == "" || strings.ToLower(cfg.Type) == TypeGPIO
+}
+
+// UsesI2C returns true if the fan is switched with an I2C expander
+func (cfg Config) UsesI2C() bool {
+	switch strings.ToLower(cfg.Type) {
+	case TypePCF8574, TypePCA9554, TypeMCP23017:
+		return true
+	}
+	return false
+}
+
+// dryRunActuator never switches anything
+type dryRunActuator struct {
+	name string
+}
+
+func (d *dryRunActuator) Name() string {
+	return "dry run (" + d.name + ")"
+}
+
+func (d *dryRunActuator) Set(on bool) error {
+	lg.Debugf("Dry run: %s not switched to %t", d.name, on)
+	return nil
+}
+
+func (d *dryRunActuator) State() (bool, error) {
+	return false, ErrNoFeedback
+}
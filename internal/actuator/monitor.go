@@ -0,0 +1,63 @@
+package actuator
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Status is the state of the actuator for the API
+type Status struct {
+	Name        string `json:"name"`
+	Confirmed   *bool  `json:"confirmed,omitempty"`    // the reported state matched the last switch operation, nil without feedback
+	Failures    int    `json:"failures"`               // failed switch operations since the start
+	Failed      bool   `json:"failed"`                 // the last switch operation failed
+	LastError   string `json:"last_error,omitempty"`   // error of the last failed switch operation
+	LastFailure string `json:"last_failure,omitempty"` // time of the last failed switch operation
+}
+
+// Monitor confirms every switch operation with the state reported by the actuator and
+// keeps the failures
+type Monitor struct {
+	Actuator
+	mu     sync.Mutex
+	status Status
+}
+
+func NewMonitor(a Actuator) *Monitor {
+	return &Monitor{Actuator: a, status: Status{Name: a.Name()}}
+}
+
+// Set switches the actuator, a state that doesn't match afterwards is an error
+func (m *Monitor) Set(on bool) error {
+	err := m.Actuator.Set(on)
+	var confirmed *bool
+	if err == nil {
+		if state, stateErr := m.Actuator.State(); stateErr == nil {
+			ok := state == on
+			confirmed = &ok
+			if !ok {
+				err = fmt.Errorf("%s reports %s after switching", m.Name(), onOff(state))
+			}
+		} else if stateErr != ErrNoFeedback {
+			err = fmt.Errorf("%s: state unknown after switching: %w", m.Name(), stateErr)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status.Confirmed = confirmed
+	m.status.Failed = err != nil
+	if err != nil {
+		m.status.Failures++
+		m.status.LastError = err.Error()
+		m.status.LastFailure = time.Now().Format("2006-01-02 15:04:05")
+	}
+	return err
+}
+
+// Status returns the result of the switch operations
+func (m *Monitor) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
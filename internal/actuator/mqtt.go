@@ -0,0 +1,142 @@
+package actuator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	DEF_PAYLOAD_ON  = "ON"
+	DEF_PAYLOAD_OFF = "OFF"
+	// time to wait for the state after a command
+	MQTT_CONFIRM = 5 * time.Second
+)
+
+var errNoState = errors.New("no state received")
+
+// mqttSwitch publishes the commands to a switch (e.g. Tasmota or ESPHome) and receives its state
+type mqttSwitch struct {
+	name       string
+	topic      string
+	stateTopic string
+	payloadOn  string
+	payloadOff string
+	client     mqtt.Client
+	mu         sync.Mutex
+	state      bool
+	known      bool
+	changed    chan struct{} // closed and replaced on every state message
+}
+
+func newMqttSwitch(cfg Config) (*mqttSwitch, error) {
+	if cfg.Broker == "" || cfg.Topic == "" {
+		return nil, errors.New("the MQTT switch needs broker and topic")
+	}
+	s := &mqttSwitch{
+		name:       cfg.Name(),
+		topic:      cfg.Topic,
+		stateTopic: cfg.StateTopic,
+		payloadOn:  cfg.PayloadOn,
+		payloadOff: cfg.PayloadOff,
+		changed:    make(chan struct{}),
+	}
+	if s.payloadOn == "" {
+		s.payloadOn = DEF_PAYLOAD_ON
+	}
+	if s.payloadOff == "" {
+		s.payloadOff = DEF_PAYLOAD_OFF
+	}
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(fmt.Sprintf("dew-point-fan-actuator-%d", time.Now().UnixNano())).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(30 * time.Second).
+		SetOnConnectHandler(func(c mqtt.Client) {
+			lg.Infof("%s: MQTT connected to %s", s.name, cfg.Broker)
+			if s.stateTopic != "" {
+				c.Subscribe(s.stateTopic, 0, s.onState)
+			}
+		})
+	s.client = mqtt.NewClient(opts)
+	s.client.Connect()
+	return s, nil
+}
+
+func (s *mqttSwitch) onState(_ mqtt.Client, msg mqtt.Message) {
+	payload := strings.TrimSpace(string(msg.Payload()))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case strings.EqualFold(payload, s.payloadOn):
+		s.state = true
+	case strings.EqualFold(payload, s.payloadOff):
+		s.state = false
+	default:
+		lg.Warnf("%s: unknown state '%s'", s.name, payload)
+		return
+	}
+	s.known = true
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *mqttSwitch) Name() string {
+	return s.name
+}
+
+// publishes the command and waits for the state, if the switch reports it
+func (s *mqttSwitch) Set(on bool) error {
+	payload := s.payloadOff
+	if on {
+		payload = s.payloadOn
+	}
+	s.mu.Lock()
+	changed := s.changed
+	s.mu.Unlock()
+	t := s.client.Publish(s.topic, 1, false, payload)
+	if !t.WaitTimeout(MQTT_CONFIRM) {
+		return errors.New("publishing the command timed out")
+	}
+	if err := t.Error(); err != nil {
+		return err
+	}
+	if s.stateTopic == "" {
+		return nil
+	}
+	deadline := time.After(MQTT_CONFIRM)
+	for {
+		select {
+		case <-changed:
+			s.mu.Lock()
+			state := s.state
+			changed = s.changed
+			s.mu.Unlock()
+			if state == on {
+				return nil
+			}
+		case <-deadline:
+			// the monitor reports the wrong state
+			return nil
+		}
+	}
+}
+
+func (s *mqttSwitch) State() (bool, error) {
+	if s.stateTopic == "" {
+		return false, ErrNoFeedback
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.known {
+		return false, errNoState
+	}
+	return s.state, nil
+}
@@ -0,0 +1,169 @@
+package actuator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const PLUG_TIMEOUT = 3 * time.Second
+
+// plugRelay switches a Shelly (Gen1 or Gen2 and later) or Tasmota smart plug via its HTTP API
+type plug struct {
+	name     string
+	typ      string
+	base     string
+	channel  int
+	username string
+	password string
+	http     *http.Client
+	mu       sync.Mutex
+	gen      int // generation of the Shelly, 0 until known
+}
+
+func newPlug(cfg Config) (*plug, error) {
+	if cfg.Url == "" {
+		return nil, fmt.Errorf("%s: the smart plug needs an url", cfg.Type)
+	}
+	base := strings.TrimRight(cfg.Url, "/")
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	return &plug{
+		name:     cfg.Name(),
+		typ:      strings.ToLower(cfg.Type),
+		base:     base,
+		channel:  cfg.Channel,
+		username: cfg.Username,
+		password: cfg.Password,
+		http:     &http.Client{Timeout: PLUG_TIMEOUT},
+	}, nil
+}
+
+func (p *plug) Name() string {
+	return p.name
+}
+
+// the monitor confirms the switch operation with State
+func (p *plug) Set(on bool) error {
+	_, err := p.request(&on)
+	return err
+}
+
+// State returns the state reported by the plug
+func (p *plug) State() (bool, error) {
+	return p.request(nil)
+}
+
+// switches the plug, if on isn't nil, and returns the state reported by the plug
+func (p *plug) request(on *bool) (bool, error) {
+	var path string
+	switch p.typ {
+	case TypeTasmota:
+		cmnd := fmt.Sprintf("Power%d", p.channel+1)
+		if on != nil {
+			cmnd += " " + onOff(*on)
+		}
+		q := url.Values{"cmnd": {cmnd}}
+		if p.username != "" {
+			q.Set("user", p.username)
+			q.Set("password", p.password)
+		}
+		path = "/cm?" + q.Encode()
+	default:
+		gen, err := p.generation()
+		if err != nil {
+			return false, err
+		}
+		if gen == 1 {
+			path = fmt.Sprintf("/relay/%d", p.channel)
+			if on != nil {
+				path += "?turn=" + strings.ToLower(onOff(*on))
+			}
+		} else if on != nil {
+			path = fmt.Sprintf("/rpc/Switch.Set?id=%d&on=%t", p.channel, *on)
+		} else {
+			path = fmt.Sprintf("/rpc/Switch.GetStatus?id=%d", p.channel)
+		}
+	}
+	var resp map[string]interface{}
+	if err := p.get(path, &resp); err != nil {
+		return false, err
+	}
+	if p.typ == TypeTasmota {
+		// {"POWER":"ON"} with one relay, {"POWER2":"OFF"} with several
+		for _, key := range []string{fmt.Sprintf("POWER%d", p.channel+1), "POWER"} {
+			if v, ok := resp[key].(string); ok {
+				return strings.EqualFold(v, "on"), nil
+			}
+		}
+		return false, fmt.Errorf("tasmota: unexpected response %v", resp)
+	}
+	// Gen1 answers with the state (ison), Gen2 with the state before a switch (was_on)
+	if v, ok := resp["ison"].(bool); ok {
+		return v, nil
+	}
+	if v, ok := resp["output"].(bool); ok {
+		return v, nil
+	}
+	if _, ok := resp["was_on"]; ok && on != nil {
+		return *on, nil
+	}
+	return false, fmt.Errorf("shelly: unexpected response %v", resp)
+}
+
+// returns the generation of the Shelly, Gen2 and later report it at /shelly
+func (p *plug) generation() (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.gen != 0 {
+		return p.gen, nil
+	}
+	var info struct {
+		Gen int `json:"gen"`
+	}
+	if err := p.get("/shelly", &info); err != nil {
+		return 0, err
+	}
+	p.gen = 1
+	if info.Gen >= 2 {
+		p.gen = info.Gen
+	}
+	lg.Infof("Shelly at %s is generation %d", p.base, p.gen)
+	return p.gen, nil
+}
+
+func (p *plug) get(path string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, p.base+path, nil)
+	if err != nil {
+		return err
+	}
+	if p.username != "" && p.typ == TypeShelly {
+		req.SetBasicAuth(p.username, p.password)
+	}
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", p.typ, resp.Status)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", p.typ, err)
+	}
+	return nil
+}
+
+func onOff(on bool) string {
+	if on {
+		return "ON"
+	}
+	return "OFF"
+}
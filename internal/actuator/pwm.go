@@ -0,0 +1,80 @@
+package actuator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	DEF_FREQUENCY = 25000 // Hz, the PWM frequency of 4 pin PC fans
+	DEF_DUTY      = 100   // %
+	pwmRoot       = "/sys/class/pwm"
+)
+
+// pwmOutput drives a hardware PWM channel via sysfs (dtoverlay=pwm on the Raspberry Pi),
+// off is a duty cycle of 0
+type pwmOutput struct {
+	name   string
+	dir    string
+	period int64 // ns
+	duty   int   // % when on
+}
+
+func newPwmOutput(cfg Config) (*pwmOutput, error) {
+	freq, duty := cfg.Frequency, cfg.Duty
+	if freq <= 0 {
+		freq = DEF_FREQUENCY
+	}
+	if duty <= 0 {
+		duty = DEF_DUTY
+	}
+	chip := filepath.Join(pwmRoot, fmt.Sprintf("pwmchip%d", cfg.PwmChip))
+	p := &pwmOutput{
+		name:   cfg.Name(),
+		dir:    filepath.Join(chip, fmt.Sprintf("pwm%d", cfg.Channel)),
+		period: int64(time.Second) / int64(freq),
+		duty:   duty,
+	}
+	if _, err := os.Stat(p.dir); os.IsNotExist(err) {
+		if err = writeSysfs(filepath.Join(chip, "export"), strconv.Itoa(cfg.Channel)); err != nil {
+			return nil, err
+		}
+		// udev needs some time to set the permissions of the new files
+		time.Sleep(100 * time.Millisecond)
+	}
+	// the duty cycle must not be larger than the period
+	if err := writeSysfs(filepath.Join(p.dir, "duty_cycle"), "0"); err != nil {
+		return nil, err
+	}
+	if err := writeSysfs(filepath.Join(p.dir, "period"), strconv.FormatInt(p.period, 10)); err != nil {
+		return nil, err
+	}
+	if err := writeSysfs(filepath.Join(p.dir, "enable"), "1"); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *pwmOutput) Name() string {
+	return p.name
+}
+
+func (p *pwmOutput) Set(on bool) error {
+	var duty int64
+	if on {
+		duty = p.period * int64(p.duty) / 100
+	}
+	return writeSysfs(filepath.Join(p.dir, "duty_cycle"), strconv.FormatInt(duty, 10))
+}
+
+// the duty cycle doesn't tell if the fan turns, that's the job of the tachometer
+func (p *pwmOutput) State() (bool, error) {
+	return false, ErrNoFeedback
+}
+
+func writeSysfs(path, value string) error {
+	return os.WriteFile(path, []byte(value), 0644)
+}
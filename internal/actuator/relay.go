@@ -0,0 +1,81 @@
+package actuator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/expander"
+	"github.com/aluedtke7/dew_point_fan/internal/gpioio"
+	"periph.io/x/conn/v3/gpio"
+)
+
+const I2C_TIMEOUT = 2 * time.Second
+
+// relais on a GPIO pin (active low), the feedback is read by the controller with GPIO22
+type gpioRelay struct {
+	pin gpioio.Pin
+}
+
+func newGpioRelay(cfg Config) (*gpioRelay, error) {
+	name := cfg.Pin
+	if name == "" {
+		name = DEF_PIN
+	}
+	pin := gpioio.ByName(name)
+	if pin == nil {
+		return nil, fmt.Errorf("failed to find %s", name)
+	}
+	return &gpioRelay{pin: pin}, nil
+}
+
+func (r *gpioRelay) Name() string {
+	return TypeGPIO + " " + r.pin.Name()
+}
+
+func (r *gpioRelay) Set(on bool) error {
+	return r.pin.Out(gpio.Level(!on))
+}
+
+func (r *gpioRelay) State() (bool, error) {
+	return false, ErrNoFeedback
+}
+
+// relais on an output of an I2C expander, it's switched off on creation
+type expanderRelay struct {
+	name      string
+	out       *expander.Output
+	activeLow bool
+}
+
+func newExpanderRelay(cfg Config) (*expanderRelay, error) {
+	out, err := expander.New(cfg.Type, cfg.I2CBus, cfg.I2CAddress, cfg.Channel, cfg.ActiveLow)
+	if err != nil {
+		return nil, err
+	}
+	return &expanderRelay{name: cfg.Name(), out: out, activeLow: cfg.ActiveLow}, nil
+}
+
+func (r *expanderRelay) Name() string {
+	return r.name
+}
+
+// a hanging I2C bus must not stall the control loop
+func (r *expanderRelay) Set(on bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), I2C_TIMEOUT)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- r.out.Set(on != r.activeLow)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("switching the relais of the expander: %w", ctx.Err())
+	}
+}
+
+func (r *expanderRelay) State() (bool, error) {
+	return false, ErrNoFeedback
+}
@@ -0,0 +1,214 @@
+// Package coap implements the small part of CoAP (RFC 7252) that the controller needs: a server
+// over UDP, so that constrained devices like battery powered displays can read the state and set
+// the override without the overhead of TCP and HTTP.
+package coap
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strings"
+
+	d2r2log "github.com/d2r2/go-logger"
+)
+
+// Code is the method of a request or the status of a response (class << 5 | detail)
+type Code byte
+
+// methods and response codes
+const (
+	GET    Code = 0x01
+	POST   Code = 0x02
+	PUT    Code = 0x03
+	DELETE Code = 0x04
+
+	Changed          Code = 0x44 // 2.04
+	Content          Code = 0x45 // 2.05
+	BadRequest       Code = 0x80 // 4.00
+	Unauthorized     Code = 0x81 // 4.01
+	BadOption        Code = 0x82 // 4.02
+	Forbidden        Code = 0x83 // 4.03
+	NotFound         Code = 0x84 // 4.04
+	MethodNotAllowed Code = 0x85 // 4.05
+)
+
+// content formats
+const (
+	FormatText = 0
+	FormatLink = 40 // application/link-format of /.well-known/core
+	FormatJson = 50
+)
+
+// message types
+const (
+	typeCon = iota
+	typeNon
+	typeAck
+	typeRst
+)
+
+// option numbers
+const (
+	optUriHost       = 3
+	optUriPort       = 7
+	optUriPath       = 11
+	optContentFormat = 12
+	optUriQuery      = 15
+	optAccept        = 17
+)
+
+// MAX_MESSAGE is the maximal size of a message, that fits into a datagram without fragmentation
+const MAX_MESSAGE = 1152
+
+var lg = d2r2log.NewPackageLogger("coap", d2r2log.InfoLevel)
+
+var errFormat = errors.New("invalid message")
+
+type option struct {
+	num   int
+	value []byte
+}
+
+type message struct {
+	typ     byte
+	code    Code
+	id      uint16
+	token   []byte
+	options []option
+	payload []byte
+}
+
+// parses a message: the header (version, type, token length, code, message id), the token,
+// the options with their delta encoded numbers and the payload after the marker 0xff
+func parse(b []byte) (message, error) {
+	var m message
+	if len(b) < 4 || b[0]>>6 != 1 {
+		return m, errFormat
+	}
+	m.typ = b[0] >> 4 & 0x3
+	tkl := int(b[0] & 0xf)
+	m.code = Code(b[1])
+	m.id = binary.BigEndian.Uint16(b[2:])
+	if tkl > 8 || len(b) < 4+tkl {
+		return m, errFormat
+	}
+	m.token = b[4 : 4+tkl]
+	b = b[4+tkl:]
+	num := 0
+	for len(b) > 0 {
+		if b[0] == 0xff {
+			m.payload = b[1:]
+			break
+		}
+		delta, length := int(b[0]>>4), int(b[0]&0xf)
+		b = b[1:]
+		var err error
+		if delta, b, err = extended(delta, b); err != nil {
+			return m, err
+		}
+		if length, b, err = extended(length, b); err != nil {
+			return m, err
+		}
+		if len(b) < length {
+			return m, errFormat
+		}
+		num += delta
+		m.options = append(m.options, option{num: num, value: b[:length]})
+		b = b[length:]
+	}
+	return m, nil
+}
+
+// returns the value of an option delta or length with the extended bytes
+func extended(v int, b []byte) (int, []byte, error) {
+	switch v {
+	case 13:
+		if len(b) < 1 {
+			return 0, nil, errFormat
+		}
+		return int(b[0]) + 13, b[1:], nil
+	case 14:
+		if len(b) < 2 {
+			return 0, nil, errFormat
+		}
+		return int(binary.BigEndian.Uint16(b)) + 269, b[2:], nil
+	case 15:
+		return 0, nil, errFormat
+	}
+	return v, b, nil
+}
+
+func (m message) encode() []byte {
+	b := []byte{1<<6 | m.typ<<4 | byte(len(m.token)), byte(m.code), byte(m.id >> 8), byte(m.id)}
+	b = append(b, m.token...)
+	sort.SliceStable(m.options, func(i, j int) bool { return m.options[i].num < m.options[j].num })
+	num := 0
+	for _, o := range m.options {
+		delta, dext := nibble(o.num - num)
+		length, lext := nibble(len(o.value))
+		b = append(append(append(b, byte(delta<<4|length)), dext...), lext...)
+		b = append(b, o.value...)
+		num = o.num
+	}
+	if len(m.payload) > 0 {
+		b = append(append(b, 0xff), m.payload...)
+	}
+	return b
+}
+
+// returns the 4 bit value of an option delta or length and its extended bytes
+func nibble(v int) (int, []byte) {
+	switch {
+	case v < 13:
+		return v, nil
+	case v < 269:
+		return 13, []byte{byte(v - 13)}
+	}
+	return 14, []byte{byte((v - 269) >> 8), byte(v - 269)}
+}
+
+// returns the path of the Uri-Path options, e.g. "state" or ".well-known/core"
+func (m message) path() string {
+	var parts []string
+	for _, o := range m.options {
+		if o.num == optUriPath {
+			parts = append(parts, string(o.value))
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// returns the Uri-Query options, e.g. token=...
+func (m message) query() map[string]string {
+	q := map[string]string{}
+	for _, o := range m.options {
+		if o.num == optUriQuery {
+			k, v, _ := strings.Cut(string(o.value), "=")
+			q[k] = v
+		}
+	}
+	return q
+}
+
+// returns false if the message has a critical option (odd number) that the server doesn't know
+func (m message) supported() bool {
+	for _, o := range m.options {
+		switch o.num {
+		case optUriHost, optUriPort, optUriPath, optUriQuery, optAccept:
+		default:
+			if o.num%2 == 1 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// returns the option value of an unsigned integer in the minimal number of bytes
+func uintValue(v int) []byte {
+	var b []byte
+	for ; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	return b
+}
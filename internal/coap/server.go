@@ -0,0 +1,114 @@
+package coap
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// Request is a request of a client
+type Request struct {
+	Method  Code
+	Path    string            // e.g. "state"
+	Query   map[string]string // e.g. token
+	Payload []byte
+	Addr    string // address of the client without the port
+}
+
+// Response is the answer to a request
+type Response struct {
+	Code    Code
+	Format  int // content format of the payload
+	Payload []byte
+}
+
+// Handler returns the response to a request
+type Handler func(req Request) Response
+
+// Server answers the requests over UDP. A confirmable request gets a piggybacked response, a
+// non-confirmable one a non-confirmable response. The resources are idempotent, so a retransmitted
+// request is simply answered again.
+type Server struct {
+	conn    net.PacketConn
+	handler Handler
+	mu      sync.Mutex
+	nextId  uint16
+}
+
+// Listen starts the server on addr, e.g. ":5683"
+func Listen(addr string, handler Handler) (*Server, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{conn: conn, handler: handler}
+	go s.serve()
+	return s, nil
+}
+
+// Close stops the server
+func (s *Server) Close() {
+	_ = s.conn.Close()
+}
+
+func (s *Server) serve() {
+	buf := make([]byte, MAX_MESSAGE)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				lg.Errorf("CoAP: %s", err)
+			}
+			return
+		}
+		req, err := parse(append([]byte{}, buf[:n]...))
+		if err != nil {
+			lg.Debugf("CoAP: %s from %s", err, addr)
+			continue
+		}
+		if resp, ok := s.respond(req, addr); ok {
+			if _, err = s.conn.WriteTo(resp.encode(), addr); err != nil {
+				lg.Warnf("CoAP: %s", err)
+			}
+		}
+	}
+}
+
+// returns the response message of a request, false if there is no response
+func (s *Server) respond(req message, addr net.Addr) (message, bool) {
+	switch {
+	case req.typ == typeAck || req.typ == typeRst:
+		return message{}, false
+	case req.code == 0:
+		// an empty confirmable message is a ping, it's answered with a reset
+		return message{typ: typeRst, id: req.id}, req.typ == typeCon
+	case req.code>>5 != 0:
+		// a response isn't expected by a server
+		return message{typ: typeRst, id: req.id}, true
+	}
+	resp := message{typ: typeAck, id: req.id, token: req.token}
+	if req.typ == typeNon {
+		resp.typ, resp.id = typeNon, s.messageId()
+	}
+	if !req.supported() {
+		resp.code = BadOption
+		return resp, true
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	r := s.handler(Request{Method: req.code, Path: req.path(), Query: req.query(), Payload: req.payload, Addr: host})
+	resp.code, resp.payload = r.Code, r.Payload
+	if len(r.Payload) > 0 {
+		resp.options = []option{{num: optContentFormat, value: uintValue(r.Format)}}
+	}
+	return resp, true
+}
+
+func (s *Server) messageId() uint16 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextId++
+	return s.nextId
+}
@@ -0,0 +1,305 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/expr"
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"github.com/aluedtke7/dew_point_fan/internal/notify"
+)
+
+const (
+	ALERT_CONTROLLER_STUCK = "controller_stuck"
+	SEVERITY_INFO          = "info"
+	SEVERITY_WARN          = "warn"
+	SEVERITY_ERROR         = "error"
+)
+
+// variables that can be used in the condition of an alert rule
+var alertVars = []string{"temp_i", "temp_o", "hum_i", "hum_o", "dp_i", "dp_o", "delta_dp", "valid",
+	"failures", "purging", "venting", "fan", "mismatch", "rpm", "stalled", "relay_wear", "boost", "frost", "paused", "lockout",
+	"rssi", "wifi_weak", "diverged", "actuator_failed", "retry_rate", "failure_rate", "degraded"}
+
+type notifyConfig struct {
+	Pushover     notify.PushoverConfig `json:"pushover"`
+	Ntfy         notify.NtfyConfig     `json:"ntfy"`
+	Repeat       int                   `json:"repeat"`        // minimum time in minutes between repetitions of an alert
+	Rules        []alertRule           `json:"rules"`         // the default rules are used if missing
+	StuckMinutes int                   `json:"stuck_minutes"` // alert when no measurement cycle was completed for this time
+	Smtp         notify.SmtpConfig     `json:"smtp"`
+	SummaryTime  string                `json:"summary_time"` // time of the daily summary email, e.g. "07:00", empty to disable
+}
+
+// alertRule sends an alert when the condition is true for the given number of minutes
+type alertRule struct {
+	Name      string   `json:"name"`
+	Condition string   `json:"condition"` // e.g. "hum_i > 65 and valid"
+	Minutes   float32  `json:"minutes"`
+	Severity  string   `json:"severity"` // info, warn or error
+	Channels  []string `json:"channels"` // pushover, ntfy, smtp, all if empty
+	Message   string   `json:"message"`  // optional text of the alert
+}
+
+// the rules that were hardcoded before the rules engine
+func defaultAlertRules() []alertRule {
+	return []alertRule{
+		{Name: "humidity_high", Condition: "hum_i > 70", Minutes: 360, Severity: SEVERITY_WARN,
+			Message: "Inside humidity is above 70%"},
+		{Name: "sensor_failed", Condition: "failures >= 20", Severity: SEVERITY_ERROR,
+			Message: "No valid sensor readings for 20 cycles"},
+		{Name: "fan_mismatch", Condition: "mismatch", Severity: SEVERITY_WARN,
+			Message: "The fan should be on, but the feedback is off (fuse, relais or switch)"},
+		{Name: "fan_stalled", Condition: "stalled", Severity: SEVERITY_ERROR,
+			Message: "The fan is on, but doesn't turn (seized fan, broken belt)"},
+		{Name: "relay_service", Condition: "relay_wear", Severity: SEVERITY_INFO,
+			Message: "The relais reached the service threshold of its switch operations"},
+		{Name: "wifi_weak", Condition: "wifi_weak", Minutes: 30, Severity: SEVERITY_WARN,
+			Message: "The Wi-Fi signal is weak, measurements may get lost"},
+		{Name: "actuator_failed", Condition: "actuator_failed", Severity: SEVERITY_ERROR,
+			Message: "Switching the fan failed or wasn't confirmed"},
+		{Name: "sensor_diverged", Condition: "diverged", Minutes: 60, Severity: SEVERITY_WARN,
+			Message: "The redundant sensors differ, check their calibration"},
+		{Name: "sensor_degraded", Condition: "degraded", Severity: SEVERITY_WARN,
+			Message: "A sensor retries or fails often, check its cable and the sensor"},
+		{Name: "condensation_risk", Condition: "valid and temp_i - dp_i < 1", Severity: SEVERITY_ERROR,
+			Message: "Inside temperature is close to the dew point"},
+	}
+}
+
+// values of the current cycle for the alert conditions
+type alertInput struct {
+	readingsGood    bool
+	purging         bool // readings are suppressed because of a heater purge
+	tempInside      float32
+	tempOutside     float32
+	humInside       float32
+	humOutside      float32
+	dewPointInside  float32
+	dewPointOutside float32
+	fanShouldBeOn   bool
+	fanStatus       bool
+	mismatch        bool // the fan is off for the grace period, although it should be on
+	rpm             int
+	stalled         bool // the fan is on, but turns slower than min_rpm
+	relayWear       bool // the relais reached warn_percent of its rated switch operations
+	boosting        bool
+	frost           bool
+	paused          bool
+	lockout         bool
+	wifi            *WifiInfo // nil without a Wi-Fi link
+	diverged        bool      // the sensors of a redundant sensor differ more than allowed
+	actuatorFailed  bool      // the last switch operation of the fan failed
+	maintenance     bool      // no alerts are sent during the maintenance mode
+	retryRate       float32   // highest retries per read of the sensors within the window of sensor_health
+	failureRate     float32   // highest failed reads in % of the sensors within the window
+	degraded        bool      // a sensor exceeds the limits of sensor_health
+}
+
+// creates the dispatcher with all configured notification backends
+func newDispatcher(cfg notifyConfig) *notify.Dispatcher {
+	d := notify.NewDispatcher(time.Duration(cfg.Repeat) * time.Minute)
+	if cfg.Pushover.Token != "" {
+		d.Add(notify.NewPushover(cfg.Pushover))
+	}
+	if cfg.Ntfy.Topic != "" {
+		d.Add(notify.NewNtfy(cfg.Ntfy))
+	}
+	if cfg.Smtp.Host != "" {
+		d.Add(notify.Filter(notify.NewSmtp(cfg.Smtp), cfg.Smtp.Rules))
+	}
+	return d
+}
+
+type compiledRule struct {
+	alertRule
+	cond   *expr.Expr
+	since  time.Time // zero while the condition is false
+	firing bool      // true after the alert was sent
+}
+
+// alertMonitor evaluates the alert rules every cycle
+type alertMonitor struct {
+	cfg        notifyConfig
+	dispatcher *notify.Dispatcher
+	rules      []*compiledRule
+	failures   int
+	events     *eventStream
+	mu         sync.Mutex // the state of the rules is read by the monitoring checks
+}
+
+func newAlertMonitor(cfg notifyConfig, dispatcher *notify.Dispatcher) (*alertMonitor, error) {
+	a := &alertMonitor{cfg: cfg, dispatcher: dispatcher}
+	rules := cfg.Rules
+	if rules == nil {
+		rules = defaultAlertRules()
+	}
+	for _, r := range rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("alert rule '%s' has no name", r.Condition)
+		}
+		switch r.Severity {
+		case "":
+			r.Severity = SEVERITY_WARN
+		case SEVERITY_INFO, SEVERITY_WARN, SEVERITY_ERROR:
+		default:
+			return nil, fmt.Errorf("alert rule %s: unknown severity '%s'", r.Name, r.Severity)
+		}
+		cond, err := expr.Parse(r.Condition, alertVars)
+		if err != nil {
+			return nil, fmt.Errorf("alert rule %s: %s", r.Name, err)
+		}
+		a.rules = append(a.rules, &compiledRule{alertRule: r, cond: cond})
+	}
+	return a, nil
+}
+
+func severityPriority(severity string) int {
+	switch severity {
+	case SEVERITY_INFO:
+		return notify.PriorityLow
+	case SEVERITY_ERROR:
+		return notify.PriorityHigh
+	}
+	return notify.PriorityNormal
+}
+
+// evaluates the alert rules
+func (a *alertMonitor) check(now time.Time, in alertInput) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if in.readingsGood {
+		a.failures = 0
+	} else if !in.purging {
+		a.failures++
+	}
+	if in.maintenance {
+		// the conditions start again after the maintenance, the alerts that fired are resolved
+		for _, r := range a.rules {
+			a.resolve(r)
+		}
+		return
+	}
+	vars := expr.Vars{
+		"temp_i":          float64(in.tempInside),
+		"temp_o":          float64(in.tempOutside),
+		"hum_i":           float64(in.humInside),
+		"hum_o":           float64(in.humOutside),
+		"dp_i":            float64(in.dewPointInside),
+		"dp_o":            float64(in.dewPointOutside),
+		"delta_dp":        float64(in.dewPointInside - in.dewPointOutside),
+		"valid":           expr.Bool(in.readingsGood),
+		"failures":        float64(a.failures),
+		"purging":         expr.Bool(in.purging),
+		"venting":         expr.Bool(in.fanShouldBeOn),
+		"fan":             expr.Bool(in.fanStatus),
+		"mismatch":        expr.Bool(in.mismatch),
+		"rpm":             float64(in.rpm),
+		"stalled":         expr.Bool(in.stalled),
+		"relay_wear":      expr.Bool(in.relayWear),
+		"boost":           expr.Bool(in.boosting),
+		"frost":           expr.Bool(in.frost),
+		"paused":          expr.Bool(in.paused),
+		"lockout":         expr.Bool(in.lockout),
+		"rssi":            0,
+		"wifi_weak":       0,
+		"diverged":        expr.Bool(in.diverged),
+		"actuator_failed": expr.Bool(in.actuatorFailed),
+		"retry_rate":      float64(in.retryRate),
+		"failure_rate":    float64(in.failureRate),
+		"degraded":        expr.Bool(in.degraded),
+	}
+	if in.wifi != nil {
+		vars["rssi"] = float64(in.wifi.Rssi)
+		vars["wifi_weak"] = expr.Bool(in.wifi.Weak)
+	}
+	for _, r := range a.rules {
+		active, err := r.cond.True(vars)
+		if err != nil {
+			logger.Warnf("Alert rule %s: %s", r.Name, err)
+			continue
+		}
+		if !active {
+			a.resolve(r)
+			continue
+		}
+		if r.since.IsZero() {
+			r.since = now
+		}
+		minutes := now.Sub(r.since).Minutes()
+		if minutes < float64(r.Minutes) {
+			continue
+		}
+		text := r.Message
+		if text == "" {
+			text = fmt.Sprintf("Condition '%s' is true", r.Condition)
+		}
+		if r.Minutes > 0 {
+			text += fmt.Sprintf(" for %.0f min", minutes)
+		}
+		if !r.firing {
+			r.firing = true
+			a.events.publish(Event{Type: EVENT_ALERT, Name: r.Name, Active: true})
+		}
+		a.dispatcher.Alert(r.Name, notify.Message{
+			Title:    fmt.Sprintf("Dew Point Fan: %s (%s)", r.Name, r.Severity),
+			Text:     text,
+			Priority: severityPriority(r.Severity),
+			Channels: r.Channels,
+		})
+	}
+}
+
+// resets the condition of the rule and resolves its alert
+func (a *alertMonitor) resolve(r *compiledRule) {
+	r.since = time.Time{}
+	a.dispatcher.Resolve(r.Name)
+	if r.firing {
+		r.firing = false
+		a.events.publish(Event{Type: EVENT_ALERT, Name: r.Name, Active: false})
+	}
+}
+
+// AlertState is an alert rule and whether its alert is firing
+type AlertState struct {
+	Name     string `json:"name"`
+	Severity string `json:"severity"`
+	Firing   bool   `json:"firing"`
+	Message  string `json:"message"`
+}
+
+// returns the state of all rules
+func (a *alertMonitor) states() []AlertState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var states []AlertState
+	for _, r := range a.rules {
+		text := r.Message
+		if text == "" {
+			text = fmt.Sprintf("Condition '%s'", r.Condition)
+		}
+		states = append(states, AlertState{Name: r.Name, Severity: r.Severity, Firing: r.firing, Message: text})
+	}
+	return states
+}
+
+// alerts when the measurement loop didn't complete a cycle for too long, should be started as goroutine
+func (a *alertMonitor) watchCycles(lastCycle func() time.Time) {
+	limit := time.Duration(a.cfg.StuckMinutes) * time.Minute
+	if limit <= 0 {
+		return
+	}
+	for {
+		time.Sleep(time.Minute)
+		if since := time.Since(lastCycle()); since > limit {
+			a.dispatcher.Alert(ALERT_CONTROLLER_STUCK, notify.Message{
+				Title:    "Dew Point Fan: controller stuck",
+				Text:     fmt.Sprintf("No measurement cycle completed for %.0f minutes", since.Minutes()),
+				Priority: notify.PriorityHigh,
+			})
+		} else {
+			a.dispatcher.Resolve(ALERT_CONTROLLER_STUCK)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+const (
+	AUDIT_FILE     = "audit.log"
+	AUDIT_LOG_SIZE = 500 // number of entries kept, the file is compacted at twice the size
+)
+
+// changes recorded in the audit log, the commands of MQTT are recorded with their name
+const (
+	AUDIT_OVERRIDE      = "override"
+	AUDIT_BOOST         = "boost"
+	AUDIT_DIFF_MIN      = "diff_min"
+	AUDIT_HYSTERESIS    = "hysteresis"
+	AUDIT_CONFIG        = "config"
+	AUDIT_PAUSE         = "pause"
+	AUDIT_MAINTENANCE   = "maintenance"
+	AUDIT_LOG_LEVEL     = "log_level"
+	AUDIT_RUNTIME_RESET = "runtime_reset"
+	AUDIT_RELAY_RESET   = "relay_reset"
+	AUDIT_RESTART       = "restart"
+)
+
+// AuditEntry is a change of the override or the configuration with the values before and after
+type AuditEntry struct {
+	Time   string `json:"time"`
+	Change string `json:"change"`           // e.g. override, boost or config
+	Via    string `json:"via"`              // web, api, ha, mqtt, coap or button
+	Client string `json:"client,omitempty"` // address of the client, empty for a button or MQTT
+	Old    string `json:"old"`
+	New    string `json:"new"`
+}
+
+// auditLog keeps the last entries in memory and appends every entry to a file, so that the
+// log survives restarts
+type auditLog struct {
+	mu      sync.Mutex
+	path    string
+	entries []AuditEntry
+	lines   int // lines of the file
+}
+
+// loads the entries of the file, a missing file is an empty log
+func loadAuditLog(dir string) *auditLog {
+	a := &auditLog{path: filepath.Join(dir, AUDIT_FILE)}
+	f, err := os.Open(a.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warnf("Couldn't read audit log %s: %s", a.path, err)
+		}
+		return a
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		a.lines++
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		a.entries = append(a.entries, e)
+	}
+	if len(a.entries) > AUDIT_LOG_SIZE {
+		a.entries = a.entries[len(a.entries)-AUDIT_LOG_SIZE:]
+	}
+	return a
+}
+
+func (a *auditLog) add(e AuditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	logger.Infof("Audit: %s via %s %s: '%s' -> '%s'", e.Change, e.Via, e.Client, e.Old, e.New)
+	a.entries = append(a.entries, e)
+	if len(a.entries) > AUDIT_LOG_SIZE {
+		a.entries = a.entries[len(a.entries)-AUDIT_LOG_SIZE:]
+	}
+	if err := a.write(e); err != nil {
+		logger.Errorf("Couldn't write audit log: %s", err)
+	}
+}
+
+// appends the entry, the file is rewritten with the kept entries when it got too long
+func (a *auditLog) write(e AuditEntry) error {
+	if a.lines >= 2*AUDIT_LOG_SIZE {
+		return a.compact()
+	}
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	j, _ := json.Marshal(e)
+	if _, err = f.Write(append(j, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	a.lines++
+	return f.Close()
+}
+
+func (a *auditLog) compact() error {
+	var data []byte
+	for _, e := range a.entries {
+		j, _ := json.Marshal(e)
+		data = append(append(data, j...), '\n')
+	}
+	// write to a temp file first, so that a power loss doesn't leave a broken file
+	tmp := a.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, a.path); err != nil {
+		return err
+	}
+	a.lines = len(a.entries)
+	return nil
+}
+
+// returns all entries, oldest first
+func (a *auditLog) list() []AuditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]AuditEntry{}, a.entries...)
+}
+
+// returns the current value of a change for the audit log
+func (c *Controller) auditValue(change string) string {
+	switch change {
+	case AUDIT_OVERRIDE:
+		return []string{"auto", "on", "off"}[c.getRemoteOverride()]
+	case AUDIT_BOOST:
+		return remainingText(c.boost.remaining())
+	case AUDIT_DIFF_MIN:
+		return strconv.FormatFloat(float64(c.limits.get().DiffMin), 'f', -1, 32)
+	case AUDIT_HYSTERESIS:
+		return strconv.FormatFloat(float64(c.hysteresis.value()), 'f', -1, 32)
+	case AUDIT_CONFIG:
+		l := c.limits.get()
+		l.Hysteresis = c.hysteresis.value()
+		j, _ := json.Marshal(l)
+		return string(j)
+	case AUDIT_PAUSE:
+		return remainingText(c.pause.remaining())
+	case AUDIT_MAINTENANCE:
+		return remainingText(c.maintenance.remaining())
+	case AUDIT_LOG_LEVEL:
+		return c.logLevel.response().Level
+	case AUDIT_RUNTIME_RESET:
+		return fmt.Sprintf("%.1f h", c.runtime.response().Hours)
+	case AUDIT_RELAY_RESET:
+		return strconv.FormatInt(c.relay.response().Switches, 10)
+	}
+	return ""
+}
+
+// "off" or the remaining time of a boost, a pause or the maintenance mode
+func remainingText(d time.Duration) string {
+	if d <= 0 {
+		return "off"
+	}
+	return d.Round(time.Second).String()
+}
+
+// Audited executes the change with fn and records it in the audit log with the values before
+// and after, failed changes aren't recorded. A change of the override or the boost is also shown
+// as override_by in /info.
+func (c *Controller) Audited(change, via, client string, fn func() error) error {
+	old := c.auditValue(change)
+	if err := fn(); err != nil {
+		return err
+	}
+	e := AuditEntry{Time: time.Now().Format(DATE_TIME_FORMAT), Change: change, Via: via, Client: client,
+		Old: old, New: c.auditValue(change)}
+	c.audits.add(e)
+	c.events.publish(Event{Type: EVENT_STATE, Name: change, Change: &e})
+	switch change {
+	case AUDIT_OVERRIDE:
+		c.overrideBy.set(e.New, via, client)
+	case AUDIT_BOOST:
+		if e.New == "off" {
+			c.overrideBy.set("boost_stop", via, client)
+		} else {
+			c.overrideBy.set("boost", via, client)
+		}
+	}
+	return nil
+}
+
+// Audit returns the audit log, oldest first
+func (c *Controller) Audit() []AuditEntry {
+	return c.audits.list()
+}
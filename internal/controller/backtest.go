@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/storage"
+)
+
+const (
+	// longer gaps between two records aren't counted as runtime
+	BACKTEST_MAX_GAP = 15 * time.Minute
+	// a run of the fan that is shorter is counted as short run
+	SHORT_RUN = 10 * time.Minute
+)
+
+// BacktestResult is the outcome of replaying historical readings through the automatic control
+type BacktestResult struct {
+	From             time.Time
+	To               time.Time
+	Records          int
+	Valid            int
+	RuntimeHours     float64
+	Switches         int // switch operations of the fan, on and off
+	ShortRuns        int // runs shorter than SHORT_RUN
+	Skipped          int // switch operations skipped due to dead_time or max_per_hour
+	MoistureRemoved  float64
+	HumInside        MinMaxAvg // inside humidity of all valid records
+	HumInsideVenting MinMaxAvg // inside humidity while the fan was running
+	AbsHumInside     MinMaxAvg
+	// the recorded behaviour of the fan, for comparison
+	ActualRuntimeHours float64
+	ActualSwitches     int
+}
+
+// simRelay applies the dead time and the maximum switching rate of the actuator
+type simRelay struct {
+	cfg    actuatorConfig
+	on     bool
+	known  bool
+	last   time.Time
+	recent []time.Time
+}
+
+// returns false if the switch operation is skipped
+func (r *simRelay) set(now time.Time, on bool) bool {
+	if r.known && on == r.on {
+		return true
+	}
+	i := 0
+	for i < len(r.recent) && now.Sub(r.recent[i]) >= time.Hour {
+		i++
+	}
+	r.recent = r.recent[i:]
+	if r.known && now.Sub(r.last) < time.Duration(r.cfg.DeadTime)*time.Second {
+		return false
+	}
+	if r.known && r.cfg.MaxPerHour > 0 && len(r.recent) >= r.cfg.MaxPerHour {
+		return false
+	}
+	if r.known {
+		r.recent = append(r.recent, now)
+	}
+	r.on, r.known, r.last = on, true, now
+	return true
+}
+
+// Backtest replays the records (oldest first) through the automatic control with the strategy
+// and the thresholds of cfg, the predictive mode of cfg.Predict and the limits of the actuator.
+// Overrides and the other inputs of the live controller aren't part of the history.
+func Backtest(cfg Config, records []storage.Record) (BacktestResult, error) {
+	var res BacktestResult
+	strategy, err := newStrategy(cfg.Strategy)
+	if err != nil {
+		return res, err
+	}
+	if len(records) == 0 {
+		return res, nil
+	}
+	res.From, res.To, res.Records = records[0].Time, records[len(records)-1].Time, len(records)
+	airflow := cfg.Stats.Airflow
+	if airflow <= 0 {
+		airflow = DEF_AIRFLOW
+	}
+	predictor := newTrendPredictor(cfg.Predict)
+	relay := &simRelay{cfg: cfg.Actuator}
+	venting := false
+	var runStart time.Time
+	for i, r := range records {
+		valid := r.Valid && r.TempInside >= -20 && r.TempInside <= 40 && r.TempOutside >= -20 && r.TempOutside <= 40
+		absInside, absOutside := calcAbsHumidity(r.TempInside, r.HumInside), calcAbsHumidity(r.TempOutside, r.HumOutside)
+		if valid {
+			res.Valid++
+			deltaTP := roundFloat32(calcDewPoint(r.TempInside, r.HumInside), 1) -
+				roundFloat32(calcDewPoint(r.TempOutside, r.HumOutside), 1)
+			predictor.add(r.Time, deltaTP)
+			state, reason := strategy.Decide(venting, StrategyInput{
+				Now:         r.Time,
+				ClockValid:  true,
+				TempInside:  r.TempInside,
+				TempOutside: r.TempOutside,
+				HumInside:   r.HumInside,
+				HumOutside:  r.HumOutside,
+				DeltaTP:     deltaTP,
+				Hysteresis:  cfg.Control.Hysteresis,
+				Limits:      cfg.Control,
+			})
+			if strategy.Name() == STRATEGY_DEW_POINT {
+				state, _ = predictor.adjust(venting, state, reason, cfg.Control, deltaTP, cfg.Control.Hysteresis)
+			}
+			if state != venting {
+				if relay.set(r.Time, state) {
+					venting = state
+					res.Switches++
+					if venting {
+						runStart = r.Time
+					} else if r.Time.Sub(runStart) < SHORT_RUN {
+						res.ShortRuns++
+					}
+				} else {
+					res.Skipped++
+				}
+			}
+			res.HumInside.add(r.HumInside)
+			res.AbsHumInside.add(roundFloat32(absInside, 1))
+			if venting {
+				res.HumInsideVenting.add(r.HumInside)
+			}
+		}
+		if i > 0 && r.FanStatus != records[i-1].FanStatus {
+			res.ActualSwitches++
+		}
+		if i == len(records)-1 {
+			break
+		}
+		elapsed := records[i+1].Time.Sub(r.Time)
+		if elapsed <= 0 || elapsed > BACKTEST_MAX_GAP {
+			continue
+		}
+		if venting {
+			res.RuntimeHours += elapsed.Hours()
+			if valid && absInside > absOutside {
+				// g/m³ * m³/h * h
+				res.MoistureRemoved += float64((absInside - absOutside) * airflow * float32(elapsed.Hours()))
+			}
+		}
+		if r.FanStatus {
+			res.ActualRuntimeHours += elapsed.Hours()
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+type boostConfig struct {
+	Minutes   int    `json:"minutes"`    // default duration of a boost
+	ButtonPin string `json:"button_pin"` // deprecated, use a button with the action "boost"
+}
+
+// BoostResponse is the state of the boost
+type BoostResponse struct {
+	Active    bool `json:"active"`
+	Remaining int  `json:"remaining"` // remaining boost time in s
+}
+
+// boost runs the fan for a limited time regardless of the dew points
+type boost struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+func (b *boost) start(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.until = time.Now().Add(d)
+	logger.Infof("Boost started for %s", d)
+}
+
+func (b *boost) stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.until.IsZero() {
+		logger.Info("Boost stopped")
+	}
+	b.until = time.Time{}
+}
+
+// returns the remaining boost time, 0 if no boost is active
+func (b *boost) remaining() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r := time.Until(b.until)
+	if r < 0 {
+		return 0
+	}
+	return r
+}
+
+func (b *boost) response() BoostResponse {
+	r := b.remaining()
+	return BoostResponse{Active: r > 0, Remaining: int(r.Seconds())}
+}
@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/gpioio"
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"periph.io/x/conn/v3/gpio"
+)
+
+// actions of the push buttons, they are available via the HTTP API as well
+const (
+	ACTION_NEXT_PAGE    = "next_page"    // shows the next info page
+	ACTION_BACKLIGHT    = "backlight"    // toggles the backlight of the display
+	ACTION_BOOST        = "boost"        // starts or stops a boost
+	ACTION_OVERRIDE_ON  = "override_on"  // forces the fan on
+	ACTION_OVERRIDE_OFF = "override_off" // forces the fan off
+	ACTION_AUTO         = "auto"         // removes the override
+	ACTION_DEBUG        = "debug"        // toggles the debug log level
+	ACTION_MAINTENANCE  = "maintenance"  // starts or ends the maintenance mode
+)
+
+var actions = []string{ACTION_NEXT_PAGE, ACTION_BACKLIGHT, ACTION_BOOST, ACTION_OVERRIDE_ON, ACTION_OVERRIDE_OFF,
+	ACTION_AUTO, ACTION_DEBUG, ACTION_MAINTENANCE}
+
+type buttonConfig struct {
+	Pin           string `json:"pin"`             // push button to ground, e.g. "GPIO17"
+	Short         string `json:"short"`           // action of a short press
+	Long          string `json:"long"`            // action of a long press
+	VeryLong      string `json:"very_long"`       // action of a very long press
+	LongPress     int    `json:"long_press"`      // minimum time in s of a long press, default 2
+	VeryLongPress int    `json:"very_long_press"` // minimum time in s of a very long press, default 5
+}
+
+// returns the configured buttons, the boost button of older configurations is a
+// button with a boost on a short and debug logging on a 5s press
+func (cfg Config) buttons() []buttonConfig {
+	if cfg.Buttons == nil && cfg.Boost.ButtonPin != "" {
+		return []buttonConfig{{Pin: cfg.Boost.ButtonPin, Short: ACTION_BOOST, Long: ACTION_DEBUG, LongPress: 5}}
+	}
+	return cfg.Buttons
+}
+
+func checkAction(action string) error {
+	if action == "" {
+		return nil
+	}
+	for _, a := range actions {
+		if a == action {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown action '%s'", action)
+}
+
+// button is a push button (active low) with up to 3 actions depending on the press duration
+type button struct {
+	cfg      buttonConfig
+	pin      gpioio.Pin
+	debounce time.Duration
+}
+
+func newButton(cfg buttonConfig, debounce time.Duration) (*button, error) {
+	for _, a := range []string{cfg.Short, cfg.Long, cfg.VeryLong} {
+		if err := checkAction(a); err != nil {
+			return nil, fmt.Errorf("button %s: %s", cfg.Pin, err)
+		}
+	}
+	if cfg.LongPress <= 0 {
+		cfg.LongPress = 2
+	}
+	if cfg.VeryLongPress <= 0 {
+		cfg.VeryLongPress = 5
+	}
+	b := &button{cfg: cfg, pin: gpioio.ByName(cfg.Pin), debounce: debounce}
+	if b.pin == nil {
+		return nil, fmt.Errorf("failed to find button pin %s", cfg.Pin)
+	}
+	if err := b.pin.In(gpio.PullUp, gpio.FallingEdge); err != nil {
+		return nil, fmt.Errorf("couldn't configure button pin %s: %s", cfg.Pin, err)
+	}
+	return b, nil
+}
+
+// returns the action for the duration of a press
+func (b *button) action(d time.Duration) string {
+	if b.cfg.VeryLong != "" && d >= time.Duration(b.cfg.VeryLongPress)*time.Second {
+		return b.cfg.VeryLong
+	}
+	if b.cfg.Long != "" && d >= time.Duration(b.cfg.LongPress)*time.Second {
+		return b.cfg.Long
+	}
+	return b.cfg.Short
+}
+
+// waits for presses and calls do with the action on release, should be started as goroutine
+func (b *button) watch(do func(action string) error) {
+	for {
+		if !b.pin.WaitForEdge(-1) {
+			continue
+		}
+		// ignore short glitches
+		if debouncedLevel(b.pin, b.debounce) == gpio.High {
+			continue
+		}
+		// wait until the button is released
+		pressed := time.Now()
+		for debouncedLevel(b.pin, b.debounce) == gpio.Low {
+			time.Sleep(50 * time.Millisecond)
+		}
+		action := b.action(time.Since(pressed))
+		if action == "" {
+			continue
+		}
+		logger.Infof("Button %s: %s", b.cfg.Pin, action)
+		if err := do(action); err != nil {
+			logger.Error(err)
+		}
+	}
+}
+
+// Action executes one of the button actions
+func (c *Controller) Action(action string) error {
+	switch action {
+	case ACTION_NEXT_PAGE:
+		c.screen.Next()
+	case ACTION_BACKLIGHT:
+		c.screen.ToggleBacklight()
+	case ACTION_BOOST:
+		if c.boost.remaining() > 0 {
+			c.StopBoost()
+		} else {
+			c.StartBoost(0)
+		}
+	case ACTION_OVERRIDE_ON:
+		return c.ExecuteCommand("override", "on")
+	case ACTION_OVERRIDE_OFF:
+		return c.ExecuteCommand("override", "off")
+	case ACTION_AUTO:
+		return c.ExecuteCommand("override", "auto")
+	case ACTION_DEBUG:
+		c.logLevel.toggleDebug()
+	case ACTION_MAINTENANCE:
+		if c.maintenance.remaining() > 0 {
+			c.StopMaintenance()
+		} else if _, err := c.StartMaintenance(0); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown action '%s'", action)
+	}
+	return nil
+}
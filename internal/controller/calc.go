@@ -0,0 +1,59 @@
+package controller
+
+import "math"
+
+// round float32 to N digits precision
+func roundFloat32(val float32, precision uint) float32 {
+	ratio := math.Pow(10, float64(precision))
+	return float32(math.Round(float64(val)*ratio) / ratio)
+}
+
+// round float64 to N digits precision
+func roundFloat64(val float64, precision uint) float64 {
+	ratio := math.Pow(10, float64(precision))
+	return math.Round(val*ratio) / ratio
+}
+
+// converts true to 1 and false to 0
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func calcDewPoint(t, r float32) float32 {
+
+	var a, b float64
+	t64 := float64(t)
+	r64 := float64(r)
+
+	if t64 >= 0 {
+		a = 7.5
+		b = 237.3
+	} else if t64 < 0 {
+		a = 7.6
+		b = 240.7
+	}
+
+	// saturation vapor pressure in hPa
+	sdd := 6.1078 * math.Pow(10, (a*t64)/(b+t64))
+
+	// vapor pressure in hPa
+	dd := sdd * (r64 / 100)
+
+	// v parameter
+	v := math.Log10(dd / 6.1078)
+
+	// dew point temperature (°C)
+	tt := (b * v) / (a - v)
+	return float32(tt)
+}
+
+// absolute humidity in g/m³ (Magnus formula)
+func calcAbsHumidity(t, r float32) float32 {
+	t64 := float64(t)
+	// saturation vapor pressure in hPa
+	sdd := 6.112 * math.Exp((17.62*t64)/(243.12+t64))
+	return float32(216.7 * (float64(r) / 100 * sdd) / (273.15 + t64))
+}
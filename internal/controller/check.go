@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aluedtke7/dew_point_fan/internal/sensor"
+	"periph.io/x/host/v3"
+)
+
+// OpenSensors initializes the hardware and creates the configured sensors without starting the controller
+func OpenSensors(cfg Config) ([]sensor.Sensor, error) {
+	if _, err := host.Init(); err != nil {
+		return nil, err
+	}
+	var sensors []sensor.Sensor
+	for _, sc := range cfg.Sensors {
+		s, err := sensor.New(sc)
+		if err != nil {
+			return nil, err
+		}
+		sensors = append(sensors, s)
+	}
+	return sensors, nil
+}
+
+// ReadSensors reads all sensors once and returns the corrected values. The values of
+// a failed sensor stay empty, the error contains all failed sensors.
+func ReadSensors(cfg Config) ([]SensorData, error) {
+	sensors, err := OpenSensors(cfg)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]SensorData, len(sensors))
+	var failed []string
+	for i, s := range sensors {
+		data[i].Name = s.Name()
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Sensors[i].ReadTimeout())
+		t, h, _, err := sensor.ReadContext(ctx, s)
+		cancel()
+		if err != nil {
+			data[i].Error = err.Error()
+			failed = append(failed, s.Name())
+			continue
+		}
+		t, h = cfg.Sensors[i].Correct(t, h)
+		data[i].Temperature = roundFloat32(t, 1)
+		data[i].Humidity = roundFloat32(h, 1)
+		data[i].DewPoint = roundFloat32(calcDewPoint(data[i].Temperature, data[i].Humidity), 1)
+	}
+	if len(failed) > 0 {
+		return data, fmt.Errorf("reading failed for %s", strings.Join(failed, ", "))
+	}
+	return data, nil
+}
@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"github.com/aluedtke7/dew_point_fan/internal/version"
+)
+
+const (
+	DEF_CLOCK_OFFSET   = 120  // s
+	DEF_CLOCK_INTERVAL = 3600 // s
+	CLOCK_RETRY        = 30 * time.Second
+)
+
+// the clock is never plausible before this date, if the build date is unknown
+var clockMinimum = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type clockConfig struct {
+	CheckUrl  string `json:"check_url"`  // the Date header of this HTTP server is the reference, empty to check the date only
+	MaxOffset int    `json:"max_offset"` // maximum difference to the reference in s, default 120
+	Interval  int    `json:"interval"`   // time between the checks in s, default 3600
+}
+
+// clockCheck tells whether the system clock is plausible. A Raspberry Pi has no RTC and often
+// starts with a wrong time until NTP has synchronized the clock.
+type clockCheck struct {
+	cfg     clockConfig
+	minimum time.Time
+	mu      sync.Mutex
+	valid   bool
+	offset  time.Duration // difference to the reference, positive if the local clock is ahead
+	checked bool          // the reference was reached at least once
+	logged  bool          // the last logged state
+}
+
+func newClockCheck(cfg clockConfig) *clockCheck {
+	if cfg.MaxOffset <= 0 {
+		cfg.MaxOffset = DEF_CLOCK_OFFSET
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DEF_CLOCK_INTERVAL
+	}
+	c := &clockCheck{cfg: cfg, minimum: clockMinimum, logged: true}
+	if t, err := time.Parse(time.RFC3339, version.BuildDate); err == nil && t.After(c.minimum) {
+		c.minimum = t
+	}
+	// until the first check of the reference only the date is checked
+	c.valid = !time.Now().Before(c.minimum)
+	return c
+}
+
+// returns the difference between the local clock and the Date header of the reference server
+func (c *clockCheck) reference() (time.Duration, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	start := time.Now()
+	resp, err := client.Head(c.cfg.CheckUrl)
+	if err != nil {
+		return 0, err
+	}
+	_ = resp.Body.Close()
+	ref, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, err
+	}
+	// the Date header has a resolution of 1 s, use the middle of the request as local time
+	local := start.Add(time.Since(start) / 2)
+	return local.Sub(ref), nil
+}
+
+// checks the clock and returns true if it's plausible
+func (c *clockCheck) check() bool {
+	now := time.Now()
+	valid := !now.Before(c.minimum)
+	var offset time.Duration
+	checked := false
+	if c.cfg.CheckUrl != "" {
+		var err error
+		if offset, err = c.reference(); err != nil {
+			logger.Debugf("Clock check: %s", err)
+		} else {
+			checked = true
+			max := time.Duration(c.cfg.MaxOffset) * time.Second
+			valid = valid && offset <= max && offset >= -max
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if checked || !c.checked {
+		// without a reference the last result of the reference check is kept
+		c.valid, c.offset = valid, offset
+		c.checked = c.checked || checked
+	}
+	if c.valid != c.logged {
+		if c.valid {
+			logger.Infof("Clock is plausible (offset %s)", c.offset.Round(time.Second))
+		} else {
+			logger.Warnf("Clock is not plausible: %s (offset %s), InfluxDB points and schedules are held back",
+				now.Format(DATE_TIME_FORMAT), c.offset.Round(time.Second))
+		}
+		c.logged = c.valid
+	}
+	return c.valid
+}
+
+// checks the clock periodically and should be started as goroutine
+func (c *clockCheck) run() {
+	for {
+		delay := time.Duration(c.cfg.Interval) * time.Second
+		if !c.check() {
+			delay = CLOCK_RETRY
+		}
+		time.Sleep(delay)
+	}
+}
+
+func (c *clockCheck) plausible() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.valid
+}
+
+// difference to the reference server in s
+func (c *clockCheck) offsetSeconds() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return roundFloat64(c.offset.Seconds(), 1)
+}
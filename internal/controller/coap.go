@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"strings"
+
+	"github.com/aluedtke7/dew_point_fan/internal/coap"
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"github.com/aluedtke7/dew_point_fan/internal/shutdown"
+)
+
+type coapConfig struct {
+	Listen string `json:"listen"` // address of the CoAP server, e.g. ":5683", empty to disable
+}
+
+// CoapState is the compact state for constrained clients, the values of the sensors are
+// rounded to 1/10
+type CoapState struct {
+	TempInside  float32 `json:"ti"`
+	HumInside   float32 `json:"hi"`
+	DpInside    float32 `json:"dpi"`
+	TempOutside float32 `json:"to"`
+	HumOutside  float32 `json:"ho"`
+	DpOutside   float32 `json:"dpo"`
+	Venting     bool    `json:"v"`
+	FanStatus   bool    `json:"f"`
+	Source      string  `json:"s"`
+	Override    string  `json:"o"`           // auto, on or off
+	Boost       int     `json:"b,omitempty"` // remaining boost time in s
+	Errors      int     `json:"e,omitempty"` // sensor errors, bit 0 inside, bit 1 outside
+}
+
+// links of the resource discovery
+const coapResources = `</state>;ct=50;rt="dpf.state",</override>;ct=0;rt="dpf.override"`
+
+// starts the CoAP server, that provides the state and the override to constrained clients
+func (c *Controller) startCoap(cfg coapConfig) {
+	if cfg.Listen == "" {
+		return
+	}
+	s, err := coap.Listen(cfg.Listen, c.coapHandle)
+	if err != nil {
+		logger.Errorf("Couldn't start the CoAP server: %s", err)
+		return
+	}
+	shutdown.OnExit(s.Close)
+	logger.Infof("CoAP server listening on %s", cfg.Listen)
+}
+
+func (c *Controller) coapHandle(req coap.Request) coap.Response {
+	change := req.Method != coap.GET
+	if !c.coapAllowed(req.Query["token"], change) {
+		return coap.Response{Code: coap.Unauthorized}
+	}
+	switch req.Path {
+	case ".well-known/core":
+		if change {
+			return coap.Response{Code: coap.MethodNotAllowed}
+		}
+		return coap.Response{Code: coap.Content, Format: coap.FormatLink, Payload: []byte(coapResources)}
+	case "state":
+		if change {
+			return coap.Response{Code: coap.MethodNotAllowed}
+		}
+		j, _ := json.Marshal(c.coapState())
+		return coap.Response{Code: coap.Content, Format: coap.FormatJson, Payload: j}
+	case "override":
+		switch req.Method {
+		case coap.GET:
+		case coap.PUT, coap.POST:
+			value := strings.TrimSpace(string(req.Payload))
+			err := c.Audited(AUDIT_OVERRIDE, VIA_COAP, req.Addr, func() error {
+				return c.ExecuteCommand("override", value)
+			})
+			if err != nil {
+				return coap.Response{Code: coap.BadRequest, Format: coap.FormatText, Payload: []byte(err.Error())}
+			}
+			return coap.Response{Code: coap.Changed, Format: coap.FormatText, Payload: []byte(c.auditValue(AUDIT_OVERRIDE))}
+		default:
+			return coap.Response{Code: coap.MethodNotAllowed}
+		}
+		return coap.Response{Code: coap.Content, Format: coap.FormatText, Payload: []byte(c.auditValue(AUDIT_OVERRIDE))}
+	}
+	return coap.Response{Code: coap.NotFound}
+}
+
+// checks the query parameter token like the web server: with a read token every request needs
+// a token, with a read or control token a change needs the control token
+func (c *Controller) coapAllowed(token string, change bool) bool {
+	tokens := c.AccessTokens()
+	matches := func(configured string) bool {
+		return configured != "" && subtle.ConstantTimeCompare([]byte(token), []byte(configured)) == 1
+	}
+	if matches(tokens.Manage) || matches(tokens.Control) {
+		return true
+	}
+	if change {
+		return tokens.Read == "" && tokens.Control == ""
+	}
+	return tokens.Read == "" || matches(tokens.Read)
+}
+
+func (c *Controller) coapState() CoapState {
+	inf := c.Info()
+	st := CoapState{
+		Venting:   inf.Venting,
+		FanStatus: inf.FanStatus,
+		Source:    inf.Source,
+		Override:  c.auditValue(AUDIT_OVERRIDE),
+		Boost:     inf.Boost,
+	}
+	if len(inf.Sensors) > 1 {
+		in, out := inf.Sensors[0], inf.Sensors[1]
+		st.TempInside, st.HumInside, st.DpInside = roundFloat32(in.Temperature, 1), roundFloat32(in.Humidity, 1), roundFloat32(in.DewPoint, 1)
+		st.TempOutside, st.HumOutside, st.DpOutside = roundFloat32(out.Temperature, 1), roundFloat32(out.Humidity, 1), roundFloat32(out.DewPoint, 1)
+		for i, s := range inf.Sensors[:2] {
+			if s.Error != "" {
+				st.Errors |= 1 << i
+			}
+		}
+	}
+	return st
+}
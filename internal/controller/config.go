@@ -0,0 +1,689 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aluedtke7/dew_point_fan/internal/actuator"
+	"github.com/aluedtke7/dew_point_fan/internal/gpioio"
+	"github.com/aluedtke7/dew_point_fan/internal/i18n"
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"github.com/aluedtke7/dew_point_fan/internal/mdns"
+	"github.com/aluedtke7/dew_point_fan/internal/notify"
+	"github.com/aluedtke7/dew_point_fan/internal/sensor"
+)
+
+const (
+	CONFIG_FILE    = "config.json"
+	SAFE_STATE_OFF = "off"
+	SAFE_STATE_ON  = "on"
+)
+
+// Config is read from ~/.dew_point_fan/config.json, missing values keep their defaults
+type Config struct {
+	Sensors    []sensor.Config    `json:"sensors"`    // first sensor is inside, second is outside
+	SafeState  string             `json:"safe_state"` // state of the fan relay on exit: "off" or "on"
+	Warmup     int                `json:"warmup"`     // time in s after start, while the relais keeps its persisted state
+	DryRun     bool               `json:"dry_run"`    // run the control without switching the relais
+	Language   string             `json:"language"`   // texts of the display and the web page: "en" (default) or "de"
+	Clock      clockConfig        `json:"clock"`      // plausibility check of the system clock
+	Gpio       gpioio.Config      `json:"gpio"`
+	Actuator   actuatorConfig     `json:"actuator"`   // switches the fan
+	Switch     switchConfig       `json:"switch"`     // hardware switch on GPIO22
+	Feedback   feedbackConfig     `json:"feedback"`   // check of the relais with the feedback of GPIO22
+	Tacho      tachoConfig        `json:"tacho"`      // tach signal of the fan
+	Indicators indicatorConfig    `json:"indicators"` // status LEDs and buzzer
+	Buttons    []buttonConfig     `json:"buttons"`    // push buttons
+	Zones      []zoneConfig       `json:"zones"`      // additional zones with the same outside sensor
+	Control    controlConfig      `json:"control"`
+	Purge      sensor.PurgeConfig `json:"purge"`
+	Boost      boostConfig        `json:"boost"`
+	Frost      frostConfig        `json:"frost"`
+	Contact    contactConfig      `json:"contact"`
+	Weather    weatherConfig      `json:"weather"`
+	Store      storeConfig        `json:"store"` // local measurement history
+	Influx     influxConfig       `json:"influx"`
+	Stats      statsConfig        `json:"stats"`
+	Display    displayConfig      `json:"display"`
+	Energy     energyConfig       `json:"energy"`
+	Mqtt       mqttConfig         `json:"mqtt"`
+	Http       httpConfig         `json:"http"`
+	Mdns       mdns.Config        `json:"mdns"` // announcement of the web page via mDNS/Zeroconf
+	Wifi       wifiConfig         `json:"wifi"` // monitoring of the Wi-Fi signal
+	Modbus     modbusConfig       `json:"modbus"`
+	Notify     notifyConfig       `json:"notify"`
+	Watchdog   watchdogConfig     `json:"watchdog"`
+	LoopWatch  loopWatchConfig    `json:"loop_watch"`
+	Log        logger.Config      `json:"log"`
+	Paths      pathsConfig        `json:"paths"` // writable directories
+	Source     string             `json:"-"`     // path of the config file
+	// adaptive hysteresis based on the switching frequency
+	AdaptiveHysteresis adaptiveConfig `json:"adaptive_hysteresis"`
+	// switching based on the trend of the dew point difference
+	Predict predictConfig `json:"predict"`
+	// forces the fan off while working at it
+	Maintenance maintenanceConfig `json:"maintenance"`
+	// warning about sensors that retry or fail often
+	SensorHealth sensorHealthConfig `json:"sensor_health"`
+	// decision of the automatic control of the main zone
+	Strategy strategyConfig `json:"strategy"`
+	// state and override for constrained clients
+	Coap coapConfig `json:"coap"`
+	// thresholds of the checks for Checkmk and Zabbix
+	Monitoring monitoringConfig `json:"monitoring"`
+	// shell commands executed on fan changes and alerts
+	Hooks hooksConfig `json:"hooks"`
+	// Lua scripts that adjust the decision and add metrics
+	Plugins pluginsConfig `json:"plugins"`
+}
+
+type displayConfig struct {
+	RotateEvery int `json:"rotate_every"` // show the info pages every n s, 0 to disable the rotation
+	PageTime    int `json:"page_time"`    // time in s each info page is shown
+	// template of the status line, e.g. "{ip} {alive} {override} {fan}"
+	Status string `json:"status"`
+	Width  int    `json:"width"` // characters per line, default is the size of the display
+	// displays that show the lines at the same time, default is the LCD
+	Outputs []DisplayOutput `json:"outputs"`
+}
+
+const (
+	DISPLAY_LCD     = "lcd"
+	DISPLAY_CONSOLE = "console" // the lines on stdout
+)
+
+// DisplayOutput is a display, that shows the lines of the LCD
+type DisplayOutput struct {
+	Type  string `json:"type"`  // lcd or console
+	Width int    `json:"width"` // characters per line of the console, default 20
+	Rows  int    `json:"rows"`  // lines of the console, default 4
+}
+
+type httpConfig struct {
+	Listen []string `json:"listen"` // addresses of the web server, ":8080" listens on IPv4 and IPv6
+	Token  string   `json:"token"`  // bearer token of the management API, it's disabled without
+	// tokens of the other endpoints, they are open without them
+	ReadToken    string `json:"read_token"`    // reading, e.g. for dashboards
+	ControlToken string `json:"control_token"` // overrides, boost and changes of the configuration, includes reading
+	// HTTPS with a certificate of Let's Encrypt or of files
+	Tls tlsConfig `json:"tls"`
+	// addresses or networks of reverse proxies, their X-Forwarded-For header is the address of the client
+	TrustedProxies []string `json:"trusted_proxies"`
+}
+
+// returns the port of the first listen address, it's announced via mDNS
+func (h httpConfig) port() int {
+	if len(h.Listen) > 0 {
+		if _, p, err := net.SplitHostPort(h.Listen[0]); err == nil {
+			if port, err := strconv.Atoi(p); err == nil {
+				return port
+			}
+		}
+	}
+	return HTTP_PORT
+}
+
+// returns the networks of the trusted proxies, a single address is a network of its own
+func (h httpConfig) proxies() ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, p := range h.TrustedProxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address '%s'", p)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// DefaultConfig returns the configuration that is used without a config file
+func DefaultConfig() Config {
+	return Config{
+		Sensors: []sensor.Config{
+			{Name: "Inside", Type: sensor.TypeDHT22, Pin: 24, Retries: 15, TempOffset: -4.0, HumOffset: 10.0},
+			{Name: "Outside", Type: sensor.TypeDHT22, Pin: 23, Retries: 15, HumOffset: -6.0},
+		},
+		Gpio: gpioio.Config{
+			Backend: gpioio.BACKEND_PERIPH,
+		},
+		Http: httpConfig{
+			Listen: []string{fmt.Sprintf(":%d", HTTP_PORT)},
+		},
+		Actuator: actuatorConfig{
+			Config:      actuator.Config{Type: actuator.TypeGPIO, ActiveLow: true},
+			WarnPercent: DEF_WEAR_WARN,
+		},
+		Switch: switchConfig{
+			Pull:     PULL_FLOAT,
+			Debounce: DEF_DEBOUNCE,
+		},
+		Feedback: feedbackConfig{
+			Grace: 120,
+		},
+		Tacho: tachoConfig{
+			Pulses: 2,
+			MinRpm: 100,
+			Grace:  30,
+		},
+		Indicators: indicatorConfig{
+			Alerts: []string{"condensation_risk", "sensor_failed"},
+		},
+		SafeState: SAFE_STATE_OFF,
+		Warmup:    60,
+		Control: controlConfig{
+			DiffMin:        DIFF_MIN,
+			Hysteresis:     HYSTERESIS,
+			HumInsideMin:   HUM_INSIDE_MIN,
+			TempInsideMin:  TEMP_INSIDE_MIN,
+			TempOutsideMin: TEMP_OUTSIDE_MIN,
+		},
+		Purge: sensor.PurgeConfig{
+			Enabled:  false,
+			Weekday:  "sunday",
+			Time:     "03:00",
+			Duration: 60,
+			Settle:   600,
+		},
+		Boost: boostConfig{
+			Minutes: 30,
+		},
+		Maintenance: maintenanceConfig{
+			Minutes: DEF_MAINTENANCE_MINUTES,
+		},
+		SensorHealth: sensorHealthConfig{
+			Window:         DEF_HEALTH_WINDOW,
+			MaxRetryRate:   DEF_MAX_RETRY_RATE,
+			MaxFailureRate: DEF_MAX_FAILURE_RATE,
+		},
+		Frost: frostConfig{
+			Enabled:    false,
+			Limit:      5.0,
+			Hysteresis: 1.0,
+		},
+		Weather: weatherConfig{
+			RainActiveLow: true,
+			Conditions:    []string{"rain", "fog"},
+			Interval:      0,
+			Lockout:       1800,
+		},
+		Influx: influxConfig{
+			Backend: BACKEND_INFLUX2,
+			Org:     "privat",
+			Bucket:  "dew-point",
+		},
+		Display: displayConfig{
+			RotateEvery: 60,
+			PageTime:    5,
+			Status:      DEF_STATUS_LINE,
+		},
+		Hooks: hooksConfig{
+			Timeout: 30,
+		},
+		Plugins: pluginsConfig{
+			Timeout: 50,
+		},
+		Monitoring: monitoringConfig{
+			HumWarn:    70,
+			HumCrit:    80,
+			MarginWarn: 3,
+			MarginCrit: 1,
+		},
+		Notify: notifyConfig{
+			Repeat:       360,
+			StuckMinutes: 10,
+			Smtp: notify.SmtpConfig{
+				Port: 587,
+			},
+		},
+		Log: logger.Config{
+			File:    true,
+			Console: true,
+		},
+		LoopWatch: loopWatchConfig{
+			Factor: 8,
+			Action: LOOP_ACTION_LOG,
+		},
+		Watchdog: watchdogConfig{
+			Timeout: 120,
+		},
+		Mqtt: mqttConfig{
+			ClientId: "dew-point-fan",
+			Topic:    "dewpointfan",
+			Qos:      0,
+			Retain:   true,
+		},
+		Energy: energyConfig{
+			Watts: 10,
+		},
+		Stats: statsConfig{
+			Airflow: DEF_AIRFLOW,
+		},
+		Store: storeConfig{
+			Enabled:   true,
+			Retention: 90,
+		},
+		AdaptiveHysteresis: adaptiveConfig{
+			Enabled:     false,
+			MaxSwitches: 6,
+			Step:        0.5,
+			Max:         3.0,
+		},
+		Predict: predictConfig{
+			Enabled: false,
+			Window:  15,
+			Horizon: 30,
+			Lead:    5,
+		},
+	}
+}
+
+// ReadConfig reads the configuration file and returns an error, if it is missing or invalid
+func ReadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	// the corrections of the default sensors must not be applied to the configured sensors
+	cfg.Sensors = nil
+	if err = json.Unmarshal(data, &cfg); err != nil {
+		return DefaultConfig(), err
+	}
+	cfg.Source = path
+	if len(cfg.Sensors) == 0 {
+		cfg.Sensors = DefaultConfig().Sensors
+	}
+	if err = mergeZoneControls(data, &cfg); err != nil {
+		return DefaultConfig(), err
+	}
+	if len(cfg.Sensors) != 2 {
+		return cfg, errSensorCount
+	}
+	return cfg, nil
+}
+
+// decodes the control thresholds of the zones over the ones of the main zone, so omitted
+// thresholds aren't 0
+func mergeZoneControls(data []byte, cfg *Config) error {
+	var raw struct {
+		Zones []struct {
+			Control json.RawMessage `json:"control"`
+		} `json:"zones"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	for i, z := range raw.Zones {
+		if i >= len(cfg.Zones) || len(z.Control) == 0 || string(z.Control) == "null" {
+			continue
+		}
+		limits := cfg.Control
+		if err := json.Unmarshal(z.Control, &limits); err != nil {
+			return err
+		}
+		cfg.Zones[i].Control = &limits
+	}
+	return nil
+}
+
+var errSensorCount = errors.New("exactly 2 sensors must be defined")
+
+// LoadConfig reads the configuration file, if there is one. In case of errors the defaults are used.
+func LoadConfig(path string) Config {
+	cfg, err := ReadConfig(path)
+	cfg.Source = path
+	var pathErr *fs.PathError
+	switch {
+	case err == nil:
+		logger.Infof("Config file %s loaded", path)
+	case os.IsNotExist(err):
+	case err == errSensorCount:
+		logger.Errorf("Config file %s must define exactly 2 sensors, using default sensors", path)
+		cfg.Sensors = DefaultConfig().Sensors
+	case errors.As(err, &pathErr):
+		logger.Warnf("Couldn't read config file %s: %s", path, err)
+	default:
+		logger.Errorf("Config file %s is invalid, using defaults: %s", path, err)
+	}
+	return cfg
+}
+
+// Validate checks the parts of the configuration that can be checked without the hardware
+func (cfg Config) Validate() []error {
+	var errs []error
+	if cfg.SafeState != SAFE_STATE_OFF && cfg.SafeState != SAFE_STATE_ON {
+		errs = append(errs, fmt.Errorf("safe_state must be '%s' or '%s'", SAFE_STATE_OFF, SAFE_STATE_ON))
+	}
+	if !i18n.Supported(cfg.Language) {
+		errs = append(errs, fmt.Errorf("unknown language '%s'", cfg.Language))
+	}
+	for _, addr := range cfg.Http.Listen {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			errs = append(errs, fmt.Errorf("http: %s", err))
+		}
+	}
+	for _, err := range cfg.Http.Tls.validate() {
+		errs = append(errs, fmt.Errorf("http: tls: %s", err))
+	}
+	if _, err := cfg.Http.proxies(); err != nil {
+		errs = append(errs, fmt.Errorf("http: trusted_proxies: %s", err))
+	}
+	if cfg.Coap.Listen != "" {
+		if _, _, err := net.SplitHostPort(cfg.Coap.Listen); err != nil {
+			errs = append(errs, fmt.Errorf("coap: %s", err))
+		}
+	}
+	if (cfg.Hooks.OnFanOn != "" || cfg.Hooks.OnFanOff != "" || cfg.Hooks.OnAlert != "") && cfg.Hooks.Timeout <= 0 {
+		errs = append(errs, errors.New("hooks: timeout must be positive"))
+	}
+	if cfg.Plugins.Enabled && cfg.Plugins.Timeout <= 0 {
+		errs = append(errs, errors.New("plugins: timeout must be positive"))
+	}
+	for _, err := range cfg.Monitoring.validate() {
+		errs = append(errs, fmt.Errorf("monitoring: %s", err))
+	}
+	if cfg.Modbus.Listen != "" {
+		if _, _, err := net.SplitHostPort(cfg.Modbus.Listen); err != nil {
+			errs = append(errs, fmt.Errorf("modbus: %s", err))
+		}
+	}
+	if cfg.Clock.MaxOffset < 0 || cfg.Clock.Interval < 0 {
+		errs = append(errs, fmt.Errorf("clock: max_offset and interval must not be negative"))
+	}
+	for _, sc := range cfg.Sensors {
+		switch strings.ToLower(sc.Type) {
+		case "", sensor.TypeDHT22, sensor.TypeSHT3x, sensor.TypeBME680, sensor.TypeTasmota, sensor.TypeESPHome,
+			sensor.TypeZigbee2MQTT, sensor.TypeModbus, sensor.TypePeer, sensor.TypeRedundant, sensor.TypeBLE:
+		default:
+			errs = append(errs, fmt.Errorf("sensor %s: unknown type '%s'", sc.Name, sc.Type))
+		}
+		if err := sc.ValidateCurves(); err != nil {
+			errs = append(errs, fmt.Errorf("sensor %s: %s", sc.Name, err))
+		}
+		if err := sc.ValidateRedundant(); err != nil {
+			errs = append(errs, fmt.Errorf("sensor %s: %s", sc.Name, err))
+		}
+	}
+	switch strings.ToLower(cfg.Gpio.Backend) {
+	case "", gpioio.BACKEND_PERIPH, gpioio.BACKEND_GPIOD, gpioio.BACKEND_FAKE:
+	default:
+		errs = append(errs, fmt.Errorf("gpio: unknown backend '%s'", cfg.Gpio.Backend))
+	}
+	if err := cfg.Actuator.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("actuator: %s", err))
+	}
+	if cfg.Actuator.DeadTime < 0 || cfg.Actuator.MaxPerHour < 0 {
+		errs = append(errs, errors.New("actuator: dead_time and max_per_hour must not be negative"))
+	}
+	if cfg.Actuator.WarnPercent < 0 || cfg.Actuator.WarnPercent > 100 {
+		errs = append(errs, errors.New("actuator: warn_percent must be between 0 and 100"))
+	}
+	for _, b := range cfg.buttons() {
+		for _, a := range []string{b.Short, b.Long, b.VeryLong} {
+			if err := checkAction(a); err != nil {
+				errs = append(errs, fmt.Errorf("button %s: %s", b.Pin, err))
+			}
+		}
+	}
+	if _, err := parsePull(cfg.Switch.Pull); err != nil {
+		errs = append(errs, fmt.Errorf("switch: %s", err))
+	}
+	names := map[string]bool{ZONE_MAIN: true}
+	for _, z := range cfg.Zones {
+		if z.Name == "" || names[z.Name] {
+			errs = append(errs, fmt.Errorf("zone: the name '%s' is empty or not unique", z.Name))
+		}
+		names[z.Name] = true
+		switch strings.ToLower(z.Sensor.Type) {
+		case "", sensor.TypeDHT22, sensor.TypeSHT3x, sensor.TypeBME680, sensor.TypeTasmota, sensor.TypeESPHome,
+			sensor.TypeZigbee2MQTT, sensor.TypeModbus, sensor.TypePeer, sensor.TypeRedundant, sensor.TypeBLE:
+		default:
+			errs = append(errs, fmt.Errorf("zone %s: unknown sensor type '%s'", z.Name, z.Sensor.Type))
+		}
+		if err := z.Sensor.ValidateCurves(); err != nil {
+			errs = append(errs, fmt.Errorf("zone %s: %s", z.Name, err))
+		}
+		if err := z.Sensor.ValidateRedundant(); err != nil {
+			errs = append(errs, fmt.Errorf("zone %s: %s", z.Name, err))
+		}
+		if err := z.Actuator.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("zone %s: %s", z.Name, err))
+		}
+		if z.Actuator.UsesGpio() && z.Actuator.Pin == "" {
+			errs = append(errs, fmt.Errorf("zone %s: the actuator needs a pin", z.Name))
+		}
+		for _, s := range z.Schedule {
+			if _, err := parseWindow(s); err != nil {
+				errs = append(errs, fmt.Errorf("zone %s: %s", z.Name, err))
+			}
+		}
+	}
+	if cfg.LoopWatch.Action != LOOP_ACTION_LOG && cfg.LoopWatch.Action != LOOP_ACTION_EXIT {
+		errs = append(errs, fmt.Errorf("loop_watch: unknown action '%s'", cfg.LoopWatch.Action))
+	}
+	if _, err := newAlertMonitor(cfg.Notify, nil); err != nil {
+		errs = append(errs, fmt.Errorf("notify: %s", err))
+	}
+	errs = append(errs, cfg.Control.validate("control")...)
+	for _, o := range cfg.Display.Outputs {
+		switch o.Type {
+		case DISPLAY_LCD, DISPLAY_CONSOLE:
+		default:
+			errs = append(errs, fmt.Errorf("display: unknown output '%s'", o.Type))
+		}
+	}
+	if _, err := newStatusLine(cfg.Display.Status); err != nil {
+		errs = append(errs, fmt.Errorf("display: status: %s", err))
+	}
+	if _, err := newStrategy(cfg.Strategy); err != nil {
+		errs = append(errs, fmt.Errorf("strategy: %s", err))
+	}
+	for _, z := range cfg.Zones {
+		if z.Control != nil {
+			errs = append(errs, z.Control.validate("zone "+z.Name)...)
+		}
+		if z.Strategy != nil {
+			if _, err := newStrategy(*z.Strategy); err != nil {
+				errs = append(errs, fmt.Errorf("zone %s: strategy: %s", z.Name, err))
+			}
+		}
+	}
+	if err := cfg.AdaptiveHysteresis.validate(cfg.Control.DiffMin); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Predict.Enabled && (cfg.Predict.Window <= 0 || cfg.Predict.Horizon < 0 || cfg.Predict.Lead < 0) {
+		errs = append(errs, errors.New("predict: window must be positive, horizon and lead must not be negative"))
+	}
+	errs = append(errs, cfg.validatePins()...)
+	errs = append(errs, cfg.validateSecrets()...)
+	return errs
+}
+
+// member of a JSON object, the value is kept as it is in the file
+type jsonMember struct {
+	key   string
+	value json.RawMessage
+}
+
+// decodes a JSON object into its members in the order of the file
+func decodeMembers(data []byte) ([]jsonMember, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil {
+		return nil, err
+	} else if d, ok := t.(json.Delim); !ok || d != '{' {
+		return nil, errors.New("not a JSON object")
+	}
+	var members []jsonMember
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		members = append(members, jsonMember{key: t.(string), value: value})
+	}
+	return members, nil
+}
+
+// replaces the value of the member or appends it
+func setMember(members []jsonMember, key string, v interface{}) ([]jsonMember, error) {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return members, err
+	}
+	for i := range members {
+		if members[i].key == key {
+			members[i].value = value
+			return members, nil
+		}
+	}
+	return append(members, jsonMember{key: key, value: value}), nil
+}
+
+func hasMember(members []jsonMember, key string) bool {
+	for _, m := range members {
+		if m.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// writes the members as object on one line, the values are compacted
+func encodeMembers(members []jsonMember) []byte {
+	var b bytes.Buffer
+	b.WriteString("{")
+	for i, m := range members {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		key, _ := json.Marshal(m.key)
+		b.Write(key)
+		b.WriteString(": ")
+		if err := json.Compact(&b, m.value); err != nil {
+			b.Write(m.value)
+		}
+	}
+	b.WriteString("}")
+	return b.Bytes()
+}
+
+// SaveSensorCorrections writes the offsets and the correction curves of the sensors to the config
+// file. Only these keys of the sensors are changed, all other settings and their layout stay as
+// they are, so omitted settings keep their defaults. Without sensors in the file, the sensors are
+// added. The file is replaced atomically.
+func SaveSensorCorrections(path string, sensors []sensor.Config) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		data, err = []byte("{}"), nil
+	}
+	if err != nil {
+		return err
+	}
+	members, err := decodeMembers(data)
+	if err != nil {
+		return fmt.Errorf("config file %s: %s", path, err)
+	}
+	var list []json.RawMessage
+	for _, m := range members {
+		if m.key == "sensors" {
+			if err = json.Unmarshal(m.value, &list); err != nil {
+				return fmt.Errorf("config file %s: sensors: %s", path, err)
+			}
+		}
+	}
+	var lines [][]byte
+	for i, sc := range sensors {
+		var sm []jsonMember
+		if i < len(list) {
+			if sm, err = decodeMembers(list[i]); err != nil {
+				return fmt.Errorf("config file %s: sensor %d: %s", path, i, err)
+			}
+		} else {
+			// a sensor that isn't in the file gets its settings without the empty ones
+			all, _ := json.Marshal(sc)
+			fields, err := decodeMembers(all)
+			if err != nil {
+				return err
+			}
+			for _, m := range fields {
+				switch string(m.value) {
+				case "0", `""`, "false", "null", "[]", "{}":
+				default:
+					sm = append(sm, m)
+				}
+			}
+		}
+		// keys that aren't in the file are only added with a correction
+		for _, c := range []struct {
+			key   string
+			value interface{}
+			set   bool
+		}{
+			{"temp_offset", sc.TempOffset, sc.TempOffset != 0},
+			{"hum_offset", sc.HumOffset, sc.HumOffset != 0},
+			{"temp_curve", sc.TempCurve, len(sc.TempCurve) > 0},
+			{"hum_curve", sc.HumCurve, len(sc.HumCurve) > 0},
+		} {
+			if c.set || hasMember(sm, c.key) {
+				if sm, err = setMember(sm, c.key, c.value); err != nil {
+					return err
+				}
+			}
+		}
+		lines = append(lines, encodeMembers(sm))
+	}
+	value := []byte("[\n    " + string(bytes.Join(lines, []byte(",\n    "))) + "\n  ]")
+	replaced := false
+	for i := range members {
+		if members[i].key == "sensors" {
+			members[i].value, replaced = value, true
+		}
+	}
+	if !replaced {
+		members = append(members, jsonMember{key: "sensors", value: value})
+	}
+
+	var b bytes.Buffer
+	b.WriteString("{\n")
+	for i, m := range members {
+		key, _ := json.Marshal(m.key)
+		b.WriteString("  ")
+		b.Write(key)
+		b.WriteString(": ")
+		b.Write(m.value)
+		if i < len(members)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("}\n")
+	// write to a temp file first, so that a power loss doesn't leave a broken file
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, b.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"fmt"
+
+	"periph.io/x/conn/v3/gpio"
+
+	"github.com/aluedtke7/dew_point_fan/internal/gpioio"
+)
+
+type contactConfig struct {
+	Pin      string `json:"pin"`      // input for a door/window reed contact, e.g. "GPIO5", empty to disable
+	Inverted bool   `json:"inverted"` // contact is open with a low level instead of a high level
+}
+
+// contactInput reads a door/window contact that is connected to GND, with the internal pull up
+type contactInput struct {
+	pin      gpioio.Pin
+	inverted bool
+}
+
+func newContactInput(cfg contactConfig) (*contactInput, error) {
+	c := &contactInput{inverted: cfg.Inverted}
+	if cfg.Pin == "" {
+		return c, nil
+	}
+	c.pin = gpioio.ByName(cfg.Pin)
+	if c.pin == nil {
+		return nil, fmt.Errorf("failed to find contact pin %s", cfg.Pin)
+	}
+	if err := c.pin.In(gpio.PullUp, gpio.NoEdge); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// returns true if the door/window is open
+func (c *contactInput) isOpen() bool {
+	if c.pin == nil {
+		return false
+	}
+	return bool(c.pin.Read()) != c.inverted
+}
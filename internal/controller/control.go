@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+)
+
+// thresholds of the automatic control, the defaults are the constants DIFF_MIN etc.
+type controlConfig struct {
+	DiffMin        float32 `json:"diff_min"`         // minimal dew point difference
+	Hysteresis     float32 `json:"hysteresis"`       // difference between switching on/off
+	HumInsideMin   float32 `json:"hum_inside_min"`   // minimal inside humidity, to have an active venting
+	TempInsideMin  float32 `json:"temp_inside_min"`  // minimal inside temperature, to have an active venting
+	TempOutsideMin float32 `json:"temp_outside_min"` // minimal outside temperature, to have an active venting
+}
+
+// controlLimits holds the thresholds that can be changed at runtime (e.g. via MQTT)
+type controlLimits struct {
+	mu     sync.Mutex
+	limits controlConfig
+}
+
+func (c *controlLimits) get() controlConfig {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.limits
+}
+
+func (c *controlLimits) set(l controlConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limits = l
+}
+
+func (c *controlLimits) setDiffMin(v float32) error {
+	if v <= 0 || v > 20 {
+		return fmt.Errorf("diff_min %.1f is out of range (0...20)", v)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limits.DiffMin = v
+	return nil
+}
@@ -0,0 +1,625 @@
+// Package controller reads the sensors, decides about the venting and drives the fan relay.
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"periph.io/x/host/v3"
+
+	"github.com/aluedtke7/dew_point_fan/internal/display"
+	"github.com/aluedtke7/dew_point_fan/internal/gpioio"
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"github.com/aluedtke7/dew_point_fan/internal/mdns"
+	"github.com/aluedtke7/dew_point_fan/internal/notify"
+	"github.com/aluedtke7/dew_point_fan/internal/sensor"
+	"github.com/aluedtke7/dew_point_fan/internal/shutdown"
+	"github.com/aluedtke7/dew_point_fan/internal/storage"
+	"github.com/aluedtke7/dew_point_fan/internal/version"
+)
+
+const (
+	DIFF_MIN         = 3.0    // minimal dew point difference
+	HYSTERESIS       = 1.0    // difference between switching on/off
+	HUM_INSIDE_MIN   = 50.0   // minimal inside humidity, to have an active venting
+	TEMP_INSIDE_MIN  = 10.0   // minimal inside temperature, to have an active venting
+	TEMP_OUTSIDE_MIN = -10.0  // minimal outside temperature, to have an active venting
+	DEF_TEMP         = -200.0 // default temperature
+	DEF_HUM          = -1.0   // default humidity
+	DATE_TIME_FORMAT = "2006-01-02 15:04:05"
+	HTTP_PORT        = 8080 // port of the web page and the REST API
+)
+
+// SensorData are the values of a sensor
+type SensorData struct {
+	Name        string       `json:"name"`
+	Temperature float32      `json:"temperature"`
+	Humidity    float32      `json:"humidity"`
+	DewPoint    float32      `json:"dew_point"`
+	Purging     bool         `json:"purging,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	Degraded    bool         `json:"degraded,omitempty"` // the sensor retries or fails often
+	Meta        *sensor.Meta `json:"meta,omitempty"`     // battery and link quality of wireless sensors
+}
+
+// Info is the current state for the http API and MQTT
+type Info struct {
+	Update         string       `json:"update"`
+	Sensors        []SensorData `json:"sensors"`
+	Venting        bool         `json:"venting"`
+	FanStatus      bool         `json:"fan_status"` // state of the hardware switch
+	Override       bool         `json:"override"`
+	RemoteOverride int          `json:"remote_override"`
+	Source         string       `json:"source"`
+	Boost          int          `json:"boost"` // remaining boost time in s
+	Frost          bool         `json:"frost"`
+	Mismatch       bool         `json:"mismatch"`      // the fan should be on, but the feedback is off
+	Rpm            *int         `json:"rpm,omitempty"` // speed of the fan, if there is a tach signal
+	Stalled        bool         `json:"stalled"`       // the fan is on, but doesn't turn
+	Paused         bool         `json:"paused"`        // automatic venting paused by door/window contact
+	Maintenance    int          `json:"maintenance"`   // remaining time of the maintenance mode in s
+	Lockout        string       `json:"lockout"`       // weather condition that blocks the automatic venting
+	Heater         bool         `json:"heater"`
+	Strategy       string       `json:"strategy"` // control strategy of the main zone
+	DiffMin        float32      `json:"diff_min"`
+	Hysteresis     float32      `json:"hysteresis"`
+	DryRun         bool         `json:"dry_run"`            // the fan relais is not switched
+	Zones          []ZoneInfo   `json:"zones,omitempty"`    // additional zones
+	ClockValid     bool         `json:"clock_valid"`        // the system clock is plausible
+	ClockOffset    float64      `json:"clock_offset"`       // difference to the reference server in s
+	Hostname       string       `json:"hostname,omitempty"` // hostname announced via mDNS
+	Addresses      []string     `json:"addresses"`          // IPv4 and IPv6 addresses of the device
+	Wifi           *WifiInfo    `json:"wifi,omitempty"`     // signal of the Wi-Fi link, if there is one
+	Connectivity   Connectivity `json:"connectivity"`
+	Version        string       `json:"version"`
+	Commit         string       `json:"commit,omitempty"`
+	BuildDate      string       `json:"build_date,omitempty"`
+	// who changed the override or the boost last, nil since the start
+	OverrideBy *OverrideOrigin `json:"override_by,omitempty"`
+	// metrics of the plugins, <plugin>_<metric>
+	PluginMetrics map[string]float64 `json:"plugin_metrics,omitempty"`
+}
+
+// Controller holds all parts of the control and the state of the last measurement cycle
+type Controller struct {
+	cfg     Config
+	dataDir string
+	screen  *display.Pager
+
+	limits     *controlLimits
+	hysteresis *adaptiveHysteresis
+	predictor  *trendPredictor
+	strategy   Strategy
+	statusLine *statusLine
+	state      *stateStore
+	decisions  *decisionLog
+	boost      *boost
+	pause      *pause
+	logLevel   *logLevelControl
+	frost      *frostProtection
+	contact    *contactInput
+	weather    *weatherLockout
+	sensors    []sensor.Sensor
+	purger     *sensor.Purger
+	influx     *influxWriter
+	store      *storage.LocalStore
+	stats      *statistics
+	runtime    *runtimeCounter
+	energy     *energyMeter
+	progress   *dryingProgress
+	dispatcher *notify.Dispatcher
+	alerts     *alertMonitor
+	mqtt       *mqttClient
+	watchdog   *hardwareWatchdog
+	readStats  *sensorStats
+	health     *sensorHealth
+	raw        *rawReadings
+	switchIn   *switchInput // GPIO22, input for the hardware 3 state switch
+	mismatch   *mismatchDetector
+	tacho      *tachometer
+	events     *eventStream
+	indicators *indicators
+	buttons    []*button
+	stall      *mismatchDetector
+	relay      *guardedRelay // the actuator of the fan, e.g. the relais on GPIO25
+	zones      []*zone       // additional zones sharing the outside sensor
+	mdns       *mdns.Responder
+	wifi       *wifiMonitor
+	// forces the fan off while working at it, e.g. cleaning
+	maintenance *maintenance
+	// who changed the override or the boost last
+	overrideBy *overrideOrigin
+	// changes of the override and the configuration, persisted in the data dir
+	audits *auditLog
+	// Lua scripts that adjust the automatic control
+	plugins *pluginSet
+
+	lastCycle      int64 // time of the last completed cycle, accessed atomically
+	remoteOverride int32 // 0 = not set, 1 = set to ON, 2 = set to OFF, accessed atomically
+	fanCommanded   int32 // last state written to the relais, 1 = on, accessed atomically
+	stage          atomic.Value
+	timing         *cycleTimer
+	clock          *clockCheck
+
+	mu   sync.Mutex
+	live Info // values of the last cycle
+
+	reloadMu sync.Mutex
+	fileCfg  Config // content of the config file, to detect the changes of a reload
+
+	netMu     sync.Mutex
+	ipAddress string   // preferred address, shown on the display
+	ipAll     []string // all usable addresses
+}
+
+// New initializes the hardware and all parts of the control. The state, the queue and the history
+// are kept in dataDir. The pager shows the values on the display, it's created without a display
+// if there is none.
+func New(cfg Config, dataDir string, screen *display.Pager) (*Controller, error) {
+	cfg = cfg.withSecrets()
+	quietCycles = cfg.Log.LowWrite
+	applyLogLevel(logger.GetLevel())
+	state := loadState(dataDir)
+	// the switch operations of a dry run aren't counted in the state file
+	relayState := state
+	if cfg.DryRun {
+		relayState = nil
+	}
+	c := &Controller{
+		cfg:        cfg,
+		dataDir:    dataDir,
+		screen:     screen,
+		limits:     &controlLimits{},
+		hysteresis: newAdaptiveHysteresis(cfg.AdaptiveHysteresis, cfg.Control.Hysteresis),
+		predictor:  newTrendPredictor(cfg.Predict),
+		state:      state,
+		decisions:  newDecisionLog(DECISION_LOG_SIZE),
+		boost:      &boost{},
+		logLevel:   &logLevelControl{},
+		pause:      &pause{},
+		readStats:  newSensorStats(),
+		health:     newSensorHealth(cfg.SensorHealth),
+		raw:        newRawReadings(),
+		events:     &eventStream{},
+		mismatch:   newMismatchDetector(cfg.Feedback),
+		relay:      newGuardedRelay(cfg.Actuator, relayState),
+		stall:      newMismatchDetector(feedbackConfig{Grace: cfg.Tacho.Grace}),
+		timing:     newCycleTimer(),
+		clock:      newClockCheck(cfg.Clock),
+		lastCycle:  time.Now().UnixNano(),
+	}
+	c.limits.set(cfg.Control)
+	c.maintenance = newMaintenance(state)
+	c.overrideBy = &overrideOrigin{}
+	c.audits = loadAuditLog(dataDir)
+	c.plugins = loadPlugins(cfg.Plugins)
+	var err error
+	if c.strategy, err = newStrategy(cfg.Strategy); err != nil {
+		return nil, fmt.Errorf("strategy: %s", err)
+	}
+	if c.statusLine, err = newStatusLine(cfg.Display.Status); err != nil {
+		return nil, fmt.Errorf("display: status: %s", err)
+	}
+	// the content of the file without the secrets and the flags of the command line
+	c.fileCfg, _ = ReadConfig(cfg.Source)
+	c.fileCfg.Source = cfg.Source
+	c.live.Update = "---"
+	c.live.Source = SOURCE_AUTO
+	c.updateAddresses(true)
+	if cfg.Mdns.Enabled {
+		r, err := mdns.New(cfg.Mdns, cfg.Http.port(), []string{"path=/", "api=/api/v1", "version=" + version.Version})
+		if err != nil {
+			logger.Errorf("Couldn't start the mDNS responder: %s", err)
+		} else {
+			c.mdns = r
+			shutdown.OnExit(r.Close)
+			logger.Infof("Announced as %s via mDNS", r.Host())
+		}
+	}
+
+	// Load the drivers for I2C and the gpio pins:
+	if _, err := host.Init(); err != nil {
+		logger.Error(err)
+	}
+	if err := gpioio.Init(cfg.Gpio); err != nil {
+		return nil, err
+	}
+	if c.switchIn, err = newSwitchInput(cfg.Switch); err != nil {
+		return nil, err
+	}
+	// initial value for the fan is the persisted state of the last run
+	c.live.Venting = c.state.get().Venting
+	if cfg.DryRun {
+		logger.Warn("Dry run: the fan relais is never switched")
+	}
+	if c.relay.relay, err = newActuator(cfg.Actuator, cfg.DryRun); err != nil {
+		return nil, err
+	}
+	logger.Infof("Fan actuator: %s", c.relay.relay.Name())
+	if err := c.setFan(c.live.Venting); err != nil {
+		return nil, err
+	}
+	// drive the relay to the safe state on exit
+	shutdown.OnExit(func() {
+		if err := c.forceFan(cfg.SafeState == SAFE_STATE_ON); err == errSwitchSkipped {
+			logger.Warnf("Switching the fan to the safe state '%s' was skipped", cfg.SafeState)
+		} else if err != nil {
+			logger.Errorf("Couldn't switch the fan to the safe state: %s", err)
+		} else if !cfg.DryRun {
+			logger.Infof("Fan switched to the safe state '%s'", cfg.SafeState)
+		}
+	})
+
+	if c.tacho, err = newTachometer(cfg.Tacho); err != nil {
+		return nil, err
+	}
+	if c.indicators, err = newIndicators(cfg.Indicators); err != nil {
+		return nil, err
+	}
+	shutdown.OnExit(c.indicators.off)
+	for _, bc := range cfg.buttons() {
+		b, err := newButton(bc, time.Duration(cfg.Switch.Debounce)*time.Millisecond)
+		if err != nil {
+			return nil, err
+		}
+		c.buttons = append(c.buttons, b)
+	}
+	if c.frost, err = newFrostProtection(cfg.Frost); err != nil {
+		return nil, err
+	}
+	if c.contact, err = newContactInput(cfg.Contact); err != nil {
+		return nil, err
+	}
+	if c.weather, err = newWeatherLockout(cfg.Weather); err != nil {
+		return nil, err
+	}
+	if c.watchdog, err = newHardwareWatchdog(cfg.Watchdog); err != nil {
+		return nil, err
+	}
+	shutdown.OnExit(c.watchdog.close)
+
+	for _, sc := range cfg.Sensors {
+		s, err := sensor.New(sc)
+		if err != nil {
+			return nil, err
+		}
+		c.sensors = append(c.sensors, s)
+	}
+	if c.purger, err = sensor.NewPurger(cfg.Purge, c.sensors); err != nil {
+		return nil, err
+	}
+	for _, zc := range cfg.Zones {
+		z, err := newZone(zc, cfg.Strategy, cfg.DryRun)
+		if err != nil {
+			return nil, err
+		}
+		z.raw = c.raw
+		z.safeOn = cfg.SafeState == SAFE_STATE_ON
+		c.zones = append(c.zones, z)
+		c.screen.AddPage("zone "+zc.Name, z.page)
+		shutdown.OnExit(func() {
+			z.setSafeState(cfg.SafeState == SAFE_STATE_ON)
+		})
+	}
+
+	writeAPI, err := newPointWriter(cfg.Influx)
+	if err != nil {
+		return nil, err
+	}
+	queue, err := storage.OpenQueue(filepath.Join(dataDir, QUEUE_FILE), QUEUE_MAX_SIZE)
+	if err != nil {
+		logger.Errorf("Couldn't open queue for InfluxDB points: %s", err)
+	}
+	c.influx = newInfluxWriter(writeAPI, queue, time.Duration(cfg.Influx.Average)*time.Second,
+		time.Duration(cfg.Influx.Batch)*time.Second)
+	c.influx.clockValid = c.clock.plausible
+
+	// local history of all measurements, independent of InfluxDB
+	if cfg.Store.Enabled {
+		store, err := storage.OpenLocal(filepath.Join(dataDir, HISTORY_FILE), time.Duration(cfg.Store.Retention)*24*time.Hour)
+		if err != nil {
+			logger.Errorf("Couldn't open local history: %s", err)
+		} else {
+			c.store = store
+			shutdown.OnExit(func() {
+				_ = store.Close()
+			})
+		}
+	}
+	c.stats = newStatistics(cfg.Stats)
+	c.screen.AddPage("today", func() []string { return c.stats.page(false) })
+	c.screen.AddPage("yesterday", func() []string { return c.stats.page(true) })
+	c.runtime = newRuntimeCounter(c.state)
+	c.screen.AddPage("runtime", c.runtime.page)
+	c.wifi = newWifiMonitor(cfg.Wifi)
+	if c.wifi.update() != nil {
+		c.screen.AddPage("wifi", c.wifi.page)
+	}
+	c.energy = newEnergyMeter(cfg.Energy, c.state)
+	c.progress = newDryingProgress(c.state)
+
+	c.dispatcher = newDispatcher(cfg.Notify)
+	if c.alerts, err = newAlertMonitor(cfg.Notify, c.dispatcher); err != nil {
+		return nil, err
+	}
+	c.alerts.events = c.events
+	if cfg.Mqtt.Broker != "" {
+		c.mqtt = newMqttClient(cfg.Mqtt, c.mqttCommand)
+	}
+	c.startModbus(cfg.Modbus)
+	c.startCoap(cfg.Coap)
+	return c, nil
+}
+
+// returns the time of the last completed measurement cycle
+func (c *Controller) lastCycleTime() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.lastCycle))
+}
+
+func (c *Controller) getRemoteOverride() int {
+	return int(atomic.LoadInt32(&c.remoteOverride))
+}
+
+// Info returns the values of the last cycle
+func (c *Controller) Info() *Info {
+	c.mu.Lock()
+	inf := c.live
+	inf.Sensors = append([]SensorData{}, c.live.Sensors...)
+	c.mu.Unlock()
+	inf.RemoteOverride = c.getRemoteOverride()
+	inf.OverrideBy = c.overrideBy.get()
+	inf.Boost = int(c.boost.remaining().Seconds())
+	inf.Maintenance = int(c.maintenance.remaining().Seconds())
+	inf.Heater = c.frost.heaterOn()
+	inf.Strategy = c.strategy.Name()
+	inf.DiffMin = c.limits.get().DiffMin
+	inf.Hysteresis = c.hysteresis.value()
+	inf.DryRun = c.cfg.DryRun
+	inf.ClockValid = c.clock.plausible()
+	inf.ClockOffset = c.clock.offsetSeconds()
+	if c.mdns != nil {
+		inf.Hostname = c.mdns.Host()
+	}
+	_, inf.Addresses = c.addresses()
+	for _, z := range c.zones {
+		inf.Zones = append(inf.Zones, z.getInfo())
+	}
+	if c.tacho.enabled() {
+		rpm := c.tacho.speed()
+		inf.Rpm = &rpm
+	}
+	inf.Wifi = c.wifi.get()
+	inf.Connectivity = c.connectivity()
+	inf.Version = version.Short()
+	inf.Commit = version.ShortCommit()
+	inf.BuildDate = version.BuildDate
+	return &inf
+}
+
+// Display returns the lines currently shown on the display
+func (c *Controller) Display() display.Snapshot {
+	return c.screen.Snapshot()
+}
+
+// Dashboard returns a Grafana dashboard for the configured InfluxDB backend
+func (c *Controller) Dashboard() ([]byte, error) {
+	return Dashboard(c.cfg)
+}
+
+// Peer returns the last readings of both sensors for other devices, that use them as their sensors
+func (c *Controller) Peer() sensor.PeerData {
+	c.mu.Lock()
+	sensors := append([]SensorData{}, c.live.Sensors...)
+	c.mu.Unlock()
+	measured := c.lastCycleTime()
+	data := sensor.PeerData{
+		Time:    measured.Format(time.RFC3339),
+		Age:     roundFloat64(time.Since(measured).Seconds(), 1),
+		Sensors: map[string]sensor.PeerReading{},
+	}
+	for i, s := range sensors {
+		key := sensor.PEER_INSIDE
+		if i == 1 {
+			key = sensor.PEER_OUTSIDE
+		}
+		data.Sensors[key] = sensor.PeerReading{
+			Name:        s.Name,
+			Temperature: s.Temperature,
+			Humidity:    s.Humidity,
+			Valid:       s.Error == "" && !s.Purging,
+		}
+	}
+	return data
+}
+
+// called by the switch input, when the hardware switch is changed between two cycles
+func (c *Controller) onSwitchChange(on bool) {
+	override := on != c.fanCommandedOn()
+	if override {
+		logger.Infof("Hardware switch changed, fan status is %t", on)
+	} else {
+		logger.Debugf("Fan status is %t", on)
+	}
+	c.mu.Lock()
+	c.live.FanStatus = on
+	c.live.Override = override
+	c.mu.Unlock()
+	// with the values, so that MQTT publishes the change before the next cycle
+	c.events.publish(Event{Type: EVENT_FAN, Active: on, Info: c.Info()})
+}
+
+// switches the fan relais, in a dry run the actuator only logs
+func (c *Controller) setFan(on bool) error {
+	if err := c.relay.set(on); err == errSwitchSkipped {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&c.fanCommanded, int32(boolToInt(on)))
+	return nil
+}
+
+// switches the fan relais regardless of the dead time and the maximum switching rate
+func (c *Controller) forceFan(on bool) error {
+	if err := c.relay.force(on); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&c.fanCommanded, int32(boolToInt(on)))
+	return nil
+}
+
+// fanCommandedOn returns the state the relais was switched to
+func (c *Controller) fanCommandedOn() bool {
+	return atomic.LoadInt32(&c.fanCommanded) == 1
+}
+
+// ExecuteCommand executes a command that changes the override or the configuration
+// (override, diff_min, hysteresis or boost), e.g. received via MQTT
+func (c *Controller) ExecuteCommand(command, value string) error {
+	switch command {
+	case "override":
+		switch strings.ToLower(value) {
+		case "0", "auto":
+			atomic.StoreInt32(&c.remoteOverride, 0)
+		case "1", "on":
+			atomic.StoreInt32(&c.remoteOverride, 1)
+		case "2", "off":
+			atomic.StoreInt32(&c.remoteOverride, 2)
+		default:
+			return fmt.Errorf("invalid override '%s'", value)
+		}
+	case "diff_min", "hysteresis":
+		v, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return err
+		}
+		// the new thresholds must pass the checks of the config file, e.g. hysteresis <= diff_min
+		l := c.limits.get()
+		l.Hysteresis = c.hysteresis.baseValue()
+		if command == "diff_min" {
+			l.DiffMin = float32(v)
+		} else {
+			l.Hysteresis = float32(v)
+		}
+		errs := l.validate("control")
+		if err = c.cfg.AdaptiveHysteresis.validate(l.DiffMin); err != nil {
+			errs = append(errs, err)
+		}
+		if len(errs) > 0 {
+			var msgs []string
+			for _, err := range errs {
+				msgs = append(msgs, err.Error())
+			}
+			return errors.New(strings.Join(msgs, "; "))
+		}
+		if command == "diff_min" {
+			return c.limits.setDiffMin(l.DiffMin)
+		}
+		return c.hysteresis.setBase(l.Hysteresis)
+	case "boost":
+		minutes, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		if minutes <= 0 {
+			c.boost.stop()
+		} else {
+			c.boost.start(time.Duration(minutes) * time.Minute)
+		}
+	default:
+		return fmt.Errorf("unknown command")
+	}
+	return nil
+}
+
+// Decisions returns the last venting decisions including their reason
+func (c *Controller) Decisions() []Decision {
+	return c.decisions.list()
+}
+
+// StartBoost runs the fan for the given minutes, 0 for the configured default
+func (c *Controller) StartBoost(minutes int) BoostResponse {
+	if minutes <= 0 {
+		minutes = c.cfg.Boost.Minutes
+	}
+	c.boost.start(time.Duration(minutes) * time.Minute)
+	return c.boost.response()
+}
+
+// StopBoost stops a running boost
+func (c *Controller) StopBoost() BoostResponse {
+	c.boost.stop()
+	return c.boost.response()
+}
+
+// Boost returns the remaining boost time
+func (c *Controller) Boost() BoostResponse {
+	return c.boost.response()
+}
+
+// Stats returns the daily statistics
+func (c *Controller) Stats() StatsResponse {
+	return c.stats.response()
+}
+
+// Runtime returns the cumulative fan runtime
+func (c *Controller) Runtime() RuntimeResponse {
+	return c.runtime.response()
+}
+
+// ResetRuntime resets the fan runtime after a maintenance
+func (c *Controller) ResetRuntime() RuntimeResponse {
+	c.runtime.reset()
+	return c.runtime.response()
+}
+
+// Energy returns the estimated energy consumption
+func (c *Controller) Energy() EnergyResponse {
+	return c.energy.response()
+}
+
+// Progress returns the weekly drying progress
+func (c *Controller) Progress() ProgressResponse {
+	return c.progress.response()
+}
+
+// Relay returns the wear state of the relais
+func (c *Controller) Relay() RelayResponse {
+	return c.relay.response()
+}
+
+// ResetRelay resets the switch counter after the relais was replaced
+func (c *Controller) ResetRelay() RelayResponse {
+	c.relay.reset()
+	return c.relay.response()
+}
+
+// HasHistory returns true, if the local history is available
+func (c *Controller) HasHistory() bool {
+	return c.store != nil
+}
+
+// History returns the records of the local history between from and to
+func (c *Controller) History(from, to time.Time) ([]storage.Record, error) {
+	if c.store == nil {
+		return nil, fmt.Errorf("local history is disabled")
+	}
+	return c.store.Range(from, to)
+}
+
+// LogLevel returns the current log level
+func (c *Controller) LogLevel() LogLevelResponse {
+	return c.logLevel.response()
+}
+
+// SetLogLevel sets the log level, it drops back to info after d
+func (c *Controller) SetLogLevel(lvl int, d time.Duration) LogLevelResponse {
+	c.logLevel.set(lvl, d)
+	return c.logLevel.response()
+}
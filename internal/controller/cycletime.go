@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"sync"
+	"time"
+)
+
+// parts of a cycle with their own timing
+const (
+	PART_SENSORS = "sensors"
+	PART_INFLUX  = "influx"
+	PART_DISPLAY = "display"
+	PART_TOTAL   = "total"
+)
+
+// CycleTiming contains the durations of the last cycle and some totals in ms
+type CycleTiming struct {
+	Last     map[string]float64 `json:"last"`     // duration of the parts of the last cycle
+	Average  float64            `json:"average"`  // average duration of a cycle
+	Max      float64            `json:"max"`      // longest cycle
+	Period   float64            `json:"period"`   // time between the starts of the last two cycles
+	Cycles   int                `json:"cycles"`   // completed cycles
+	Overruns int                `json:"overruns"` // cycles that took longer than the cycle interval
+}
+
+// cycleTimer measures the durations of the parts of a cycle
+type cycleTimer struct {
+	mu        sync.Mutex
+	start     time.Time
+	current   map[string]time.Duration
+	last      map[string]time.Duration
+	lastStart time.Time
+	period    time.Duration
+	sum       time.Duration
+	max       time.Duration
+	cycles    int
+	overruns  int
+}
+
+func newCycleTimer() *cycleTimer {
+	return &cycleTimer{current: map[string]time.Duration{}, last: map[string]time.Duration{}}
+}
+
+// begin starts a new cycle
+func (t *cycleTimer) begin(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.lastStart.IsZero() {
+		t.period = now.Sub(t.lastStart)
+	}
+	t.lastStart = now
+	t.start = now
+	t.current = map[string]time.Duration{}
+}
+
+// measure adds the time since start to the part, use it with defer or at the end of the part
+func (t *cycleTimer) measure(part string, start time.Time) {
+	d := time.Since(start)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.current[part] += d
+}
+
+// end completes the cycle
+func (t *cycleTimer) end(now time.Time, interval time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	total := now.Sub(t.start)
+	t.current[PART_TOTAL] = total
+	t.last = t.current
+	t.cycles++
+	t.sum += total
+	if total > t.max {
+		t.max = total
+	}
+	if total > interval {
+		t.overruns++
+	}
+}
+
+// duration of a part of the last completed cycle
+func (t *cycleTimer) lastPart(part string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.last[part]
+}
+
+func (t *cycleTimer) response() CycleTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ms := func(d time.Duration) float64 {
+		return roundFloat64(float64(d)/float64(time.Millisecond), 1)
+	}
+	r := CycleTiming{
+		Last:     map[string]float64{},
+		Max:      ms(t.max),
+		Period:   ms(t.period),
+		Cycles:   t.cycles,
+		Overruns: t.overruns,
+	}
+	for part, d := range t.last {
+		r.Last[part] = ms(d)
+	}
+	if t.cycles > 0 {
+		r.Average = ms(t.sum / time.Duration(t.cycles))
+	}
+	return r
+}
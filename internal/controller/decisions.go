@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"sync"
+	"time"
+)
+
+// machine-readable reasons for a venting decision
+const (
+	REASON_DELTA_ABOVE      = "delta_above_threshold"
+	REASON_DELTA_BELOW      = "delta_below_threshold"
+	REASON_HYSTERESIS       = "within_hysteresis"
+	REASON_HUMIDITY_LOW     = "humidity_too_low"
+	REASON_TEMP_INSIDE_LOW  = "inside_temperature_too_low"
+	REASON_TEMP_OUTSIDE_LOW = "outside_temperature_too_low"
+	REASON_REMOTE_OVERRIDE  = "remote_override"
+	REASON_HARDWARE_SWITCH  = "hardware_switch"
+	REASON_BOOST            = "boost"
+	REASON_FROST            = "frost_protection"
+	REASON_CONTACT_OPEN     = "contact_open"
+	REASON_WEATHER_LOCKOUT  = "weather_lockout"
+	REASON_SCHEDULE         = "outside_schedule"
+	REASON_SENSOR_FAILURE   = "sensor_failure"
+	REASON_SENSOR_HUNG      = "sensor_hung"
+	REASON_SENSOR_PURGE     = "sensor_purge"
+	REASON_SPIKE            = "spike_detected"
+	REASON_STARTUP          = "startup"
+	REASON_WARMUP           = "warmup"
+	DECISION_LOG_SIZE       = 200 // number of decisions kept in memory
+)
+
+// Decision is a change of the venting state with its reason
+type Decision struct {
+	Time           string  `json:"time"`
+	Venting        bool    `json:"venting"`
+	FanStatus      bool    `json:"fan_status"`
+	RemoteOverride int     `json:"remote_override"`
+	Reason         string  `json:"reason"`
+	Source         string  `json:"source"`
+	DeltaDewPoint  float32 `json:"delta_dew_point"`
+	Maintenance    bool    `json:"maintenance,omitempty"`
+}
+
+// ring buffer for the last decisions, safe for concurrent use
+type decisionLog struct {
+	mu      sync.Mutex
+	entries []Decision
+	next    int
+	full    bool
+}
+
+func newDecisionLog(size int) *decisionLog {
+	return &decisionLog{entries: make([]Decision, size)}
+}
+
+func (d *decisionLog) add(dec Decision) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if dec.Time == "" {
+		dec.Time = time.Now().Format(DATE_TIME_FORMAT)
+	}
+	d.entries[d.next] = dec
+	d.next = (d.next + 1) % len(d.entries)
+	if d.next == 0 {
+		d.full = true
+	}
+}
+
+// returns all stored decisions, oldest first
+func (d *decisionLog) list() []Decision {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.full {
+		return append([]Decision{}, d.entries[:d.next]...)
+	}
+	return append(append([]Decision{}, d.entries[d.next:]...), d.entries[:d.next]...)
+}
+
+// calculates the new venting state from the current readings and returns it together with the reason
+func decideVenting(current bool, l controlConfig, deltaTP, hysteresis, tempInside, tempOutside, humInside float32) (bool, string) {
+	state, reason := current, REASON_HYSTERESIS
+	if deltaTP > (l.DiffMin + hysteresis) {
+		state, reason = true, REASON_DELTA_ABOVE
+	}
+	if deltaTP < l.DiffMin {
+		state, reason = false, REASON_DELTA_BELOW
+	}
+	if tempInside < l.TempInsideMin {
+		return false, REASON_TEMP_INSIDE_LOW
+	}
+	if tempOutside < l.TempOutsideMin {
+		return false, REASON_TEMP_OUTSIDE_LOW
+	}
+	// no venting when inside humidity is below threshold
+	if humInside < l.HumInsideMin {
+		return false, REASON_HUMIDITY_LOW
+	}
+	return state, reason
+}
@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/gpioio"
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"github.com/aluedtke7/dew_point_fan/internal/sensor"
+	"github.com/aluedtke7/dew_point_fan/internal/version"
+)
+
+const DIAG_ERRORS = 10
+
+var startTime = time.Now()
+
+// SensorStat counts the reads of a sensor
+type SensorStat struct {
+	Reads         int     `json:"reads"`
+	Failures      int     `json:"failures"`
+	Retries       int     `json:"retries"`
+	RetryRate     float32 `json:"retry_rate"` // average retries per read
+	LastError     string  `json:"last_error,omitempty"`
+	LastErrorTime string  `json:"last_error_time,omitempty"`
+	// rates of the last sensor_health.window minutes
+	Recent SensorHealth `json:"recent"`
+}
+
+type sensorStats struct {
+	mu    sync.Mutex
+	stats map[string]*SensorStat
+}
+
+func newSensorStats() *sensorStats {
+	return &sensorStats{stats: map[string]*SensorStat{}}
+}
+
+// records the result of a sensor read
+func (s *sensorStats) record(name string, retried int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.stats[name]
+	if !ok {
+		st = &SensorStat{}
+		s.stats[name] = st
+	}
+	st.Reads++
+	st.Retries += retried
+	st.RetryRate = roundFloat32(float32(st.Retries)/float32(st.Reads), 2)
+	if err != nil {
+		st.Failures++
+		st.LastError = err.Error()
+		st.LastErrorTime = time.Now().Format(DATE_TIME_FORMAT)
+	}
+}
+
+func (s *sensorStats) get() map[string]SensorStat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := map[string]SensorStat{}
+	for name, st := range s.stats {
+		result[name] = *st
+	}
+	return result
+}
+
+// MemoryInfo contains the memory statistics of the Go runtime
+type MemoryInfo struct {
+	Alloc      uint64 `json:"alloc"`
+	Sys        uint64 `json:"sys"`
+	HeapInUse  uint64 `json:"heap_in_use"`
+	NumGC      uint32 `json:"num_gc"`
+	LastGCTime string `json:"last_gc_time,omitempty"`
+}
+
+// DiagResponse contains the self-diagnostics for remote support
+type DiagResponse struct {
+	GoVersion   string                `json:"go_version"`
+	Module      string                `json:"module"`
+	Version     string                `json:"version"`
+	Revision    string                `json:"revision,omitempty"`
+	Started     string                `json:"started"`
+	Uptime      string                `json:"uptime"`
+	Goroutines  int                   `json:"goroutines"`
+	Memory      MemoryInfo            `json:"memory"`
+	LoopStage   string                `json:"loop_stage"`
+	LastCycle   string                `json:"last_cycle"`
+	CycleTiming CycleTiming           `json:"cycle_timing"`
+	I2CDevices  map[string]bool       `json:"i2c_devices"`
+	Pins        map[string]string     `json:"pins"`
+	Sensors     map[string]SensorStat `json:"sensors"`
+	LastErrors  []logger.Entry        `json:"last_errors"`
+	LogLevel    string                `json:"log_level"`
+	HistoryOpen bool                  `json:"history_open"`
+}
+
+// returns the names of all GPIO pins in use
+func (c *Controller) usedPins() []string {
+	var pins []string
+	seen := map[string]bool{}
+	for _, u := range c.cfg.pinUses() {
+		if !seen[u.pin] {
+			seen[u.pin] = true
+			pins = append(pins, u.pin)
+		}
+	}
+	return pins
+}
+
+// Diag collects the self-diagnostics
+func (c *Controller) Diag() DiagResponse {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	d := DiagResponse{
+		GoVersion:  runtime.Version(),
+		Version:    version.Short(),
+		Revision:   version.Commit,
+		Started:    startTime.Format(DATE_TIME_FORMAT),
+		Uptime:     time.Since(startTime).Round(time.Second).String(),
+		Goroutines: runtime.NumGoroutine(),
+		Memory: MemoryInfo{
+			Alloc:     ms.Alloc,
+			Sys:       ms.Sys,
+			HeapInUse: ms.HeapInuse,
+			NumGC:     ms.NumGC,
+		},
+		LoopStage:   c.currentStage(),
+		LastCycle:   c.lastCycleTime().Format(DATE_TIME_FORMAT),
+		CycleTiming: c.timing.response(),
+		I2CDevices:  map[string]bool{},
+		Pins:        map[string]string{},
+		Sensors:     c.readStats.get(),
+		LastErrors:  logger.Recent(DIAG_ERRORS, logger.LevelError),
+		LogLevel:    logger.LevelName(logger.GetLevel()),
+		HistoryOpen: c.store != nil,
+	}
+	for name, st := range d.Sensors {
+		st.Recent = c.health.get(name)
+		d.Sensors[name] = st
+	}
+	if ms.LastGC > 0 {
+		d.Memory.LastGCTime = time.Unix(0, int64(ms.LastGC)).Format(DATE_TIME_FORMAT)
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		d.Module = bi.Main.Path
+	}
+	var buses []int
+	for _, sc := range c.cfg.Sensors {
+		if sc.Type == sensor.TypeSHT3x || sc.Type == sensor.TypeBME680 {
+			buses = append(buses, sc.I2CBus)
+		}
+		for _, m := range sc.Sensors {
+			if m.Type == sensor.TypeSHT3x || m.Type == sensor.TypeBME680 {
+				buses = append(buses, m.I2CBus)
+			}
+		}
+	}
+	if c.cfg.Actuator.UsesI2C() {
+		buses = append(buses, c.cfg.Actuator.I2CBus)
+	}
+	for _, bus := range buses {
+		if bus == 0 {
+			bus = 1
+		}
+		dev := fmt.Sprintf("/dev/i2c-%d", bus)
+		_, err := os.Stat(dev)
+		d.I2CDevices[dev] = err == nil
+	}
+	for _, name := range c.usedPins() {
+		if p := gpioio.ByName(name); p != nil {
+			d.Pins[name] = p.Read().String()
+		} else {
+			d.Pins[name] = "missing"
+		}
+	}
+	return d
+}
@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// aggregation of the fields of all points with the same measurement and tags
+type fieldAggregate struct {
+	name   string
+	tags   map[string]string
+	sums   map[string]float64
+	counts map[string]int
+	last   map[string]interface{}
+}
+
+// downsampler averages points over a fixed time window
+type downsampler struct {
+	window  time.Duration
+	start   time.Time
+	entries map[string]*fieldAggregate
+	order   []string
+}
+
+func newDownsampler(window time.Duration) *downsampler {
+	return &downsampler{window: window, entries: map[string]*fieldAggregate{}}
+}
+
+func pointKey(p *write.Point) string {
+	parts := []string{p.Name()}
+	for _, t := range p.TagList() {
+		parts = append(parts, t.Key+"="+t.Value)
+	}
+	sort.Strings(parts[1:])
+	return strings.Join(parts, ",")
+}
+
+// adds a point and returns the averaged points, when the time window is over
+func (d *downsampler) add(p *write.Point) []*write.Point {
+	if d.start.IsZero() {
+		d.start = p.Time()
+	}
+	key := pointKey(p)
+	agg, ok := d.entries[key]
+	if !ok {
+		agg = &fieldAggregate{
+			name:   p.Name(),
+			tags:   map[string]string{},
+			sums:   map[string]float64{},
+			counts: map[string]int{},
+			last:   map[string]interface{}{},
+		}
+		for _, t := range p.TagList() {
+			agg.tags[t.Key] = t.Value
+		}
+		d.entries[key] = agg
+		d.order = append(d.order, key)
+	}
+	for _, f := range p.FieldList() {
+		switch v := f.Value.(type) {
+		case float64:
+			agg.sums[f.Key] += v
+		case int64:
+			agg.sums[f.Key] += float64(v)
+		case uint64:
+			agg.sums[f.Key] += float64(v)
+		case bool:
+			if v {
+				agg.sums[f.Key]++
+			}
+		}
+		agg.counts[f.Key]++
+		agg.last[f.Key] = f.Value
+	}
+	if p.Time().Sub(d.start) < d.window {
+		return nil
+	}
+	return d.flush(p.Time())
+}
+
+// returns the averaged points and starts a new time window. The field types are kept,
+// otherwise InfluxDB would reject the points because of a field type conflict.
+func (d *downsampler) flush(ts time.Time) []*write.Point {
+	points := make([]*write.Point, 0, len(d.order))
+	for _, key := range d.order {
+		agg := d.entries[key]
+		fields := map[string]interface{}{}
+		for k, last := range agg.last {
+			avg := agg.sums[k] / float64(agg.counts[k])
+			switch last.(type) {
+			case float64:
+				fields[k] = math.Round(avg*100) / 100
+			case int64:
+				fields[k] = int64(math.Round(avg))
+			case uint64:
+				fields[k] = uint64(math.Round(avg))
+			case bool:
+				fields[k] = avg >= 0.5
+			default:
+				fields[k] = last
+			}
+		}
+		points = append(points, write.NewPoint(agg.name, agg.tags, fields, ts))
+	}
+	d.start = time.Time{}
+	d.entries = map[string]*fieldAggregate{}
+	d.order = nil
+	return points
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+const MONTH_FORMAT = "2006-01"
+
+type energyConfig struct {
+	Watts float32 `json:"watts"` // power consumption of the fan in W
+	Price float32 `json:"price"` // optional price per kWh, to calculate the costs
+}
+
+// EnergyResponse is the estimated energy consumption
+type EnergyResponse struct {
+	Watts         float32 `json:"watts"`
+	Today         float64 `json:"today_kwh"`
+	Yesterday     float64 `json:"yesterday_kwh"`
+	Month         float64 `json:"month_kwh"`
+	LastMonth     float64 `json:"last_month_kwh"`
+	CostToday     float64 `json:"cost_today,omitempty"`
+	CostMonth     float64 `json:"cost_month,omitempty"`
+	CostLastMonth float64 `json:"cost_last_month,omitempty"`
+}
+
+// energyMeter estimates the energy consumption of the fan from its runtime
+type energyMeter struct {
+	mu         sync.Mutex
+	cfg        energyConfig
+	state      *stateStore
+	energy     energyState
+	lastUpdate time.Time
+	lastSave   time.Time
+}
+
+// energy consumption per day and month, persisted in the state file
+type energyState struct {
+	Day       string  `json:"day"`
+	DayKwh    float64 `json:"day_kwh"`
+	Yesterday float64 `json:"yesterday_kwh"`
+	Month     string  `json:"month"`
+	MonthKwh  float64 `json:"month_kwh"`
+	LastMonth float64 `json:"last_month_kwh"`
+}
+
+func newEnergyMeter(cfg energyConfig, state *stateStore) *energyMeter {
+	return &energyMeter{cfg: cfg, state: state, energy: state.get().Energy, lastSave: time.Now()}
+}
+
+// adds the consumption since the last update. When a day is over, the point for InfluxDB is returned.
+func (e *energyMeter) update(now time.Time, fanOn bool) *write.Point {
+	e.mu.Lock()
+	var point *write.Point
+	day, month := now.Format(DATE_FORMAT), now.Format(MONTH_FORMAT)
+	if e.energy.Day != day {
+		if e.energy.Day != "" {
+			ts, _ := time.ParseInLocation(DATE_FORMAT, e.energy.Day, time.Local)
+			point = write.NewPoint("dp_energy", map[string]string{}, map[string]interface{}{
+				"day_kwh":   e.energy.DayKwh,
+				"month_kwh": e.energy.MonthKwh,
+			}, ts)
+		}
+		e.energy.Yesterday = e.energy.DayKwh
+		e.energy.Day = day
+		e.energy.DayKwh = 0
+	}
+	if e.energy.Month != month {
+		e.energy.LastMonth = e.energy.MonthKwh
+		e.energy.Month = month
+		e.energy.MonthKwh = 0
+	}
+	if fanOn && !e.lastUpdate.IsZero() {
+		if elapsed := now.Sub(e.lastUpdate); elapsed < MAX_STATS_GAP {
+			kwh := float64(e.cfg.Watts) / 1000 * elapsed.Hours()
+			e.energy.DayKwh += kwh
+			e.energy.MonthKwh += kwh
+		}
+	}
+	e.lastUpdate = now
+	save := point != nil || now.Sub(e.lastSave) >= RUNTIME_SAVE_INTERVAL
+	if save {
+		e.lastSave = now
+	}
+	energy := e.energy
+	e.mu.Unlock()
+	if save {
+		e.state.update(func(st *persistentState) {
+			st.Energy = energy
+		})
+	}
+	return point
+}
+
+func roundKwh(v float64) float64 {
+	return float64(roundFloat32(float32(v), 3))
+}
+
+func (e *energyMeter) response() EnergyResponse {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	price := float64(e.cfg.Price)
+	return EnergyResponse{
+		Watts:         e.cfg.Watts,
+		Today:         roundKwh(e.energy.DayKwh),
+		Yesterday:     roundKwh(e.energy.Yesterday),
+		Month:         roundKwh(e.energy.MonthKwh),
+		LastMonth:     roundKwh(e.energy.LastMonth),
+		CostToday:     roundKwh(e.energy.DayKwh * price),
+		CostMonth:     roundKwh(e.energy.MonthKwh * price),
+		CostLastMonth: roundKwh(e.energy.LastMonth * price),
+	}
+}
@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+const (
+	EVENT_FAN         = "fan"         // the fan was switched on or off (feedback of GPIO22)
+	EVENT_SENSORS     = "sensors"     // the sensor readings failed or are valid again
+	EVENT_ALERT       = "alert"       // an alert rule became active or was resolved
+	EVENT_MEASUREMENT = "measurement" // a cycle was completed, with the values of /info
+	EVENT_DECISION    = "decision"    // the venting, the fan status or the remote override changed
+	EVENT_STATE       = "state"       // the override, the boost or the configuration was changed
+	EVENT_ERROR       = "error"       // an error of the loop, e.g. writing the history
+	EVENT_DISPLAY     = "display"     // a line of the display was changed
+
+	EVENT_QUEUE_MAX = 10000 // events waiting for a queued subscriber, further events are dropped
+)
+
+// Event is a measurement or a state change of the controller, the fields depend on the type
+type Event struct {
+	Type     string       `json:"type"`
+	Name     string       `json:"name,omitempty"` // name of the alert rule or the change
+	Active   bool         `json:"active"`         // fan on, sensors failed or alert active
+	Time     time.Time    `json:"time"`
+	Info     *Info        `json:"info,omitempty"` // values of a measurement
+	Decision *Decision    `json:"decision,omitempty"`
+	Change   *AuditEntry  `json:"change,omitempty"` // change of a state, as in the audit log
+	Error    string       `json:"error,omitempty"`
+	Display  *DisplayLine `json:"display,omitempty"`
+	// points of a measurement for InfluxDB, of the main zone and the additional zones
+	Points []*write.Point `json:"-"`
+}
+
+// DisplayLine is a line of the main page of the display
+type DisplayLine struct {
+	Line   int    `json:"line"`
+	Text   string `json:"text"`
+	Scroll bool   `json:"scroll"`
+}
+
+// eventStream is the event bus of the controller, it distributes the events to all subscribers
+type eventStream struct {
+	mu   sync.Mutex
+	subs []*subscriber
+}
+
+type subscriber struct {
+	name     string
+	ch       chan Event
+	queued   bool          // the events are queued instead of dropped
+	queue    []Event       // events of a queued subscriber, that aren't received yet
+	wake     chan struct{} // signals new events in the queue
+	dropping bool          // events are dropped, logged once until an event is delivered again
+}
+
+// returns a channel that receives all events, events are dropped while the channel is full
+func (s *eventStream) subscribe(name string, size int) <-chan Event {
+	sub := &subscriber{name: name, ch: make(chan Event, size)}
+	s.mu.Lock()
+	s.subs = append(s.subs, sub)
+	s.mu.Unlock()
+	return sub.ch
+}
+
+// returns a channel that receives all events in order, a slow receiver doesn't lose events up to
+// EVENT_QUEUE_MAX waiting events, e.g. for the display and the data written to InfluxDB
+func (s *eventStream) subscribeQueued(name string) <-chan Event {
+	sub := &subscriber{name: name, ch: make(chan Event), queued: true, wake: make(chan struct{}, 1)}
+	s.mu.Lock()
+	s.subs = append(s.subs, sub)
+	s.mu.Unlock()
+	go func() {
+		for range sub.wake {
+			s.mu.Lock()
+			events := sub.queue
+			sub.queue = nil
+			s.mu.Unlock()
+			for _, e := range events {
+				sub.ch <- e
+			}
+		}
+	}()
+	return sub.ch
+}
+
+// removes the subscription and closes its channel
+func (s *eventStream) unsubscribe(ch <-chan Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, sub := range s.subs {
+		if sub.ch == ch && !sub.queued {
+			s.subs = append(s.subs[:i], s.subs[i+1:]...)
+			close(sub.ch)
+			return
+		}
+	}
+}
+
+func (s *eventStream) publish(e Event) {
+	if s == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sub := range s.subs {
+		delivered := true
+		if sub.queued {
+			if len(sub.queue) < EVENT_QUEUE_MAX {
+				sub.queue = append(sub.queue, e)
+				select {
+				case sub.wake <- struct{}{}:
+				default:
+				}
+			} else {
+				delivered = false
+			}
+		} else {
+			select {
+			case sub.ch <- e:
+			default:
+				delivered = false
+			}
+		}
+		if !delivered && !sub.dropping {
+			logger.Warnf("Event subscriber %s is too slow, events are dropped", sub.name)
+		} else if delivered && sub.dropping {
+			logger.Infof("Event subscriber %s receives the events again", sub.name)
+		}
+		sub.dropping = !delivered
+	}
+}
+
+// Subscribe returns a channel with the events of the controller, e.g. for a stream of the HTTP
+// API. Events are dropped while the channel is full, cancel ends the subscription.
+func (c *Controller) Subscribe(size int) (events <-chan Event, cancel func()) {
+	ch := c.events.subscribe("api", size)
+	return ch, func() { c.events.unsubscribe(ch) }
+}
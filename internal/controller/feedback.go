@@ -0,0 +1,37 @@
+package controller
+
+import "time"
+
+type feedbackConfig struct {
+	Grace int `json:"grace"` // time in s the fan may be off, although it should be on
+}
+
+// mismatchDetector compares the commanded state of the relais with the feedback of GPIO22. A
+// mismatch (blown fuse, stuck relais, switch in OFF) is reported after the grace period.
+type mismatchDetector struct {
+	grace  time.Duration
+	since  time.Time
+	active bool
+}
+
+func newMismatchDetector(cfg feedbackConfig) *mismatchDetector {
+	return &mismatchDetector{grace: time.Duration(cfg.Grace) * time.Second}
+}
+
+// updates the state with the current cycle and returns the mismatch state and true, if it has changed
+func (m *mismatchDetector) update(now time.Time, shouldBeOn, isOn bool) (bool, bool) {
+	if !shouldBeOn || isOn {
+		m.since = time.Time{}
+		changed := m.active
+		m.active = false
+		return false, changed
+	}
+	if m.since.IsZero() {
+		m.since = now
+	}
+	if m.active || now.Sub(m.since) < m.grace {
+		return m.active, false
+	}
+	m.active = true
+	return true, true
+}
@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/aluedtke7/dew_point_fan/internal/gpioio"
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"periph.io/x/conn/v3/gpio"
+)
+
+type frostConfig struct {
+	Enabled    bool    `json:"enabled"`
+	Limit      float32 `json:"limit"`      // frost protection starts below this inside temperature in °C
+	Hysteresis float32 `json:"hysteresis"` // frost protection ends above limit + hysteresis
+	HeaterPin  string  `json:"heater_pin"` // optional output for a heater relais, e.g. "GPIO27"
+	ActiveLow  bool    `json:"active_low"` // heater relais is switched on with a low level
+}
+
+// frostProtection blocks venting and switches an optional heater when the vented room gets too cold
+type frostProtection struct {
+	cfg    frostConfig
+	active bool
+	heater gpioio.Pin
+}
+
+func newFrostProtection(cfg frostConfig) (*frostProtection, error) {
+	f := &frostProtection{cfg: cfg}
+	if !cfg.Enabled || cfg.HeaterPin == "" {
+		return f, nil
+	}
+	f.heater = gpioio.ByName(cfg.HeaterPin)
+	if f.heater == nil {
+		return nil, fmt.Errorf("failed to find heater pin %s", cfg.HeaterPin)
+	}
+	return f, f.setHeater(false)
+}
+
+func (f *frostProtection) setHeater(on bool) error {
+	if f.heater == nil {
+		return nil
+	}
+	level := gpio.Level(on != f.cfg.ActiveLow)
+	return f.heater.Out(level)
+}
+
+// updates the frost state with a valid inside temperature and returns true while frost protection is active
+func (f *frostProtection) update(tempInside float32) bool {
+	if !f.cfg.Enabled {
+		return false
+	}
+	changed := false
+	if !f.active && tempInside < f.cfg.Limit {
+		f.active = true
+		changed = true
+	} else if f.active && tempInside > f.cfg.Limit+f.cfg.Hysteresis {
+		f.active = false
+		changed = true
+	}
+	if changed {
+		logger.Infof("Frost protection is %t (inside temperature %5.1f°C)", f.active, tempInside)
+		if err := f.setHeater(f.active); err != nil {
+			logger.Errorf("Couldn't switch heater: %s", err)
+		}
+	}
+	return f.active
+}
+
+func (f *frostProtection) heaterOn() bool {
+	return f.active && f.heater != nil
+}
@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// a series of a Grafana panel: field of a measurement
+type grafanaSeries struct {
+	measurement string
+	field       string
+	zoned       bool // the measurement has the tag zone
+}
+
+type grafanaPanel struct {
+	title  string
+	unit   string
+	kind   string // "timeseries" or "barchart"
+	series []grafanaSeries
+}
+
+// the panels of the dashboard, the names match the points written by the loop
+func grafanaPanels(cfg Config) []grafanaPanel {
+	dp := func(fields ...string) []grafanaSeries {
+		var s []grafanaSeries
+		for _, f := range fields {
+			s = append(s, grafanaSeries{measurement: "dp", field: f, zoned: true})
+		}
+		return s
+	}
+	panels := []grafanaPanel{
+		{title: "Dew points", unit: "celsius", kind: "timeseries", series: dp("dewpoint_i", "dewpoint_o")},
+		{title: "Temperatures", unit: "celsius", kind: "timeseries", series: dp("temp_i", "temp_o")},
+		{title: "Humidity", unit: "humidity", kind: "timeseries", series: dp("hum_i", "hum_o")},
+		{title: "Venting", unit: "bool_on_off", kind: "timeseries", series: dp("vent_val", "mismatch")},
+		{title: "Sensor retries", unit: "short", kind: "timeseries", series: dp("retry_i", "retry_o")},
+	}
+	if cfg.Tacho.Pin != "" {
+		panels = append(panels, grafanaPanel{title: "Fan speed", unit: "rotrpm", kind: "timeseries", series: dp("rpm")})
+	}
+	panels = append(panels,
+		grafanaPanel{title: "Daily fan runtime", unit: "m", kind: "barchart", series: []grafanaSeries{
+			{measurement: "dp_daily", field: "runtime_minutes"}, {measurement: "dp_daily", field: "switch_cycles"}}},
+		grafanaPanel{title: "Daily energy", unit: "kwatth", kind: "barchart", series: []grafanaSeries{
+			{measurement: "dp_energy", field: "day_kwh"}}},
+	)
+	return panels
+}
+
+// returns the query of a series in the language of the backend
+func grafanaQuery(cfg Config, s grafanaSeries, zones bool) (string, error) {
+	switch cfg.Influx.Backend {
+	case "", BACKEND_INFLUX2:
+		q := fmt.Sprintf(`from(bucket: "%s")
+  |> range(start: v.timeRangeStart, stop: v.timeRangeStop)
+  |> filter(fn: (r) => r._measurement == "%s" and r._field == "%s")`, cfg.Influx.Bucket, s.measurement, s.field)
+		if s.zoned && zones {
+			q += "\n  |> filter(fn: (r) => r.zone == \"${zone}\")"
+		}
+		if s.measurement == "dp" {
+			q += "\n  |> aggregateWindow(every: v.windowPeriod, fn: mean, createEmpty: false)"
+		}
+		return q + fmt.Sprintf("\n  |> keep(columns: [\"_time\", \"_value\"])\n  |> set(key: \"_field\", value: \"%s\")", s.field), nil
+	case BACKEND_INFLUX1, BACKEND_UDP:
+		where := "$timeFilter"
+		if s.zoned && zones {
+			where += ` AND "zone" = '${zone}'`
+		}
+		if s.measurement == "dp" {
+			return fmt.Sprintf(`SELECT mean("%s") AS "%s" FROM "%s" WHERE %s GROUP BY time($__interval) fill(none)`,
+				s.field, s.field, s.measurement, where), nil
+		}
+		return fmt.Sprintf(`SELECT "%s" FROM "%s" WHERE %s`, s.field, s.measurement, where), nil
+	case BACKEND_VM:
+		q := s.measurement + "_" + s.field
+		if s.zoned && zones {
+			q += `{zone="${zone}"}`
+		}
+		return q, nil
+	}
+	return "", fmt.Errorf("no dashboard for the backend '%s'", cfg.Influx.Backend)
+}
+
+// Dashboard returns a Grafana dashboard for the data this device writes, ready for the import.
+// The data source is selected during the import.
+func Dashboard(cfg Config) ([]byte, error) {
+	dsType, dsName := "influxdb", "InfluxDB"
+	if cfg.Influx.Backend == BACKEND_VM {
+		dsType, dsName = "prometheus", "VictoriaMetrics"
+	}
+	datasource := map[string]string{"type": dsType, "uid": "${DS_DEWPOINT}"}
+	zones := len(cfg.Zones) > 0
+	var panels []map[string]interface{}
+	for i, p := range grafanaPanels(cfg) {
+		var targets []map[string]interface{}
+		for j, s := range p.series {
+			q, err := grafanaQuery(cfg, s, zones)
+			if err != nil {
+				return nil, err
+			}
+			target := map[string]interface{}{
+				"refId":      string(rune('A' + j)),
+				"datasource": datasource,
+			}
+			switch cfg.Influx.Backend {
+			case BACKEND_VM:
+				target["expr"] = q
+				target["legendFormat"] = s.field
+			case BACKEND_INFLUX1, BACKEND_UDP:
+				target["query"] = q
+				target["rawQuery"] = true
+				target["resultFormat"] = "time_series"
+			default:
+				target["query"] = q
+			}
+			targets = append(targets, target)
+		}
+		custom := map[string]interface{}{}
+		if p.unit == "bool_on_off" {
+			custom["lineInterpolation"] = "stepAfter"
+		}
+		panels = append(panels, map[string]interface{}{
+			"id":          i + 1,
+			"type":        p.kind,
+			"title":       p.title,
+			"datasource":  datasource,
+			"gridPos":     map[string]int{"h": 8, "w": 12, "x": (i % 2) * 12, "y": (i / 2) * 8},
+			"fieldConfig": map[string]interface{}{"defaults": map[string]interface{}{"unit": p.unit, "custom": custom}},
+			"targets":     targets,
+		})
+	}
+	variables := []map[string]interface{}{}
+	if zones {
+		names := []string{ZONE_MAIN}
+		for _, z := range cfg.Zones {
+			names = append(names, z.Name)
+		}
+		var options []map[string]interface{}
+		for i, n := range names {
+			options = append(options, map[string]interface{}{"text": n, "value": n, "selected": i == 0})
+		}
+		variables = append(variables, map[string]interface{}{
+			"name":    "zone",
+			"label":   "Zone",
+			"type":    "custom",
+			"query":   strings.Join(names, ","),
+			"current": map[string]string{"text": ZONE_MAIN, "value": ZONE_MAIN},
+			"options": options,
+		})
+	}
+	dashboard := map[string]interface{}{
+		"__inputs": []map[string]string{{
+			"name":     "DS_DEWPOINT",
+			"label":    dsName,
+			"type":     "datasource",
+			"pluginId": dsType,
+		}},
+		"title":         "Dew Point Fan",
+		"tags":          []string{"dew-point-fan"},
+		"timezone":      "browser",
+		"schemaVersion": 36,
+		"time":          map[string]string{"from": "now-24h", "to": "now"},
+		"refresh":       "1m",
+		"panels":        panels,
+		"templating":    map[string]interface{}{"list": variables},
+	}
+	// the queries contain "=>" and "|>", so don't escape them
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(dashboard); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
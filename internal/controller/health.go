@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+const (
+	DEF_HEALTH_WINDOW       = 60  // minutes
+	DEF_MAX_RETRY_RATE      = 1.0 // retries per read
+	DEF_MAX_FAILURE_RATE    = 10  // % of the reads
+	MIN_HEALTH_WINDOW_READS = 20  // no judgement before this number of reads
+)
+
+// a sensor that retries or fails often indicates a bad cable or an aging sensor
+type sensorHealthConfig struct {
+	Window         int     `json:"window"`           // minutes of reads for the rates
+	MaxRetryRate   float32 `json:"max_retry_rate"`   // average retries per read
+	MaxFailureRate float32 `json:"max_failure_rate"` // failed reads in %
+}
+
+type healthSample struct {
+	t       time.Time
+	retried int
+	failed  bool
+}
+
+// SensorHealth are the rates of a sensor within the window
+type SensorHealth struct {
+	Reads       int     `json:"reads"`
+	RetryRate   float32 `json:"retry_rate"`   // average retries per read
+	FailureRate float32 `json:"failure_rate"` // failed reads in %
+	Degraded    bool    `json:"degraded"`
+}
+
+// sensorHealth keeps the reads of the window for every sensor
+type sensorHealth struct {
+	cfg     sensorHealthConfig
+	mu      sync.Mutex
+	samples map[string][]healthSample
+	state   map[string]SensorHealth
+}
+
+func newSensorHealth(cfg sensorHealthConfig) *sensorHealth {
+	if cfg.Window <= 0 {
+		cfg.Window = DEF_HEALTH_WINDOW
+	}
+	if cfg.MaxRetryRate <= 0 {
+		cfg.MaxRetryRate = DEF_MAX_RETRY_RATE
+	}
+	if cfg.MaxFailureRate <= 0 {
+		cfg.MaxFailureRate = DEF_MAX_FAILURE_RATE
+	}
+	return &sensorHealth{cfg: cfg, samples: map[string][]healthSample{}, state: map[string]SensorHealth{}}
+}
+
+// records a read and updates the rates of the sensor, a change of the degradation is logged
+func (s *sensorHealth) record(now time.Time, name string, retried int, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	window := time.Duration(s.cfg.Window) * time.Minute
+	samples := append(s.samples[name], healthSample{t: now, retried: retried, failed: failed})
+	first := 0
+	for first < len(samples) && now.Sub(samples[first].t) > window {
+		first++
+	}
+	samples = samples[first:]
+	s.samples[name] = samples
+
+	retries, failures := 0, 0
+	for _, sm := range samples {
+		retries += sm.retried
+		if sm.failed {
+			failures++
+		}
+	}
+	h := SensorHealth{
+		Reads:       len(samples),
+		RetryRate:   roundFloat32(float32(retries)/float32(len(samples)), 2),
+		FailureRate: roundFloat32(100*float32(failures)/float32(len(samples)), 1),
+	}
+	h.Degraded = h.Reads >= MIN_HEALTH_WINDOW_READS &&
+		(h.RetryRate > s.cfg.MaxRetryRate || h.FailureRate > s.cfg.MaxFailureRate)
+	if h.Degraded != s.state[name].Degraded {
+		if h.Degraded {
+			logger.Warnf("Sensor %s degraded: %.2f retries per read, %.1f%% failed reads in the last %d min, check the cable",
+				name, h.RetryRate, h.FailureRate, s.cfg.Window)
+		} else {
+			logger.Infof("Sensor %s is reliable again", name)
+		}
+	}
+	s.state[name] = h
+}
+
+// returns the rates of the sensor
+func (s *sensorHealth) get(name string) SensorHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state[name]
+}
+
+// returns the highest rates of all sensors and if any of them is degraded
+func (s *sensorHealth) worst() (retryRate, failureRate float32, degraded bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, h := range s.state {
+		if h.RetryRate > retryRate {
+			retryRate = h.RetryRate
+		}
+		if h.FailureRate > failureRate {
+			failureRate = h.FailureRate
+		}
+		degraded = degraded || h.Degraded
+	}
+	return
+}
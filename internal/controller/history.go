@@ -0,0 +1,8 @@
+package controller
+
+const HISTORY_FILE = "history.db"
+
+type storeConfig struct {
+	Enabled   bool `json:"enabled"`
+	Retention int  `json:"retention"` // retention time of the local history in days
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+const (
+	HOOK_FAN_ON  = "on_fan_on"
+	HOOK_FAN_OFF = "on_fan_off"
+	HOOK_ALERT   = "on_alert"
+)
+
+// shell commands that are executed on events, e.g. to switch a smart plug or to send an SMS
+type hooksConfig struct {
+	OnFanOn  string `json:"on_fan_on"`  // the fan was switched on (feedback of the switch)
+	OnFanOff string `json:"on_fan_off"` // the fan was switched off
+	OnAlert  string `json:"on_alert"`   // an alert fired or was resolved
+	Timeout  int    `json:"timeout"`    // in s, the command is killed after this time
+}
+
+// hookPayload is written as JSON to stdin of the command
+type hookPayload struct {
+	Hook  string      `json:"hook"`
+	Time  string      `json:"time"`
+	Fan   bool        `json:"fan"`             // state of the fan
+	Alert *AlertState `json:"alert,omitempty"` // the alert of on_alert, firing is false when resolved
+	Info  *Info       `json:"info"`            // the values of /info
+}
+
+// returns true if at least one hook is configured
+func (cfg hooksConfig) enabled() bool {
+	return cfg.OnFanOn != "" || cfg.OnFanOff != "" || cfg.OnAlert != ""
+}
+
+// executes the hooks of the events one after the other, should be started as goroutine
+func (c *Controller) runHooks(cfg hooksConfig, events <-chan Event) {
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	fanKnown, fan := false, false
+	for e := range events {
+		payload := hookPayload{Time: e.Time.Format(DATE_TIME_FORMAT), Info: e.Info}
+		var command string
+		switch e.Type {
+		case EVENT_FAN:
+			// the switch input and the loop both report a change, the first state after the start is a change
+			if fanKnown && e.Active == fan {
+				continue
+			}
+			fanKnown, fan = true, e.Active
+			payload.Hook, command = HOOK_FAN_OFF, cfg.OnFanOff
+			if e.Active {
+				payload.Hook, command = HOOK_FAN_ON, cfg.OnFanOn
+			}
+		case EVENT_ALERT:
+			payload.Hook, command = HOOK_ALERT, cfg.OnAlert
+			payload.Alert = &AlertState{Name: e.Name, Firing: e.Active}
+			for _, a := range c.alerts.states() {
+				if a.Name == e.Name {
+					payload.Alert.Severity, payload.Alert.Message = a.Severity, a.Message
+				}
+			}
+		default:
+			continue
+		}
+		if command == "" {
+			continue
+		}
+		if payload.Info == nil {
+			payload.Info = c.Info()
+		}
+		payload.Fan = payload.Info.FanStatus
+		if e.Type == EVENT_FAN {
+			payload.Fan = e.Active
+		}
+		runHook(command, payload, timeout)
+	}
+}
+
+// executes the command with /bin/sh, the payload is passed on stdin and the name of the hook
+// in DPF_HOOK
+func runHook(command string, payload hookPayload, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	j, _ := json.Marshal(payload)
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(j)
+	cmd.Env = append(os.Environ(), "DPF_HOOK="+payload.Hook)
+	if payload.Alert != nil {
+		cmd.Env = append(cmd.Env, "DPF_ALERT="+payload.Alert.Name)
+	}
+	start := time.Now()
+	out, err := cmd.CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = ctx.Err()
+		}
+		logger.Warnf("Hook %s failed: %s %s", payload.Hook, err, output)
+		return
+	}
+	logger.Infof("Hook %s executed in %s", payload.Hook, time.Since(start).Round(time.Millisecond))
+	if output != "" {
+		logger.Debugf("Output of hook %s: %s", payload.Hook, output)
+	}
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+type adaptiveConfig struct {
+	Enabled     bool    `json:"enabled"`
+	MaxSwitches int     `json:"max_switches"` // allowed switching operations per hour before widening
+	Step        float32 `json:"step"`         // change of hysteresis per adjustment in °C
+	Max         float32 `json:"max"`          // upper limit for the hysteresis in °C
+}
+
+// adaptiveHysteresis widens the hysteresis when the fan switches too often and narrows it back when stable
+type adaptiveHysteresis struct {
+	mu         sync.Mutex
+	cfg        adaptiveConfig
+	base       float32
+	current    float32
+	switches   []time.Time
+	lastAdjust time.Time
+}
+
+// checks that the hysteresis can't be widened beyond diff_min
+func (cfg adaptiveConfig) validate(diffMin float32) error {
+	if cfg.Enabled && cfg.Max > diffMin {
+		return fmt.Errorf("adaptive_hysteresis: max %.1f must not be greater than diff_min (%.1f)", cfg.Max, diffMin)
+	}
+	return nil
+}
+
+func newAdaptiveHysteresis(cfg adaptiveConfig, base float32) *adaptiveHysteresis {
+	return &adaptiveHysteresis{cfg: cfg, base: base, current: base}
+}
+
+// records a switching operation of the automatic control
+func (a *adaptiveHysteresis) recordSwitch(t time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.switches = append(a.switches, t)
+}
+
+// returns the hysteresis to use, adjusting it if necessary
+func (a *adaptiveHysteresis) update(now time.Time) float32 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.cfg.Enabled {
+		return a.current
+	}
+	idx := 0
+	for idx < len(a.switches) && now.Sub(a.switches[idx]) > time.Hour {
+		idx++
+	}
+	a.switches = a.switches[idx:]
+	count := len(a.switches)
+	sinceAdjust := now.Sub(a.lastAdjust)
+
+	if count > a.cfg.MaxSwitches && a.current < a.cfg.Max && sinceAdjust >= 15*time.Minute {
+		old := a.current
+		a.current = roundFloat32(a.current+a.cfg.Step, 2)
+		if a.current > a.cfg.Max {
+			a.current = a.cfg.Max
+		}
+		a.lastAdjust = now
+		logger.Infof("Hysteresis widened from %.2f to %.2f (%d switches in the last hour)", old, a.current, count)
+	} else if count <= a.cfg.MaxSwitches/2 && a.current > a.base && sinceAdjust >= time.Hour {
+		old := a.current
+		a.current = roundFloat32(a.current-a.cfg.Step, 2)
+		if a.current < a.base {
+			a.current = a.base
+		}
+		a.lastAdjust = now
+		logger.Infof("Hysteresis narrowed from %.2f to %.2f (%d switches in the last hour)", old, a.current, count)
+	}
+	return a.current
+}
+
+func (a *adaptiveHysteresis) value() float32 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.current
+}
+
+// returns the configured hysteresis without the widening
+func (a *adaptiveHysteresis) baseValue() float32 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.base
+}
+
+// sets a new base hysteresis, e.g. via MQTT
+func (a *adaptiveHysteresis) setBase(v float32) error {
+	if v < 0 || v > 10 {
+		return fmt.Errorf("hysteresis %.1f is out of range (0...10)", v)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.base = v
+	if a.current < v || !a.cfg.Enabled {
+		a.current = v
+	}
+	return nil
+}
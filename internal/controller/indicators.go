@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/gpioio"
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"periph.io/x/conn/v3/gpio"
+)
+
+const (
+	BEEP_COUNT  = 3
+	BEEP_TIME   = 200 * time.Millisecond
+	BEEP_REPEAT = time.Minute
+)
+
+type indicatorConfig struct {
+	GreenPin  string   `json:"green_pin"`  // LED that is on while the fan is running
+	RedPin    string   `json:"red_pin"`    // LED that is on while the sensors fail or a critical alert is active
+	BuzzerPin string   `json:"buzzer_pin"` // active piezo buzzer that beeps while a critical alert is active
+	Alerts    []string `json:"alerts"`     // critical alerts
+	ActiveLow bool     `json:"active_low"` // the outputs are switched on with a low level
+}
+
+// indicators drives the status LEDs and the buzzer from the events of the controller
+type indicators struct {
+	cfg      indicatorConfig
+	green    gpioio.Pin
+	red      gpioio.Pin
+	buzzer   gpioio.Pin
+	critical map[string]bool
+}
+
+func newIndicators(cfg indicatorConfig) (*indicators, error) {
+	ind := &indicators{cfg: cfg, critical: map[string]bool{}}
+	for _, a := range cfg.Alerts {
+		ind.critical[a] = true
+	}
+	var err error
+	if ind.green, err = ind.output(cfg.GreenPin); err != nil {
+		return nil, err
+	}
+	if ind.red, err = ind.output(cfg.RedPin); err != nil {
+		return nil, err
+	}
+	if ind.buzzer, err = ind.output(cfg.BuzzerPin); err != nil {
+		return nil, err
+	}
+	return ind, nil
+}
+
+// returns the pin switched off or nil, if the name is empty
+func (ind *indicators) output(name string) (gpioio.Pin, error) {
+	if name == "" {
+		return nil, nil
+	}
+	pin := gpioio.ByName(name)
+	if pin == nil {
+		return nil, fmt.Errorf("failed to find indicator pin %s", name)
+	}
+	return pin, ind.set(pin, false)
+}
+
+func (ind *indicators) set(pin gpioio.Pin, on bool) error {
+	if pin == nil {
+		return nil
+	}
+	return pin.Out(gpio.Level(on != ind.cfg.ActiveLow))
+}
+
+// switches all outputs off
+func (ind *indicators) off() {
+	for _, pin := range []gpioio.Pin{ind.green, ind.red, ind.buzzer} {
+		_ = ind.set(pin, false)
+	}
+}
+
+// returns true if there is a LED or a buzzer
+func (ind *indicators) enabled() bool {
+	return ind.green != nil || ind.red != nil || ind.buzzer != nil
+}
+
+// processes the events, should be started as goroutine
+func (ind *indicators) run(events <-chan Event) {
+	sensorsFailed := false
+	activeAlerts := map[string]bool{}
+	beep := time.NewTicker(BEEP_REPEAT)
+	defer beep.Stop()
+	for {
+		select {
+		case e := <-events:
+			switch e.Type {
+			case EVENT_FAN:
+				if err := ind.set(ind.green, e.Active); err != nil {
+					logger.Error(err)
+				}
+			case EVENT_SENSORS:
+				sensorsFailed = e.Active
+			case EVENT_ALERT:
+				if !ind.critical[e.Name] {
+					continue
+				}
+				if e.Active {
+					activeAlerts[e.Name] = true
+					ind.beep()
+				} else {
+					delete(activeAlerts, e.Name)
+				}
+			}
+			if err := ind.set(ind.red, sensorsFailed || len(activeAlerts) > 0); err != nil {
+				logger.Error(err)
+			}
+		case <-beep.C:
+			if len(activeAlerts) > 0 {
+				ind.beep()
+			}
+		}
+	}
+}
+
+// plays the beep pattern
+func (ind *indicators) beep() {
+	if ind.buzzer == nil {
+		return
+	}
+	for i := 0; i < BEEP_COUNT; i++ {
+		_ = ind.set(ind.buzzer, true)
+		time.Sleep(BEEP_TIME)
+		_ = ind.set(ind.buzzer, false)
+		time.Sleep(BEEP_TIME)
+	}
+}
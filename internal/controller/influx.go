@@ -0,0 +1,308 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+
+	"github.com/aluedtke7/dew_point_fan/internal/storage"
+)
+
+const (
+	QUEUE_FILE       = "queue.db"
+	QUEUE_MAX_SIZE   = 200000 // approx. 1 month of data
+	QUEUE_BATCH      = 500    // number of queued lines written at once
+	RETRY_MIN_DELAY  = 5 * time.Second
+	RETRY_MAX_DELAY  = 5 * time.Minute
+	WRITE_CHANNEL    = 100 // points waiting for the writer goroutine
+	WRITE_TIMEOUT    = 10 * time.Second
+	BACKEND_INFLUX2  = "influx2"
+	BACKEND_INFLUX1  = "influx1"
+	BACKEND_UDP      = "udp"
+	BACKEND_VM       = "victoriametrics"
+	BACKEND_GRAPHITE = "graphite"
+)
+
+type influxConfig struct {
+	Backend         string `json:"backend"` // "influx2" (default), "influx1", "udp", "victoriametrics" or "graphite"
+	Url             string `json:"url"`     // overruled by environment variable INFLUX_SRV_URL
+	Org             string `json:"org"`     // InfluxDB 2.x only
+	Bucket          string `json:"bucket"`  // InfluxDB 2.x only
+	Token           string `json:"token"`   // InfluxDB 2.x only, better use INFLUX_DP_TOKEN or INFLUX_DP_TOKEN_FILE
+	Username        string `json:"username"`
+	Password        string `json:"password"`
+	Database        string `json:"database"`         // InfluxDB 1.x only
+	RetentionPolicy string `json:"retention_policy"` // InfluxDB 1.x only, empty for the default policy
+	UdpAddress      string `json:"udp_address"`      // host:port for line protocol over UDP
+	GraphiteAddress string `json:"graphite_address"` // host:port of the Graphite plaintext receiver
+	GraphitePrefix  string `json:"graphite_prefix"`  // prefix for all Graphite metrics
+	Average         int    `json:"average"`          // write averages over this time in s instead of every sample, 0 to disable
+	Batch           int    `json:"batch"`            // collect points and write them every n s, 0 to write immediately
+}
+
+// pointWriter is implemented by the blocking InfluxDB write API and the UDP writer
+type pointWriter interface {
+	WritePoint(ctx context.Context, point ...*write.Point) error
+	WriteRecord(ctx context.Context, line ...string) error
+}
+
+// creates the writer for the configured backend
+func newPointWriter(cfg influxConfig) (pointWriter, error) {
+	url := cfg.Url
+	if u, ok := os.LookupEnv("INFLUX_SRV_URL"); ok {
+		url = u
+	}
+	switch cfg.Backend {
+	case "", BACKEND_INFLUX2:
+		logger.Infof("InfluxDB token: %s", secretHint(cfg.Token))
+		logger.Infof("Influx srv url: %s", url)
+		client := influxdb2.NewClient(url, cfg.Token)
+		return client.WriteAPIBlocking(cfg.Org, cfg.Bucket), nil
+	case BACKEND_INFLUX1:
+		// InfluxDB 1.8 offers a compatible API with 'username:password' as token and 'database/rp' as bucket
+		logger.Infof("InfluxDB 1.x url: %s, database: %s", url, cfg.Database)
+		client := influxdb2.NewClient(url, fmt.Sprintf("%s:%s", cfg.Username, cfg.Password))
+		return client.WriteAPIBlocking("", cfg.Database+"/"+cfg.RetentionPolicy), nil
+	case BACKEND_UDP:
+		logger.Infof("Line protocol over UDP to %s", cfg.UdpAddress)
+		return storage.NewUDPWriter(cfg.UdpAddress)
+	case BACKEND_VM:
+		// VictoriaMetrics accepts the InfluxDB line protocol on /write
+		logger.Infof("VictoriaMetrics url: %s", url)
+		return storage.NewHTTPLineWriter(strings.TrimSuffix(url, "/") + "/write"), nil
+	case BACKEND_GRAPHITE:
+		logger.Infof("Graphite plaintext protocol to %s", cfg.GraphiteAddress)
+		return storage.NewGraphiteWriter(cfg.GraphiteAddress, cfg.GraphitePrefix), nil
+	}
+	return nil, fmt.Errorf("unknown InfluxDB backend '%s'", cfg.Backend)
+}
+
+// influxWriter writes points to InfluxDB. Points that can't be written are queued on disk
+// and written later, so that outages of the server or the network don't result in gaps.
+// The points are written by a goroutine, so a slow server never delays the control loop.
+type influxWriter struct {
+	writeAPI    pointWriter
+	queue       *storage.Queue
+	notify      chan struct{}
+	points      chan influxItem
+	dropped     int64 // points dropped because the channel was full and there is no queue, accessed atomically
+	held        int64 // points dropped because of an implausible clock, accessed atomically
+	failed      int32 // 1 if the last write failed, accessed atomically
+	clockValid  func() bool
+	downsampler *downsampler
+	batch       time.Duration
+	pending     []*write.Point
+	lastFlush   time.Time
+}
+
+type influxItem struct {
+	point   *write.Point
+	average bool // the point may be averaged
+}
+
+func newInfluxWriter(writeAPI pointWriter, queue *storage.Queue, average, batch time.Duration) *influxWriter {
+	w := &influxWriter{
+		writeAPI:  writeAPI,
+		queue:     queue,
+		notify:    make(chan struct{}, 1),
+		points:    make(chan influxItem, WRITE_CHANNEL),
+		batch:     batch,
+		lastFlush: time.Now(),
+	}
+	if average > 0 {
+		w.downsampler = newDownsampler(average)
+	}
+	if queue != nil {
+		go w.retry()
+	}
+	go w.run()
+	return w
+}
+
+// writes a point, depending on the configuration averaged and/or in batches
+func (w *influxWriter) write(point *write.Point) {
+	w.put(influxItem{point: point, average: true})
+}
+
+// writes an event or aggregate point, these are never averaged
+func (w *influxWriter) writeEvent(point *write.Point) {
+	w.put(influxItem{point: point})
+}
+
+// hands the point over to the writer goroutine without blocking. If the goroutine is busy for
+// too long, the point goes directly to the queue.
+func (w *influxWriter) put(item influxItem) {
+	// points with a wrong timestamp would end up somewhere in the past
+	if w.clockValid != nil && !w.clockValid() {
+		if n := atomic.AddInt64(&w.held, 1); n == 1 || n%100 == 0 {
+			logger.Warnf("Clock is not plausible, %d points not written", n)
+		}
+		return
+	}
+	select {
+	case w.points <- item:
+		return
+	default:
+	}
+	if w.queue != nil {
+		w.enqueue(item.point)
+		return
+	}
+	if n := atomic.AddInt64(&w.dropped, 1); n == 1 || n%100 == 0 {
+		logger.Warnf("InfluxDB writer is busy, %d points dropped", n)
+	}
+}
+
+// writes the points of the channel, runs as goroutine
+func (w *influxWriter) run() {
+	for item := range w.points {
+		points := []*write.Point{item.point}
+		if item.average && w.downsampler != nil {
+			points = w.downsampler.add(item.point)
+		}
+		w.collect(points...)
+	}
+}
+
+func (w *influxWriter) collect(points ...*write.Point) {
+	if w.batch <= 0 {
+		w.send(points...)
+		return
+	}
+	w.pending = append(w.pending, points...)
+	if time.Since(w.lastFlush) >= w.batch {
+		w.send(w.pending...)
+		w.pending = nil
+		w.lastFlush = time.Now()
+	}
+}
+
+func (w *influxWriter) send(points ...*write.Point) {
+	if len(points) == 0 {
+		return
+	}
+	// keep the order: as long as there are queued points, new points are queued as well
+	if w.queue != nil && w.queue.Len() > 0 {
+		w.enqueue(points...)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), WRITE_TIMEOUT)
+	defer cancel()
+	err := w.writeAPI.WritePoint(ctx, points...)
+	w.setReachable(err == nil)
+	if err != nil {
+		logger.Error(err)
+		w.enqueue(points...)
+	}
+}
+
+func (w *influxWriter) setReachable(ok bool) {
+	var failed int32
+	if !ok {
+		failed = 1
+	}
+	atomic.StoreInt32(&w.failed, failed)
+}
+
+// returns false if the last write failed, the points are queued until InfluxDB is reachable again
+func (w *influxWriter) reachable() bool {
+	return atomic.LoadInt32(&w.failed) == 0
+}
+
+func (w *influxWriter) enqueue(points ...*write.Point) {
+	if w.queue == nil {
+		return
+	}
+	lines := make([]string, 0, len(points))
+	for _, p := range points {
+		lines = append(lines, write.PointToLineProtocol(p, time.Nanosecond))
+	}
+	if err := w.queue.Push(lines...); err != nil {
+		logger.Errorf("Couldn't queue points: %s", err)
+		return
+	}
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// writes the queued points with an exponential backoff in case of errors
+func (w *influxWriter) retry() {
+	delay := RETRY_MIN_DELAY
+	for {
+		keys, lines, err := w.queue.Peek(QUEUE_BATCH)
+		if err != nil {
+			logger.Errorf("Couldn't read queue: %s", err)
+		}
+		if len(lines) == 0 {
+			delay = RETRY_MIN_DELAY
+			<-w.notify
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), WRITE_TIMEOUT)
+		err = w.writeAPI.WriteRecord(ctx, lines...)
+		cancel()
+		w.setReachable(err == nil)
+		if err != nil {
+			logger.Warnf("Writing %d queued points failed, next try in %s: %s", len(lines), delay, err)
+			time.Sleep(delay)
+			delay *= 2
+			if delay > RETRY_MAX_DELAY {
+				delay = RETRY_MAX_DELAY
+			}
+			continue
+		}
+		if err = w.queue.Remove(keys); err != nil {
+			logger.Errorf("Couldn't remove points from queue: %s", err)
+		}
+		logger.Infof("Wrote %d queued points, %d remaining", len(lines), w.queue.Len())
+		delay = RETRY_MIN_DELAY
+	}
+}
+
+// writes the points of the measurements and the decisions of the events (as points dp_event),
+// should be started as goroutine
+func (c *Controller) writeInflux(events <-chan Event) {
+	for e := range events {
+		switch {
+		case e.Type == EVENT_MEASUREMENT:
+			start := time.Now()
+			for _, p := range e.Points {
+				c.influx.write(p)
+			}
+			c.timing.measure(PART_INFLUX, start)
+		case e.Type == EVENT_DECISION && e.Decision != nil:
+			c.influx.writeDecision(e.Decision, e.Time, c.cfg.DryRun)
+		}
+	}
+}
+
+// writes a decision as point dp_event
+func (w *influxWriter) writeDecision(d *Decision, t time.Time, dryRun bool) {
+	tags := map[string]string{
+		"reason": d.Reason,
+		"source": d.Source,
+	}
+	if dryRun {
+		tags["dry_run"] = "true"
+	}
+	if d.Maintenance {
+		tags["maintenance"] = "true"
+	}
+	w.writeEvent(write.NewPoint("dp_event", tags,
+		map[string]interface{}{
+			"venting":         boolToInt(d.Venting),
+			"fan_status":      boolToInt(d.FanStatus),
+			"remote_override": d.RemoteOverride,
+			"delta_dp":        d.DeltaDewPoint,
+		},
+		t))
+}
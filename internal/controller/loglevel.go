@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	d2r2log "github.com/d2r2/go-logger"
+)
+
+const DEF_DEBUG_MINUTES = 30
+
+// the values of every cycle aren't logged at level info in the low-write mode of the log
+var quietCycles bool
+
+// LogLevelResponse is the current log level
+type LogLevelResponse struct {
+	Level string `json:"level"`
+	Until string `json:"until,omitempty"`
+}
+
+// logLevelControl raises the log level temporarily for troubleshooting
+type logLevelControl struct {
+	mu    sync.Mutex
+	timer *time.Timer
+	until time.Time
+}
+
+// sets the level, it drops back to info after d
+func (c *logLevelControl) set(lvl int, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.until = time.Time{}
+	applyLogLevel(lvl)
+	logger.Infof("Log level set to %s", logger.LevelName(lvl))
+	if lvl != logger.LevelInfo && d > 0 {
+		c.until = time.Now().Add(d)
+		c.timer = time.AfterFunc(d, func() {
+			c.set(logger.LevelInfo, 0)
+		})
+	}
+}
+
+// switches between debug and info, e.g. by a long press of the button
+func (c *logLevelControl) toggleDebug() {
+	if logger.GetLevel() == logger.LevelDebug {
+		c.set(logger.LevelInfo, 0)
+	} else {
+		c.set(logger.LevelDebug, DEF_DEBUG_MINUTES*time.Minute)
+	}
+}
+
+func (c *logLevelControl) response() LogLevelResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := LogLevelResponse{Level: logger.LevelName(logger.GetLevel())}
+	if !c.until.IsZero() {
+		r.Until = c.until.Format(DATE_TIME_FORMAT)
+	}
+	return r
+}
+
+// sets the level of the log and the package loggers of the sensors and the cycles
+func applyLogLevel(lvl int) {
+	logger.SetLevel(lvl)
+	sensorLevel := d2r2log.InfoLevel
+	if quietCycles {
+		sensorLevel = d2r2log.WarnLevel
+	}
+	cycleLevel := sensorLevel
+	dhtLevel := d2r2log.ErrorLevel
+	if lvl == logger.LevelDebug {
+		sensorLevel = d2r2log.DebugLevel
+		cycleLevel = d2r2log.DebugLevel
+		dhtLevel = d2r2log.DebugLevel
+	}
+	_ = d2r2log.ChangePackageLogLevel("sensor", sensorLevel)
+	_ = d2r2log.ChangePackageLogLevel("controller", cycleLevel)
+	_ = d2r2log.ChangePackageLogLevel("dht", dhtLevel)
+}
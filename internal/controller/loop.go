@@ -0,0 +1,636 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+
+	"github.com/aluedtke7/dew_point_fan/internal/actuator"
+	"github.com/aluedtke7/dew_point_fan/internal/i18n"
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"github.com/aluedtke7/dew_point_fan/internal/sensor"
+	"github.com/aluedtke7/dew_point_fan/internal/shutdown"
+	"github.com/aluedtke7/dew_point_fan/internal/storage"
+	"github.com/aluedtke7/dew_point_fan/internal/version"
+)
+
+// publishes a line of the main page, the display is a subscriber of the event bus
+func (c *Controller) printLine(line int, text string, scroll bool) {
+	c.events.publish(Event{Type: EVENT_DISPLAY, Display: &DisplayLine{Line: line, Text: strings.TrimSpace(text), Scroll: scroll}})
+}
+
+// shows the lines of the display events on the main page
+func (c *Controller) runDisplay(events <-chan Event) {
+	for e := range events {
+		if e.Type != EVENT_DISPLAY || e.Display == nil {
+			continue
+		}
+		start := time.Now()
+		c.screen.PrintMain(e.Display.Line, e.Display.Text, e.Display.Scroll)
+		c.timing.measure(PART_DISPLAY, start)
+	}
+}
+
+// shows the address, the heartbeat, the source and the fan state with the template of display.status
+func (c *Controller) showStatusLine(fan string, isAlive bool, source string) {
+	width := c.cfg.Display.Width
+	if width <= 0 {
+		width = c.screen.Width()
+	}
+	c.printLine(3, c.statusLine.render(c.statusValues(fan, isAlive, source), width), false)
+}
+
+// returns true, if the sensors of a redundant sensor differ more than allowed
+func diverged(sensors []sensor.Sensor) bool {
+	for _, s := range sensors {
+		if d, ok := s.(sensor.Diverger); ok && d.Diverged() {
+			return true
+		}
+	}
+	return false
+}
+
+// Run starts the background tasks and runs the measurement loop, it never returns
+func (c *Controller) Run() {
+	cfg := c.cfg
+	// the display and InfluxDB must not lose events, the other subscribers get the current state
+	// with the next events
+	displayEvents := c.events.subscribeQueued("display")
+	shutdown.Go(func() { c.runDisplay(displayEvents) })
+	c.printLine(0, i18n.T("Starting..."), false)
+	c.printLine(1, i18n.T("Version")+" "+version.Short(), false)
+	c.showStatusLine("", false, SOURCE_AUTO)
+
+	// a panic of a background task switches the fan to the safe state, too
+	shutdown.Go(c.weather.poll)
+	shutdown.Go(c.clock.run)
+	shutdown.Go(c.watchNetwork)
+	shutdown.Go(func() { c.watchdog.run(c.lastCycleTime) })
+	shutdown.Go(c.watchLoop)
+	shutdown.Go(func() { c.switchIn.watch(c.onSwitchChange) })
+	shutdown.Go(c.tacho.count)
+	if c.indicators.enabled() {
+		indicatorEvents := c.events.subscribe("indicators", 16)
+		shutdown.Go(func() { c.indicators.run(indicatorEvents) })
+	}
+	influxEvents := c.events.subscribeQueued("influx")
+	shutdown.Go(func() { c.writeInflux(influxEvents) })
+	if c.mqtt != nil {
+		mqttEvents := c.events.subscribe("mqtt", 16)
+		shutdown.Go(func() { c.mqtt.run(mqttEvents, c.Peer) })
+	}
+	if cfg.Hooks.enabled() {
+		hookEvents := c.events.subscribeQueued("hooks")
+		shutdown.Go(func() { c.runHooks(cfg.Hooks, hookEvents) })
+	}
+	shutdown.Go(c.tacho.measure)
+	shutdown.Go(c.purger.Run)
+	for _, b := range c.buttons {
+		b := b
+		shutdown.Go(func() {
+			b.watch(func(action string) error {
+				return c.ActionBy(action, VIA_BUTTON, "")
+			})
+		})
+	}
+	shutdown.Go(func() {
+		c.screen.Rotate(time.Duration(cfg.Display.RotateEvery)*time.Second, time.Duration(cfg.Display.PageTime)*time.Second)
+	})
+	shutdown.Go(func() { c.alerts.watchCycles(c.lastCycleTime) })
+	shutdown.Go(func() { runDailySummary(cfg.Notify, c.stats, c.energy, c.runtime, c.clock) })
+
+	// initial value for fan fanShouldBeOn is the persisted state of the last run
+	fanShouldBeOn := c.live.Venting
+	// venting state of the automatic control, without any overrides
+	autoVenting := fanShouldBeOn
+	// last value of fanShouldBeOn state to detect changes for logging purpose
+	lastfanShouldBeOn := fanShouldBeOn
+	frostActive := false
+	paused := false
+	lockout := ""
+	// during the warm-up the sensor readings are collected, but the automatic control keeps its state
+	warmupUntil := time.Now().Add(time.Duration(cfg.Warmup) * time.Second)
+	logger.Infof("Warm-up for %ds, initial venting state is %t", cfg.Warmup, fanShouldBeOn)
+
+	// initial off value for manual fanIsOn (3 state switch)
+	fanStatus := false
+	plugFailed := false
+	lastFanStatus := false // to detect changes and log them
+	lastSensorsFailed := false
+	firstCycle := true
+	lastRemoteOverride := 0
+	isAlive := false
+	source := SOURCE_AUTO
+
+	sensors := c.sensors
+	var purging = []bool{false, false}
+	var temperatures = []float32{DEF_TEMP, DEF_TEMP}
+	var humidities = []float32{DEF_HUM, DEF_HUM}
+	var dewpoints = []float32{0.0, 0.0}
+	spikes := []*spikeFilter{newSpikeFilter(cfg.Sensors[0]), newSpikeFilter(cfg.Sensors[1])}
+	var retried = []int{0, 0}
+	var venting = "---"
+	var fanIsOn = "---"
+	var reason = REASON_STARTUP
+	var deltaTP float32
+	var err error
+	lastPrune := time.Time{}
+	// a ticker keeps the cycle period constant, independent of the time the sensor reads take
+	ticker := time.NewTicker(CYCLE_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		c.timing.begin(time.Now())
+		readingsGood := true
+		var point *write.Point
+		// the points of the main zone and the additional zones, written with the measurement event
+		var points []*write.Point
+		var pluginMetrics map[string]float64
+		location := ""
+		purgeActive := false
+		// the read of a sensor hangs, the driver or the bus won't recover by itself
+		sensorHung := false
+		// reading errors of the sensors, shown in /info and shared with peers
+		sensorErrors := []string{"", ""}
+		for i := 0; i < len(sensors); i++ {
+			if i == 0 {
+				location = "I"
+			} else {
+				location = "O"
+			}
+			// readings are suppressed during and shortly after a heater purge
+			purging[i] = c.purger.Purging(sensors[i])
+			if purging[i] {
+				c.raw.purging(sensors[i].Name(), time.Now())
+				c.printLine(i, fmt.Sprintf("%s: %s", location, i18n.T("heater purge")), false)
+				readingsGood = false
+				purgeActive = true
+				continue
+			}
+			// Read sensor data, retrying several times in case of failure.
+			c.setStage("reading sensor " + sensors[i].Name())
+			// a failed reading keeps the last values, the sensors return zeros in this case
+			var t, h float32
+			readStart := time.Now()
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Sensors[i].ReadTimeout())
+			t, h, retried[i], err = sensor.ReadContext(ctx, sensors[i])
+			cancel()
+			c.timing.measure(PART_SENSORS, readStart)
+			c.readStats.record(sensors[i].Name(), retried[i], err)
+			c.health.record(time.Now(), sensors[i].Name(), retried[i], err != nil)
+			c.raw.record(cfg.Sensors[i], sensors[i].Name(), readStart, t, h, retried[i], err)
+			if err != nil {
+				c.printLine(i, fmt.Sprintf("%s: %s %d", location, i18n.T("retried"), retried[i]), false)
+				readingsGood = false
+				sensorErrors[i] = err.Error()
+				sensorHung = sensorHung || err == sensor.ErrHung
+			} else {
+				logger.Debugf("Sensor %s: %.1f°C %.1f%%, %d retries", sensors[i].Name(), t, h, retried[i])
+				t, h = cfg.Sensors[i].Correct(t, h)
+				temperatures[i] = roundFloat32(t, 1)
+				humidities[i] = roundFloat32(h, 1)
+				// print temperature and humidity on LCD, a '!' marks a degraded sensor
+				sep := "-"
+				if c.health.get(sensors[i].Name()).Degraded {
+					sep = "!"
+				}
+				c.printLine(i, fmt.Sprintf("%s%sT:%5.1fC H:%5.1f%%", location, sep, temperatures[i], humidities[i]), false)
+			}
+			if temperatures[i] > DEF_TEMP && humidities[i] > DEF_HUM {
+				if temperatures[i] < -20 || temperatures[i] > 40 {
+					logger.Warnf("%s: temperature is out of range: %5.1f°C", location, temperatures[i])
+					readingsGood = false
+					sensorErrors[i] = "temperature is out of range"
+				} else {
+					dewpoints[i] = roundFloat32(calcDewPoint(temperatures[i], humidities[i]), 1)
+					logger.Infof("%s: Dewpoint =%5.1f, Temperature =%5.1f°C, Humidity =%5.1f%% (retried %d times)",
+						location, dewpoints[i], temperatures[i], humidities[i], retried[i])
+					if err == nil {
+						c.stats.addReading(time.Now(), sensors[i].Name(), temperatures[i], humidities[i])
+					}
+				}
+			}
+		}
+		if readingsGood {
+			// check for spike/false values and skip them
+			spike := false
+			for i := range spikes {
+				if !spikes[i].plausible(time.Now(), temperatures[i], humidities[i]) {
+					spike = true
+				}
+			}
+			if spike {
+				reason = REASON_SPIKE
+			} else if time.Now().Before(warmupUntil) {
+				deltaTP = dewpoints[0] - dewpoints[1]
+				reason = REASON_WARMUP
+			} else {
+				deltaTP = dewpoints[0] - dewpoints[1]
+				lastAutoVenting := autoVenting
+				limits, hysteresis := c.limits.get(), c.hysteresis.update(time.Now())
+				c.predictor.add(time.Now(), deltaTP)
+				autoVenting, reason = c.strategy.Decide(autoVenting, StrategyInput{
+					Now:         time.Now(),
+					ClockValid:  c.clock.plausible(),
+					TempInside:  temperatures[0],
+					TempOutside: temperatures[1],
+					HumInside:   humidities[0],
+					HumOutside:  humidities[1],
+					DeltaTP:     deltaTP,
+					Hysteresis:  hysteresis,
+					Limits:      limits,
+				})
+				// the prediction is based on the dew point difference
+				if c.strategy.Name() == STRATEGY_DEW_POINT {
+					autoVenting, reason = c.predictor.adjust(lastAutoVenting, autoVenting, reason, limits, deltaTP, hysteresis)
+				}
+				autoVenting, reason, pluginMetrics = c.plugins.adjust(pluginInput{
+					now:             time.Now(),
+					tempInside:      temperatures[0],
+					tempOutside:     temperatures[1],
+					humInside:       humidities[0],
+					humOutside:      humidities[1],
+					dewPointInside:  dewpoints[0],
+					dewPointOutside: dewpoints[1],
+					venting:         autoVenting,
+					reason:          reason,
+				})
+				if autoVenting != lastAutoVenting {
+					c.hysteresis.recordSwitch(time.Now())
+				}
+				if autoVenting {
+					venting = i18n.T("on")
+				} else {
+					venting = i18n.T("off")
+				}
+				c.printLine(2, fmt.Sprintf("DP:%5.1fC %5.1fC %s", dewpoints[0], dewpoints[1], venting), false)
+
+				// prepare data for InfuxDb and send it
+				tags := map[string]string{
+					"version": version.Short(),
+					// "manual_override": strconv.FormatBool(fanStatus),
+					// "remote_override": strconv.Itoa(remoteOverride),
+					// "venting":         strconv.FormatBool(fanShouldBeOn),
+				}
+				fields := map[string]interface{}{
+					"temp_i":     temperatures[0],
+					"temp_o":     temperatures[1],
+					"dewpoint_i": dewpoints[0],
+					"dewpoint_o": dewpoints[1],
+					"hum_i":      humidities[0],
+					"hum_o":      humidities[1],
+					"retry_i":    retried[0],
+					"retry_o":    retried[1],
+					"vent_val":   boolToInt(autoVenting),
+				}
+				if cfg.DryRun {
+					tags["dry_run"] = "true"
+				}
+				if len(c.zones) > 0 {
+					tags["zone"] = ZONE_MAIN
+				}
+				point = write.NewPoint("dp", tags, fields, time.Now())
+			}
+		} else if purgeActive {
+			reason = REASON_SENSOR_PURGE
+		} else if sensorHung {
+			// the fan doesn't keep its last state, until the sensor is fixed
+			autoVenting = cfg.SafeState == SAFE_STATE_ON
+			reason = REASON_SENSOR_HUNG
+		} else {
+			reason = REASON_SENSOR_FAILURE
+		}
+
+		// an open door or window pauses the automatic venting
+		if c.contact.isOpen() != paused {
+			paused = !paused
+			logger.Infof("Door/window contact changed, automatic venting paused: %t", paused)
+		}
+		if paused {
+			autoVenting = false
+			venting = i18n.T("off")
+			reason = REASON_CONTACT_OPEN
+			c.printLine(2, fmt.Sprintf("DP:%5.1fC %5.1fC %s", dewpoints[0], dewpoints[1], i18n.T("PAU")), false)
+		} else if c.pause.remaining() > 0 {
+			// paused via the API, overrides and the boost still work
+			autoVenting = false
+			venting = i18n.T("off")
+			reason = REASON_PAUSED
+			c.printLine(2, fmt.Sprintf("DP:%5.1fC %5.1fC %s", dewpoints[0], dewpoints[1], i18n.T("PAU")), false)
+		}
+		// no venting with rainy or foggy outside air
+		if lockout = c.weather.check(); lockout != "" && !paused {
+			autoVenting = false
+			venting = i18n.T("off")
+			reason = REASON_WEATHER_LOCKOUT
+			c.printLine(2, fmt.Sprintf("DP:%5.1fC %5.1fC %s", dewpoints[0], dewpoints[1], i18n.T("LCK")), false)
+		}
+		fanShouldBeOn = autoVenting
+		boosting := false
+		if remaining := c.boost.remaining(); remaining > 0 {
+			// no boost when it's too cold, the same limits as for the automatic control apply
+			if l := c.limits.get(); temperatures[0] < l.TempInsideMin || temperatures[1] < l.TempOutsideMin {
+				logger.Warn("Boost is not possible, temperature is too low")
+				c.boost.stop()
+			} else {
+				boosting = true
+				fanShouldBeOn = true
+				reason = REASON_BOOST
+				minutes := int(math.Ceil(remaining.Minutes()))
+				if minutes > 99 {
+					minutes = 99
+				}
+				c.printLine(2, fmt.Sprintf("DP:%5.1fC %5.1fC B%02d", dewpoints[0], dewpoints[1], minutes), false)
+			}
+		}
+		remoteOverride := c.getRemoteOverride()
+		if remoteOverride > 0 {
+			reason = REASON_REMOTE_OVERRIDE
+			if remoteOverride == 1 {
+				fanShouldBeOn = true
+			} else {
+				fanShouldBeOn = false
+			}
+		}
+		// frost protection overrules everything except the hardware switch
+		if readingsGood {
+			frostActive = c.frost.update(temperatures[0])
+		}
+		if frostActive {
+			fanShouldBeOn = false
+			reason = REASON_FROST
+		}
+		// the maintenance mode overrules everything except the hardware switch, too
+		maint := c.maintenance.active()
+		if maint {
+			fanShouldBeOn = false
+			reason = REASON_MAINTENANCE
+			c.printLine(2, fmt.Sprintf("DP:%5.1fC %5.1fC %s", dewpoints[0], dewpoints[1], i18n.T("MNT")), false)
+		}
+		// here we set the value for the fan relais, the safety overrides ignore the switching rate limit
+		if frostActive || maint {
+			err = c.forceFan(false)
+		} else {
+			err = c.setFan(fanShouldBeOn)
+		}
+		if err == errSwitchSkipped {
+			logger.Warnf("Safety switch of the fan relais skipped (%s)", reason)
+		} else if err != nil {
+			logger.Error(err)
+		}
+		// the additional zones use the reading of the shared outside sensor
+		var outside *SensorData
+		if !purging[1] && sensorErrors[1] == "" {
+			outside = &SensorData{Temperature: temperatures[1], Humidity: humidities[1], DewPoint: dewpoints[1]}
+		}
+		// the maintenance mode, the frost protection and the pause stop the fans of all zones
+		zoneHold := ""
+		switch {
+		case maint:
+			zoneHold = REASON_MAINTENANCE
+		case frostActive:
+			zoneHold = REASON_FROST
+		case paused:
+			zoneHold = REASON_CONTACT_OPEN
+		case c.pause.remaining() > 0:
+			zoneHold = REASON_PAUSED
+		}
+		for _, z := range c.zones {
+			c.setStage("updating zone " + z.cfg.Name)
+			zoneStart := time.Now()
+			p := z.update(zoneStart, outside, c.limits.get(), lockout != "", c.clock.plausible(), zoneHold)
+			c.timing.measure(PART_SENSORS, zoneStart)
+			if p != nil {
+				points = append(points, p)
+			}
+			if info := z.getInfo(); info.Sensor.Name != "" && info.Sensor.Error == "" {
+				c.stats.addReading(zoneStart, info.Sensor.Name, info.Sensor.Temperature, info.Sensor.Humidity)
+			}
+		}
+
+		isAlive = !isAlive
+		// here we read the value of the fan relais, to detect a manual (switch) override
+		c.setStage("reading the hardware switch")
+		// a smart plug reports its actual state instead
+		if isOn, err := c.relay.actual(); err == actuator.ErrNoFeedback {
+			fanStatus = c.switchIn.read()
+		} else if err != nil {
+			if !plugFailed {
+				logger.Warnf("Couldn't read the state of the smart plug: %s", err)
+				plugFailed = true
+			}
+		} else {
+			fanStatus, plugFailed = isOn, false
+		}
+		if fanStatus {
+			fanIsOn = i18n.T("ON ")
+		} else {
+			fanIsOn = i18n.T("OFF")
+		}
+		// the feedback is compared with the state of the relais, not the decision (e.g. a skipped
+		// switch operation), in a dry run the relais isn't driven at all
+		switched := !cfg.DryRun && c.fanCommandedOn() != fanStatus
+		source = activeSource(switched, remoteOverride, boosting, frostActive, maint)
+		if source == SOURCE_SWITCH {
+			reason = REASON_HARDWARE_SWITCH
+		}
+		c.showStatusLine(fanIsOn, isAlive, source)
+		// the relais can't be checked in a dry run
+		mismatch, mismatchChanged := c.mismatch.update(time.Now(), c.fanCommandedOn() && !cfg.DryRun, fanStatus)
+		if mismatchChanged {
+			if mismatch {
+				logger.Warnf("Relais mismatch: the fan should be on, but the feedback is off for %ds", cfg.Feedback.Grace)
+			} else {
+				logger.Info("Relais mismatch resolved")
+			}
+			c.influx.writeEvent(write.NewPoint("dp_mismatch", map[string]string{},
+				map[string]interface{}{
+					"mismatch": boolToInt(mismatch),
+				},
+				time.Now()))
+		}
+		// a running fan that doesn't turn (seized fan, broken belt)
+		stalled, stalledChanged := c.stall.update(time.Now(), c.tacho.enabled() && fanStatus, c.tacho.speed() >= cfg.Tacho.MinRpm)
+		if stalledChanged {
+			if stalled {
+				logger.Warnf("Fan stalled: %d rpm", c.tacho.speed())
+			} else {
+				logger.Info("Fan is turning again")
+			}
+		}
+		wifi := c.wifi.update()
+		if point != nil {
+			point.AddTag("source", source)
+			if maint {
+				point.AddTag("maintenance", "true")
+			}
+			point.AddField("mismatch", boolToInt(mismatch))
+			if c.tacho.enabled() {
+				point.AddField("rpm", c.tacho.speed())
+			}
+			if wifi != nil {
+				point.AddField("rssi", wifi.Rssi)
+			}
+			// durations of the previous cycle
+			point.AddField("cycle_ms", c.timing.lastPart(PART_TOTAL).Milliseconds())
+			point.AddField("read_ms", c.timing.lastPart(PART_SENSORS).Milliseconds())
+			// the metrics of the plugins can't overwrite the fields of the control
+			core := map[string]bool{}
+			for _, f := range point.FieldList() {
+				core[f.Key] = true
+			}
+			c.plugins.dropCollisions(pluginMetrics, core)
+			for name, v := range pluginMetrics {
+				point.AddField(name, v)
+			}
+			points = append(points, point)
+		}
+		if fanStatus != lastFanStatus || firstCycle {
+			c.events.publish(Event{Type: EVENT_FAN, Active: fanStatus})
+		}
+		if sensorsFailed := !readingsGood && !purgeActive; sensorsFailed != lastSensorsFailed {
+			c.events.publish(Event{Type: EVENT_SENSORS, Active: sensorsFailed})
+			lastSensorsFailed = sensorsFailed
+		}
+		if fanShouldBeOn != lastfanShouldBeOn || fanStatus != lastFanStatus || remoteOverride != lastRemoteOverride {
+			logger.Infof("Venting change: new state is %t (%s), fan status %t, remote fanIsOn %d, source %s",
+				fanShouldBeOn, reason, fanStatus, remoteOverride, source)
+			dec := Decision{
+				Time:           time.Now().Format(DATE_TIME_FORMAT),
+				Venting:        fanShouldBeOn,
+				FanStatus:      fanStatus,
+				RemoteOverride: remoteOverride,
+				Reason:         reason,
+				Source:         source,
+				DeltaDewPoint:  roundFloat32(deltaTP, 1),
+				Maintenance:    maint,
+			}
+			c.decisions.add(dec)
+			c.events.publish(Event{Type: EVENT_DECISION, Decision: &dec})
+		}
+		if fanShouldBeOn != lastfanShouldBeOn {
+			if cfg.DryRun {
+				logger.Infof("Dry run: venting would be switched to %t (%s)", fanShouldBeOn, reason)
+			} else {
+				c.state.update(func(st *persistentState) {
+					st.Venting = fanShouldBeOn
+				})
+			}
+		}
+		retryRate, failureRate, degraded := c.health.worst()
+		c.alerts.check(time.Now(), alertInput{
+			readingsGood:    readingsGood,
+			purging:         purgeActive,
+			tempInside:      temperatures[0],
+			tempOutside:     temperatures[1],
+			humInside:       humidities[0],
+			humOutside:      humidities[1],
+			dewPointInside:  dewpoints[0],
+			dewPointOutside: dewpoints[1],
+			fanShouldBeOn:   fanShouldBeOn,
+			fanStatus:       fanStatus,
+			mismatch:        mismatch,
+			rpm:             c.tacho.speed(),
+			relayWear:       c.relay.serviceDue(),
+			stalled:         stalled,
+			boosting:        boosting,
+			frost:           frostActive,
+			paused:          paused,
+			lockout:         lockout != "",
+			maintenance:     maint,
+			retryRate:       retryRate,
+			failureRate:     failureRate,
+			degraded:        degraded,
+			wifi:            wifi,
+			diverged:        diverged(sensors),
+			actuatorFailed:  c.relay.failures().Failed,
+		})
+		c.runtime.update(time.Now(), fanStatus)
+		c.progress.update(time.Now(), readingsGood, autoVenting, fanStatus,
+			calcAbsHumidity(temperatures[0], humidities[0]), calcAbsHumidity(temperatures[1], humidities[1]))
+		if p := c.energy.update(time.Now(), fanStatus); p != nil {
+			c.influx.writeEvent(p)
+		}
+		if day := c.stats.update(time.Now(), fanStatus, readingsGood, humidities[0], deltaTP,
+			calcAbsHumidity(temperatures[0], humidities[0]), calcAbsHumidity(temperatures[1], humidities[1])); day != nil {
+			logger.Infof("Statistics of %s: fan runtime %.0f min, %d cycles", day.Date, day.RuntimeMinutes, day.SwitchCycles)
+			c.influx.writeEvent(dayStatsPoint(day))
+			for _, p := range sensorDayPoints(day) {
+				c.influx.writeEvent(p)
+			}
+		}
+		if c.store != nil {
+			now := time.Now()
+			c.setStage("storing the history")
+			err = c.store.Add(storage.Record{
+				Time:            now,
+				Valid:           readingsGood,
+				TempInside:      temperatures[0],
+				TempOutside:     temperatures[1],
+				HumInside:       humidities[0],
+				HumOutside:      humidities[1],
+				DewPointInside:  dewpoints[0],
+				DewPointOutside: dewpoints[1],
+				Venting:         fanShouldBeOn,
+				FanStatus:       fanStatus,
+				Source:          source,
+				Maintenance:     maint,
+			})
+			if err != nil {
+				logger.Error(err)
+				c.events.publish(Event{Type: EVENT_ERROR, Error: err.Error()})
+			}
+			if now.Sub(lastPrune) > time.Hour {
+				if n, err := c.store.Prune(now); err != nil {
+					logger.Error(err)
+				} else if n > 0 {
+					logger.Infof("Removed %d records from local history", n)
+				}
+				lastPrune = now
+			}
+		}
+		lastfanShouldBeOn = fanShouldBeOn
+		lastFanStatus = fanStatus
+		firstCycle = false
+		lastRemoteOverride = remoteOverride
+		logger.Infof("Fan is %s - %s", venting, fanIsOn)
+
+		c.mu.Lock()
+		c.live = Info{
+			Update: time.Now().Format(DATE_TIME_FORMAT),
+			Sensors: []SensorData{
+				{Name: sensors[0].Name(), Temperature: temperatures[0], Humidity: humidities[0], DewPoint: dewpoints[0], Purging: purging[0], Error: sensorErrors[0]},
+				{Name: sensors[1].Name(), Temperature: temperatures[1], Humidity: humidities[1], DewPoint: dewpoints[1], Purging: purging[1], Error: sensorErrors[1]},
+			},
+			Venting:   fanShouldBeOn,
+			FanStatus: fanStatus,
+			Override:  fanShouldBeOn != fanStatus,
+			Source:    source,
+			Frost:     frostActive,
+			Mismatch:  mismatch,
+			Stalled:   stalled,
+			Paused:    paused,
+			Lockout:   lockout,
+
+			PluginMetrics: pluginMetrics,
+		}
+		for i, s := range sensors {
+			c.live.Sensors[i].Degraded = c.health.get(s.Name()).Degraded
+			if m, ok := s.(sensor.MetaReporter); ok {
+				meta := m.Meta()
+				c.live.Sensors[i].Meta = &meta
+			}
+		}
+		c.mu.Unlock()
+		atomic.StoreInt64(&c.lastCycle, time.Now().UnixNano())
+		c.events.publish(Event{Type: EVENT_MEASUREMENT, Info: c.Info(), Points: points})
+		c.timing.end(time.Now(), CYCLE_INTERVAL)
+		c.setStage("sleeping")
+		<-ticker.C
+	}
+}
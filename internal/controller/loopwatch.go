@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"github.com/aluedtke7/dew_point_fan/internal/shutdown"
+)
+
+const (
+	CYCLE_INTERVAL    = 15 * time.Second
+	LOOP_ACTION_LOG   = "log"
+	LOOP_ACTION_EXIT  = "exit"
+	LOOP_STACK_BUFFER = 1 << 20
+)
+
+type loopWatchConfig struct {
+	Factor int    `json:"factor"` // the loop is stuck, when no cycle was completed within factor × cycle interval
+	Action string `json:"action"` // "log" or "exit" (the service manager restarts the program)
+}
+
+// stores the step the main loop is currently executing, for the diagnostics of a stuck loop
+func (c *Controller) setStage(stage string) {
+	c.stage.Store(stage)
+}
+
+func (c *Controller) currentStage() string {
+	if s, ok := c.stage.Load().(string); ok {
+		return s
+	}
+	return "unknown"
+}
+
+// detects a main loop that doesn't complete its cycles anymore (e.g. a wedged sensor read),
+// should be started as goroutine
+func (c *Controller) watchLoop() {
+	cfg := c.cfg.LoopWatch
+	if cfg.Factor <= 0 {
+		return
+	}
+	limit := time.Duration(cfg.Factor) * CYCLE_INTERVAL
+	reported := false
+	for {
+		time.Sleep(CYCLE_INTERVAL)
+		since := time.Since(c.lastCycleTime())
+		if since < limit {
+			reported = false
+			continue
+		}
+		if reported {
+			continue
+		}
+		reported = true
+		buf := make([]byte, LOOP_STACK_BUFFER)
+		buf = buf[:runtime.Stack(buf, true)]
+		logger.Errorf("Main loop stuck for %.0f s while '%s', goroutines:\n%s",
+			since.Seconds(), c.currentStage(), buf)
+		if cfg.Action == LOOP_ACTION_EXIT {
+			logger.Error("Exiting because of the stuck main loop")
+			shutdown.Run()
+			os.Exit(2)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+const (
+	DEF_MAINTENANCE_MINUTES = 120
+	REASON_MAINTENANCE      = "maintenance"
+)
+
+type maintenanceConfig struct {
+	Minutes int `json:"minutes"` // the maintenance mode ends automatically after this time
+}
+
+// MaintenanceResponse is the state of the maintenance mode
+type MaintenanceResponse struct {
+	Active    bool   `json:"active"`
+	Remaining int    `json:"remaining"` // remaining time in s
+	Until     string `json:"until,omitempty"`
+}
+
+// maintenance forces the fan off while working at it (e.g. cleaning), it survives a restart
+// and expires automatically, so the control isn't forgotten afterwards
+type maintenance struct {
+	mu    sync.Mutex
+	until time.Time
+	state *stateStore
+}
+
+func newMaintenance(state *stateStore) *maintenance {
+	m := &maintenance{state: state}
+	if until, err := time.ParseInLocation(DATE_TIME_FORMAT, state.get().MaintenanceUntil, time.Local); err == nil &&
+		time.Until(until) > 0 {
+		m.until = until
+		logger.Infof("Maintenance mode active until %s", state.get().MaintenanceUntil)
+	}
+	return m
+}
+
+func (m *maintenance) start(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.until = time.Now().Add(d)
+	m.persist()
+	logger.Infof("Maintenance mode started for %s, the fan is forced off", d)
+}
+
+func (m *maintenance) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.until.IsZero() {
+		logger.Info("Maintenance mode ended")
+	}
+	m.until = time.Time{}
+	m.persist()
+}
+
+func (m *maintenance) persist() {
+	until := ""
+	if !m.until.IsZero() {
+		until = m.until.Format(DATE_TIME_FORMAT)
+	}
+	m.state.update(func(st *persistentState) {
+		st.MaintenanceUntil = until
+	})
+}
+
+// returns the remaining time of the maintenance mode, 0 if it isn't active
+func (m *maintenance) remaining() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := time.Until(m.until)
+	if r < 0 {
+		return 0
+	}
+	return r
+}
+
+// called every cycle, ends an expired maintenance mode and returns true while it's active
+func (m *maintenance) active() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.until.IsZero() {
+		return false
+	}
+	if time.Until(m.until) > 0 {
+		return true
+	}
+	logger.Info("Maintenance mode expired, automatic control resumed")
+	m.until = time.Time{}
+	m.persist()
+	return false
+}
+
+func (m *maintenance) response() MaintenanceResponse {
+	m.mu.Lock()
+	until := m.until
+	m.mu.Unlock()
+	r := time.Until(until)
+	if r <= 0 {
+		return MaintenanceResponse{}
+	}
+	return MaintenanceResponse{Active: true, Remaining: int(r.Seconds()), Until: until.Format(DATE_TIME_FORMAT)}
+}
+
+// StartMaintenance forces the fan off for the given minutes, 0 for the configured default
+func (c *Controller) StartMaintenance(minutes int) (MaintenanceResponse, error) {
+	if minutes == 0 {
+		minutes = c.cfg.Maintenance.Minutes
+	}
+	if minutes < 0 || minutes > MAX_PAUSE_MINUTES {
+		return MaintenanceResponse{}, fmt.Errorf("minutes must be between 1 and %d", MAX_PAUSE_MINUTES)
+	}
+	c.maintenance.start(time.Duration(minutes) * time.Minute)
+	return c.maintenance.response(), nil
+}
+
+// StopMaintenance ends the maintenance mode
+func (c *Controller) StopMaintenance() MaintenanceResponse {
+	c.maintenance.stop()
+	return c.maintenance.response()
+}
+
+// Maintenance returns the state of the maintenance mode
+func (c *Controller) Maintenance() MaintenanceResponse {
+	return c.maintenance.response()
+}
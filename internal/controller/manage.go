@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"github.com/aluedtke7/dew_point_fan/internal/shutdown"
+)
+
+const (
+	DEF_PAUSE_MINUTES = 60
+	MAX_PAUSE_MINUTES = 7 * 24 * 60
+	REASON_PAUSED     = "paused"
+	// exit code of a restart via the API, systemd restarts the program with Restart=on-failure
+	EXIT_RESTART = 3
+)
+
+// PauseResponse is the state of the pause of the automatic control
+type PauseResponse struct {
+	Active    bool   `json:"active"`
+	Remaining int    `json:"remaining"` // remaining time in s
+	Until     string `json:"until,omitempty"`
+}
+
+// ReloadResponse is the result of reloading the config file
+type ReloadResponse struct {
+	Applied         []string `json:"applied"`          // settings that are used at once
+	RestartRequired bool     `json:"restart_required"` // other settings changed, they are used after a restart
+}
+
+// pause stops the automatic control for a limited time, e.g. while working at the device
+type pause struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+func (p *pause) start(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.until = time.Now().Add(d)
+	logger.Infof("Automatic control paused for %s", d)
+}
+
+func (p *pause) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.until.IsZero() {
+		logger.Info("Automatic control resumed")
+	}
+	p.until = time.Time{}
+}
+
+// returns the remaining time of the pause, 0 if the automatic control is active
+func (p *pause) remaining() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r := time.Until(p.until)
+	if r < 0 {
+		return 0
+	}
+	return r
+}
+
+func (p *pause) response() PauseResponse {
+	p.mu.Lock()
+	until := p.until
+	p.mu.Unlock()
+	r := time.Until(until)
+	if r <= 0 {
+		return PauseResponse{}
+	}
+	return PauseResponse{Active: true, Remaining: int(r.Seconds()), Until: until.Format(DATE_TIME_FORMAT)}
+}
+
+// Pause stops the automatic control for the given minutes (default 60), 0 resumes it
+func (c *Controller) Pause(minutes int) (PauseResponse, error) {
+	if minutes < 0 || minutes > MAX_PAUSE_MINUTES {
+		return PauseResponse{}, fmt.Errorf("minutes must be between 0 and %d", MAX_PAUSE_MINUTES)
+	}
+	if minutes == 0 {
+		c.pause.stop()
+	} else {
+		c.pause.start(time.Duration(minutes) * time.Minute)
+	}
+	return c.pause.response(), nil
+}
+
+// AccessTokens are the tokens of the API, an empty token isn't set
+type AccessTokens struct {
+	Read    string
+	Control string
+	Manage  string // the management API is disabled without
+}
+
+// TrustedProxies returns the networks of the reverse proxies, whose X-Forwarded-For header is used
+func (c *Controller) TrustedProxies() []*net.IPNet {
+	nets, err := c.cfg.Http.proxies()
+	if err != nil {
+		logger.Errorf("http: trusted_proxies: %s", err)
+	}
+	return nets
+}
+
+// AccessTokens returns the tokens of the API
+func (c *Controller) AccessTokens() AccessTokens {
+	return AccessTokens{Read: c.cfg.Http.ReadToken, Control: c.cfg.Http.ControlToken, Manage: c.cfg.Http.Token}
+}
+
+// PauseState returns the state of the pause
+func (c *Controller) PauseState() PauseResponse {
+	return c.pause.response()
+}
+
+// Restart switches the fan to the safe state and exits, the service manager starts the program again
+func (c *Controller) Restart() {
+	logger.Info("Restart requested via the API")
+	// the response is sent before
+	time.AfterFunc(500*time.Millisecond, func() {
+		shutdown.Run()
+		os.Exit(EXIT_RESTART)
+	})
+}
+
+// ReloadConfig reads the config file again. The thresholds of the automatic control are used at
+// once, other changes need a restart. An invalid file is rejected.
+func (c *Controller) ReloadConfig() (ReloadResponse, error) {
+	if c.cfg.Source == "" {
+		return ReloadResponse{}, errors.New("the configuration wasn't loaded from a file")
+	}
+	if errs := ValidateFile(c.cfg.Source); len(errs) > 0 {
+		var msgs []string
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		return ReloadResponse{}, fmt.Errorf("%s is invalid: %s", c.cfg.Source, strings.Join(msgs, "; "))
+	}
+	cfg, err := ReadConfig(c.cfg.Source)
+	if err != nil {
+		return ReloadResponse{}, err
+	}
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+	resp := ReloadResponse{Applied: []string{}}
+	if cfg.Control != c.fileCfg.Control {
+		c.limits.set(cfg.Control)
+		if err = c.hysteresis.setBase(cfg.Control.Hysteresis); err != nil {
+			return resp, err
+		}
+		resp.Applied = append(resp.Applied, "control")
+	}
+	rest := cfg
+	rest.Control = c.fileCfg.Control
+	resp.RestartRequired = !reflect.DeepEqual(rest, c.fileCfg)
+	c.fileCfg = cfg
+	logger.Infof("Config file %s reloaded, applied: %v, restart required: %t", cfg.Source, resp.Applied, resp.RestartRequired)
+	return resp, nil
+}
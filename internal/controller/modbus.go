@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"math"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"github.com/aluedtke7/dew_point_fan/internal/modbus"
+	"github.com/aluedtke7/dew_point_fan/internal/shutdown"
+)
+
+type modbusConfig struct {
+	Listen string `json:"listen"` // address of the Modbus TCP server, e.g. ":502", empty to disable
+}
+
+// registers of the Modbus TCP server, temperatures, humidities and dew points are in 1/10
+const (
+	REG_TEMP_INSIDE = iota
+	REG_HUM_INSIDE
+	REG_DP_INSIDE
+	REG_TEMP_OUTSIDE
+	REG_HUM_OUTSIDE
+	REG_DP_OUTSIDE
+	REG_VENTING
+	REG_FAN_STATUS
+	REG_OVERRIDE
+	REG_REMOTE_OVERRIDE
+	REG_BOOST // remaining time in s
+	REG_FROST
+	REG_MISMATCH
+	REG_STALLED
+	REG_PAUSED
+	REG_SENSOR_ERRORS // bit 0 inside, bit 1 outside
+	REG_RPM
+	REG_COUNT
+)
+
+// starts the Modbus TCP server, that provides the current state for building automation
+func (c *Controller) startModbus(cfg modbusConfig) {
+	if cfg.Listen == "" {
+		return
+	}
+	s, err := modbus.Listen(cfg.Listen, c.modbusRegisters)
+	if err != nil {
+		logger.Errorf("Couldn't start the Modbus TCP server: %s", err)
+		return
+	}
+	shutdown.OnExit(s.Close)
+	logger.Infof("Modbus TCP server listening on %s", cfg.Listen)
+}
+
+func (c *Controller) modbusRegisters() []uint16 {
+	inf := c.Info()
+	regs := make([]uint16, REG_COUNT)
+	tenths := func(v float32) uint16 {
+		return uint16(int16(math.Round(float64(v) * 10)))
+	}
+	flag := func(b bool) uint16 {
+		return uint16(boolToInt(b))
+	}
+	for i, s := range inf.Sensors {
+		if i > 1 {
+			break
+		}
+		regs[REG_TEMP_INSIDE+3*i] = tenths(s.Temperature)
+		regs[REG_HUM_INSIDE+3*i] = tenths(s.Humidity)
+		regs[REG_DP_INSIDE+3*i] = tenths(s.DewPoint)
+		if s.Error != "" {
+			regs[REG_SENSOR_ERRORS] |= 1 << i
+		}
+	}
+	regs[REG_VENTING] = flag(inf.Venting)
+	regs[REG_FAN_STATUS] = flag(inf.FanStatus)
+	regs[REG_OVERRIDE] = flag(inf.Override)
+	regs[REG_REMOTE_OVERRIDE] = uint16(inf.RemoteOverride)
+	regs[REG_BOOST] = uint16(inf.Boost)
+	regs[REG_FROST] = flag(inf.Frost)
+	regs[REG_MISMATCH] = flag(inf.Mismatch)
+	regs[REG_STALLED] = flag(inf.Stalled)
+	regs[REG_PAUSED] = flag(inf.Paused)
+	if inf.Rpm != nil {
+		regs[REG_RPM] = uint16(*inf.Rpm)
+	}
+	return regs
+}
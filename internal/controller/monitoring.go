@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// states of a monitoring check, the numbers of Checkmk and Nagios
+const (
+	STATE_OK = iota
+	STATE_WARN
+	STATE_CRIT
+	STATE_UNKNOWN
+)
+
+// thresholds of the checks for Checkmk and Zabbix, the alert rules are checks of their own
+type monitoringConfig struct {
+	HumWarn    float32 `json:"hum_warn"` // inside humidity in %
+	HumCrit    float32 `json:"hum_crit"`
+	MarginWarn float32 `json:"margin_warn"` // inside temperature minus inside dew point in °C
+	MarginCrit float32 `json:"margin_crit"`
+}
+
+func (m monitoringConfig) validate() []error {
+	var errs []error
+	if m.HumWarn > m.HumCrit {
+		errs = append(errs, errors.New("hum_warn must not be greater than hum_crit"))
+	}
+	if m.MarginWarn < m.MarginCrit {
+		errs = append(errs, errors.New("margin_warn must not be less than margin_crit"))
+	}
+	return errs
+}
+
+// MonitorMetric is a performance value of a check, warn and crit are omitted without thresholds
+type MonitorMetric struct {
+	Name  string   `json:"name"`
+	Value float64  `json:"value"`
+	Warn  *float64 `json:"warn,omitempty"`
+	Crit  *float64 `json:"crit,omitempty"`
+}
+
+// MonitorCheck is a service of Checkmk or an item of the Zabbix discovery
+type MonitorCheck struct {
+	Name    string          `json:"name"`
+	State   int             `json:"state"` // 0 OK, 1 WARN, 2 CRIT, 3 UNKNOWN
+	Text    string          `json:"text"`
+	Metrics []MonitorMetric `json:"metrics,omitempty"`
+}
+
+// StateName returns OK, WARN, CRIT or UNKNOWN
+func (m MonitorCheck) StateName() string {
+	if m.State < STATE_OK || m.State > STATE_UNKNOWN {
+		return "UNKNOWN"
+	}
+	return []string{"OK", "WARN", "CRIT", "UNKNOWN"}[m.State]
+}
+
+func metric(name string, value float32, levels ...float32) MonitorMetric {
+	m := MonitorMetric{Name: name, Value: roundFloat64(float64(value), 2)}
+	if len(levels) == 2 {
+		warn, crit := float64(levels[0]), float64(levels[1])
+		m.Warn, m.Crit = &warn, &crit
+	}
+	return m
+}
+
+// returns the state of a value with upper levels
+func upperState(v, warn, crit float32) int {
+	switch {
+	case v >= crit:
+		return STATE_CRIT
+	case v >= warn:
+		return STATE_WARN
+	}
+	return STATE_OK
+}
+
+// MonitorChecks returns the checks of the controller, the sensors, the inside air and the alert
+// rules, e.g. for the local checks of Checkmk or the low-level discovery of Zabbix
+func (c *Controller) MonitorChecks() []MonitorCheck {
+	inf := c.Info()
+	m := c.cfg.Monitoring
+	var checks []MonitorCheck
+
+	age := time.Since(c.lastCycleTime())
+	cycle := MonitorCheck{Name: "controller", Text: fmt.Sprintf("Last cycle %.0f s ago", age.Seconds()),
+		Metrics: []MonitorMetric{metric("cycle_age", float32(age.Seconds()))}}
+	if stuck := time.Duration(c.cfg.Notify.StuckMinutes) * time.Minute; stuck > 0 && age > stuck {
+		cycle.State = STATE_CRIT
+	} else if age > 4*CYCLE_INTERVAL {
+		cycle.State = STATE_WARN
+	}
+	checks = append(checks, cycle)
+
+	if len(inf.Sensors) < 2 {
+		return append(checks, MonitorCheck{Name: "sensors", State: STATE_UNKNOWN, Text: "No measurement yet"})
+	}
+	for _, s := range inf.Sensors {
+		ch := MonitorCheck{Name: "sensor_" + strings.ReplaceAll(strings.ToLower(s.Name), " ", "_")}
+		switch {
+		case s.Error != "":
+			ch.State, ch.Text = STATE_CRIT, s.Error
+		case s.Purging:
+			ch.Text = fmt.Sprintf("%s: heater purge", s.Name)
+		default:
+			ch.Text = fmt.Sprintf("%s: %.1f °C, %.1f %%, dew point %.1f °C", s.Name, s.Temperature, s.Humidity, s.DewPoint)
+			ch.Metrics = []MonitorMetric{metric("temperature", s.Temperature), metric("humidity", s.Humidity),
+				metric("dew_point", s.DewPoint)}
+			if s.Degraded {
+				ch.State, ch.Text = STATE_WARN, ch.Text+", retries or fails often"
+			}
+		}
+		checks = append(checks, ch)
+	}
+
+	in := inf.Sensors[0]
+	if in.Error == "" && !in.Purging {
+		margin := in.Temperature - in.DewPoint
+		hum := MonitorCheck{Name: "humidity", State: upperState(in.Humidity, m.HumWarn, m.HumCrit),
+			Text:    fmt.Sprintf("Inside humidity %.1f %%", in.Humidity),
+			Metrics: []MonitorMetric{metric("humidity", in.Humidity, m.HumWarn, m.HumCrit)}}
+		// the margin to the dew point has lower levels, the metric is written without them
+		cond := MonitorCheck{Name: "condensation", Text: fmt.Sprintf("%.1f °C above the dew point", margin),
+			Metrics: []MonitorMetric{metric("margin", margin)}}
+		switch {
+		case margin <= m.MarginCrit:
+			cond.State = STATE_CRIT
+		case margin <= m.MarginWarn:
+			cond.State = STATE_WARN
+		}
+		checks = append(checks, hum, cond)
+	}
+
+	fan := MonitorCheck{Name: "fan", Text: fmt.Sprintf("Venting %s, fan %s (%s)", onOffText(inf.Venting),
+		onOffText(inf.FanStatus), inf.Source)}
+	fan.Metrics = []MonitorMetric{metric("venting", boolValue(inf.Venting)), metric("fan", boolValue(inf.FanStatus))}
+	if inf.Rpm != nil {
+		fan.Metrics = append(fan.Metrics, metric("rpm", float32(*inf.Rpm)))
+	}
+	if inf.Maintenance > 0 {
+		fan.State, fan.Text = STATE_WARN, fan.Text+", maintenance mode"
+	}
+	checks = append(checks, fan)
+
+	for _, a := range c.alerts.states() {
+		ch := MonitorCheck{Name: "alert_" + a.Name, Text: "OK"}
+		if a.Firing {
+			ch.State, ch.Text = STATE_WARN, a.Message
+			if a.Severity == SEVERITY_ERROR {
+				ch.State = STATE_CRIT
+			}
+		}
+		checks = append(checks, ch)
+	}
+	return checks
+}
+
+func boolValue(b bool) float32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func onOffText(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"github.com/aluedtke7/dew_point_fan/internal/sensor"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+type mqttConfig struct {
+	Broker   string `json:"broker"` // e.g. "tcp://192.168.0.22:1883", empty to disable MQTT
+	ClientId string `json:"client_id"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Topic    string `json:"topic"` // base topic for all messages
+	Qos      byte   `json:"qos"`
+	Retain   bool   `json:"retain"`
+}
+
+// mqttClient publishes the readings and the fan state to an MQTT broker and receives commands
+type mqttClient struct {
+	cfg     mqttConfig
+	client  mqtt.Client
+	execute func(command, value string) error
+}
+
+// creates the client, commands are passed to execute
+func newMqttClient(cfg mqttConfig, execute func(command, value string) error) *mqttClient {
+	m := &mqttClient{cfg: cfg, execute: execute}
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientId).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(30 * time.Second).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			logger.Warnf("MQTT connection lost: %s", err)
+		}).
+		SetOnConnectHandler(func(c mqtt.Client) {
+			logger.Infof("MQTT connected to %s", cfg.Broker)
+			// subscribe again after every reconnect
+			c.Subscribe(cfg.Topic+"/set/+", cfg.Qos, m.onCommand)
+		})
+	m.client = mqtt.NewClient(opts)
+	// with ConnectRetry the client keeps trying in the background
+	m.client.Connect()
+	return m
+}
+
+func (m *mqttClient) connected() bool {
+	return m.client.IsConnectionOpen()
+}
+
+func (m *mqttClient) publish(subTopic string, payload interface{}) {
+	if !m.client.IsConnectionOpen() {
+		return
+	}
+	topic := m.cfg.Topic + "/" + subTopic
+	token := m.client.Publish(topic, m.cfg.Qos, m.cfg.Retain, payload)
+	go func() {
+		if token.WaitTimeout(10*time.Second) && token.Error() != nil {
+			logger.Errorf("MQTT publish to %s failed: %s", topic, token.Error())
+		}
+	}()
+}
+
+// publishes the complete state as JSON and every value in its own topic
+func (m *mqttClient) publishInfo(inf *Info) {
+	j, _ := json.Marshal(inf)
+	m.publish("state", j)
+	suffix := []string{"i", "o"}
+	for i, s := range inf.Sensors {
+		if i >= len(suffix) {
+			break
+		}
+		m.publish("temp_"+suffix[i], fmt.Sprintf("%.1f", s.Temperature))
+		m.publish("hum_"+suffix[i], fmt.Sprintf("%.1f", s.Humidity))
+		m.publish("dewpoint_"+suffix[i], fmt.Sprintf("%.1f", s.DewPoint))
+	}
+	m.publish("venting", strconv.FormatBool(inf.Venting))
+	m.publish("override", strconv.FormatBool(inf.Override))
+	m.publish("remote_override", strconv.Itoa(inf.RemoteOverride))
+	m.publish("source", inf.Source)
+	m.publish("boost", strconv.Itoa(inf.Boost))
+	if inf.Rpm != nil {
+		m.publish("rpm", strconv.Itoa(*inf.Rpm))
+	}
+	if inf.Wifi != nil {
+		m.publish("rssi", strconv.Itoa(inf.Wifi.Rssi))
+	}
+}
+
+// publishes the readings for other devices, that use them as peer sensors
+func (m *mqttClient) publishPeer(data sensor.PeerData) {
+	j, _ := json.Marshal(data)
+	m.publish("peer", j)
+}
+
+// publishes the values of the events with a state, the peer data after every measurement.
+// Should be started as goroutine.
+func (m *mqttClient) run(events <-chan Event, peer func() sensor.PeerData) {
+	for e := range events {
+		if e.Info == nil {
+			continue
+		}
+		m.publishInfo(e.Info)
+		if e.Type == EVENT_MEASUREMENT {
+			m.publishPeer(peer())
+		}
+	}
+}
+
+type mqttAck struct {
+	Command string `json:"command"`
+	Value   string `json:"value"`
+	Ok      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+}
+
+// handles messages on <topic>/set/<command> and publishes the result to <topic>/ack/<command>
+func (m *mqttClient) onCommand(_ mqtt.Client, msg mqtt.Message) {
+	command := msg.Topic()[strings.LastIndex(msg.Topic(), "/")+1:]
+	value := strings.TrimSpace(string(msg.Payload()))
+	logger.Infof("MQTT command %s: %s", command, value)
+	err := m.execute(command, value)
+	ack := mqttAck{Command: command, Value: value, Ok: err == nil}
+	if err != nil {
+		ack.Error = err.Error()
+		logger.Warnf("MQTT command %s failed: %s", command, err)
+	}
+	j, _ := json.Marshal(ack)
+	token := m.client.Publish(m.cfg.Topic+"/ack/"+command, m.cfg.Qos, false, j)
+	go token.WaitTimeout(10 * time.Second)
+}
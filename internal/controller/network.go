@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+// DHCP and Wi-Fi reconnects can change the addresses at any time
+const NETWORK_CHECK = 30 * time.Second
+
+// Connectivity shows at a glance why data isn't arriving upstream
+type Connectivity struct {
+	Online bool  `json:"online"`         // all of the following are ok
+	Influx bool  `json:"influx"`         // the last write to InfluxDB succeeded
+	Mqtt   *bool `json:"mqtt,omitempty"` // connected to the broker, if MQTT is configured
+	Clock  bool  `json:"clock"`          // the clock is plausible (NTP synchronized)
+}
+
+func (c *Controller) connectivity() Connectivity {
+	con := Connectivity{Influx: c.influx.reachable(), Clock: c.clock.plausible()}
+	con.Online = con.Influx && con.Clock
+	if c.mqtt != nil {
+		connected := c.mqtt.connected()
+		con.Mqtt = &connected
+		con.Online = con.Online && connected
+	}
+	return con
+}
+
+// detects the addresses and stores the preferred one in 'ipAddress': IPv4 first, then global
+// IPv6, unique local IPv6 and link-local addresses. All addresses are logged with logAll,
+// otherwise only changes. Returns true if the addresses have changed.
+func (c *Controller) updateAddresses(logAll bool) bool {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		logger.Error(err.Error())
+		return false
+	}
+	best := -1
+	var preferred string
+	var all []string
+	for _, i := range interfaces {
+		addresses, err := i.Addrs()
+		if err != nil {
+			logger.Warn(err.Error())
+			continue
+		}
+		for _, v := range addresses {
+			ipNet, ok := v.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if logAll {
+				logger.Infof("%s: %s", i.Name, ipNet)
+			}
+			rank := addressRank(ipNet.IP)
+			if rank < 0 {
+				continue
+			}
+			all = append(all, ipNet.IP.String())
+			if best < 0 || rank < best {
+				best = rank
+				preferred = ipNet.IP.String()
+			}
+		}
+	}
+
+	c.netMu.Lock()
+	changed := preferred != c.ipAddress || strings.Join(all, ",") != strings.Join(c.ipAll, ",")
+	c.ipAddress = preferred
+	c.ipAll = all
+	c.netMu.Unlock()
+	if logAll {
+		logger.Infof("IP address: %s", preferred)
+	} else if changed {
+		logger.Infof("Network changed, IP address: %s, all addresses: %s", preferred, strings.Join(all, ", "))
+	}
+	return changed
+}
+
+// returns the preferred address and all usable addresses
+func (c *Controller) addresses() (string, []string) {
+	c.netMu.Lock()
+	defer c.netMu.Unlock()
+	return c.ipAddress, c.ipAll
+}
+
+// checks the addresses periodically, the display shows the new address with the next cycle
+// and the mDNS records are announced again
+func (c *Controller) watchNetwork() {
+	for {
+		time.Sleep(NETWORK_CHECK)
+		if c.updateAddresses(false) && c.mdns != nil {
+			c.mdns.Refresh()
+		}
+	}
+}
+
+// returns the preference of an address for the display, lower is better, -1 if it can't be used
+func addressRank(ip net.IP) int {
+	switch {
+	case ip.IsLoopback() || ip.IsUnspecified() || ip.IsMulticast():
+		return -1
+	case ip.To4() != nil:
+		if ip.IsLinkLocalUnicast() {
+			return 4
+		}
+		return 0
+	case ip.IsLinkLocalUnicast():
+		return 3
+	case ip.IsPrivate():
+		// unique local address fc00::/7
+		return 2
+	}
+	return 1
+}
+
+// shortens an IPv6 address to max characters for the display, the end of the address (the
+// interface identifier) is kept as it identifies the device
+func shortAddress(addr string, max int) string {
+	if len(addr) <= max {
+		return addr
+	}
+	return ".." + addr[len(addr)-max+2:]
+}
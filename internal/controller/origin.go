@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"sync"
+	"time"
+)
+
+// channels of a manual change of the fan
+const (
+	VIA_WEB    = "web"
+	VIA_API    = "api"
+	VIA_HA     = "ha"
+	VIA_MQTT   = "mqtt"
+	VIA_BUTTON = "button"
+	VIA_COAP   = "coap"
+)
+
+// OverrideOrigin tells who changed the override or the boost last and when
+type OverrideOrigin struct {
+	Action string `json:"action"`           // on, off, auto, boost or boost_stop
+	Via    string `json:"via"`              // web, api, ha, mqtt, coap or button
+	Client string `json:"client,omitempty"` // address of the client, empty for a button
+	Time   string `json:"time"`
+}
+
+type overrideOrigin struct {
+	mu   sync.Mutex
+	last *OverrideOrigin
+}
+
+func (o *overrideOrigin) set(action, via, client string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.last = &OverrideOrigin{Action: action, Via: via, Client: client, Time: time.Now().Format(DATE_TIME_FORMAT)}
+}
+
+func (o *overrideOrigin) get() *OverrideOrigin {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.last == nil {
+		return nil
+	}
+	last := *o.last
+	return &last
+}
+
+// returns the change of the audit log for the button actions, "" for the actions that don't
+// change the fan or the configuration
+func auditChange(action string) string {
+	switch action {
+	case ACTION_OVERRIDE_ON, ACTION_OVERRIDE_OFF, ACTION_AUTO:
+		return AUDIT_OVERRIDE
+	case ACTION_BOOST:
+		return AUDIT_BOOST
+	case ACTION_MAINTENANCE:
+		return AUDIT_MAINTENANCE
+	case ACTION_DEBUG:
+		return AUDIT_LOG_LEVEL
+	}
+	return ""
+}
+
+// ActionBy executes a button action like Action, the changes are recorded in the audit log
+func (c *Controller) ActionBy(action, via, client string) error {
+	change := auditChange(action)
+	if change == "" {
+		return c.Action(action)
+	}
+	return c.Audited(change, via, client, func() error {
+		return c.Action(action)
+	})
+}
+
+// executes a command of MQTT and records it in the audit log
+func (c *Controller) mqttCommand(command, value string) error {
+	return c.Audited(command, VIA_MQTT, "", func() error {
+		return c.ExecuteCommand(command, value)
+	})
+}
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+// magic number of an overlay filesystem in statfs, e.g. of the overlay file system of raspi-config
+const OVERLAYFS_MAGIC = 0x794c7630
+
+// writable paths, e.g. for a read-only root filesystem or an SD card protected by an overlay
+type pathsConfig struct {
+	Data string `json:"data"` // directory of the state file, the InfluxDB queue and the local history, default ~/.dew_point_fan
+	Log  string `json:"log"`  // directory of the log files, default ~/.dew_point_fan/log
+	// directory of the Lua plugins, default ~/.dew_point_fan/plugins
+	Plugins string `json:"plugins"`
+}
+
+// DataDir returns the directory of the state file, the queue and the history
+func (p pathsConfig) DataDir(homePath string) string {
+	if p.Data != "" {
+		return p.Data
+	}
+	return homePath
+}
+
+// LogDir returns the directory of the log files
+func (p pathsConfig) LogDir(homePath string) string {
+	if p.Log != "" {
+		return p.Log
+	}
+	return filepath.Join(homePath, "log")
+}
+
+// PluginDir returns the directory of the plugins
+func (p pathsConfig) PluginDir(homePath string) string {
+	if p.Plugins != "" {
+		return p.Plugins
+	}
+	return filepath.Join(homePath, "plugins")
+}
+
+// CheckWritable creates the directory if necessary and returns an error, if files can't be
+// written there. A directory on an overlay filesystem is logged, its files are lost on a reboot.
+func CheckWritable(dir string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err == nil {
+		if st.Flags&unix.ST_RDONLY != 0 {
+			return fmt.Errorf("%s is on a read-only filesystem", dir)
+		}
+		if st.Type == OVERLAYFS_MAGIC {
+			logger.Warnf("%s is on an overlay filesystem, its files are lost on a reboot", dir)
+		}
+	}
+	f, err := os.CreateTemp(dir, ".write-test-*")
+	if err != nil {
+		if errors.Is(err, unix.EROFS) {
+			return fmt.Errorf("%s is on a read-only filesystem", dir)
+		}
+		return err
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,304 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/metrics"
+	"sort"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+const (
+	PLUGIN_EXT          = ".lua"
+	PLUGIN_FUNCTION     = "cycle" // called every cycle with the values of the automatic control
+	PLUGIN_MAX_FAILURES = 10      // a plugin is disabled after this number of consecutive errors
+	PLUGIN_LOAD_TIMEOUT = time.Second
+	PLUGIN_MAX_MEMORY   = 16 << 20 // bytes a plugin may allocate per call, a plugin above is disabled
+	PLUGIN_MAX_STRING   = 64 << 10 // maximal length of a string built by string.rep
+)
+
+// metric of the Go runtime with the allocated heap memory
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+var errPluginMemory = errors.New("memory limit exceeded")
+
+// Lua scripts in the plugin directory, that can adjust the decision of the automatic control and
+// add derived metrics every cycle
+type pluginsConfig struct {
+	Enabled bool   `json:"enabled"`
+	Timeout int    `json:"timeout"` // in ms, maximal run time of a plugin per cycle
+	Dir     string `json:"-"`       // see paths.plugins
+}
+
+// values of the cycle passed to the plugins
+type pluginInput struct {
+	now             time.Time
+	tempInside      float32
+	tempOutside     float32
+	humInside       float32
+	humOutside      float32
+	dewPointInside  float32
+	dewPointOutside float32
+	venting         bool
+	reason          string
+}
+
+// plugin is a script with its own interpreter, it has no access to files, processes or the network
+type plugin struct {
+	name     string
+	state    *lua.LState
+	fn       *lua.LFunction
+	failures int
+}
+
+type pluginSet struct {
+	list     []*plugin
+	timeout  time.Duration
+	rejected map[string]bool // metrics with the name of a field of the dp point, logged once
+}
+
+// the libraries of the sandbox, without io, os and loading of other files
+var pluginLibs = []struct {
+	name string
+	open lua.LGFunction
+}{
+	{lua.BaseLibName, lua.OpenBase},
+	{lua.TabLibName, lua.OpenTable},
+	{lua.StringLibName, lua.OpenString},
+	{lua.MathLibName, lua.OpenMath},
+}
+
+// functions of the base library that load code from files
+var pluginBlocked = []string{"dofile", "loadfile", "load", "loadstring", "require", "module"}
+
+// loads all plugins of the directory in alphabetical order, a broken plugin is logged and skipped
+func loadPlugins(cfg pluginsConfig) *pluginSet {
+	ps := &pluginSet{timeout: time.Duration(cfg.Timeout) * time.Millisecond}
+	if !cfg.Enabled {
+		return ps
+	}
+	files, err := filepath.Glob(filepath.Join(cfg.Dir, "*"+PLUGIN_EXT))
+	if err != nil {
+		logger.Errorf("Couldn't read the plugins: %s", err)
+		return ps
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		p, err := ps.load(f)
+		if err != nil {
+			logger.Errorf("Plugin %s: %s", filepath.Base(f), err)
+			continue
+		}
+		logger.Infof("Plugin %s loaded", p.name)
+		ps.list = append(ps.list, p)
+	}
+	if len(ps.list) == 0 {
+		logger.Warnf("Plugins are enabled, but there are none in %s", cfg.Dir)
+	}
+	return ps
+}
+
+func (ps *pluginSet) load(path string) (*plugin, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	L := lua.NewState(lua.Options{SkipOpenLibs: true, CallStackSize: 120, RegistryMaxSize: 1024 * 80})
+	for _, lib := range pluginLibs {
+		if err := L.CallByParam(lua.P{Fn: L.NewFunction(lib.open), Protect: true}, lua.LString(lib.name)); err != nil {
+			L.Close()
+			return nil, err
+		}
+	}
+	for _, name := range pluginBlocked {
+		L.SetGlobal(name, lua.LNil)
+	}
+	// string.rep builds its result in one step, the memory limit can't stop it in between
+	if str, ok := L.GetGlobal(lua.StringLibName).(*lua.LTable); ok {
+		str.RawSetString("rep", L.NewFunction(pluginStrRep))
+	}
+	err = runLimited(L, PLUGIN_LOAD_TIMEOUT, func() error {
+		return L.DoString(string(src))
+	})
+	if err != nil {
+		L.Close()
+		return nil, err
+	}
+	fn, ok := L.GetGlobal(PLUGIN_FUNCTION).(*lua.LFunction)
+	if !ok {
+		L.Close()
+		return nil, fmt.Errorf("function %s is missing", PLUGIN_FUNCTION)
+	}
+	return &plugin{name: strings.TrimSuffix(filepath.Base(path), PLUGIN_EXT), state: L, fn: fn}, nil
+}
+
+// calls the plugins one after the other, each gets the decision of the previous one. Returns the
+// decision and the metrics of all plugins, named <plugin>_<metric>.
+func (ps *pluginSet) adjust(in pluginInput) (bool, string, map[string]float64) {
+	venting, reason := in.venting, in.reason
+	var metrics map[string]float64
+	for _, p := range ps.list {
+		if p.failures >= PLUGIN_MAX_FAILURES {
+			continue
+		}
+		in.venting, in.reason = venting, reason
+		res, err := p.call(in, ps.timeout)
+		if err == errPluginMemory {
+			// the state may hold the memory, so the plugin is disabled at once
+			logger.Errorf("Plugin %s disabled: %s", p.name, err)
+			p.failures = PLUGIN_MAX_FAILURES
+			p.state.Close()
+			continue
+		}
+		if err != nil {
+			p.failures++
+			logger.Warnf("Plugin %s: %s", p.name, err)
+			if p.failures == PLUGIN_MAX_FAILURES {
+				logger.Errorf("Plugin %s disabled after %d errors", p.name, p.failures)
+			}
+			continue
+		}
+		p.failures = 0
+		if res == nil {
+			continue
+		}
+		if v, ok := res.RawGetString("venting").(lua.LBool); ok && bool(v) != venting {
+			venting, reason = bool(v), "plugin_"+p.name
+		}
+		if r, ok := res.RawGetString("reason").(lua.LString); ok && r != "" {
+			reason = string(r)
+		}
+		if m, ok := res.RawGetString("metrics").(*lua.LTable); ok {
+			m.ForEach(func(k, v lua.LValue) {
+				if n, ok := v.(lua.LNumber); ok {
+					if metrics == nil {
+						metrics = map[string]float64{}
+					}
+					metrics[p.name+"_"+k.String()] = float64(n)
+				}
+			})
+		}
+	}
+	return venting, reason, metrics
+}
+
+// calls the function of the plugin, it returns a table or nil
+func (p *plugin) call(in pluginInput, timeout time.Duration) (*lua.LTable, error) {
+	L := p.state
+	t := L.NewTable()
+	num := func(v float32) lua.LNumber { return lua.LNumber(roundFloat64(float64(v), 2)) }
+	t.RawSetString("time", lua.LNumber(in.now.Unix()))
+	t.RawSetString("temp_i", num(in.tempInside))
+	t.RawSetString("temp_o", num(in.tempOutside))
+	t.RawSetString("hum_i", num(in.humInside))
+	t.RawSetString("hum_o", num(in.humOutside))
+	t.RawSetString("dp_i", num(in.dewPointInside))
+	t.RawSetString("dp_o", num(in.dewPointOutside))
+	t.RawSetString("delta_dp", num(in.dewPointInside-in.dewPointOutside))
+	t.RawSetString("venting", lua.LBool(in.venting))
+	t.RawSetString("reason", lua.LString(in.reason))
+
+	err := runLimited(L, timeout, func() error {
+		return L.CallByParam(lua.P{Fn: p.fn, NRet: 1, Protect: true}, t)
+	})
+	if err != nil {
+		return nil, err
+	}
+	ret := L.Get(-1)
+	L.Pop(1)
+	switch r := ret.(type) {
+	case *lua.LTable:
+		return r, nil
+	case *lua.LNilType:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("%s returned a %s instead of a table", PLUGIN_FUNCTION, ret.Type())
+}
+
+// removes the metrics with the name of a field that is already in fields, so a plugin can't
+// overwrite the values of the control
+func (ps *pluginSet) dropCollisions(metrics map[string]float64, fields map[string]bool) {
+	for name := range metrics {
+		if !fields[name] {
+			continue
+		}
+		delete(metrics, name)
+		if !ps.rejected[name] {
+			logger.Warnf("Plugin metric %s rejected, it's a field of the control", name)
+			if ps.rejected == nil {
+				ps.rejected = map[string]bool{}
+			}
+			ps.rejected[name] = true
+		}
+	}
+}
+
+// runs fn with the context of L, the context is cancelled after the timeout or when the heap
+// grows more than PLUGIN_MAX_MEMORY
+func runLimited(L *lua.LState, timeout time.Duration, fn func() error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	L.SetContext(ctx)
+	defer L.RemoveContext()
+	exceeded := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		sample := []metrics.Sample{{Name: heapMetric}}
+		metrics.Read(sample)
+		start := sample[0].Value.Uint64()
+		ticker := time.NewTicker(2 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				metrics.Read(sample)
+				if heap := sample[0].Value.Uint64(); heap > start && heap-start > PLUGIN_MAX_MEMORY {
+					close(exceeded)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	err := fn()
+	close(done)
+	if err == nil {
+		return nil
+	}
+	select {
+	case <-exceeded:
+		return errPluginMemory
+	default:
+	}
+	if ctx.Err() != nil {
+		return errors.New("timeout")
+	}
+	return err
+}
+
+// string.rep with a limit of the length of the result
+func pluginStrRep(L *lua.LState) int {
+	str := L.CheckString(1)
+	n := L.CheckInt(2)
+	if n <= 0 {
+		L.Push(lua.LString(""))
+		return 1
+	}
+	if len(str) > PLUGIN_MAX_STRING/n {
+		L.RaiseError("string.rep: the result is longer than %d bytes", PLUGIN_MAX_STRING)
+	}
+	L.Push(lua.LString(strings.Repeat(str, n)))
+	return 1
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+const (
+	REASON_PREDICTED_DROP = "predicted_delta_drop"
+	REASON_PREDICTED_RISE = "predicted_delta_rise"
+	// the trend needs samples over at least half of the window
+	MIN_TREND_SAMPLES = 5
+)
+
+type predictConfig struct {
+	Enabled bool `json:"enabled"`
+	Window  int  `json:"window"`  // minutes of dew point differences used for the trend
+	Horizon int  `json:"horizon"` // a start is skipped, if the difference falls below diff_min within these minutes
+	Lead    int  `json:"lead"`    // the fan starts early, if the difference reaches the threshold within these minutes
+}
+
+type trendSample struct {
+	t     time.Time
+	delta float32
+}
+
+// trendPredictor extrapolates the dew point difference linearly, so the fan isn't started
+// shortly before the outside dew point crosses the threshold and is started a bit earlier when
+// the difference rises fast
+type trendPredictor struct {
+	cfg     predictConfig
+	samples []trendSample
+}
+
+func newTrendPredictor(cfg predictConfig) *trendPredictor {
+	return &trendPredictor{cfg: cfg}
+}
+
+// adds a valid dew point difference
+func (p *trendPredictor) add(now time.Time, delta float32) {
+	if !p.cfg.Enabled {
+		return
+	}
+	window := time.Duration(p.cfg.Window) * time.Minute
+	idx := 0
+	for idx < len(p.samples) && now.Sub(p.samples[idx].t) > window {
+		idx++
+	}
+	p.samples = append(p.samples[idx:], trendSample{t: now, delta: delta})
+}
+
+// returns the slope of the dew point difference in °C/min by a linear regression, ok is false
+// if there are too few samples
+func (p *trendPredictor) slope() (slope float64, ok bool) {
+	n := len(p.samples)
+	if n < MIN_TREND_SAMPLES {
+		return 0, false
+	}
+	first := p.samples[0].t
+	if p.samples[n-1].t.Sub(first) < time.Duration(p.cfg.Window)*time.Minute/2 {
+		return 0, false
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range p.samples {
+		x := s.t.Sub(first).Minutes()
+		y := float64(s.delta)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	denom := float64(n)*sumXX - sumX*sumX
+	if denom == 0 {
+		return 0, false
+	}
+	return (float64(n)*sumXY - sumX*sumY) / denom, true
+}
+
+// adjust changes a start decision of the automatic control with the predicted dew point
+// difference. Decisions that don't start the fan or are caused by other limits are kept.
+func (p *trendPredictor) adjust(current, state bool, reason string, l controlConfig, deltaTP, hysteresis float32) (bool, string) {
+	if !p.cfg.Enabled || current {
+		return state, reason
+	}
+	slope, ok := p.slope()
+	if !ok {
+		return state, reason
+	}
+	switch reason {
+	case REASON_DELTA_ABOVE:
+		predicted := deltaTP + float32(slope*float64(p.cfg.Horizon))
+		if predicted < l.DiffMin {
+			logger.Infof("Fan not started, the dew point difference falls by %.2f°C/min to %.1f°C within %d min",
+				-slope, predicted, p.cfg.Horizon)
+			return false, REASON_PREDICTED_DROP
+		}
+	case REASON_HYSTERESIS:
+		predicted := deltaTP + float32(slope*float64(p.cfg.Lead))
+		// the difference must not fall below diff_min within the horizon either
+		later := deltaTP + float32(slope*float64(p.cfg.Horizon))
+		if predicted > l.DiffMin+hysteresis && later >= l.DiffMin {
+			logger.Infof("Fan started early, the dew point difference rises by %.2f°C/min to %.1f°C within %d min",
+				slope, predicted, p.cfg.Lead)
+			return true, REASON_PREDICTED_RISE
+		}
+	}
+	return state, reason
+}
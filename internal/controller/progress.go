@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	PROGRESS_WEEKS     = 104 // number of weeks kept in the state file
+	MIN_TREND_WEEKS    = 4   // finished weeks needed for a trend
+	DRYING_THRESHOLD   = 0.1 // change of the inside absolute humidity in g/m³ per month that counts as a trend
+	VERDICT_DRIER      = "drier"
+	VERDICT_WETTER     = "wetter"
+	VERDICT_STABLE     = "stable"
+	VERDICT_NOT_ENOUGH = "not_enough_data"
+)
+
+// WeekProgress are the long-term indicators of a week, persisted in the state file
+type WeekProgress struct {
+	Week          string  `json:"week"`  // ISO week, e.g. "2026-W42"
+	Start         string  `json:"start"` // date of the first measurement of the week
+	AbsHumInside  float32 `json:"abs_hum_i"`
+	AbsHumOutside float32 `json:"abs_hum_o"`
+	GoodHours     float64 `json:"good_hours"` // hours the dew point difference allowed venting
+	FanHours      float64 `json:"fan_hours"`
+	SumInside     float64 `json:"sum_i"`
+	SumOutside    float64 `json:"sum_o"`
+	Count         int     `json:"count"`
+}
+
+// ProgressResponse is the drying progress of the cellar
+type ProgressResponse struct {
+	Since     string         `json:"since,omitempty"` // first recorded week
+	GoodHours float64        `json:"good_hours"`      // sum of all recorded weeks
+	FanHours  float64        `json:"fan_hours"`
+	Trend     float32        `json:"trend"`   // change of the weekly inside absolute humidity in g/m³ per month
+	Verdict   string         `json:"verdict"` // "drier", "wetter", "stable" or "not_enough_data"
+	Weeks     []WeekProgress `json:"weeks"`   // newest last
+}
+
+// dryingProgress aggregates the inside absolute humidity and the venting hours per week, to
+// see if the cellar gets drier over months
+type dryingProgress struct {
+	mu         sync.Mutex
+	state      *stateStore
+	weeks      []WeekProgress
+	lastUpdate time.Time
+	lastSave   time.Time
+}
+
+func newDryingProgress(state *stateStore) *dryingProgress {
+	return &dryingProgress{state: state, weeks: state.get().Progress, lastSave: time.Now()}
+}
+
+func isoWeek(t time.Time) string {
+	year, week := t.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// adds a measurement cycle, good is true if the automatic control wanted to vent
+func (p *dryingProgress) update(now time.Time, valid, good, fanOn bool, absHumInside, absHumOutside float32) {
+	p.mu.Lock()
+	week := isoWeek(now)
+	newWeek := len(p.weeks) == 0 || p.weeks[len(p.weeks)-1].Week != week
+	if newWeek {
+		p.weeks = append(p.weeks, WeekProgress{Week: week, Start: now.Format(DATE_FORMAT)})
+		if len(p.weeks) > PROGRESS_WEEKS {
+			p.weeks = p.weeks[len(p.weeks)-PROGRESS_WEEKS:]
+		}
+	}
+	w := &p.weeks[len(p.weeks)-1]
+	if elapsed := now.Sub(p.lastUpdate); !p.lastUpdate.IsZero() && elapsed < MAX_STATS_GAP {
+		if valid && good {
+			w.GoodHours += elapsed.Hours()
+		}
+		if fanOn {
+			w.FanHours += elapsed.Hours()
+		}
+	}
+	if valid {
+		w.SumInside += float64(absHumInside)
+		w.SumOutside += float64(absHumOutside)
+		w.Count++
+		w.AbsHumInside = roundFloat32(float32(w.SumInside/float64(w.Count)), 2)
+		w.AbsHumOutside = roundFloat32(float32(w.SumOutside/float64(w.Count)), 2)
+	}
+	p.lastUpdate = now
+	save := newWeek || now.Sub(p.lastSave) >= RUNTIME_SAVE_INTERVAL
+	if save {
+		p.lastSave = now
+	}
+	weeks := append([]WeekProgress{}, p.weeks...)
+	p.mu.Unlock()
+	if save {
+		p.state.update(func(st *persistentState) {
+			st.Progress = weeks
+		})
+	}
+}
+
+func (p *dryingProgress) response() ProgressResponse {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	resp := ProgressResponse{Verdict: VERDICT_NOT_ENOUGH, Weeks: append([]WeekProgress{}, p.weeks...)}
+	if len(p.weeks) > 0 {
+		resp.Since = p.weeks[0].Week
+	}
+	for _, w := range p.weeks {
+		resp.GoodHours += w.GoodHours
+		resp.FanHours += w.FanHours
+	}
+	resp.GoodHours = float64(roundFloat32(float32(resp.GoodHours), 1))
+	resp.FanHours = float64(roundFloat32(float32(resp.FanHours), 1))
+	// the running week is incomplete and not part of the trend
+	var finished []WeekProgress
+	if len(p.weeks) > 1 {
+		finished = p.weeks[:len(p.weeks)-1]
+	}
+	if slope, ok := weeklySlope(finished); ok {
+		resp.Trend = roundFloat32(float32(slope*30/7), 2)
+		switch {
+		case resp.Trend <= -DRYING_THRESHOLD:
+			resp.Verdict = VERDICT_DRIER
+		case resp.Trend >= DRYING_THRESHOLD:
+			resp.Verdict = VERDICT_WETTER
+		default:
+			resp.Verdict = VERDICT_STABLE
+		}
+	}
+	return resp
+}
+
+// returns the slope of the weekly inside absolute humidity in g/m³ per week by a linear
+// regression, weeks without valid readings are skipped
+func weeklySlope(weeks []WeekProgress) (float64, bool) {
+	var n, sumX, sumY, sumXY, sumXX float64
+	var first time.Time
+	for _, w := range weeks {
+		start, err := time.ParseInLocation(DATE_FORMAT, w.Start, time.Local)
+		if w.Count == 0 || err != nil {
+			continue
+		}
+		if first.IsZero() {
+			first = start
+		}
+		// weeks without the program running leave a gap
+		x, y := start.Sub(first).Hours()/24/7, float64(w.AbsHumInside)
+		n++
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	denom := n*sumXX - sumX*sumX
+	if n < MIN_TREND_WEEKS || denom == 0 {
+		return 0, false
+	}
+	return (n*sumXY - sumX*sumY) / denom, true
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/sensor"
+)
+
+// RawReading is the last reading of a sensor before and after the correction, the values
+// are 0 if the reading failed
+type RawReading struct {
+	Name           string  `json:"name"`
+	Time           string  `json:"time"`
+	RawTemperature float32 `json:"raw_temperature"`
+	RawHumidity    float32 `json:"raw_humidity"`
+	TempOffset     float32 `json:"temp_offset"` // applied correction
+	HumOffset      float32 `json:"hum_offset"`
+	Curve          bool    `json:"curve"` // the offsets were interpolated from a correction curve
+	Temperature    float32 `json:"temperature"`
+	Humidity       float32 `json:"humidity"`
+	Retries        int     `json:"retries"`
+	ReadMs         int64   `json:"read_ms"` // duration of the read including the retries
+	Purging        bool    `json:"purging,omitempty"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// RawResponse contains the readings of all sensors of the last cycle
+type RawResponse struct {
+	Sensors []RawReading `json:"sensors"`
+}
+
+// rawReadings keeps the last reading of every sensor in the order of the first read
+type rawReadings struct {
+	mu       sync.Mutex
+	names    []string
+	readings map[string]RawReading
+}
+
+func newRawReadings() *rawReadings {
+	return &rawReadings{readings: map[string]RawReading{}}
+}
+
+// records a read of the sensor with the configuration cfg, t and h are the raw values
+func (r *rawReadings) record(cfg sensor.Config, name string, start time.Time, t, h float32, retried int, err error) {
+	reading := RawReading{
+		Name:    name,
+		Time:    start.Format(DATE_TIME_FORMAT),
+		Retries: retried,
+		ReadMs:  time.Since(start).Milliseconds(),
+		Curve:   len(cfg.TempCurve) > 0 || len(cfg.HumCurve) > 0,
+	}
+	if err != nil {
+		reading.Error = err.Error()
+	} else {
+		reading.RawTemperature = roundFloat32(t, 2)
+		reading.RawHumidity = roundFloat32(h, 2)
+		tOffset, hOffset := cfg.Offsets(t)
+		reading.TempOffset = roundFloat32(tOffset, 2)
+		reading.HumOffset = roundFloat32(hOffset, 2)
+		reading.Temperature = roundFloat32(t+tOffset, 2)
+		reading.Humidity = roundFloat32(h+hOffset, 2)
+	}
+	r.set(reading)
+}
+
+// records a sensor whose readings are suppressed during a heater purge
+func (r *rawReadings) purging(name string, now time.Time) {
+	r.set(RawReading{Name: name, Time: now.Format(DATE_TIME_FORMAT), Purging: true})
+}
+
+func (r *rawReadings) set(reading RawReading) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.readings[reading.Name]; !ok {
+		r.names = append(r.names, reading.Name)
+	}
+	r.readings[reading.Name] = reading
+}
+
+func (r *rawReadings) get() RawResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	resp := RawResponse{Sensors: []RawReading{}}
+	for _, name := range r.names {
+		resp.Sensors = append(resp.Sensors, r.readings[name])
+	}
+	return resp
+}
+
+// Raw returns the raw and the corrected readings of the last cycle
+func (c *Controller) Raw() RawResponse {
+	return c.raw.get()
+}
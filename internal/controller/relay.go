@@ -0,0 +1,24 @@
+package controller
+
+import "github.com/aluedtke7/dew_point_fan/internal/actuator"
+
+// FAN_PIN is the default GPIO of the fan relais (active low)
+const FAN_PIN = actuator.DEF_PIN
+
+type actuatorConfig struct {
+	actuator.Config
+	// wear protection
+	DeadTime        int   `json:"dead_time"`        // minimum seconds between two switch operations, 0 to switch immediately
+	MaxPerHour      int   `json:"max_per_hour"`     // maximum number of switch operations per hour, 0 for no limit
+	ServiceSwitches int64 `json:"service_switches"` // rated number of switch operations of the relais
+	WarnPercent     int   `json:"warn_percent"`     // alert when the count reaches this percentage of service_switches
+}
+
+// creates the monitored actuator of the fan, in a dry run it only logs
+func newActuator(cfg actuatorConfig, dryRun bool) (*actuator.Monitor, error) {
+	a, err := actuator.New(cfg.Config, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	return actuator.NewMonitor(a), nil
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+
+	"github.com/aluedtke7/dew_point_fan/internal/storage"
+)
+
+const REPLAY_TIMEOUT = 5 * time.Minute
+
+// LoadInfluxRecords reads the readings of the main zone between from and to from the configured
+// InfluxDB (2.x, or 1.8 with Flux enabled), e.g. for Backtest. There is no measured fan state in
+// the dp measurement, FanStatus is the recorded decision of the automatic control (vent_val).
+func LoadInfluxRecords(cfg Config, from, to time.Time) ([]storage.Record, error) {
+	cfg = cfg.withSecrets()
+	url := cfg.Influx.Url
+	if u, ok := os.LookupEnv("INFLUX_SRV_URL"); ok {
+		url = u
+	}
+	if url == "" {
+		return nil, fmt.Errorf("no InfluxDB url configured")
+	}
+	var client influxdb2.Client
+	bucket, org := cfg.Influx.Bucket, cfg.Influx.Org
+	switch cfg.Influx.Backend {
+	case "", BACKEND_INFLUX2:
+		client = influxdb2.NewClient(url, cfg.Influx.Token)
+	case BACKEND_INFLUX1:
+		client = influxdb2.NewClient(url, fmt.Sprintf("%s:%s", cfg.Influx.Username, cfg.Influx.Password))
+		bucket, org = cfg.Influx.Database+"/"+cfg.Influx.RetentionPolicy, ""
+	default:
+		return nil, fmt.Errorf("the backend '%s' can't be queried", cfg.Influx.Backend)
+	}
+	defer client.Close()
+
+	// the points of the main zone have no zone tag without additional zones
+	query := fmt.Sprintf(`from(bucket: "%s")
+  |> range(start: %s, stop: %s)
+  |> filter(fn: (r) => r._measurement == "dp")
+  |> filter(fn: (r) => r._field == "temp_i" or r._field == "temp_o" or r._field == "hum_i" or r._field == "hum_o" or r._field == "vent_val")
+  |> filter(fn: (r) => not exists r.zone or r.zone == "%s")
+  |> group()
+  |> pivot(rowKey: ["_time"], columnKey: ["_field"], valueColumn: "_value")
+  |> sort(columns: ["_time"])`, bucket, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339), ZONE_MAIN)
+	ctx, cancel := context.WithTimeout(context.Background(), REPLAY_TIMEOUT)
+	defer cancel()
+	result, err := client.QueryAPI(org).Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = result.Close()
+	}()
+	var records []storage.Record
+	for result.Next() {
+		values := result.Record().Values()
+		rec := storage.Record{Time: result.Record().Time(), Valid: true, Source: SOURCE_AUTO}
+		for field, v := range map[string]*float32{"temp_i": &rec.TempInside, "temp_o": &rec.TempOutside,
+			"hum_i": &rec.HumInside, "hum_o": &rec.HumOutside} {
+			f, ok := toFloat(values[field])
+			if !ok {
+				rec.Valid = false
+			}
+			*v = float32(f)
+		}
+		vent, _ := toFloat(values["vent_val"])
+		rec.Venting = vent > 0
+		rec.FanStatus = rec.Venting
+		records = append(records, rec)
+	}
+	return records, result.Err()
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case int64:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	}
+	return 0, false
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/i18n"
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+const RUNTIME_SAVE_INTERVAL = 10 * time.Minute
+
+// RuntimeResponse is the cumulative fan runtime
+type RuntimeResponse struct {
+	Hours float64 `json:"hours"`
+	Since string  `json:"since"` // time of the last reset
+}
+
+// runtimeCounter counts the cumulative fan runtime for maintenance, the value is persisted in the state file
+type runtimeCounter struct {
+	mu         sync.Mutex
+	state      *stateStore
+	seconds    float64
+	since      string
+	lastUpdate time.Time
+	lastSave   time.Time
+}
+
+func newRuntimeCounter(state *stateStore) *runtimeCounter {
+	st := state.get()
+	since := st.RuntimeSince
+	if since == "" {
+		since = time.Now().Format(DATE_TIME_FORMAT)
+	}
+	return &runtimeCounter{state: state, seconds: st.RuntimeSeconds, since: since, lastSave: time.Now()}
+}
+
+// adds the time since the last update, if the fan is running
+func (r *runtimeCounter) update(now time.Time, fanOn bool) {
+	r.mu.Lock()
+	if fanOn && !r.lastUpdate.IsZero() {
+		elapsed := now.Sub(r.lastUpdate)
+		if elapsed < MAX_STATS_GAP {
+			r.seconds += elapsed.Seconds()
+		}
+	}
+	r.lastUpdate = now
+	save := now.Sub(r.lastSave) >= RUNTIME_SAVE_INTERVAL
+	r.mu.Unlock()
+	if save {
+		r.save()
+	}
+}
+
+func (r *runtimeCounter) save() {
+	r.mu.Lock()
+	seconds, since := r.seconds, r.since
+	r.lastSave = time.Now()
+	r.mu.Unlock()
+	r.state.update(func(st *persistentState) {
+		st.RuntimeSeconds = seconds
+		st.RuntimeSince = since
+	})
+}
+
+func (r *runtimeCounter) reset() {
+	r.mu.Lock()
+	logger.Infof("Fan runtime counter reset at %.1f h", r.seconds/3600)
+	r.seconds = 0
+	r.since = time.Now().Format(DATE_TIME_FORMAT)
+	r.mu.Unlock()
+	r.save()
+}
+
+func (r *runtimeCounter) response() RuntimeResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return RuntimeResponse{Hours: float64(roundFloat32(float32(r.seconds/3600), 2)), Since: r.since}
+}
+
+// lines for the LCD info page
+func (r *runtimeCounter) page() []string {
+	resp := r.response()
+	since := resp.Since
+	if t, err := time.ParseInLocation(DATE_TIME_FORMAT, since, time.Local); err == nil {
+		since = i18n.Date(t)
+	}
+	return []string{
+		i18n.T("Fan runtime"),
+		fmt.Sprintf("%.1f h", resp.Hours),
+		i18n.T("since"),
+		since,
+	}
+}
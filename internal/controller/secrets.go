@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+// names of the secrets, used for the environment variables and the systemd credentials
+const (
+	SECRET_INFLUX_TOKEN    = "INFLUX_DP_TOKEN"
+	SECRET_INFLUX_PASSWORD = "INFLUX_PASSWORD"
+	SECRET_MQTT_PASSWORD   = "MQTT_PASSWORD"
+	SECRET_PUSHOVER_TOKEN  = "PUSHOVER_TOKEN"
+	SECRET_NTFY_TOKEN      = "NTFY_TOKEN"
+	SECRET_SMTP_PASSWORD   = "SMTP_PASSWORD"
+	SECRET_PLUG_PASSWORD   = "PLUG_PASSWORD"
+	SECRET_HTTP_TOKEN      = "HTTP_TOKEN"
+	SECRET_READ_TOKEN      = "HTTP_READ_TOKEN"
+	SECRET_CONTROL_TOKEN   = "HTTP_CONTROL_TOKEN"
+)
+
+// readSecret returns the secret from the first of these sources:
+//   - the environment variable name, e.g. MQTT_PASSWORD
+//   - the file in the environment variable name_FILE, e.g. MQTT_PASSWORD_FILE (Docker secrets)
+//   - the systemd credential with the name in lower case, e.g. mqtt_password (LoadCredential=)
+//   - value, the setting of the config file
+func readSecret(name, value string) string {
+	if v, ok := os.LookupEnv(name); ok {
+		return v
+	}
+	if path, ok := os.LookupEnv(name + "_FILE"); ok {
+		if v, ok := readSecretFile(path); ok {
+			return v
+		}
+	}
+	if dir, ok := os.LookupEnv("CREDENTIALS_DIRECTORY"); ok {
+		path := filepath.Join(dir, strings.ToLower(name))
+		if _, err := os.Stat(path); err == nil {
+			if v, ok := readSecretFile(path); ok {
+				return v
+			}
+		}
+	}
+	return value
+}
+
+func readSecretFile(path string) (string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.Errorf("Couldn't read secret: %s", err)
+		return "", false
+	}
+	// editors and echo add a newline
+	return strings.TrimRight(string(data), "\r\n"), true
+}
+
+// withSecrets returns the configuration with the secrets of the environment and the files
+func (cfg Config) withSecrets() Config {
+	cfg.Influx.Token = readSecret(SECRET_INFLUX_TOKEN, cfg.Influx.Token)
+	cfg.Influx.Password = readSecret(SECRET_INFLUX_PASSWORD, cfg.Influx.Password)
+	cfg.Mqtt.Password = readSecret(SECRET_MQTT_PASSWORD, cfg.Mqtt.Password)
+	cfg.Notify.Pushover.Token = readSecret(SECRET_PUSHOVER_TOKEN, cfg.Notify.Pushover.Token)
+	cfg.Notify.Ntfy.Token = readSecret(SECRET_NTFY_TOKEN, cfg.Notify.Ntfy.Token)
+	cfg.Notify.Smtp.Password = readSecret(SECRET_SMTP_PASSWORD, cfg.Notify.Smtp.Password)
+	cfg.Actuator.Password = readSecret(SECRET_PLUG_PASSWORD, cfg.Actuator.Password)
+	cfg.Http.Token = readSecret(SECRET_HTTP_TOKEN, cfg.Http.Token)
+	cfg.Http.ReadToken = readSecret(SECRET_READ_TOKEN, cfg.Http.ReadToken)
+	cfg.Http.ControlToken = readSecret(SECRET_CONTROL_TOKEN, cfg.Http.ControlToken)
+	return cfg
+}
+
+// returns a hint for the log, that never contains the secret itself
+func secretHint(secret string) string {
+	if secret == "" {
+		return "not set"
+	}
+	return "set"
+}
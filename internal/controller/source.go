@@ -0,0 +1,50 @@
+package controller
+
+// sources that can determine the fan state, in order of precedence
+const (
+	SOURCE_SWITCH = "switch"      // hardware 3 state switch
+	SOURCE_MAINT  = "maintenance" // maintenance mode
+	SOURCE_FROST  = "frost"       // frost protection
+	SOURCE_REMOTE = "remote"      // remote override via http API
+	SOURCE_BOOST  = "boost"       // boost via push button or http API
+	SOURCE_AUTO   = "auto"        // automatic control
+)
+
+// returns the source that currently determines the fan state. The hardware switch has the
+// highest precedence: if the fan status differs from the state the relais was switched to
+// (switched), the switch is in position ON or OFF and overrules everything else.
+func activeSource(switched bool, remoteOverride int, boosting, frost, maint bool) string {
+	if switched {
+		return SOURCE_SWITCH
+	}
+	if maint {
+		return SOURCE_MAINT
+	}
+	if frost {
+		return SOURCE_FROST
+	}
+	if remoteOverride > 0 {
+		return SOURCE_REMOTE
+	}
+	if boosting {
+		return SOURCE_BOOST
+	}
+	return SOURCE_AUTO
+}
+
+// single letter for the LCD status line
+func sourceLetter(src string) string {
+	switch src {
+	case SOURCE_SWITCH:
+		return "S"
+	case SOURCE_MAINT:
+		return "M"
+	case SOURCE_FROST:
+		return "F"
+	case SOURCE_REMOTE:
+		return "R"
+	case SOURCE_BOOST:
+		return "B"
+	}
+	return "A"
+}
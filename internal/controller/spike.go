@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"math"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"github.com/aluedtke7/dew_point_fan/internal/sensor"
+)
+
+// spikeFilter rejects readings that change faster than the sensor's rate limits. The allowed
+// change grows with the time since the last good reading, so a reading after long retries or
+// failed cycles isn't rejected, and a real change is accepted after some cycles.
+type spikeFilter struct {
+	name     string
+	tempRate float64 // °C/min
+	humRate  float64 // %/min
+	last     time.Time
+	temp     float32
+	hum      float32
+}
+
+func newSpikeFilter(cfg sensor.Config) *spikeFilter {
+	tempRate, humRate := cfg.RateLimits()
+	return &spikeFilter{name: cfg.Name, tempRate: float64(tempRate), humRate: float64(humRate)}
+}
+
+// returns true if the reading is plausible, it's the last good reading afterwards
+func (f *spikeFilter) plausible(now time.Time, t, h float32) bool {
+	if !f.last.IsZero() {
+		// changes within one cycle are always allowed up to the rate of a full cycle
+		minutes := math.Max(now.Sub(f.last).Minutes(), CYCLE_INTERVAL.Minutes())
+		dt := math.Abs(float64(t - f.temp))
+		dh := math.Abs(float64(h - f.hum))
+		if dt > f.tempRate*minutes || dh > f.humRate*minutes {
+			logger.Warnf("%s: spike of %.1f°C and %.1f%% within %.1f min rejected", f.name, dt, dh, minutes)
+			return false
+		}
+	}
+	f.last, f.temp, f.hum = now, t, h
+	return true
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+const STATE_FILE = "state.json"
+
+// persistentState survives restarts of the program
+type persistentState struct {
+	Venting        bool           `json:"venting"`         // last state of the fan relais
+	RuntimeSeconds float64        `json:"runtime_seconds"` // cumulative fan runtime
+	RuntimeSince   string         `json:"runtime_since"`   // last reset of the runtime counter
+	Energy         energyState    `json:"energy"`
+	RelaySwitches  int64          `json:"relay_switches"` // switch operations of the relais
+	RelaySince     string         `json:"relay_since"`    // last reset of the switch counter
+	Progress       []WeekProgress `json:"progress"`       // weekly indicators of the drying progress
+	// end of the maintenance mode, empty if it isn't active
+	MaintenanceUntil string `json:"maintenance_until"`
+}
+
+type stateStore struct {
+	mu     sync.Mutex
+	path   string
+	state  persistentState
+	failed bool // the last write failed, logged once
+}
+
+// loads the persisted state, a missing or invalid file results in the default state
+func loadState(dir string) *stateStore {
+	st := &stateStore{path: filepath.Join(dir, STATE_FILE)}
+	data, err := os.ReadFile(st.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warnf("Couldn't read state file %s: %s", st.path, err)
+		}
+		return st
+	}
+	if err = json.Unmarshal(data, &st.state); err != nil {
+		logger.Warnf("State file %s is invalid: %s", st.path, err)
+	}
+	return st
+}
+
+// returns a copy of the current state
+func (s *stateStore) get() persistentState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// modifies the state with the given function and writes it to disk
+func (s *stateStore) update(fn func(st *persistentState)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.state)
+	data, _ := json.MarshalIndent(s.state, "", "  ")
+	// write to a temp file first, so that a power loss doesn't leave a broken file
+	tmp := s.path + ".tmp"
+	err := os.WriteFile(tmp, data, 0644)
+	if err == nil {
+		err = os.Rename(tmp, s.path)
+	}
+	// e.g. on a read-only filesystem every write fails, the state is kept in memory
+	if err != nil && !s.failed {
+		logger.Errorf("Couldn't write state file: %s", err)
+	} else if err == nil && s.failed {
+		logger.Infof("State file %s written again", s.path)
+	}
+	s.failed = err != nil
+}
@@ -0,0 +1,252 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/i18n"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+const (
+	DATE_FORMAT   = "2006-01-02"
+	STATS_DAYS    = 7     // number of finished days kept in memory
+	DEF_AIRFLOW   = 100.0 // default air flow of the fan in m³/h
+	MAX_STATS_GAP = time.Minute
+)
+
+type statsConfig struct {
+	Airflow float32 `json:"airflow"` // air flow of the fan in m³/h, used to estimate the removed moisture
+}
+
+// MinMaxAvg holds the minimum, maximum and average of a value
+type MinMaxAvg struct {
+	Min   float32 `json:"min"`
+	Max   float32 `json:"max"`
+	Avg   float32 `json:"avg"`
+	sum   float64
+	count int
+}
+
+func (m *MinMaxAvg) add(v float32) {
+	if m.count == 0 || v < m.Min {
+		m.Min = v
+	}
+	if m.count == 0 || v > m.Max {
+		m.Max = v
+	}
+	m.sum += float64(v)
+	m.count++
+	m.Avg = roundFloat32(float32(m.sum/float64(m.count)), 1)
+}
+
+// DayStats are the statistics of a day
+type DayStats struct {
+	Date            string           `json:"date"`
+	RuntimeMinutes  float32          `json:"runtime_minutes"`
+	SwitchCycles    int              `json:"switch_cycles"`
+	HumInside       MinMaxAvg        `json:"hum_i"`
+	DeltaDewPoint   MinMaxAvg        `json:"delta_dp"`
+	MoistureRemoved float32          `json:"moisture_removed"` // estimated in g
+	Sensors         []SensorDayStats `json:"sensors,omitempty"`
+}
+
+// SensorDayStats are the extremes of the valid readings of a sensor during a day
+type SensorDayStats struct {
+	Name        string    `json:"name"`
+	Temperature MinMaxAvg `json:"temp"`
+	Humidity    MinMaxAvg `json:"hum"`
+}
+
+// StatsResponse contains the statistics of today and the last days
+type StatsResponse struct {
+	Today DayStats   `json:"today"`
+	Days  []DayStats `json:"days"` // finished days, newest last
+	Week  DayStats   `json:"week"` // sum of the last 7 days including today
+}
+
+// Yesterday returns the statistics of the last finished day, nil after the start
+func (r StatsResponse) Yesterday() *DayStats {
+	if len(r.Days) == 0 {
+		return nil
+	}
+	return &r.Days[len(r.Days)-1]
+}
+
+// statistics aggregates the measurements per day
+type statistics struct {
+	mu         sync.Mutex
+	airflow    float32
+	today      DayStats
+	days       []DayStats
+	lastUpdate time.Time
+	lastFanOn  bool
+	finished   *DayStats // day that ended and wasn't returned by update yet
+}
+
+func newStatistics(cfg statsConfig) *statistics {
+	airflow := cfg.Airflow
+	if airflow <= 0 {
+		airflow = DEF_AIRFLOW
+	}
+	return &statistics{airflow: airflow, today: DayStats{Date: time.Now().Format(DATE_FORMAT)}}
+}
+
+// adds the values of a measurement cycle. When a day is over, its statistics are returned.
+func (s *statistics) update(now time.Time, fanOn, valid bool, humInside, deltaDP, absHumInside, absHumOutside float32) *DayStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rollover(now)
+	finished := s.finished
+	s.finished = nil
+	// the runtime is only counted for continuous operation, not across long interruptions
+	elapsed := now.Sub(s.lastUpdate)
+	if s.lastFanOn && !s.lastUpdate.IsZero() && elapsed < MAX_STATS_GAP {
+		s.today.RuntimeMinutes = roundFloat32(s.today.RuntimeMinutes+float32(elapsed.Minutes()), 2)
+		if valid && absHumInside > absHumOutside {
+			// g/m³ * m³/h * h
+			removed := (absHumInside - absHumOutside) * s.airflow * float32(elapsed.Hours())
+			s.today.MoistureRemoved = roundFloat32(s.today.MoistureRemoved+removed, 1)
+		}
+	}
+	if fanOn && !s.lastFanOn {
+		s.today.SwitchCycles++
+	}
+	if valid {
+		s.today.HumInside.add(humInside)
+		s.today.DeltaDewPoint.add(roundFloat32(deltaDP, 1))
+	}
+	s.lastUpdate = now
+	s.lastFanOn = fanOn
+	return finished
+}
+
+// starts a new day at local midnight
+func (s *statistics) rollover(now time.Time) {
+	date := now.Format(DATE_FORMAT)
+	if date == s.today.Date {
+		return
+	}
+	done := s.today
+	s.finished = &done
+	s.days = append(s.days, done)
+	if len(s.days) > STATS_DAYS {
+		s.days = s.days[1:]
+	}
+	s.today = DayStats{Date: date}
+}
+
+// adds a valid reading of a sensor to its daily minimum and maximum
+func (s *statistics) addReading(now time.Time, name string, temp, hum float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rollover(now)
+	for i := range s.today.Sensors {
+		if s.today.Sensors[i].Name == name {
+			s.today.Sensors[i].Temperature.add(temp)
+			s.today.Sensors[i].Humidity.add(hum)
+			return
+		}
+	}
+	st := SensorDayStats{Name: name}
+	st.Temperature.add(temp)
+	st.Humidity.add(hum)
+	s.today.Sensors = append(s.today.Sensors, st)
+}
+
+// the info page with the extremes of today or yesterday, one line per sensor
+func (s *statistics) page(yesterday bool) []string {
+	resp := s.response()
+	day, title := &resp.Today, i18n.T("Today")
+	if yesterday {
+		day, title = resp.Yesterday(), i18n.T("Yesterday")
+	}
+	lines := []string{title + " " + i18n.T("min/max")}
+	if day == nil || len(day.Sensors) == 0 {
+		return append(lines, i18n.T("no data"))
+	}
+	for _, st := range day.Sensors {
+		if len(lines) == 4 {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%-3.3s %4.1f/%4.1f %2.0f/%2.0f", st.Name,
+			st.Temperature.Min, st.Temperature.Max, st.Humidity.Min, st.Humidity.Max))
+	}
+	return lines
+}
+
+func (s *statistics) response() StatsResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := StatsResponse{Today: s.today, Days: append([]DayStats{}, s.days...)}
+	resp.Today.Sensors = append([]SensorDayStats{}, s.today.Sensors...)
+	week := DayStats{Date: s.today.Date}
+	days := append(append([]DayStats{}, s.days...), s.today)
+	if len(days) > STATS_DAYS {
+		days = days[len(days)-STATS_DAYS:]
+	}
+	for _, d := range days {
+		week.RuntimeMinutes += d.RuntimeMinutes
+		week.SwitchCycles += d.SwitchCycles
+		week.MoistureRemoved += d.MoistureRemoved
+		week.HumInside.merge(d.HumInside)
+		week.DeltaDewPoint.merge(d.DeltaDewPoint)
+	}
+	week.RuntimeMinutes = roundFloat32(week.RuntimeMinutes, 2)
+	week.MoistureRemoved = roundFloat32(week.MoistureRemoved, 1)
+	resp.Week = week
+	return resp
+}
+
+func (m *MinMaxAvg) merge(o MinMaxAvg) {
+	if o.count == 0 {
+		return
+	}
+	if m.count == 0 || o.Min < m.Min {
+		m.Min = o.Min
+	}
+	if m.count == 0 || o.Max > m.Max {
+		m.Max = o.Max
+	}
+	m.sum += o.sum
+	m.count += o.count
+	m.Avg = roundFloat32(float32(m.sum/float64(m.count)), 1)
+}
+
+// creates the point for the daily statistics measurement
+func dayStatsPoint(d *DayStats) *write.Point {
+	ts, _ := time.ParseInLocation(DATE_FORMAT, d.Date, time.Local)
+	return write.NewPoint("dp_daily",
+		map[string]string{},
+		map[string]interface{}{
+			"runtime_minutes":  d.RuntimeMinutes,
+			"switch_cycles":    d.SwitchCycles,
+			"hum_i_min":        d.HumInside.Min,
+			"hum_i_max":        d.HumInside.Max,
+			"hum_i_avg":        d.HumInside.Avg,
+			"delta_dp_min":     d.DeltaDewPoint.Min,
+			"delta_dp_max":     d.DeltaDewPoint.Max,
+			"delta_dp_avg":     d.DeltaDewPoint.Avg,
+			"moisture_removed": d.MoistureRemoved,
+		},
+		ts)
+}
+
+// creates the points with the daily extremes of the sensors
+func sensorDayPoints(d *DayStats) []*write.Point {
+	ts, _ := time.ParseInLocation(DATE_FORMAT, d.Date, time.Local)
+	var points []*write.Point
+	for _, st := range d.Sensors {
+		points = append(points, write.NewPoint("dp_daily_sensor",
+			map[string]string{"sensor": st.Name},
+			map[string]interface{}{
+				"temp_min": st.Temperature.Min,
+				"temp_max": st.Temperature.Max,
+				"hum_min":  st.Humidity.Min,
+				"hum_max":  st.Humidity.Max,
+			},
+			ts))
+	}
+	return points
+}
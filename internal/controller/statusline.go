@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const DEF_STATUS_LINE = "{ip} {alive} {override} {fan}"
+
+// fields of the status line
+var statusFields = []string{"ip", "alive", "override", "fan", "time"}
+
+// one part of the template, either literal text or a field
+type statusPart struct {
+	text  string
+	field string
+	width int // 0 is flexible
+}
+
+// statusLine renders the last line of the main page from a template like "{ip} {alive} {override} {fan}".
+// {field:N} has a fixed width of N characters. If the line is too long, the address is shortened
+// from the left, then the other fields without a width.
+type statusLine struct {
+	parts []statusPart
+}
+
+func newStatusLine(template string) (*statusLine, error) {
+	if template == "" {
+		template = DEF_STATUS_LINE
+	}
+	s := &statusLine{}
+	rest := template
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			s.parts = append(s.parts, statusPart{text: rest})
+			break
+		}
+		if open > 0 {
+			s.parts = append(s.parts, statusPart{text: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("missing '}' in '%s'", template)
+		}
+		part, err := parseStatusField(rest[open+1 : open+end])
+		if err != nil {
+			return nil, err
+		}
+		s.parts = append(s.parts, part)
+		rest = rest[open+end+1:]
+	}
+	return s, nil
+}
+
+func parseStatusField(s string) (statusPart, error) {
+	name, width := s, 0
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		w, err := strconv.Atoi(s[i+1:])
+		if err != nil || w <= 0 {
+			return statusPart{}, fmt.Errorf("invalid width in '{%s}'", s)
+		}
+		name, width = s[:i], w
+	}
+	for _, f := range statusFields {
+		if f == name {
+			return statusPart{field: name, width: width}, nil
+		}
+	}
+	return statusPart{}, fmt.Errorf("unknown field '{%s}', available are %s", name, strings.Join(statusFields, ", "))
+}
+
+// render returns the line for the display with the given number of characters
+func (s *statusLine) render(values map[string]string, width int) string {
+	texts := make([]string, len(s.parts))
+	used := 0
+	for i, p := range s.parts {
+		switch {
+		case p.field == "":
+			texts[i] = p.text
+		case p.width > 0:
+			texts[i] = fit(values[p.field], p.width)
+		default:
+			texts[i] = values[p.field]
+		}
+		used += utf8.RuneCountInString(texts[i])
+	}
+	// the address is shortened first, then the other flexible fields in their order
+	order := []int{}
+	for i, p := range s.parts {
+		if p.field == "ip" && p.width == 0 {
+			order = append(order, i)
+		}
+	}
+	for i, p := range s.parts {
+		if p.field != "" && p.field != "ip" && p.width == 0 {
+			order = append(order, i)
+		}
+	}
+	for _, i := range order {
+		if used <= width {
+			break
+		}
+		p := s.parts[i]
+		n := utf8.RuneCountInString(texts[i])
+		keep := n - (used - width)
+		if keep < 0 {
+			keep = 0
+		}
+		if p.field == "ip" && keep > 2 {
+			texts[i] = shortAddress(texts[i], keep)
+		} else {
+			texts[i] = string([]rune(texts[i])[:keep])
+		}
+		used -= n - utf8.RuneCountInString(texts[i])
+	}
+	line := []rune(strings.Join(texts, ""))
+	if len(line) > width {
+		line = line[:width]
+	}
+	return string(line)
+}
+
+// truncates or pads the text to exactly width characters
+func fit(text string, width int) string {
+	r := []rune(text)
+	if len(r) > width {
+		return string(r[:width])
+	}
+	return text + strings.Repeat(" ", width-len(r))
+}
+
+// values of the fields of the status line
+func (c *Controller) statusValues(fan string, isAlive bool, source string) map[string]string {
+	// the announced hostname is easier to remember than the IP address
+	address, _ := c.addresses()
+	if c.mdns != nil {
+		address = c.mdns.Host()
+	}
+	// the heartbeat is a '!' while InfluxDB, MQTT or the clock is not ok
+	alive := " "
+	if isAlive {
+		alive = "*"
+		if !c.connectivity().Online {
+			alive = "!"
+		}
+	}
+	return map[string]string{
+		"ip":       address,
+		"alive":    alive,
+		"override": sourceLetter(source),
+		"fan":      fan,
+		"time":     time.Now().Format("15:04"),
+	}
+}
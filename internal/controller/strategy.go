@@ -0,0 +1,258 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/expr"
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+// control strategies of the automatic venting
+const (
+	STRATEGY_DEW_POINT    = "dew_point"    // dew point difference (default)
+	STRATEGY_ABS_HUMIDITY = "abs_humidity" // difference of the absolute humidity
+	STRATEGY_TARGET_RH    = "target_rh"    // inside humidity above a target, if the outside air is drier
+	STRATEGY_SCHEDULE     = "schedule"     // time windows only
+	STRATEGY_RULE         = "rule"         // custom expression
+
+	DEF_ABS_DIFF_MIN   = 1.0 // g/m³
+	DEF_ABS_HYSTERESIS = 0.5 // g/m³
+	DEF_TARGET_RH      = 60  // %
+	DEF_RH_HYSTERESIS  = 3   // %
+
+	REASON_ABS_ABOVE      = "abs_humidity_above_threshold"
+	REASON_ABS_BELOW      = "abs_humidity_below_threshold"
+	REASON_ABOVE_TARGET   = "humidity_above_target"
+	REASON_TARGET_REACHED = "humidity_target_reached"
+	REASON_OUTSIDE_WETTER = "outside_air_not_drier"
+	REASON_IN_SCHEDULE    = "within_schedule"
+	REASON_RULE_TRUE      = "rule_true"
+	REASON_RULE_FALSE     = "rule_false"
+	REASON_RULE_ERROR     = "rule_error"
+)
+
+// variables of the custom rule, t_i and t_o are short for temp_i and temp_o
+var ruleVars = []string{"temp_i", "temp_o", "t_i", "t_o", "hum_i", "hum_o", "dp_i", "dp_o", "delta_dp",
+	"abs_i", "abs_o", "delta_abs", "venting", "hour", "minute"}
+
+type strategyConfig struct {
+	Type string `json:"type"` // dew_point, abs_humidity, target_rh, schedule or rule
+	// abs_humidity
+	AbsDiffMin    float32 `json:"abs_diff_min"`   // minimal difference of the absolute humidity in g/m³
+	AbsHysteresis float32 `json:"abs_hysteresis"` // in g/m³
+	// target_rh
+	TargetRh     float32 `json:"target_rh"`     // inside humidity in %
+	RhHysteresis float32 `json:"rh_hysteresis"` // in %
+	// schedule
+	Windows []string `json:"windows"` // time windows with venting, e.g. "10:00-12:00"
+	// rule
+	Rule string `json:"rule"` // the fan runs while it's true, e.g. "dp_i - dp_o > 4 and hum_i > 55 and t_o > -5"
+}
+
+// StrategyInput are the values of a cycle for the decision
+type StrategyInput struct {
+	Now         time.Time
+	ClockValid  bool
+	TempInside  float32
+	TempOutside float32
+	HumInside   float32
+	HumOutside  float32
+	DeltaTP     float32       // dew point difference inside - outside
+	Hysteresis  float32       // of the dew point difference, it's adapted at runtime
+	Limits      controlConfig // the temperature limits apply to all strategies
+}
+
+// Strategy decides about the venting, current is the venting state of the last cycle
+type Strategy interface {
+	Name() string
+	Decide(current bool, in StrategyInput) (bool, string)
+}
+
+// returns the strategy of the configuration, an empty type is the dew point difference
+func newStrategy(cfg strategyConfig) (Strategy, error) {
+	switch strings.ToLower(cfg.Type) {
+	case "", STRATEGY_DEW_POINT:
+		return dewPointStrategy{}, nil
+	case STRATEGY_ABS_HUMIDITY:
+		if cfg.AbsDiffMin <= 0 {
+			cfg.AbsDiffMin = DEF_ABS_DIFF_MIN
+		}
+		if cfg.AbsHysteresis <= 0 {
+			cfg.AbsHysteresis = DEF_ABS_HYSTERESIS
+		}
+		return absHumidityStrategy{cfg: cfg}, nil
+	case STRATEGY_TARGET_RH:
+		if cfg.TargetRh <= 0 {
+			cfg.TargetRh = DEF_TARGET_RH
+		}
+		if cfg.RhHysteresis <= 0 {
+			cfg.RhHysteresis = DEF_RH_HYSTERESIS
+		}
+		return targetRhStrategy{cfg: cfg}, nil
+	case STRATEGY_SCHEDULE:
+		if len(cfg.Windows) == 0 {
+			return nil, fmt.Errorf("the strategy %s needs windows", STRATEGY_SCHEDULE)
+		}
+		s := scheduleStrategy{}
+		for _, w := range cfg.Windows {
+			tw, err := parseWindow(w)
+			if err != nil {
+				return nil, err
+			}
+			s.windows = append(s.windows, tw)
+		}
+		return s, nil
+	case STRATEGY_RULE:
+		if strings.TrimSpace(cfg.Rule) == "" {
+			return nil, fmt.Errorf("the strategy %s needs a rule", STRATEGY_RULE)
+		}
+		cond, err := expr.Parse(cfg.Rule, ruleVars)
+		if err != nil {
+			return nil, fmt.Errorf("rule: %s", err)
+		}
+		return ruleStrategy{cond: cond}, nil
+	}
+	return nil, fmt.Errorf("unknown strategy '%s'", cfg.Type)
+}
+
+// no venting when it's too cold inside or outside
+func temperatureLimits(in StrategyInput) (bool, string) {
+	if in.TempInside < in.Limits.TempInsideMin {
+		return false, REASON_TEMP_INSIDE_LOW
+	}
+	if in.TempOutside < in.Limits.TempOutsideMin {
+		return false, REASON_TEMP_OUTSIDE_LOW
+	}
+	return true, ""
+}
+
+// the classic control with the dew point difference
+type dewPointStrategy struct{}
+
+func (dewPointStrategy) Name() string {
+	return STRATEGY_DEW_POINT
+}
+
+func (dewPointStrategy) Decide(current bool, in StrategyInput) (bool, string) {
+	return decideVenting(current, in.Limits, in.DeltaTP, in.Hysteresis, in.TempInside, in.TempOutside, in.HumInside)
+}
+
+// the difference of the absolute humidity is the amount of water removed per m³ of air
+type absHumidityStrategy struct {
+	cfg strategyConfig
+}
+
+func (absHumidityStrategy) Name() string {
+	return STRATEGY_ABS_HUMIDITY
+}
+
+func (s absHumidityStrategy) Decide(current bool, in StrategyInput) (bool, string) {
+	if ok, reason := temperatureLimits(in); !ok {
+		return false, reason
+	}
+	if in.HumInside < in.Limits.HumInsideMin {
+		return false, REASON_HUMIDITY_LOW
+	}
+	delta := calcAbsHumidity(in.TempInside, in.HumInside) - calcAbsHumidity(in.TempOutside, in.HumOutside)
+	if delta > s.cfg.AbsDiffMin+s.cfg.AbsHysteresis {
+		return true, REASON_ABS_ABOVE
+	}
+	if delta < s.cfg.AbsDiffMin {
+		return false, REASON_ABS_BELOW
+	}
+	return current, REASON_HYSTERESIS
+}
+
+// vents while the inside humidity is above the target, as long as the outside air is drier
+type targetRhStrategy struct {
+	cfg strategyConfig
+}
+
+func (targetRhStrategy) Name() string {
+	return STRATEGY_TARGET_RH
+}
+
+func (s targetRhStrategy) Decide(current bool, in StrategyInput) (bool, string) {
+	if ok, reason := temperatureLimits(in); !ok {
+		return false, reason
+	}
+	if in.DeltaTP <= 0 {
+		return false, REASON_OUTSIDE_WETTER
+	}
+	if in.HumInside > s.cfg.TargetRh+s.cfg.RhHysteresis {
+		return true, REASON_ABOVE_TARGET
+	}
+	if in.HumInside <= s.cfg.TargetRh {
+		return false, REASON_TARGET_REACHED
+	}
+	return current, REASON_HYSTERESIS
+}
+
+// vents within the time windows regardless of the humidity, e.g. for a fixed air exchange
+type scheduleStrategy struct {
+	windows []timeWindow
+}
+
+func (scheduleStrategy) Name() string {
+	return STRATEGY_SCHEDULE
+}
+
+func (s scheduleStrategy) Decide(_ bool, in StrategyInput) (bool, string) {
+	if ok, reason := temperatureLimits(in); !ok {
+		return false, reason
+	}
+	if !in.ClockValid {
+		return false, REASON_SCHEDULE
+	}
+	for _, w := range s.windows {
+		if w.contains(in.Now) {
+			return true, REASON_IN_SCHEDULE
+		}
+	}
+	return false, REASON_SCHEDULE
+}
+
+// vents while the expression of the user is true, with "venting" it can have a hysteresis
+type ruleStrategy struct {
+	cond *expr.Expr
+}
+
+func (ruleStrategy) Name() string {
+	return STRATEGY_RULE
+}
+
+func (s ruleStrategy) Decide(current bool, in StrategyInput) (bool, string) {
+	if ok, reason := temperatureLimits(in); !ok {
+		return false, reason
+	}
+	absInside, absOutside := calcAbsHumidity(in.TempInside, in.HumInside), calcAbsHumidity(in.TempOutside, in.HumOutside)
+	dpInside, dpOutside := calcDewPoint(in.TempInside, in.HumInside), calcDewPoint(in.TempOutside, in.HumOutside)
+	vars := expr.Vars{
+		"temp_i":    float64(in.TempInside),
+		"temp_o":    float64(in.TempOutside),
+		"t_i":       float64(in.TempInside),
+		"t_o":       float64(in.TempOutside),
+		"hum_i":     float64(in.HumInside),
+		"hum_o":     float64(in.HumOutside),
+		"dp_i":      float64(dpInside),
+		"dp_o":      float64(dpOutside),
+		"delta_dp":  float64(in.DeltaTP),
+		"abs_i":     float64(absInside),
+		"abs_o":     float64(absOutside),
+		"delta_abs": float64(absInside - absOutside),
+		"venting":   expr.Bool(current),
+		"hour":      float64(in.Now.Hour()),
+		"minute":    float64(in.Now.Minute()),
+	}
+	on, err := s.cond.True(vars)
+	if err != nil {
+		logger.Warnf("Rule '%s': %s", s.cond, err)
+		return false, REASON_RULE_ERROR
+	}
+	if on {
+		return true, REASON_RULE_TRUE
+	}
+	return false, REASON_RULE_FALSE
+}
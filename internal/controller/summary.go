@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+
+	"github.com/aluedtke7/dew_point_fan/internal/notify"
+)
+
+// sends the daily summary email at the configured time, should be started as goroutine
+func runDailySummary(cfg notifyConfig, stats *statistics, energy *energyMeter, runtimeHours *runtimeCounter, clock *clockCheck) {
+	if cfg.SummaryTime == "" || cfg.Smtp.Host == "" {
+		return
+	}
+	var hour, minute int
+	if _, err := fmt.Sscanf(cfg.SummaryTime, "%d:%d", &hour, &minute); err != nil {
+		logger.Errorf("Invalid summary time '%s': %s", cfg.SummaryTime, err)
+		return
+	}
+	mailer := notify.NewSmtp(cfg.Smtp)
+	lastSent := ""
+	for {
+		now := time.Now()
+		today := now.Format(DATE_FORMAT)
+		if clock.plausible() && lastSent != today && (now.Hour() > hour || (now.Hour() == hour && now.Minute() >= minute)) {
+			lastSent = today
+			if err := mailer.Send(dailySummary(stats.response(), energy.response(), runtimeHours.response())); err != nil {
+				logger.Errorf("Couldn't send daily summary: %s", err)
+			}
+		}
+		time.Sleep(time.Minute)
+	}
+}
+
+func dailySummary(st StatsResponse, en EnergyResponse, rt RuntimeResponse) notify.Message {
+	var sb strings.Builder
+	day := st.Today
+	if len(st.Days) > 0 {
+		day = st.Days[len(st.Days)-1]
+	}
+	sb.WriteString(fmt.Sprintf("Summary of %s\n\n", day.Date))
+	sb.WriteString(fmt.Sprintf("Fan runtime:        %.0f min\n", day.RuntimeMinutes))
+	sb.WriteString(fmt.Sprintf("Switch cycles:      %d\n", day.SwitchCycles))
+	sb.WriteString(fmt.Sprintf("Inside humidity:    min %.1f%%, max %.1f%%, avg %.1f%%\n",
+		day.HumInside.Min, day.HumInside.Max, day.HumInside.Avg))
+	sb.WriteString(fmt.Sprintf("Dew point delta:    min %.1f, max %.1f, avg %.1f\n",
+		day.DeltaDewPoint.Min, day.DeltaDewPoint.Max, day.DeltaDewPoint.Avg))
+	sb.WriteString(fmt.Sprintf("Moisture removed:   %.0f g\n", day.MoistureRemoved))
+	sb.WriteString(fmt.Sprintf("Energy:             %.3f kWh (month %.3f kWh)\n", en.Yesterday, en.Month))
+	sb.WriteString(fmt.Sprintf("\nTotal fan runtime:  %.1f h since %s\n", rt.Hours, rt.Since))
+	return notify.Message{Key: "daily_summary", Title: "Dew Point Fan: daily summary", Text: sb.String()}
+}
@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/gpioio"
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"periph.io/x/conn/v3/gpio"
+)
+
+const (
+	SWITCH_PIN   = "GPIO22"
+	PULL_FLOAT   = "float"
+	PULL_UP      = "up"
+	PULL_DOWN    = "down"
+	DEF_DEBOUNCE = 50 // ms
+)
+
+type switchConfig struct {
+	Pull     string `json:"pull"`     // pull resistor of GPIO22: "float" (default), "up" or "down"
+	Debounce int    `json:"debounce"` // time in ms the level must be stable
+}
+
+// switchInput reads the state of the hardware 3 state switch (GPIO22, active low). Changes
+// are detected with edge interrupts and debounced, so they are registered immediately.
+type switchInput struct {
+	pin      gpioio.Pin
+	debounce time.Duration
+	edges    bool
+	level    int32 // debounced level, 1 = high, accessed atomically
+}
+
+func parsePull(pull string) (gpio.Pull, error) {
+	switch strings.ToLower(pull) {
+	case "", PULL_FLOAT:
+		return gpio.Float, nil
+	case PULL_UP:
+		return gpio.PullUp, nil
+	case PULL_DOWN:
+		return gpio.PullDown, nil
+	}
+	return gpio.PullNoChange, fmt.Errorf("unknown pull '%s'", pull)
+}
+
+func newSwitchInput(cfg switchConfig) (*switchInput, error) {
+	pull, err := parsePull(cfg.Pull)
+	if err != nil {
+		return nil, err
+	}
+	s := &switchInput{pin: gpioio.ByName(SWITCH_PIN), debounce: time.Duration(cfg.Debounce) * time.Millisecond, edges: true}
+	if s.pin == nil {
+		return nil, fmt.Errorf("failed to find %s", SWITCH_PIN)
+	}
+	if err = s.pin.In(pull, gpio.BothEdges); err != nil {
+		// without edge detection the switch is read once per cycle
+		logger.Warnf("No edge detection on %s, the switch is polled: %s", SWITCH_PIN, err)
+		s.edges = false
+		if err = s.pin.In(pull, gpio.NoEdge); err != nil {
+			return nil, err
+		}
+	}
+	s.read()
+	return s, nil
+}
+
+// returns the level of the pin after it was stable for the debounce time
+func debouncedLevel(pin gpioio.Pin, debounce time.Duration) gpio.Level {
+	l := pin.Read()
+	stableSince := time.Now()
+	for time.Since(stableSince) < debounce {
+		time.Sleep(5 * time.Millisecond)
+		if n := pin.Read(); n != l {
+			l = n
+			stableSince = time.Now()
+		}
+	}
+	return l
+}
+
+// stores the level and returns true, if it has changed
+func (s *switchInput) store(l gpio.Level) bool {
+	var v int32
+	if l == gpio.High {
+		v = 1
+	}
+	return atomic.SwapInt32(&s.level, v) != v
+}
+
+// reads the debounced level and returns true, if the fan is on
+func (s *switchInput) read() bool {
+	s.store(debouncedLevel(s.pin, s.debounce))
+	return s.isOn()
+}
+
+// returns the last debounced state, true if the fan is on
+func (s *switchInput) isOn() bool {
+	return atomic.LoadInt32(&s.level) == 0
+}
+
+// waits for edges and calls onChange with the new state
+func (s *switchInput) watch(onChange func(on bool)) {
+	if !s.edges {
+		return
+	}
+	for {
+		if !s.pin.WaitForEdge(time.Minute) {
+			continue
+		}
+		if s.store(debouncedLevel(s.pin, s.debounce)) {
+			onChange(s.isOn())
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/gpioio"
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"periph.io/x/conn/v3/gpio"
+)
+
+const TACHO_WINDOW = 5 * time.Second
+
+type tachoConfig struct {
+	Pin    string `json:"pin"`     // input for the tach signal of the fan, e.g. "GPIO16", empty to disable
+	Pulses int    `json:"pulses"`  // pulses per revolution, 2 for most PC fans
+	MinRpm int    `json:"min_rpm"` // the fan is stalled below this speed
+	Grace  int    `json:"grace"`   // time in s the fan may run below min_rpm, after it was switched on
+}
+
+// tachometer counts the pulses of the tach signal (open collector, pull up) and calculates the speed
+type tachometer struct {
+	cfg    tachoConfig
+	pin    gpioio.Pin
+	pulses int64 // accessed atomically
+	rpm    int32 // speed of the last window, accessed atomically
+}
+
+func newTachometer(cfg tachoConfig) (*tachometer, error) {
+	t := &tachometer{cfg: cfg}
+	if cfg.Pin == "" {
+		return t, nil
+	}
+	if t.cfg.Pulses <= 0 {
+		t.cfg.Pulses = 2
+	}
+	t.pin = gpioio.ByName(cfg.Pin)
+	if t.pin == nil {
+		return nil, fmt.Errorf("failed to find tacho pin %s", cfg.Pin)
+	}
+	if err := t.pin.In(gpio.PullUp, gpio.FallingEdge); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// returns true if a tach signal is configured
+func (t *tachometer) enabled() bool {
+	return t.pin != nil
+}
+
+// counts the pulses, should be started as goroutine
+func (t *tachometer) count() {
+	if t.pin == nil {
+		return
+	}
+	for {
+		if t.pin.WaitForEdge(time.Second) {
+			atomic.AddInt64(&t.pulses, 1)
+		}
+	}
+}
+
+// calculates the speed every TACHO_WINDOW, should be started as goroutine
+func (t *tachometer) measure() {
+	if t.pin == nil {
+		return
+	}
+	last := time.Now()
+	for {
+		time.Sleep(TACHO_WINDOW)
+		now := time.Now()
+		n := atomic.SwapInt64(&t.pulses, 0)
+		rpm := float64(n) / float64(t.cfg.Pulses) / now.Sub(last).Minutes()
+		atomic.StoreInt32(&t.rpm, int32(rpm+0.5))
+		last = now
+		logger.Debugf("Fan speed: %d rpm", int32(rpm+0.5))
+	}
+}
+
+// returns the speed in rpm
+func (t *tachometer) speed() int {
+	return int(atomic.LoadInt32(&t.rpm))
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+// directory of the ACME account and the certificates within the data dir
+const ACME_CACHE_DIR = "acme"
+
+// HTTPS for a dashboard outside the LAN, either with a certificate of Let's Encrypt or with the
+// files of another ACME client (e.g. certbot or acme.sh with a DNS challenge)
+type tlsConfig struct {
+	Listen    string   `json:"listen"`    // address of the HTTPS server, e.g. ":443", disabled if empty
+	CertFile  string   `json:"cert_file"` // certificate chain in PEM, reloaded when the file changes
+	KeyFile   string   `json:"key_file"`
+	Acme      bool     `json:"acme"`      // certificates of Let's Encrypt via the TLS-ALPN challenge
+	Domains   []string `json:"domains"`   // host names of the certificate, they must point to this device
+	Email     string   `json:"email"`     // contact of the ACME account, optional
+	Directory string   `json:"directory"` // URL of the ACME directory, default Let's Encrypt
+}
+
+func (t tlsConfig) validate() []error {
+	if t.Listen == "" {
+		return nil
+	}
+	var errs []error
+	if _, _, err := net.SplitHostPort(t.Listen); err != nil {
+		errs = append(errs, err)
+	}
+	files := t.CertFile != "" || t.KeyFile != ""
+	switch {
+	case t.Acme && files:
+		errs = append(errs, errors.New("either acme or cert_file and key_file"))
+	case t.Acme && len(t.Domains) == 0:
+		errs = append(errs, errors.New("acme needs the domains of the certificate"))
+	case !t.Acme && (t.CertFile == "" || t.KeyFile == ""):
+		errs = append(errs, errors.New("acme or cert_file and key_file are needed"))
+	}
+	return errs
+}
+
+// Config returns the TLS configuration of the HTTPS server, the ACME account and the certificates
+// are stored in dataDir
+func (t tlsConfig) Config(dataDir string) (*tls.Config, error) {
+	if errs := t.validate(); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	if !t.Acme {
+		kp := &keyPair{certFile: t.CertFile, keyFile: t.KeyFile}
+		if _, err := kp.get(nil); err != nil {
+			return nil, err
+		}
+		return &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: kp.get}, nil
+	}
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(t.Domains...),
+		Cache:      autocert.DirCache(filepath.Join(dataDir, ACME_CACHE_DIR)),
+		Email:      t.Email,
+	}
+	if t.Directory != "" {
+		m.Client = &acme.Client{DirectoryURL: t.Directory}
+	}
+	logger.Infof("HTTPS with certificates of ACME for %s", strings.Join(t.Domains, ", "))
+	cfg := m.TLSConfig()
+	cfg.MinVersion = tls.VersionTLS12
+	return cfg, nil
+}
+
+// keyPair loads the certificate again when the file was changed, e.g. after a renewal
+type keyPair struct {
+	certFile string
+	keyFile  string
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modTime  time.Time
+}
+
+func (k *keyPair) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	st, err := os.Stat(k.certFile)
+	if err != nil {
+		if k.cert != nil {
+			return k.cert, nil
+		}
+		return nil, err
+	}
+	if k.cert != nil && st.ModTime().Equal(k.modTime) {
+		return k.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(k.certFile, k.keyFile)
+	if err != nil {
+		// e.g. the certificate was written, but not yet the key
+		if k.cert != nil {
+			logger.Warnf("Couldn't load the certificate again: %s", err)
+			return k.cert, nil
+		}
+		return nil, fmt.Errorf("couldn't load the certificate: %s", err)
+	}
+	if k.cert != nil {
+		logger.Infof("Certificate %s loaded again", k.certFile)
+	}
+	k.cert, k.modTime = &cert, st.ModTime()
+	return k.cert, nil
+}
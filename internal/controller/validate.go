@@ -0,0 +1,265 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aluedtke7/dew_point_fan/internal/sensor"
+)
+
+// ValidateFile reads the configuration file and checks it: syntax errors with their line,
+// keys that don't belong to the configuration (typos are silently ignored otherwise) and
+// the checks of Validate.
+func ValidateFile(path string) []error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []error{err}
+	}
+	cfg, err := ReadConfig(path)
+	if err != nil && err != errSensorCount {
+		return []error{withLine(data, err)}
+	}
+	var errs []error
+	if err != nil {
+		errs = append(errs, err)
+	}
+	keys, err := unknownKeys(data)
+	if err != nil {
+		return append(errs, withLine(data, err))
+	}
+	for _, k := range keys {
+		errs = append(errs, fmt.Errorf("unknown key '%s'", k))
+	}
+	return append(errs, cfg.Validate()...)
+}
+
+// adds the line of the error position to JSON errors
+func withLine(data []byte, err error) error {
+	var offset int64 = -1
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) {
+		offset = syntaxErr.Offset
+	} else if errors.As(err, &typeErr) {
+		offset = typeErr.Offset
+	}
+	if offset < 0 || offset > int64(len(data)) {
+		return err
+	}
+	return fmt.Errorf("line %d: %w", bytes.Count(data[:offset], []byte("\n"))+1, err)
+}
+
+// returns the keys of the JSON data that don't match a field of the configuration, e.g. "control.diff_mni"
+func unknownKeys(data []byte) ([]string, error) {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	var keys []string
+	collectUnknownKeys(raw, reflect.TypeOf(Config{}), "", &keys)
+	sort.Strings(keys)
+	return keys, nil
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+func collectUnknownKeys(v interface{}, t reflect.Type, path string, keys *[]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		return
+	}
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := map[string]reflect.Type{}
+		jsonFields(t, fields)
+		for k, val := range obj {
+			// encoding/json matches the keys case-insensitively
+			ft, ok := fields[strings.ToLower(k)]
+			if !ok {
+				*keys = append(*keys, join(k))
+				continue
+			}
+			collectUnknownKeys(val, ft, join(k), keys)
+		}
+	case reflect.Slice, reflect.Array:
+		arr, _ := v.([]interface{})
+		for i, e := range arr {
+			collectUnknownKeys(e, t.Elem(), path+"["+strconv.Itoa(i)+"]", keys)
+		}
+	case reflect.Map:
+		obj, _ := v.(map[string]interface{})
+		for k, val := range obj {
+			collectUnknownKeys(val, t.Elem(), join(k), keys)
+		}
+	}
+}
+
+// collects the JSON names of the fields of a struct, including embedded structs
+func jsonFields(t reflect.Type, fields map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			jsonFields(f.Type, fields)
+			continue
+		}
+		if f.PkgPath != "" || tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		fields[strings.ToLower(tag)] = f.Type
+	}
+}
+
+// checks the thresholds of the control, prefix is the part of the configuration
+func (l controlConfig) validate(prefix string) []error {
+	var errs []error
+	if l.DiffMin <= 0 || l.DiffMin > 20 {
+		errs = append(errs, fmt.Errorf("%s: diff_min %.1f is out of range (0...20)", prefix, l.DiffMin))
+	}
+	if l.Hysteresis < 0 || l.Hysteresis > l.DiffMin {
+		// the fan would run until the difference is almost 0 or negative
+		errs = append(errs, fmt.Errorf("%s: hysteresis %.1f must be between 0 and diff_min (%.1f)", prefix, l.Hysteresis, l.DiffMin))
+	}
+	if l.HumInsideMin < 0 || l.HumInsideMin > 100 {
+		errs = append(errs, fmt.Errorf("%s: hum_inside_min %.1f is out of range (0...100)", prefix, l.HumInsideMin))
+	}
+	temps := []struct {
+		name  string
+		value float32
+	}{{"temp_inside_min", l.TempInsideMin}, {"temp_outside_min", l.TempOutsideMin}}
+	for _, t := range temps {
+		if t.value < -40 || t.value > 80 {
+			errs = append(errs, fmt.Errorf("%s: %s %.1f is out of the range of the sensors (-40...80)", prefix, t.name, t.value))
+		}
+	}
+	return errs
+}
+
+// pinUse is a GPIO pin and the part of the configuration that uses it
+type pinUse struct {
+	pin  string
+	user string
+}
+
+// returns all GPIO pins in use, the names are normalized to "GPIOn"
+func (cfg Config) pinUses() []pinUse {
+	uses := []pinUse{{SWITCH_PIN, "switch"}}
+	add := func(pin, user string) {
+		if pin != "" {
+			uses = append(uses, pinUse{normalizePin(pin), user})
+		}
+	}
+	var addSensor func(sc sensor.Config, user string)
+	addSensor = func(sc sensor.Config, user string) {
+		switch strings.ToLower(sc.Type) {
+		case "", sensor.TypeDHT22:
+			add("GPIO"+strconv.Itoa(sc.Pin), user)
+		case sensor.TypeRedundant:
+			for _, m := range sc.Sensors {
+				addSensor(m, user+"/"+m.Name)
+			}
+		}
+	}
+	for _, sc := range cfg.Sensors {
+		addSensor(sc, "sensor "+sc.Name)
+	}
+	if cfg.Actuator.UsesGpio() {
+		pin := cfg.Actuator.Pin
+		if pin == "" {
+			pin = FAN_PIN
+		}
+		add(pin, "actuator")
+	}
+	for _, b := range cfg.buttons() {
+		add(b.Pin, "button")
+	}
+	add(cfg.Frost.HeaterPin, "frost.heater_pin")
+	add(cfg.Contact.Pin, "contact")
+	add(cfg.Weather.RainPin, "weather.rain_pin")
+	add(cfg.Tacho.Pin, "tacho")
+	add(cfg.Indicators.GreenPin, "indicators.green_pin")
+	add(cfg.Indicators.RedPin, "indicators.red_pin")
+	add(cfg.Indicators.BuzzerPin, "indicators.buzzer_pin")
+	for _, z := range cfg.Zones {
+		addSensor(z.Sensor, "zone "+z.Name)
+		if z.Actuator.UsesGpio() {
+			add(z.Actuator.Pin, "zone "+z.Name)
+		}
+	}
+	return uses
+}
+
+// "25", "gpio25" and "GPIO25" are the same pin
+func normalizePin(pin string) string {
+	pin = strings.ToUpper(strings.TrimSpace(pin))
+	if _, err := strconv.Atoi(pin); err == nil {
+		return "GPIO" + pin
+	}
+	return pin
+}
+
+// returns an error for every GPIO pin that is used more than once
+func (cfg Config) validatePins() []error {
+	users := map[string][]string{}
+	var pins []string
+	for _, u := range cfg.pinUses() {
+		if users[u.pin] == nil {
+			pins = append(pins, u.pin)
+		}
+		users[u.pin] = append(users[u.pin], u.user)
+	}
+	var errs []error
+	for _, p := range pins {
+		if len(users[p]) > 1 {
+			errs = append(errs, fmt.Errorf("%s is used more than once: %s", p, strings.Join(users[p], ", ")))
+		}
+	}
+	return errs
+}
+
+// returns an error for every configured service without its password or token
+func (cfg Config) validateSecrets() []error {
+	cfg = cfg.withSecrets()
+	var errs []error
+	url := cfg.Influx.Url
+	if u, ok := os.LookupEnv("INFLUX_SRV_URL"); ok {
+		url = u
+	}
+	if url != "" && (cfg.Influx.Backend == "" || cfg.Influx.Backend == BACKEND_INFLUX2) {
+		if cfg.Influx.Token == "" {
+			errs = append(errs, errors.New("influx: the token is missing, set INFLUX_DP_TOKEN or INFLUX_DP_TOKEN_FILE"))
+		}
+	}
+	if cfg.Mqtt.Broker != "" && cfg.Mqtt.Username != "" && cfg.Mqtt.Password == "" {
+		errs = append(errs, errors.New("mqtt: the password is missing"))
+	}
+	if (cfg.Notify.Pushover.Token == "") != (cfg.Notify.Pushover.User == "") {
+		errs = append(errs, errors.New("notify.pushover: token and user are both required"))
+	}
+	if cfg.Notify.Smtp.Host != "" && cfg.Notify.Smtp.Username != "" && cfg.Notify.Smtp.Password == "" {
+		errs = append(errs, errors.New("notify.smtp: the password is missing"))
+	}
+	return errs
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"os"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+const WATCHDOG_FEED_INTERVAL = 5 * time.Second
+
+type watchdogConfig struct {
+	Device string `json:"device"` // hardware watchdog device, e.g. "/dev/watchdog", empty to disable
+	// the watchdog isn't fed anymore, when no measurement cycle was completed for this time in seconds
+	Timeout int `json:"timeout"`
+}
+
+// hardwareWatchdog feeds the kernel watchdog as long as the main loop is running. When the
+// main loop or the kernel hangs, the Raspberry reboots and the fan relay returns to its default state.
+type hardwareWatchdog struct {
+	file    *os.File
+	timeout time.Duration
+}
+
+func newHardwareWatchdog(cfg watchdogConfig) (*hardwareWatchdog, error) {
+	w := &hardwareWatchdog{timeout: time.Duration(cfg.Timeout) * time.Second}
+	if cfg.Device == "" {
+		return w, nil
+	}
+	f, err := os.OpenFile(cfg.Device, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	w.file = f
+	logger.Infof("Hardware watchdog %s opened", cfg.Device)
+	return w, nil
+}
+
+// feeds the watchdog while the last cycle is recent enough, should be started as goroutine
+func (w *hardwareWatchdog) run(lastCycle func() time.Time) {
+	if w.file == nil {
+		return
+	}
+	for {
+		if since := time.Since(lastCycle()); since < w.timeout {
+			if _, err := w.file.Write([]byte{0}); err != nil {
+				logger.Errorf("Couldn't feed the hardware watchdog: %s", err)
+			}
+		} else {
+			logger.Errorf("No cycle completed for %.0f s, hardware watchdog isn't fed anymore", since.Seconds())
+		}
+		time.Sleep(WATCHDOG_FEED_INTERVAL)
+	}
+}
+
+// disables the watchdog with the magic character before a regular exit
+func (w *hardwareWatchdog) close() {
+	if w.file == nil {
+		return
+	}
+	if _, err := w.file.Write([]byte("V")); err != nil {
+		logger.Errorf("Couldn't disable the hardware watchdog: %s", err)
+	}
+	_ = w.file.Close()
+}
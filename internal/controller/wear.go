@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/actuator"
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+const DEF_WEAR_WARN = 90 // percent of service_switches
+
+var errSwitchSkipped = errors.New("relais switch skipped")
+
+// RelayResponse is the wear state of the relais
+type RelayResponse struct {
+	Switches        int64           `json:"switches"` // switch operations since the last reset
+	Since           string          `json:"since"`    // time of the last reset
+	LastHour        int             `json:"last_hour"`
+	MaxPerHour      int             `json:"max_per_hour"`
+	ServiceSwitches int64           `json:"service_switches"`
+	ServiceDue      bool            `json:"service_due"` // the count reached warn_percent of service_switches
+	Actuator        actuator.Status `json:"actuator"`
+}
+
+// guardedRelay counts the switch operations of the relais (persisted in the state file, if there is one) and
+// limits the switching rate to extend the life of the relais and the fan motor
+type guardedRelay struct {
+	mu       sync.Mutex
+	relay    *actuator.Monitor
+	cfg      actuatorConfig
+	state    *stateStore // nil for the fans of additional zones
+	switches int64
+	since    string
+	recent   []time.Time // switch operations of the last hour
+	last     time.Time   // time of the last switch operation
+	on       bool        // current state of the relais
+	known    bool        // false until the relais was set the first time
+	limited  bool        // a switch was skipped, logged once
+}
+
+func newGuardedRelay(cfg actuatorConfig, state *stateStore) *guardedRelay {
+	g := &guardedRelay{cfg: cfg, state: state}
+	if state != nil {
+		st := state.get()
+		g.switches, g.since = st.RelaySwitches, st.RelaySince
+	}
+	if g.since == "" {
+		g.since = time.Now().Format(DATE_TIME_FORMAT)
+	}
+	return g
+}
+
+// removes the switch operations older than an hour
+func (g *guardedRelay) prune(now time.Time) {
+	i := 0
+	for i < len(g.recent) && now.Sub(g.recent[i]) >= time.Hour {
+		i++
+	}
+	g.recent = g.recent[i:]
+}
+
+// switches the relais, returns errSwitchSkipped if the dead time since the last switch operation
+// isn't over or the maximum switching rate is reached
+func (g *guardedRelay) set(on bool) error {
+	return g.switchTo(on, false)
+}
+
+// switches the relais even if the dead time isn't over or the maximum switching rate is reached,
+// for the safe state and the safety overrides (frost protection, maintenance)
+func (g *guardedRelay) force(on bool) error {
+	return g.switchTo(on, true)
+}
+
+func (g *guardedRelay) switchTo(on, forced bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.known && on == g.on {
+		return g.relay.Set(on)
+	}
+	now := time.Now()
+	g.prune(now)
+	if dead := time.Duration(g.cfg.DeadTime) * time.Second; !forced && g.known && now.Sub(g.last) < dead {
+		if !g.limited {
+			logger.Infof("Relais switch to %t skipped, dead time of %ds not over", on, g.cfg.DeadTime)
+			g.limited = true
+		}
+		return errSwitchSkipped
+	}
+	if !forced && g.known && g.cfg.MaxPerHour > 0 && len(g.recent) >= g.cfg.MaxPerHour {
+		if !g.limited {
+			logger.Warnf("Relais switch to %t skipped, %d switches in the last hour", on, len(g.recent))
+			g.limited = true
+		}
+		return errSwitchSkipped
+	}
+	if err := g.relay.Set(on); err != nil {
+		return err
+	}
+	g.limited = false
+	if g.known {
+		g.switches++
+		g.recent = append(g.recent, now)
+		g.persist()
+	}
+	g.on = on
+	g.known = true
+	g.last = now
+	return nil
+}
+
+// returns true if the relais should be replaced soon
+func (g *guardedRelay) serviceDue() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.serviceDueLocked()
+}
+
+func (g *guardedRelay) serviceDueLocked() bool {
+	if g.cfg.ServiceSwitches <= 0 {
+		return false
+	}
+	warn := g.cfg.WarnPercent
+	if warn <= 0 {
+		warn = DEF_WEAR_WARN
+	}
+	return g.switches*100 >= g.cfg.ServiceSwitches*int64(warn)
+}
+
+// resets the counter after the relais was replaced
+func (g *guardedRelay) reset() {
+	g.mu.Lock()
+	logger.Infof("Relais switch counter reset at %d switches", g.switches)
+	g.switches = 0
+	g.since = time.Now().Format(DATE_TIME_FORMAT)
+	g.persist()
+	g.mu.Unlock()
+}
+
+// writes the counter to the state file, must be called with the lock held
+func (g *guardedRelay) persist() {
+	if g.state == nil {
+		return
+	}
+	switches, since := g.switches, g.since
+	g.state.update(func(st *persistentState) {
+		st.RelaySwitches = switches
+		st.RelaySince = since
+	})
+}
+
+func (g *guardedRelay) response() RelayResponse {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.prune(time.Now())
+	return RelayResponse{
+		Switches:        g.switches,
+		Since:           g.since,
+		LastHour:        len(g.recent),
+		MaxPerHour:      g.cfg.MaxPerHour,
+		ServiceSwitches: g.cfg.ServiceSwitches,
+		ServiceDue:      g.serviceDueLocked(),
+		Actuator:        g.failures(),
+	}
+}
+
+// reads the actual state of the fan, actuator.ErrNoFeedback if the actuator doesn't report it
+func (g *guardedRelay) actual() (bool, error) {
+	return g.relay.State()
+}
+
+// returns the result of the switch operations, the actuator is missing until New has created it
+func (g *guardedRelay) failures() actuator.Status {
+	if g.relay == nil {
+		return actuator.Status{}
+	}
+	return g.relay.Status()
+}
@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/gpioio"
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"periph.io/x/conn/v3/gpio"
+)
+
+const OPEN_METEO_URL = "https://api.open-meteo.com/v1/forecast?latitude=%f&longitude=%f&current_weather=true"
+
+type weatherConfig struct {
+	RainPin       string   `json:"rain_pin"`        // digital input of a rain sensor, e.g. "GPIO6", empty to disable
+	RainActiveLow bool     `json:"rain_active_low"` // rain is signaled with a low level
+	Latitude      float64  `json:"latitude"`        // location for the weather API (open-meteo.com)
+	Longitude     float64  `json:"longitude"`
+	Conditions    []string `json:"conditions"` // weather conditions that block venting: rain, drizzle, fog, snow, thunderstorm
+	Interval      int      `json:"interval"`   // polling interval of the weather API in s, 0 to disable
+	Lockout       int      `json:"lockout"`    // venting stays blocked for this time in s after the condition ended
+}
+
+type openMeteoResponse struct {
+	CurrentWeather struct {
+		WeatherCode int `json:"weathercode"`
+	} `json:"current_weather"`
+}
+
+// weatherLockout blocks venting while it rains or the weather API reports a bad condition
+type weatherLockout struct {
+	cfg       weatherConfig
+	rainPin   gpioio.Pin
+	mu        sync.Mutex
+	condition string
+	until     time.Time
+}
+
+func newWeatherLockout(cfg weatherConfig) (*weatherLockout, error) {
+	w := &weatherLockout{cfg: cfg}
+	if cfg.RainPin != "" {
+		w.rainPin = gpioio.ByName(cfg.RainPin)
+		if w.rainPin == nil {
+			return nil, fmt.Errorf("failed to find rain sensor pin %s", cfg.RainPin)
+		}
+		if err := w.rainPin.In(gpio.PullUp, gpio.NoEdge); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// maps a WMO weather code to a condition name
+func weatherCondition(code int) string {
+	switch {
+	case code == 45 || code == 48:
+		return "fog"
+	case code >= 51 && code <= 57:
+		return "drizzle"
+	case (code >= 61 && code <= 67) || (code >= 80 && code <= 82):
+		return "rain"
+	case (code >= 71 && code <= 77) || code == 85 || code == 86:
+		return "snow"
+	case code >= 95:
+		return "thunderstorm"
+	}
+	return ""
+}
+
+func (w *weatherLockout) trigger(condition string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if time.Now().After(w.until) {
+		logger.Infof("Weather lockout started: %s", condition)
+	}
+	w.condition = condition
+	w.until = time.Now().Add(time.Duration(w.cfg.Lockout) * time.Second)
+}
+
+// polls the weather API and should be started as goroutine
+func (w *weatherLockout) poll() {
+	if w.cfg.Interval <= 0 {
+		return
+	}
+	url := fmt.Sprintf(OPEN_METEO_URL, w.cfg.Latitude, w.cfg.Longitude)
+	client := &http.Client{Timeout: 10 * time.Second}
+	for {
+		resp, err := client.Get(url)
+		if err != nil {
+			logger.Warnf("Weather API: %s", err)
+		} else {
+			om := &openMeteoResponse{}
+			err = json.NewDecoder(resp.Body).Decode(om)
+			_ = resp.Body.Close()
+			if err != nil {
+				logger.Warnf("Weather API: %s", err)
+			} else {
+				cond := weatherCondition(om.CurrentWeather.WeatherCode)
+				for _, c := range w.cfg.Conditions {
+					if c == cond {
+						w.trigger(cond)
+					}
+				}
+			}
+		}
+		time.Sleep(time.Duration(w.cfg.Interval) * time.Second)
+	}
+}
+
+// checks the rain sensor and returns the blocking condition or an empty string
+func (w *weatherLockout) check() string {
+	if w.rainPin != nil && bool(w.rainPin.Read()) != w.cfg.RainActiveLow {
+		w.trigger("rain")
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if time.Now().After(w.until) {
+		return ""
+	}
+	return w.condition
+}
@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aluedtke7/dew_point_fan/internal/i18n"
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+const (
+	WIRELESS_FILE = "/proc/net/wireless"
+	DEF_WIFI_WEAK = -75 // dBm
+	WIFI_LINK_MAX = 70  // maximum of the link quality of most drivers
+)
+
+type wifiConfig struct {
+	Interface string `json:"interface"` // e.g. "wlan0", default is the first wireless interface
+	Weak      int    `json:"weak"`      // the link is weak below this signal level in dBm, default -75
+}
+
+// WifiInfo is the state of the Wi-Fi link
+type WifiInfo struct {
+	Interface string `json:"interface"`
+	Rssi      int    `json:"rssi"`    // signal level in dBm
+	Quality   int    `json:"quality"` // link quality in %
+	Weak      bool   `json:"weak"`
+}
+
+// wifiMonitor reads the signal level of the Wi-Fi link each cycle
+type wifiMonitor struct {
+	cfg    wifiConfig
+	mu     sync.Mutex
+	last   *WifiInfo // nil without a wireless interface
+	failed bool      // the last read failed, it's only logged once
+}
+
+func newWifiMonitor(cfg wifiConfig) *wifiMonitor {
+	if cfg.Weak == 0 {
+		cfg.Weak = DEF_WIFI_WEAK
+	}
+	return &wifiMonitor{cfg: cfg}
+}
+
+// reads the current signal level, returns nil if there is no wireless interface (e.g. Ethernet)
+func (w *wifiMonitor) update() *WifiInfo {
+	info, err := readWireless(w.cfg.Interface)
+	if err != nil && !w.failed {
+		logger.Warnf("Couldn't read the Wi-Fi signal level: %s", err)
+	}
+	w.failed = err != nil
+	if info != nil {
+		info.Weak = info.Rssi < w.cfg.Weak
+	}
+	w.mu.Lock()
+	w.last = info
+	w.mu.Unlock()
+	return info
+}
+
+func (w *wifiMonitor) get() *WifiInfo {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.last == nil {
+		return nil
+	}
+	info := *w.last
+	return &info
+}
+
+// returns the info page for the display
+func (w *wifiMonitor) page() []string {
+	info := w.get()
+	if info == nil {
+		return []string{"Wi-Fi", i18n.T("no data")}
+	}
+	lines := []string{
+		"Wi-Fi " + info.Interface,
+		fmt.Sprintf("%d dBm", info.Rssi),
+		fmt.Sprintf("%s %d%%", i18n.T("Quality"), info.Quality),
+	}
+	if info.Weak {
+		lines = append(lines, i18n.T("weak signal"))
+	}
+	return lines
+}
+
+func readWireless(iface string) (*WifiInfo, error) {
+	f, err := os.Open(WIRELESS_FILE)
+	if errors.Is(err, fs.ErrNotExist) && iface == "" {
+		// no wireless driver loaded
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	return parseWireless(f, iface)
+}
+
+// parses the format of /proc/net/wireless:
+//
+//	Inter-| sta-|   Quality        |   Discarded packets               | Missed | WE
+//	 face | tus | link level noise |  nwid  crypt   frag  retry   misc | beacon | 22
+//	 wlan0: 0000   54.  -56.  -256        0      0      0      0     15        0
+func parseWireless(r io.Reader, iface string) (*WifiInfo, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name, values, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if iface != "" && name != iface {
+			continue
+		}
+		fields := strings.Fields(values)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("unexpected format of %s", WIRELESS_FILE)
+		}
+		link, err := strconv.ParseFloat(strings.TrimSuffix(fields[1], "."), 64)
+		if err != nil {
+			return nil, err
+		}
+		level, err := strconv.ParseFloat(strings.TrimSuffix(fields[2], "."), 64)
+		if err != nil {
+			return nil, err
+		}
+		// some drivers report the level as unsigned value
+		if level > 0 {
+			level -= 256
+		}
+		quality := int(link * 100 / WIFI_LINK_MAX)
+		if quality > 100 {
+			quality = 100
+		}
+		return &WifiInfo{Interface: name, Rssi: int(level), Quality: quality}, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if iface != "" {
+		return nil, fmt.Errorf("interface %s not found in %s", iface, WIRELESS_FILE)
+	}
+	return nil, nil
+}
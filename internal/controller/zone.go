@@ -0,0 +1,266 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+
+	"github.com/aluedtke7/dew_point_fan/internal/i18n"
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"github.com/aluedtke7/dew_point_fan/internal/sensor"
+	"github.com/aluedtke7/dew_point_fan/internal/version"
+)
+
+// name of the zone with the first sensor, GPIO25 and the hardware switch
+const ZONE_MAIN = "main"
+
+// additional zone with its own inside sensor and fan, the outside sensor is shared
+type zoneConfig struct {
+	Name     string          `json:"name"`
+	Sensor   sensor.Config   `json:"sensor"`   // inside sensor of the zone
+	Actuator actuatorConfig  `json:"actuator"` // fan of the zone, "pin" is needed for type "gpio"
+	Control  *controlConfig  `json:"control"`  // thresholds, omitted ones are the ones of the main zone
+	Schedule []string        `json:"schedule"` // time windows with automatic venting, e.g. "08:00-20:00", default is always
+	Strategy *strategyConfig `json:"strategy"` // default is the strategy of the main zone
+}
+
+// ZoneInfo is the state of an additional zone
+type ZoneInfo struct {
+	Name     string     `json:"name"`
+	Sensor   SensorData `json:"sensor"`
+	Valid    bool       `json:"valid"`
+	Venting  bool       `json:"venting"`
+	Reason   string     `json:"reason"`
+	Schedule bool       `json:"schedule"` // the current time is within the schedule
+}
+
+// time window of a day in minutes, end may be lower than start (over midnight) or 24:00 (end of the day)
+type timeWindow struct {
+	start, end int
+}
+
+func parseWindow(s string) (timeWindow, error) {
+	var h1, m1, h2, m2 int
+	if _, err := fmt.Sscanf(strings.TrimSpace(s), "%d:%d-%d:%d", &h1, &m1, &h2, &m2); err != nil ||
+		h1 < 0 || h1 > 23 || h2 < 0 || h2 > 24 || m1 < 0 || m1 > 59 || m2 < 0 || m2 > 59 || h2 == 24 && m2 != 0 {
+		return timeWindow{}, fmt.Errorf("invalid time window '%s', expected e.g. 08:00-20:00", s)
+	}
+	return timeWindow{start: h1*60 + m1, end: h2*60 + m2}, nil
+}
+
+func (w timeWindow) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if w.start <= w.end {
+		return m >= w.start && m < w.end
+	}
+	return m >= w.start || m < w.end
+}
+
+// zone controls the fan of an additional zone
+type zone struct {
+	cfg      zoneConfig
+	sensor   sensor.Sensor
+	relay    *guardedRelay
+	windows  []timeWindow
+	dryRun   bool
+	venting  bool
+	spike    *spikeFilter
+	strategy Strategy
+	raw      *rawReadings
+	safeOn   bool // safe state of the fan, used while the read of the sensor hangs
+	logged   bool // venting state that was logged last
+	mu       sync.Mutex
+	info     ZoneInfo
+}
+
+func newZone(cfg zoneConfig, mainStrategy strategyConfig, dryRun bool) (*zone, error) {
+	z := &zone{cfg: cfg, dryRun: dryRun, relay: newGuardedRelay(cfg.Actuator, nil), spike: newSpikeFilter(cfg.Sensor)}
+	if cfg.Strategy != nil {
+		mainStrategy = *cfg.Strategy
+	}
+	var err error
+	if z.strategy, err = newStrategy(mainStrategy); err != nil {
+		return nil, fmt.Errorf("zone %s: %s", cfg.Name, err)
+	}
+	for _, s := range cfg.Schedule {
+		w, err := parseWindow(s)
+		if err != nil {
+			return nil, fmt.Errorf("zone %s: %s", cfg.Name, err)
+		}
+		z.windows = append(z.windows, w)
+	}
+	z.info = ZoneInfo{Name: cfg.Name, Reason: REASON_STARTUP, Schedule: z.scheduled(time.Now())}
+	if z.sensor, err = sensor.New(cfg.Sensor); err != nil {
+		return nil, fmt.Errorf("zone %s: %s", cfg.Name, err)
+	}
+	if z.relay.relay, err = newActuator(cfg.Actuator, dryRun); err != nil {
+		return nil, fmt.Errorf("zone %s: %s", cfg.Name, err)
+	}
+	if err = z.relay.set(false); err != nil {
+		return nil, fmt.Errorf("zone %s: %s", cfg.Name, err)
+	}
+	return z, nil
+}
+
+// returns true if the automatic venting is allowed at this time
+func (z *zone) scheduled(now time.Time) bool {
+	if len(z.windows) == 0 {
+		return true
+	}
+	for _, w := range z.windows {
+		if w.contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// update reads the sensor of the zone and switches its fan. outside is the reading of the shared
+// outside sensor, it's nil if that reading is invalid. Without a plausible clock the schedule
+// blocks the venting. hold is the reason that forces all fans off (maintenance, frost protection,
+// pause), "" if there is none. The InfluxDB point is nil if there is nothing to write.
+func (z *zone) update(now time.Time, outside *SensorData, mainLimits controlConfig, lockout, clockValid bool, hold string) *write.Point {
+	limits := mainLimits
+	if z.cfg.Control != nil {
+		limits = *z.cfg.Control
+	}
+	data := SensorData{Name: z.sensor.Name()}
+	ctx, cancel := context.WithTimeout(context.Background(), z.cfg.Sensor.ReadTimeout())
+	t, h, retried, err := sensor.ReadContext(ctx, z.sensor)
+	cancel()
+	z.raw.record(z.cfg.Sensor, z.sensor.Name(), now, t, h, retried, err)
+	valid := err == nil && outside != nil
+	if err != nil {
+		data.Error = err.Error()
+	} else {
+		t, h = z.cfg.Sensor.Correct(t, h)
+		data.Temperature = roundFloat32(t, 1)
+		data.Humidity = roundFloat32(h, 1)
+		data.DewPoint = roundFloat32(calcDewPoint(data.Temperature, data.Humidity), 1)
+		if data.Temperature < -20 || data.Temperature > 40 {
+			logger.Warnf("Zone %s: temperature is out of range: %5.1f°C", z.cfg.Name, data.Temperature)
+			valid = false
+		}
+	}
+	scheduled := z.scheduled(now) && (clockValid || len(z.windows) == 0)
+	reason := REASON_SENSOR_FAILURE
+	var point *write.Point
+	if valid {
+		if !z.spike.plausible(now, data.Temperature, data.Humidity) {
+			reason = REASON_SPIKE
+		} else {
+			deltaTP := data.DewPoint - outside.DewPoint
+			z.venting, reason = z.strategy.Decide(z.venting, StrategyInput{
+				Now:         now,
+				ClockValid:  clockValid,
+				TempInside:  data.Temperature,
+				TempOutside: outside.Temperature,
+				HumInside:   data.Humidity,
+				HumOutside:  outside.Humidity,
+				DeltaTP:     deltaTP,
+				Hysteresis:  limits.Hysteresis,
+				Limits:      limits,
+			})
+			tags := map[string]string{
+				"version": version.Short(),
+				"zone":    z.cfg.Name,
+			}
+			if z.dryRun {
+				tags["dry_run"] = "true"
+			}
+			point = write.NewPoint("dp", tags, map[string]interface{}{
+				"temp_i":     data.Temperature,
+				"temp_o":     outside.Temperature,
+				"dewpoint_i": data.DewPoint,
+				"dewpoint_o": outside.DewPoint,
+				"hum_i":      data.Humidity,
+				"hum_o":      outside.Humidity,
+				"retry_i":    retried,
+				"vent_val":   boolToInt(z.venting),
+			}, now)
+		}
+	}
+	if err == sensor.ErrHung {
+		z.venting = z.safeOn
+		reason = REASON_SENSOR_HUNG
+	}
+	if lockout {
+		z.venting = false
+		reason = REASON_WEATHER_LOCKOUT
+	}
+	if !scheduled {
+		z.venting = false
+		reason = REASON_SCHEDULE
+	}
+	if hold != "" {
+		z.venting = false
+		reason = hold
+	}
+	if z.venting != z.logged {
+		if z.dryRun {
+			logger.Infof("Dry run: venting of zone %s would be switched to %t (%s)", z.cfg.Name, z.venting, reason)
+		} else {
+			logger.Infof("Venting change of zone %s: new state is %t (%s)", z.cfg.Name, z.venting, reason)
+		}
+		z.logged = z.venting
+	}
+	if hold == REASON_MAINTENANCE || hold == REASON_FROST {
+		// the safety overrides ignore the dead time and the switching rate limit
+		err = z.relay.force(false)
+	} else {
+		err = z.relay.set(z.venting)
+	}
+	if err != nil && err != errSwitchSkipped {
+		logger.Errorf("Zone %s: %s", z.cfg.Name, err)
+	}
+	z.mu.Lock()
+	z.info = ZoneInfo{
+		Name:     z.cfg.Name,
+		Sensor:   data,
+		Valid:    valid,
+		Venting:  z.venting,
+		Reason:   reason,
+		Schedule: scheduled,
+	}
+	z.mu.Unlock()
+	return point
+}
+
+func (z *zone) getInfo() ZoneInfo {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.info
+}
+
+// switches the fan of the zone to the safe state
+func (z *zone) setSafeState(on bool) {
+	if err := z.relay.force(on); err == errSwitchSkipped {
+		logger.Warnf("Switching the fan of zone %s to the safe state was skipped", z.cfg.Name)
+	} else if err != nil {
+		logger.Errorf("Couldn't switch the fan of zone %s to the safe state: %s", z.cfg.Name, err)
+	}
+}
+
+// info page of the zone
+func (z *zone) page() []string {
+	info := z.getInfo()
+	venting := i18n.T("off")
+	if info.Venting {
+		venting = i18n.T("on")
+	}
+	lines := []string{i18n.T("Zone") + " " + info.Name, i18n.T("no data"), "", i18n.T("Fan") + " " + venting}
+	if info.Sensor.Error != "" {
+		lines[1] = i18n.T("sensor failed")
+	} else if info.Sensor.Name != "" {
+		lines[1] = fmt.Sprintf("T:%5.1fC H:%5.1f%%", info.Sensor.Temperature, info.Sensor.Humidity)
+		lines[2] = fmt.Sprintf("DP:%5.1fC", info.Sensor.DewPoint)
+	}
+	if !info.Schedule {
+		lines[3] += " " + i18n.T("(schedule)")
+	}
+	return lines
+}
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		window string
+		valid  bool
+		inside []string
+		out    []string
+	}{
+		{"08:00-20:00", true, []string{"08:00", "12:30", "19:59"}, []string{"07:59", "20:00", "23:59", "00:00"}},
+		{" 00:00-24:00 ", true, []string{"00:00", "12:00", "23:59"}, nil},
+		{"20:00-24:00", true, []string{"20:00", "23:59"}, []string{"19:59", "00:00"}},
+		{"22:00-06:00", true, []string{"22:00", "23:59", "00:00", "05:59"}, []string{"06:00", "12:00", "21:59"}},
+		{"23:30-00:15", true, []string{"23:30", "00:00", "00:14"}, []string{"00:15", "23:29"}},
+		{"00:00-00:30", true, []string{"00:00", "00:29"}, []string{"00:30", "23:59"}},
+		{"08:00-24:59", false, nil, nil},
+		{"08:00-24:01", false, nil, nil},
+		{"24:00-08:00", false, nil, nil},
+		{"08:00-25:00", false, nil, nil},
+		{"08:60-20:00", false, nil, nil},
+		{"08:00-20:60", false, nil, nil},
+		{"-01:00-20:00", false, nil, nil},
+		{"08:00", false, nil, nil},
+		{"", false, nil, nil},
+	}
+	day := time.Date(2024, 3, 10, 0, 0, 0, 0, time.Local)
+	at := func(hm string) time.Time {
+		tm, err := time.Parse("15:04", hm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return day.Add(time.Duration(tm.Hour())*time.Hour + time.Duration(tm.Minute())*time.Minute)
+	}
+	for _, tt := range tests {
+		t.Run(tt.window, func(t *testing.T) {
+			w, err := parseWindow(tt.window)
+			if (err == nil) != tt.valid {
+				t.Fatalf("parseWindow(%q) error = %v, valid %v", tt.window, err, tt.valid)
+			}
+			for _, hm := range tt.inside {
+				if !w.contains(at(hm)) {
+					t.Errorf("%s should contain %s", tt.window, hm)
+				}
+			}
+			for _, hm := range tt.out {
+				if w.contains(at(hm)) {
+					t.Errorf("%s shouldn't contain %s", tt.window, hm)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Package console shows the lines of the display on stdout, e.g. for a device without an LCD or
+// for debugging via the journal.
+package console
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/aluedtke7/dew_point_fan/internal/display"
+)
+
+// console prints a line when its text changes, a scrolling text is printed in full and other
+// texts are cut to the width
+type console struct {
+	mu    sync.Mutex
+	w     io.Writer
+	width int
+	lines []string
+}
+
+// New returns a display with the given geometry, that writes to w
+func New(w io.Writer, width, rows int) display.Display {
+	if width <= 0 {
+		width = display.DEF_WIDTH
+	}
+	if rows <= 0 {
+		rows = 4
+	}
+	return &console{w: w, width: width, lines: make([]string, rows)}
+}
+
+func (c *console) Backlight(bool) {}
+
+func (c *console) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.lines {
+		c.lines[i] = ""
+	}
+}
+
+func (c *console) ClearLine(ofs int) {
+	c.PrintLine(ofs, "", false)
+}
+
+func (c *console) Close() {}
+
+func (c *console) GetCharsPerLine() int {
+	return c.width
+}
+
+func (c *console) GetMinMaxRowNum() (int, int) {
+	return 0, len(c.lines) - 1
+}
+
+func (c *console) PrintLine(line int, text string, scroll bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if line < 0 || line >= len(c.lines) {
+		return
+	}
+	if r := []rune(text); !scroll && len(r) > c.width {
+		text = string(r[:c.width])
+	}
+	text = strings.TrimRight(text, " ")
+	if c.lines[line] == text {
+		return
+	}
+	c.lines[line] = text
+	_, _ = fmt.Fprintf(c.w, "[display %d] %s\n", line, text)
+}
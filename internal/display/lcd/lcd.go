@@ -0,0 +1,309 @@
+package lcd
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/display"
+	device "github.com/d2r2/go-hd44780"
+	"github.com/d2r2/go-i2c"
+	d2r2log "github.com/d2r2/go-logger"
+)
+
+const (
+	numChars      = 20
+	numLines      = 4
+	i2cAddress    = 0x27
+	i2cBus        = 1
+	retryMinDelay = 5 * time.Second
+	retryMaxDelay = 5 * time.Minute
+	closeTimeout  = 2 * time.Second
+)
+
+var lg = d2r2log.NewPackageLogger("lcd", d2r2log.InfoLevel)
+
+// The display is written by the command handler goroutine, so a hanging I2C bus never blocks
+// the callers. The callers only store the requested state: repeated updates of a line are
+// coalesced and only the latest text is shown, while the display is down nothing is queued.
+type lcd struct {
+	i2cbus       *i2c.I2C
+	dev          *device.Lcd
+	lines        [numLines]device.ShowOptions
+	ticker       [numLines]*time.Ticker
+	scrollSpeed  int
+	charsPerLine int
+	initDelay    int
+	retryCount   int
+
+	mu        sync.Mutex
+	up        bool          // false while the display is reconnected
+	wake      chan struct{} // signals pending changes to the command handler
+	text      [numLines]string
+	dirty     [numLines]bool
+	clear     bool
+	backlight *bool // requested backlight state, nil if unchanged
+}
+
+// signals the command handler without blocking
+func (l *lcd) notify() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stores the text of a line, the command handler shows it
+func (l *lcd) setLine(line int, text string) {
+	l.mu.Lock()
+	l.text[line] = text
+	l.dirty[line] = true
+	l.mu.Unlock()
+	l.notify()
+}
+
+func (l *lcd) printLine(line int, text string) (err error) {
+	if line >= 0 && line < numLines {
+		if len(text) == 0 {
+			text = " " // avoid panic, because the library can't handle empty strings
+		}
+		err = l.dev.ShowMessage(text, l.lines[line])
+		return err
+	}
+	return nil
+}
+
+func (l *lcd) runTicker(line int, text string) {
+	l.ticker[line] = time.NewTicker(time.Duration(l.scrollSpeed) * time.Millisecond)
+	s := text + "     "
+	for range l.ticker[line].C {
+		l.setLine(line, s)
+		s = s[1:] + s[:1]
+	}
+}
+
+func (l *lcd) printAndScrollLine(line int, text string) {
+	line = line % numLines
+	if l.ticker[line] != nil {
+		l.ticker[line].Stop()
+		l.ticker[line] = nil
+	}
+	if len(text) <= numChars {
+		l.setLine(line, text)
+	} else {
+		go l.runTicker(line, text)
+	}
+}
+
+// writes the pending changes to the display
+func (l *lcd) commandHandler() {
+	for range l.wake {
+		l.mu.Lock()
+		if !l.up {
+			// the changes are kept and shown after the reconnect
+			l.mu.Unlock()
+			continue
+		}
+		clear, backlight := l.clear, l.backlight
+		l.clear, l.backlight = false, nil
+		l.mu.Unlock()
+		var err error
+		if clear {
+			err = l.dev.Clear()
+			time.Sleep(100 * time.Millisecond)
+		}
+		if err == nil && backlight != nil {
+			if *backlight {
+				err = l.dev.BacklightOn()
+			} else {
+				err = l.dev.BacklightOff()
+			}
+		}
+		for line := 0; line < numLines && err == nil; line++ {
+			l.mu.Lock()
+			text, dirty := l.text[line], l.dirty[line]
+			l.dirty[line] = false
+			l.mu.Unlock()
+			if dirty {
+				err = l.printLine(line, text)
+			}
+		}
+		if err != nil {
+			lg.Error(err.Error())
+			l.mu.Lock()
+			l.up = false
+			// the display lost its content, show everything again after the reconnect
+			on := true
+			l.clear = true
+			l.backlight = &on
+			for i := range l.dirty {
+				l.dirty[i] = true
+			}
+			l.mu.Unlock()
+			go l.reconnect()
+		}
+	}
+}
+
+// returns true if there are changes that are not shown yet
+func (l *lcd) pending() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.clear || l.backlight != nil {
+		return true
+	}
+	for _, d := range l.dirty {
+		if d {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *lcd) Backlight(on bool) {
+	l.mu.Lock()
+	l.backlight = &on
+	l.mu.Unlock()
+	l.notify()
+}
+
+func (l *lcd) ClearLine(line int) {
+	// dummy function, not really needed for lcd
+	if line >= 0 && line < numLines {
+		l.setLine(line, "")
+	}
+}
+
+func (l *lcd) Clear() {
+	l.mu.Lock()
+	l.clear = true
+	for i := range l.text {
+		l.text[i] = ""
+		l.dirty[i] = false
+	}
+	l.mu.Unlock()
+	l.notify()
+}
+
+// Close waits until the pending changes are shown (at most 2 s) and closes the I2C bus
+func (l *lcd) Close() {
+	for i := 0; i < numLines; i++ {
+		if l.ticker[i] != nil {
+			l.ticker[i].Stop()
+			l.ticker[i] = nil
+		}
+	}
+	deadline := time.Now().Add(closeTimeout)
+	for l.pending() && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.up && l.i2cbus != nil {
+		_ = l.i2cbus.Close()
+	}
+	l.up = false
+}
+
+func (l *lcd) PrintLine(line int, text string, scroll bool) {
+	if line < 0 || line >= numLines {
+		lg.Error("LCD display row is ouf of bounds: ", line)
+		return
+	}
+	if scroll {
+		l.printAndScrollLine(line, text)
+	} else {
+		if l.ticker[line] != nil {
+			l.ticker[line].Stop()
+			l.ticker[line] = nil
+		}
+		l.setLine(line, text)
+	}
+}
+
+func (l *lcd) GetCharsPerLine() int {
+	return l.charsPerLine
+}
+
+func (l *lcd) GetMinMaxRowNum() (int, int) {
+	return 0, numLines - 1
+}
+
+// opens the I2C bus and initializes the display
+func (l *lcd) open() error {
+	bus, err := i2c.NewI2C(i2cAddress, i2cBus)
+	if err != nil {
+		return err
+	}
+	time.Sleep(3 * time.Second)
+	dev, err := device.NewLcd(bus, device.LCD_20x4)
+	if err != nil {
+		_ = bus.Close()
+		return err
+	}
+	time.Sleep(time.Duration(l.initDelay) * time.Second)
+	l.i2cbus, l.dev = bus, dev
+	return nil
+}
+
+// reconnects the display with an increasing delay, e.g. after it was unplugged. The callers
+// are never blocked meanwhile, the command handler keeps the changes until the display is back.
+func (l *lcd) reconnect() {
+	if l.i2cbus != nil {
+		_ = l.i2cbus.Close()
+		l.i2cbus = nil
+	}
+	delay := retryMinDelay
+	for {
+		l.retryCount++
+		lg.Infof("Reconnecting the display (%d)", l.retryCount)
+		err := l.open()
+		if err == nil {
+			break
+		}
+		lg.Warnf("Reconnecting the display failed, next try in %s: %s", delay, err)
+		time.Sleep(delay)
+		delay *= 2
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+	}
+	l.mu.Lock()
+	l.up = true
+	l.mu.Unlock()
+	l.notify()
+	lg.Infof("Display reconnected after %d tries", l.retryCount)
+	l.retryCount = 0
+}
+
+/*
+*
+Initializes the LC-Display and returns the maximum char count per line
+*/
+func New(scrollHeader bool, speed int, initDelay int) (disp display.Display, err error) {
+	lg.Debug("LCD initializing...")
+	_ = d2r2log.ChangePackageLogLevel("i2c", d2r2log.WarnLevel)
+	l := lcd{scrollSpeed: speed, charsPerLine: numChars, wake: make(chan struct{}, 1)}
+	err = nil
+
+	l.retryCount = 0
+	l.initDelay = initDelay
+	l.lines[0] = device.SHOW_LINE_1 | device.SHOW_BLANK_PADDING
+	if !scrollHeader {
+		l.lines[0] |= device.SHOW_ELIPSE_IF_NOT_FIT
+	}
+	l.lines[1] = device.SHOW_LINE_2 | device.SHOW_BLANK_PADDING
+	l.lines[2] = device.SHOW_LINE_3 | device.SHOW_BLANK_PADDING
+	l.lines[3] = device.SHOW_LINE_4 | device.SHOW_BLANK_PADDING
+
+	if err = l.open(); err != nil {
+		lg.Error(err.Error())
+		return &l, err
+	}
+	l.up = true
+
+	go l.commandHandler()
+
+	l.Clear()
+	l.Backlight(true)
+	return &l, err
+}
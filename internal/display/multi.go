@@ -0,0 +1,87 @@
+package display
+
+// Multi shows the same lines on several displays, e.g. the LCD and the console. Every display
+// gets only the lines of its rows and, without scrolling, the text cut to its width.
+type Multi struct {
+	list []Display
+}
+
+// NewMulti returns a display, that prints to all displays
+func NewMulti(list ...Display) *Multi {
+	return &Multi{list: list}
+}
+
+func (m *Multi) Backlight(on bool) {
+	for _, d := range m.list {
+		d.Backlight(on)
+	}
+}
+
+func (m *Multi) Clear() {
+	for _, d := range m.list {
+		d.Clear()
+	}
+}
+
+func (m *Multi) ClearLine(ofs int) {
+	for _, d := range m.list {
+		if lo, hi := d.GetMinMaxRowNum(); ofs >= lo && ofs <= hi {
+			d.ClearLine(ofs)
+		}
+	}
+}
+
+func (m *Multi) Close() {
+	for _, d := range m.list {
+		d.Close()
+	}
+}
+
+// GetCharsPerLine returns the width of the narrowest display, so that a text fits on all of them
+func (m *Multi) GetCharsPerLine() int {
+	width := 0
+	for _, d := range m.list {
+		if w := d.GetCharsPerLine(); width == 0 || w < width {
+			width = w
+		}
+	}
+	if width == 0 {
+		return DEF_WIDTH
+	}
+	return width
+}
+
+// GetMinMaxRowNum returns the rows of all displays
+func (m *Multi) GetMinMaxRowNum() (int, int) {
+	first, last := 0, -1
+	for i, d := range m.list {
+		lo, hi := d.GetMinMaxRowNum()
+		if i == 0 || lo < first {
+			first = lo
+		}
+		if hi > last {
+			last = hi
+		}
+	}
+	return first, last
+}
+
+func (m *Multi) PrintLine(line int, text string, scroll bool) {
+	for _, d := range m.list {
+		if lo, hi := d.GetMinMaxRowNum(); line < lo || line > hi {
+			continue
+		}
+		d.PrintLine(line, fit(text, d.GetCharsPerLine(), scroll), scroll)
+	}
+}
+
+// cuts the text to the width of a display, a scrolling text is kept
+func fit(text string, width int, scroll bool) string {
+	if scroll || width <= 0 {
+		return text
+	}
+	if r := []rune(text); len(r) > width {
+		return string(r[:width])
+	}
+	return text
+}
@@ -0,0 +1,159 @@
+package display
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// characters per line of the usual 20x4 LCD
+const DEF_WIDTH = 20
+
+// an info page renders up to 4 lines
+type page struct {
+	name   string
+	render func() []string
+}
+
+// Pager shows either the main page with the live values or one of the info pages
+type Pager struct {
+	mu        sync.Mutex
+	disp      Display // nil without a display
+	mainLines [4]string
+	pages     []page
+	current   int // 0 is the main page, info pages start with 1
+	dark      bool
+}
+
+// NewPager creates a pager for the display, disp may be nil
+func NewPager(disp Display) *Pager {
+	return &Pager{disp: disp}
+}
+
+// PrintMain prints a line of the main page, the line is only shown on the display while the main page is active
+func (p *Pager) PrintMain(line int, text string, scroll bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if line < 0 || line >= len(p.mainLines) {
+		return
+	}
+	p.mainLines[line] = text
+	if p.current == 0 && p.disp != nil {
+		p.disp.PrintLine(line, text, scroll)
+	}
+}
+
+// Width returns the characters per line of the display, 20 without a display
+func (p *Pager) Width() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.disp == nil {
+		return DEF_WIDTH
+	}
+	return p.disp.GetCharsPerLine()
+}
+
+// AddPage adds an info page, render returns its lines
+func (p *Pager) AddPage(name string, render func() []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pages = append(p.pages, page{name: name, render: render})
+}
+
+// Show shows the page with the given index, 0 is the main page
+func (p *Pager) Show(idx int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if idx < 0 || idx > len(p.pages) {
+		idx = 0
+	}
+	p.current = idx
+	if p.disp == nil {
+		return
+	}
+	var lines []string
+	if idx == 0 {
+		lines = p.mainLines[:]
+	} else {
+		lines = p.pages[idx-1].render()
+	}
+	for i := 0; i < len(p.mainLines); i++ {
+		text := ""
+		if i < len(lines) {
+			text = strings.TrimSpace(lines[i])
+		}
+		p.disp.PrintLine(i, text, false)
+	}
+}
+
+// Next shows the next page, after the last info page the main page follows
+func (p *Pager) Next() {
+	p.mu.Lock()
+	idx := (p.current + 1) % (len(p.pages) + 1)
+	p.mu.Unlock()
+	p.Show(idx)
+}
+
+// Snapshot is the content of the display, e.g. for a mirror on the web page
+type Snapshot struct {
+	Page      string   `json:"page"` // "main" or the name of the info page
+	Lines     []string `json:"lines"`
+	Width     int      `json:"width"`
+	Backlight bool     `json:"backlight"`
+}
+
+// Snapshot returns the lines of the current page, also without a display
+func (p *Pager) Snapshot() Snapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := Snapshot{Page: "main", Width: DEF_WIDTH, Backlight: !p.dark}
+	if p.disp != nil {
+		s.Width = p.disp.GetCharsPerLine()
+	}
+	var lines []string
+	if p.current == 0 {
+		lines = p.mainLines[:]
+	} else {
+		s.Page = p.pages[p.current-1].name
+		lines = p.pages[p.current-1].render()
+	}
+	for i := 0; i < len(p.mainLines); i++ {
+		text := ""
+		if i < len(lines) {
+			text = lines[i]
+			if p.current != 0 {
+				text = strings.TrimSpace(text)
+			}
+		}
+		s.Lines = append(s.Lines, text)
+	}
+	return s
+}
+
+// ToggleBacklight switches the backlight of the display off or on again
+func (p *Pager) ToggleBacklight() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dark = !p.dark
+	if p.disp != nil {
+		p.disp.Backlight(!p.dark)
+	}
+}
+
+// Rotate shows all info pages periodically and should be started as goroutine
+func (p *Pager) Rotate(every, pageTime time.Duration) {
+	if every <= 0 {
+		return
+	}
+	for {
+		time.Sleep(every)
+		p.mu.Lock()
+		count := len(p.pages)
+		p.mu.Unlock()
+		for i := 1; i <= count; i++ {
+			p.Show(i)
+			time.Sleep(pageTime)
+		}
+		p.Show(0)
+	}
+}
@@ -0,0 +1,127 @@
+// Package expander drives single outputs of I2C IO expanders. Most I2C relay boards and
+// HATs are built with one of the supported chips.
+package expander
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/d2r2/go-i2c"
+	d2r2log "github.com/d2r2/go-logger"
+)
+
+const (
+	TypePCF8574  = "pcf8574"
+	TypePCA9554  = "pca9554"
+	TypeMCP23017 = "mcp23017"
+)
+
+// registers of the PCA9554 (TCA6408 and PCA9538 are compatible)
+const (
+	pca9554Output = 0x01
+	pca9554Config = 0x03
+)
+
+// registers of the MCP23017 with IOCON.BANK = 0, port B follows port A
+const (
+	mcp23017Iodir = 0x00
+	mcp23017Olat  = 0x14
+)
+
+// Output is a single output pin of an expander
+type Output struct {
+	mu      sync.Mutex
+	typ     string
+	bus     *i2c.I2C
+	reg     byte // output register, unused for the PCF8574
+	bit     byte
+	current byte // shadow of the output register
+}
+
+// New opens the expander and configures the channel as output with the given initial level
+func New(typ string, busNum int, addr uint8, channel int, high bool) (*Output, error) {
+	typ = strings.ToLower(typ)
+	maxChannel := 7
+	if typ == TypeMCP23017 {
+		maxChannel = 15
+	}
+	if channel < 0 || channel > maxChannel {
+		return nil, fmt.Errorf("%s: invalid channel %d", typ, channel)
+	}
+	if busNum == 0 {
+		busNum = 1
+	}
+	if addr == 0 {
+		addr = 0x20
+	}
+	_ = d2r2log.ChangePackageLogLevel("i2c", d2r2log.WarnLevel)
+	bus, err := i2c.NewI2C(addr, busNum)
+	if err != nil {
+		return nil, err
+	}
+	o := &Output{typ: typ, bus: bus, bit: 1 << uint(channel%8)}
+	switch typ {
+	case TypePCF8574:
+		// quasi bidirectional pins: all pins high is the state after power on
+		o.current = 0xFF
+		err = o.Set(high)
+	case TypePCA9554:
+		o.reg = pca9554Output
+		err = o.configure(pca9554Config, high)
+	case TypeMCP23017:
+		port := byte(channel / 8)
+		o.reg = mcp23017Olat + port
+		err = o.configure(mcp23017Iodir+port, high)
+	default:
+		err = fmt.Errorf("unknown expander type '%s'", typ)
+	}
+	if err != nil {
+		_ = bus.Close()
+		return nil, err
+	}
+	return o, nil
+}
+
+// sets the output latch of the channel and switches the pin to output,
+// the other pins keep their configuration
+func (o *Output) configure(configReg byte, high bool) error {
+	var err error
+	if o.current, err = o.bus.ReadRegU8(o.reg); err != nil {
+		return err
+	}
+	if err = o.Set(high); err != nil {
+		return err
+	}
+	dir, err := o.bus.ReadRegU8(configReg)
+	if err != nil {
+		return err
+	}
+	return o.bus.WriteRegU8(configReg, dir&^o.bit)
+}
+
+// Set sets the level of the output
+func (o *Output) Set(high bool) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	value := o.current &^ o.bit
+	if high {
+		value |= o.bit
+	}
+	var err error
+	if o.typ == TypePCF8574 {
+		_, err = o.bus.WriteBytes([]byte{value})
+	} else {
+		err = o.bus.WriteRegU8(o.reg, value)
+	}
+	if err != nil {
+		return err
+	}
+	o.current = value
+	return nil
+}
+
+// Close closes the I2C bus
+func (o *Output) Close() error {
+	return o.bus.Close()
+}
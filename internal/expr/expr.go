@@ -0,0 +1,327 @@
+// Package expr implements a small expression language for rules, e.g. "dp_i - dp_o > 4 && hum_i > 55".
+// It supports numbers, variables, + - * /, comparisons (< <= > >= == !=), && || ! (or and, or, not)
+// and parentheses.
+// Boolean values are represented as 1 (true) and 0 (false).
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Vars holds the values of the variables used in an expression
+type Vars map[string]float64
+
+// Expr is a parsed expression
+type Expr struct {
+	source string
+	root   node
+}
+
+type node interface {
+	eval(v Vars) (float64, error)
+}
+
+// Parse parses the expression. If known is not nil, all variables must be contained in it.
+func Parse(source string, known []string) (*Expr, error) {
+	p := &parser{source: source}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s' in '%s'", p.tokens[p.pos].text, source)
+	}
+	if known != nil {
+		for _, name := range p.vars {
+			found := false
+			for _, k := range known {
+				if k == name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unknown variable '%s' in '%s'", name, source)
+			}
+		}
+	}
+	return &Expr{source: source, root: root}, nil
+}
+
+// Eval evaluates the expression with the given variables
+func (e *Expr) Eval(v Vars) (float64, error) {
+	return e.root.eval(v)
+}
+
+// True evaluates the expression and returns true, if the result is not 0
+func (e *Expr) True(v Vars) (bool, error) {
+	r, err := e.root.eval(v)
+	return r != 0, err
+}
+
+func (e *Expr) String() string {
+	return e.source
+}
+
+func Bool(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// ---- tokenizer ----
+
+const (
+	tokNumber = iota
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind int
+	text string
+	num  float64
+}
+
+type parser struct {
+	source string
+	tokens []token
+	pos    int
+	vars   []string
+}
+
+var keywords = map[string]string{"and": "&&", "or": "||", "not": "!"}
+
+var operators = []string{"&&", "||", "<=", ">=", "==", "!=", "<", ">", "+", "-", "*", "/", "!", "(", ")"}
+
+func (p *parser) tokenize() error {
+	s := p.source
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || c == '.':
+			j := i
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+			n, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return fmt.Errorf("invalid number '%s' in '%s'", s[i:j], s)
+			}
+			p.tokens = append(p.tokens, token{kind: tokNumber, text: s[i:j], num: n})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_') {
+				j++
+			}
+			if op, ok := keywords[s[i:j]]; ok {
+				p.tokens = append(p.tokens, token{kind: tokOp, text: op})
+			} else {
+				p.tokens = append(p.tokens, token{kind: tokIdent, text: s[i:j]})
+			}
+			i = j
+		default:
+			found := false
+			for _, op := range operators {
+				if strings.HasPrefix(s[i:], op) {
+					p.tokens = append(p.tokens, token{kind: tokOp, text: op})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("invalid character '%c' in '%s'", c, s)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *parser) peekOp(ops ...string) string {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokOp {
+		for _, op := range ops {
+			if p.tokens[p.pos].text == op {
+				return op
+			}
+		}
+	}
+	return ""
+}
+
+// ---- recursive descent parser, lowest precedence first ----
+
+func (p *parser) parseBinary(next func() (node, error), ops ...string) (node, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peekOp(ops...); op != ""; op = p.peekOp(ops...) {
+		p.pos++
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	return p.parseBinary(p.parseAnd, "||")
+}
+
+func (p *parser) parseAnd() (node, error) {
+	return p.parseBinary(p.parseComparison, "&&")
+}
+
+func (p *parser) parseComparison() (node, error) {
+	return p.parseBinary(p.parseSum, "<=", ">=", "==", "!=", "<", ">")
+}
+
+func (p *parser) parseSum() (node, error) {
+	return p.parseBinary(p.parseProduct, "+", "-")
+}
+
+func (p *parser) parseProduct() (node, error) {
+	return p.parseBinary(p.parseUnary, "*", "/")
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if op := p.peekOp("!", "-"); op != "" {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of '%s'", p.source)
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	switch {
+	case t.kind == tokNumber:
+		return numberNode(t.num), nil
+	case t.kind == tokIdent:
+		switch t.text {
+		case "true":
+			return numberNode(1), nil
+		case "false":
+			return numberNode(0), nil
+		}
+		p.vars = append(p.vars, t.text)
+		return varNode(t.text), nil
+	case t.text == "(":
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peekOp(")") == "" {
+			return nil, fmt.Errorf("missing ')' in '%s'", p.source)
+		}
+		p.pos++
+		return n, nil
+	}
+	return nil, fmt.Errorf("unexpected '%s' in '%s'", t.text, p.source)
+}
+
+// ---- nodes ----
+
+type numberNode float64
+
+func (n numberNode) eval(Vars) (float64, error) {
+	return float64(n), nil
+}
+
+type varNode string
+
+func (n varNode) eval(v Vars) (float64, error) {
+	value, ok := v[string(n)]
+	if !ok {
+		return 0, fmt.Errorf("variable '%s' is not set", string(n))
+	}
+	return value, nil
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+func (n *unaryNode) eval(v Vars) (float64, error) {
+	x, err := n.operand.eval(v)
+	if err != nil {
+		return 0, err
+	}
+	if n.op == "!" {
+		return Bool(x == 0), nil
+	}
+	return -x, nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryNode) eval(v Vars) (float64, error) {
+	l, err := n.left.eval(v)
+	if err != nil {
+		return 0, err
+	}
+	// short circuit evaluation
+	if n.op == "&&" && l == 0 {
+		return 0, nil
+	}
+	if n.op == "||" && l != 0 {
+		return 1, nil
+	}
+	r, err := n.right.eval(v)
+	if err != nil {
+		return 0, err
+	}
+	switch n.op {
+	case "&&", "||":
+		return Bool(r != 0), nil
+	case "<":
+		return Bool(l < r), nil
+	case "<=":
+		return Bool(l <= r), nil
+	case ">":
+		return Bool(l > r), nil
+	case ">=":
+		return Bool(l >= r), nil
+	case "==":
+		return Bool(l == r), nil
+	case "!=":
+		return Bool(l != r), nil
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	}
+	return 0, fmt.Errorf("unknown operator '%s'", n.op)
+}
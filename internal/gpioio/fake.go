@@ -0,0 +1,114 @@
+package gpioio
+
+import (
+	"sync"
+	"time"
+
+	d2r2log "github.com/d2r2/go-logger"
+	"periph.io/x/conn/v3/gpio"
+)
+
+var lg = d2r2log.NewPackageLogger("gpioio", d2r2log.InfoLevel)
+
+// fakeBackend creates the pins on first use and keeps their levels in memory
+type fakeBackend struct {
+	mu   sync.Mutex
+	pins map[string]*FakePin
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{pins: map[string]*FakePin{}}
+}
+
+func (b *fakeBackend) init() error {
+	lg.Warning("Using fake GPIO pins, no hardware is switched")
+	return nil
+}
+
+func (b *fakeBackend) byName(name string) Pin {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p, ok := b.pins[name]
+	if !ok {
+		p = &FakePin{name: name, level: gpio.High, edges: make(chan struct{}, 1)}
+		b.pins[name] = p
+	}
+	return p
+}
+
+// FakePin is an in-memory pin. Inputs are changed with Set, the level of an output is
+// the last level written with Out.
+type FakePin struct {
+	name  string
+	mu    sync.Mutex
+	level gpio.Level
+	pull  gpio.Pull
+	edge  gpio.Edge
+	edges chan struct{}
+}
+
+func (p *FakePin) Name() string {
+	return p.name
+}
+
+// In configures the pin as input, with a pull up the level is high until Set is called
+func (p *FakePin) In(pull gpio.Pull, edge gpio.Edge) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pull = pull
+	p.edge = edge
+	if pull == gpio.PullUp {
+		p.level = gpio.High
+	} else if pull == gpio.PullDown {
+		p.level = gpio.Low
+	}
+	return nil
+}
+
+func (p *FakePin) Read() gpio.Level {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.level
+}
+
+func (p *FakePin) WaitForEdge(timeout time.Duration) bool {
+	if timeout < 0 {
+		<-p.edges
+		return true
+	}
+	select {
+	case <-p.edges:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (p *FakePin) Out(l gpio.Level) error {
+	p.mu.Lock()
+	changed := p.level != l
+	p.level = l
+	p.mu.Unlock()
+	if changed {
+		lg.Debugf("%s set to %s", p.name, l)
+	}
+	return nil
+}
+
+// Set simulates a changed input level and signals a matching edge
+func (p *FakePin) Set(l gpio.Level) {
+	p.mu.Lock()
+	old := p.level
+	p.level = l
+	edge := p.edge
+	p.mu.Unlock()
+	if old == l {
+		return
+	}
+	if edge == gpio.BothEdges || (edge == gpio.RisingEdge && l == gpio.High) || (edge == gpio.FallingEdge && l == gpio.Low) {
+		select {
+		case p.edges <- struct{}{}:
+		default:
+		}
+	}
+}
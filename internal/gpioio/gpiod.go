@@ -0,0 +1,178 @@
+package gpioio
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/warthog618/gpiod"
+	"periph.io/x/conn/v3/gpio"
+)
+
+const DEF_CHIP = "gpiochip0"
+
+// gpiodBackend uses the GPIO character device of the Linux kernel, it runs on all boards with
+// a kernel >= 5.10 (Orange Pi, Banana Pi, Rock Pi, ...)
+type gpiodBackend struct {
+	cfg  Config
+	chip *gpiod.Chip
+	mu   sync.Mutex
+	pins map[string]*gpiodPin
+}
+
+func newGpiodBackend(cfg Config) *gpiodBackend {
+	if cfg.Chip == "" {
+		cfg.Chip = DEF_CHIP
+	}
+	return &gpiodBackend{cfg: cfg, pins: map[string]*gpiodPin{}}
+}
+
+func (b *gpiodBackend) init() error {
+	chip, err := gpiod.NewChip(b.cfg.Chip, gpiod.WithConsumer("dew-point-fan"))
+	if err != nil {
+		return fmt.Errorf("couldn't open GPIO chip %s: %s", b.cfg.Chip, err)
+	}
+	b.chip = chip
+	return nil
+}
+
+// returns the line offset of a pin: the value in the lines map of the configuration or the
+// number of a name like "GPIO25"
+func (b *gpiodBackend) offset(name string) (int, bool) {
+	if o, ok := b.cfg.Lines[name]; ok {
+		return o, true
+	}
+	o, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(name), "GPIO"))
+	if err != nil || o < 0 || o >= b.chip.Lines() {
+		return 0, false
+	}
+	return o, true
+}
+
+func (b *gpiodBackend) byName(name string) Pin {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if p, ok := b.pins[name]; ok {
+		return p
+	}
+	o, ok := b.offset(name)
+	if !ok {
+		return nil
+	}
+	p := &gpiodPin{name: name, chip: b.chip, offset: o, edges: make(chan struct{}, 1)}
+	b.pins[name] = p
+	return p
+}
+
+// gpiodPin requests its line on the first use as input or output
+type gpiodPin struct {
+	name   string
+	chip   *gpiod.Chip
+	offset int
+	mu     sync.Mutex
+	line   *gpiod.Line
+	output bool
+	edges  chan struct{}
+}
+
+func (p *gpiodPin) Name() string {
+	return p.name
+}
+
+// releases the line, the caller holds the lock
+func (p *gpiodPin) release() {
+	if p.line != nil {
+		_ = p.line.Close()
+		p.line = nil
+	}
+}
+
+func (p *gpiodPin) In(pull gpio.Pull, edge gpio.Edge) error {
+	opts := []gpiod.LineReqOption{gpiod.AsInput}
+	switch pull {
+	case gpio.PullUp:
+		opts = append(opts, gpiod.WithPullUp)
+	case gpio.PullDown:
+		opts = append(opts, gpiod.WithPullDown)
+	case gpio.Float:
+		opts = append(opts, gpiod.WithBiasDisabled)
+	}
+	switch edge {
+	case gpio.RisingEdge:
+		opts = append(opts, gpiod.WithRisingEdge)
+	case gpio.FallingEdge:
+		opts = append(opts, gpiod.WithFallingEdge)
+	case gpio.BothEdges:
+		opts = append(opts, gpiod.WithBothEdges)
+	}
+	if edge != gpio.NoEdge {
+		opts = append(opts, gpiod.WithEventHandler(func(gpiod.LineEvent) {
+			select {
+			case p.edges <- struct{}{}:
+			default:
+			}
+		}))
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.release()
+	line, err := p.chip.RequestLine(p.offset, opts...)
+	if err != nil {
+		return fmt.Errorf("couldn't request %s as input: %s", p.name, err)
+	}
+	p.line = line
+	p.output = false
+	return nil
+}
+
+func (p *gpiodPin) Read() gpio.Level {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.line == nil {
+		line, err := p.chip.RequestLine(p.offset, gpiod.AsInput)
+		if err != nil {
+			return gpio.Low
+		}
+		p.line = line
+	}
+	v, err := p.line.Value()
+	if err != nil {
+		return gpio.Low
+	}
+	return gpio.Level(v != 0)
+}
+
+func (p *gpiodPin) WaitForEdge(timeout time.Duration) bool {
+	if timeout < 0 {
+		<-p.edges
+		return true
+	}
+	select {
+	case <-p.edges:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (p *gpiodPin) Out(l gpio.Level) error {
+	v := 0
+	if l == gpio.High {
+		v = 1
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.line != nil && p.output {
+		return p.line.SetValue(v)
+	}
+	p.release()
+	line, err := p.chip.RequestLine(p.offset, gpiod.AsOutput(v))
+	if err != nil {
+		return fmt.Errorf("couldn't request %s as output: %s", p.name, err)
+	}
+	p.line = line
+	p.output = true
+	return nil
+}
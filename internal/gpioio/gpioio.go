@@ -0,0 +1,79 @@
+// Package gpioio hides the access to the GPIO pins behind the Pin interface. The backend is
+// selected once at startup: "periph" uses the pins of the Raspberry Pi, "gpiod" the GPIO
+// character device of other boards and "fake" keeps the pins in memory, so the program
+// runs on machines without GPIOs.
+package gpioio
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"periph.io/x/conn/v3/gpio"
+)
+
+const (
+	BACKEND_PERIPH = "periph"
+	BACKEND_GPIOD  = "gpiod"
+	BACKEND_FAKE   = "fake"
+)
+
+// Config selects the backend
+type Config struct {
+	Backend string `json:"backend"` // "periph" (default), "gpiod" or "fake" for machines without GPIOs
+	// gpiod backend
+	Chip  string         `json:"chip"`  // GPIO chip, default "gpiochip0"
+	Lines map[string]int `json:"lines"` // line offsets of the pins, e.g. {"GPIO25": 67}, default is the number of the name
+}
+
+// Pin is a single GPIO pin, the methods are a subset of periph's gpio.PinIO
+type Pin interface {
+	Name() string
+	In(pull gpio.Pull, edge gpio.Edge) error
+	Read() gpio.Level
+	// WaitForEdge waits for an edge configured with In, a negative timeout waits forever
+	WaitForEdge(timeout time.Duration) bool
+	Out(l gpio.Level) error
+}
+
+// backend finds pins by name, e.g. "GPIO25"
+type backend interface {
+	init() error
+	byName(name string) Pin
+}
+
+var (
+	mu      sync.Mutex
+	current backend = &periphBackend{}
+)
+
+// Init selects and initializes the backend, an empty name selects periph
+func Init(cfg Config) error {
+	var b backend
+	switch strings.ToLower(cfg.Backend) {
+	case "", BACKEND_PERIPH:
+		b = &periphBackend{}
+	case BACKEND_GPIOD:
+		b = newGpiodBackend(cfg)
+	case BACKEND_FAKE:
+		b = newFakeBackend()
+	default:
+		return fmt.Errorf("unknown GPIO backend '%s'", cfg.Backend)
+	}
+	if err := b.init(); err != nil {
+		return err
+	}
+	mu.Lock()
+	current = b
+	mu.Unlock()
+	return nil
+}
+
+// ByName returns the pin with the given name or nil, if there is no such pin
+func ByName(name string) Pin {
+	mu.Lock()
+	b := current
+	mu.Unlock()
+	return b.byName(name)
+}
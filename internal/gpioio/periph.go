@@ -0,0 +1,22 @@
+package gpioio
+
+import (
+	"periph.io/x/conn/v3/gpio/gpioreg"
+	"periph.io/x/host/v3"
+)
+
+// periphBackend uses the GPIO drivers of periph.io
+type periphBackend struct{}
+
+func (periphBackend) init() error {
+	_, err := host.Init()
+	return err
+}
+
+func (periphBackend) byName(name string) Pin {
+	p := gpioreg.ByName(name)
+	if p == nil {
+		return nil
+	}
+	return p
+}
@@ -0,0 +1,136 @@
+package httpapi
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// roles of the tokens, every role includes the lower ones
+const (
+	ROLE_NONE = iota
+	ROLE_READ
+	ROLE_CONTROL
+	ROLE_MANAGE
+)
+
+// returns the token of the header "Authorization: Bearer <token>" or of the query parameter
+// token, e.g. for a browser or a peer
+func requestToken(req *http.Request) string {
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return req.URL.Query().Get("token")
+}
+
+func tokenMatches(token, configured string) bool {
+	return configured != "" && subtle.ConstantTimeCompare([]byte(token), []byte(configured)) == 1
+}
+
+// returns the role of the token of the request
+func (s *server) role(req *http.Request) int {
+	tokens := s.ctrl.AccessTokens()
+	token := requestToken(req)
+	switch {
+	case token == "":
+		return ROLE_NONE
+	case tokenMatches(token, tokens.Manage):
+		return ROLE_MANAGE
+	case tokenMatches(token, tokens.Control):
+		return ROLE_CONTROL
+	case tokenMatches(token, tokens.Read):
+		return ROLE_READ
+	}
+	return ROLE_NONE
+}
+
+// returns the role that a request without a token has. Reading is open without a read token,
+// the control without a read or control token.
+func (s *server) openRole() int {
+	tokens := s.ctrl.AccessTokens()
+	switch {
+	case tokens.Read != "":
+		return ROLE_NONE
+	case tokens.Control != "":
+		return ROLE_READ
+	}
+	return ROLE_CONTROL
+}
+
+// returns the role of the request, at least the one without a token
+func (s *server) effectiveRole(req *http.Request) int {
+	role, open := s.role(req), s.openRole()
+	if open > role {
+		return open
+	}
+	return role
+}
+
+// access checks the role of every request except the management API, which has its own check.
+// GET and HEAD need the read role, all other methods the control role.
+func (s *server) access(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, "/api/v1/manage/") {
+			h.ServeHTTP(w, req)
+			return
+		}
+		lg.Debugf("%s %s from %s", req.Method, req.URL.Path, s.clientAddress(req))
+		needed := ROLE_CONTROL
+		if req.Method == "GET" || req.Method == "HEAD" {
+			needed = ROLE_READ
+		}
+		if role := s.effectiveRole(req); role < needed {
+			if role == ROLE_NONE {
+				lg.Warnf("Unauthorized call of %s from %s", req.URL.Path, s.clientAddress(req))
+				w.Header().Set("WWW-Authenticate", `Bearer realm="dew-point-fan"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+			} else {
+				lg.Warnf("Call of %s %s from %s without the control token", req.Method, req.URL.Path, s.clientAddress(req))
+				http.Error(w, "forbidden, the control token is needed", http.StatusForbidden)
+			}
+			return
+		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// address of the client without the port. Behind a trusted reverse proxy it's the last address
+// of X-Forwarded-For, that isn't a trusted proxy itself.
+func (s *server) clientAddress(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	if !s.trusted(host) {
+		return host
+	}
+	var forwarded []string
+	for _, h := range req.Header.Values("X-Forwarded-For") {
+		for _, a := range strings.Split(h, ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				forwarded = append(forwarded, a)
+			}
+		}
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		host = forwarded[i]
+		if !s.trusted(host) {
+			break
+		}
+	}
+	return host
+}
+
+func (s *server) trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range s.proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
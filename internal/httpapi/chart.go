@@ -0,0 +1,250 @@
+package httpapi
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/i18n"
+	"github.com/aluedtke7/dew_point_fan/internal/storage"
+)
+
+// size of the chart in the units of the SVG, it's scaled to the width of the browser
+// maximum range of the chart and of /api/v1/history in hours, the API doesn't average the records
+const HISTORY_MAX_HOURS = 24 * 31
+
+const (
+	CHART_WIDTH  = 960
+	CHART_HEIGHT = 320
+	CHART_POINTS = 480 // the records are averaged to this number of points
+	chartLeft    = 40  // space of the axis labels
+	chartTop     = 8
+	chartBottom  = 24
+	chartFan     = 16 // height of the band with the fan state
+)
+
+// time ranges of the selector in hours and the interval of the labels of the time axis
+var chartRanges = []struct {
+	hours int
+	label time.Duration
+}{
+	{6, time.Hour},
+	{24, 4 * time.Hour},
+	{72, 12 * time.Hour},
+	{168, 24 * time.Hour},
+}
+
+// a point of the chart, the average of the records within its time slot
+type chartPoint struct {
+	dpInside  float64
+	dpOutside float64
+	fan       float64 // share of the records with the fan on
+	valid     bool
+}
+
+// averages the valid records into n slots, slots without a valid record are gaps
+func chartPoints(records []storage.Record, from time.Time, span time.Duration, n int) []chartPoint {
+	points := make([]chartPoint, n)
+	counts := make([]int, n)
+	fans := make([]int, n)
+	total := make([]int, n)
+	for _, r := range records {
+		i := int(float64(r.Time.Sub(from)) / float64(span) * float64(n))
+		if i < 0 || i >= n {
+			continue
+		}
+		total[i]++
+		if r.FanStatus {
+			fans[i]++
+		}
+		if !r.Valid {
+			continue
+		}
+		points[i].dpInside += float64(r.DewPointInside)
+		points[i].dpOutside += float64(r.DewPointOutside)
+		counts[i]++
+	}
+	for i := range points {
+		if counts[i] > 0 {
+			points[i].dpInside /= float64(counts[i])
+			points[i].dpOutside /= float64(counts[i])
+			points[i].valid = true
+		}
+		if total[i] > 0 {
+			points[i].fan = float64(fans[i]) / float64(total[i])
+		}
+	}
+	return points
+}
+
+// returns a step of 1, 2 or 5 times a power of 10 for about 5 grid lines
+func chartStep(span float64) float64 {
+	raw := span / 5
+	if raw <= 0 {
+		return 1
+	}
+	pow := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5} {
+		if m*pow >= raw {
+			return m * pow
+		}
+	}
+	return 10 * pow
+}
+
+// GET shows a chart of the dew points inside and outside and of the fan state of the local
+// history, ?hours=<n> selects the range (6, 24, 72 or 168, default 24)
+func (s *server) chart(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	hours := 24
+	if h := req.URL.Query().Get("hours"); h != "" {
+		var err error
+		if hours, err = strconv.Atoi(h); err != nil || hours <= 0 || hours > HISTORY_MAX_HOURS {
+			http.Error(w, "invalid value for hours", http.StatusBadRequest)
+			return
+		}
+	}
+	to := time.Now()
+	span := time.Duration(hours) * time.Hour
+	from := to.Add(-span)
+	records, err := s.ctrl.History(from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	title := html.EscapeString(i18n.T("Dew Point Fan"))
+	_, _ = fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>%s</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+svg { width: 100%%; max-width: %dpx; height: auto; }
+svg text { font-size: 12px; fill: #555; }
+.ranges a { margin-right: 1em; }
+.legend span { margin-right: 1.5em; }
+</style>
+</head>
+<body>
+<h3>%s</h3>
+<p class="ranges">`, title, CHART_WIDTH, title)
+	for _, r := range chartRanges {
+		label := fmt.Sprintf("%d h", r.hours)
+		if r.hours == hours {
+			_, _ = fmt.Fprintf(w, "<b>%s</b> ", label)
+		} else {
+			_, _ = fmt.Fprintf(w, "<a href=\"/chart?hours=%d\">%s</a> ", r.hours, label)
+		}
+	}
+	_, _ = io.WriteString(w, "</p>\n")
+	if len(records) == 0 {
+		_, _ = fmt.Fprintf(w, "<p>%s</p>\n", html.EscapeString(i18n.T("no data")))
+	} else {
+		writeChartSvg(w, chartPoints(records, from, span, CHART_POINTS), from, span)
+	}
+	_, _ = fmt.Fprintf(w, `<p class="legend"><span style="color:#1f77b4">&#9632; %s</span><span style="color:#ff7f0e">&#9632; %s</span><span style="color:#2ca02c">&#9632; %s</span></p>
+</body>
+</html>
+`, html.EscapeString(i18n.T("Dew point inside")), html.EscapeString(i18n.T("Dew point outside")),
+		html.EscapeString(i18n.T("Fan")))
+}
+
+func writeChartSvg(w io.Writer, points []chartPoint, from time.Time, span time.Duration) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, p := range points {
+		if p.valid {
+			lo = math.Min(lo, math.Min(p.dpInside, p.dpOutside))
+			hi = math.Max(hi, math.Max(p.dpInside, p.dpOutside))
+		}
+	}
+	if math.IsInf(lo, 1) {
+		lo, hi = 0, 10
+	}
+	step := chartStep(hi - lo + 2)
+	lo, hi = math.Floor((lo-1)/step)*step, math.Ceil((hi+1)/step)*step
+	plotW := float64(CHART_WIDTH - chartLeft)
+	plotH := float64(CHART_HEIGHT - chartTop - chartBottom - chartFan - 4)
+	x := func(i int) float64 { return chartLeft + (float64(i)+0.5)*plotW/float64(len(points)) }
+	y := func(v float64) float64 { return chartTop + plotH - (v-lo)/(hi-lo)*plotH }
+
+	_, _ = fmt.Fprintf(w, "<svg viewBox=\"0 0 %d %d\" xmlns=\"http://www.w3.org/2000/svg\">\n", CHART_WIDTH, CHART_HEIGHT)
+	for v := lo; v <= hi+step/2; v += step {
+		_, _ = fmt.Fprintf(w, "<line x1=\"%d\" y1=\"%.1f\" x2=\"%d\" y2=\"%.1f\" stroke=\"#ddd\"/>", chartLeft, y(v), CHART_WIDTH, y(v))
+		_, _ = fmt.Fprintf(w, "<text x=\"%d\" y=\"%.1f\" text-anchor=\"end\">%s°C</text>\n", chartLeft-4, y(v)+4,
+			strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	// the labels of the time axis at whole hours or days of the local time
+	interval := chartRanges[len(chartRanges)-1].label
+	for _, r := range chartRanges {
+		if span <= time.Duration(r.hours)*time.Hour {
+			interval = r.label
+			break
+		}
+	}
+	t := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+	for ; !t.After(from.Add(span)); t = t.Add(interval) {
+		if t.Before(from) {
+			continue
+		}
+		tx := chartLeft + float64(t.Sub(from))/float64(span)*plotW
+		label := t.Format("15:04")
+		if interval >= 24*time.Hour {
+			label = i18n.Date(t)
+		} else if span > 24*time.Hour {
+			label = i18n.Date(t) + " " + label
+		}
+		_, _ = fmt.Fprintf(w, "<line x1=\"%.1f\" y1=\"%d\" x2=\"%.1f\" y2=\"%.1f\" stroke=\"#eee\"/>", tx, chartTop, tx, chartTop+plotH)
+		_, _ = fmt.Fprintf(w, "<text x=\"%.1f\" y=\"%d\" text-anchor=\"middle\">%s</text>\n", tx, CHART_HEIGHT-6,
+			html.EscapeString(label))
+	}
+	// the fan state as band below the plot, the opacity is the share of the time the fan was on,
+	// adjacent slots with the same share are one rectangle
+	slot := plotW / float64(len(points))
+	fanY := chartTop + plotH + 4
+	for i := 0; i < len(points); {
+		share := math.Round(points[i].fan*20) / 20
+		j := i + 1
+		for j < len(points) && math.Round(points[j].fan*20)/20 == share {
+			j++
+		}
+		if share > 0 {
+			_, _ = fmt.Fprintf(w, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%d\" fill=\"#2ca02c\" fill-opacity=\"%.2f\"/>",
+				chartLeft+float64(i)*slot, fanY, float64(j-i)*slot, chartFan, share)
+		}
+		i = j
+	}
+	_, _ = io.WriteString(w, "\n")
+	for _, line := range []struct {
+		color string
+		value func(chartPoint) float64
+	}{
+		{"#1f77b4", func(p chartPoint) float64 { return p.dpInside }},
+		{"#ff7f0e", func(p chartPoint) float64 { return p.dpOutside }},
+	} {
+		// a gap of the readings starts a new part of the path
+		var d strings.Builder
+		cmd := "M"
+		for i, p := range points {
+			if !p.valid {
+				cmd = "M"
+				continue
+			}
+			_, _ = fmt.Fprintf(&d, "%s%.1f %.1f ", cmd, x(i), y(line.value(p)))
+			cmd = "L"
+		}
+		_, _ = fmt.Fprintf(w, "<path d=\"%s\" fill=\"none\" stroke=\"%s\" stroke-width=\"1.5\"/>\n",
+			strings.TrimSpace(d.String()), line.color)
+	}
+	_, _ = io.WriteString(w, "</svg>\n")
+}
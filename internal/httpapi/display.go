@@ -0,0 +1,115 @@
+package httpapi
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aluedtke7/dew_point_fan/internal/display"
+	"github.com/aluedtke7/dew_point_fan/internal/i18n"
+)
+
+// default interval in s, in which the mirror of the display is reloaded
+const DISPLAY_REFRESH = 5
+
+const displayHead = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+%s<title>%s</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+.lcd { display: inline-block; padding: 0.6em 0.8em; border-radius: 0.4em; background: #4a7; color: #012;
+  font-family: monospace; font-size: 1.4em; line-height: 1.3; white-space: pre; }
+.lcd.dark { background: #243; color: #9b9; }
+</style>
+</head>
+<body>
+`
+
+// GET shows the lines of the display as HTML page, with ?format=text as plain text and with
+// ?format=json as JSON. ?refresh=<s> sets the reload interval of the page, 0 disables it.
+func (s *server) display(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	snap := s.ctrl.Display()
+	format := req.URL.Query().Get("format")
+	if format == "" && strings.HasPrefix(req.Header.Get("Accept"), "text/plain") {
+		format = "text"
+	}
+	switch format {
+	case "json":
+		writeJson(w, snap)
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = io.WriteString(w, displayText(snap))
+	case "", "html":
+		refresh := DISPLAY_REFRESH
+		if r := req.URL.Query().Get("refresh"); r != "" {
+			n, err := strconv.Atoi(r)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid refresh", http.StatusBadRequest)
+				return
+			}
+			refresh = n
+		}
+		writeDisplayPage(w, req, snap, refresh)
+	default:
+		http.Error(w, "unknown format", http.StatusBadRequest)
+	}
+}
+
+// returns the line as shown on the display, cut or padded to the width
+func displayLine(text string, width int) string {
+	r := []rune(text)
+	if len(r) > width {
+		return string(r[:width])
+	}
+	return text + strings.Repeat(" ", width-len(r))
+}
+
+// the lines in a frame, e.g. for curl in a terminal
+func displayText(snap display.Snapshot) string {
+	border := "+" + strings.Repeat("-", snap.Width) + "+\n"
+	var b strings.Builder
+	b.WriteString(border)
+	for _, l := range snap.Lines {
+		b.WriteString("|" + displayLine(l, snap.Width) + "|\n")
+	}
+	b.WriteString(border)
+	return b.String()
+}
+
+func writeDisplayPage(w http.ResponseWriter, req *http.Request, snap display.Snapshot, refresh int) {
+	meta := ""
+	if refresh > 0 {
+		meta = fmt.Sprintf("<meta http-equiv=\"refresh\" content=\"%d\">\n", refresh)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = fmt.Fprintf(w, displayHead, meta, html.EscapeString(i18n.T("Dew Point Fan")))
+	class := "lcd"
+	if !snap.Backlight {
+		class += " dark"
+	}
+	_, _ = fmt.Fprintf(w, "<div class=\"%s\">", class)
+	for i, l := range snap.Lines {
+		if i > 0 {
+			_, _ = io.WriteString(w, "\n")
+		}
+		// a longer text scrolls on the display, the full text is shown as tooltip
+		title := ""
+		if len([]rune(l)) > snap.Width {
+			title = fmt.Sprintf(" title=\"%s\"", html.EscapeString(l))
+		}
+		_, _ = fmt.Fprintf(w, "<span%s>%s</span>", title, html.EscapeString(displayLine(l, snap.Width)))
+	}
+	_, _ = fmt.Fprintf(w, "</div>\n<p>%s: %s &middot; <a href=\"%s\">%s</a></p>\n</body>\n</html>\n",
+		html.EscapeString(i18n.T("Page")), html.EscapeString(snap.Page),
+		html.EscapeString(withToken("/", req)), html.EscapeString(i18n.T("Dew Point Fan")))
+}
@@ -0,0 +1,65 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// interval of the comments, that keep proxies from closing an idle stream
+const EVENT_KEEPALIVE = 30 * time.Second
+
+// GET streams the events of the controller as server-sent events, ?types=fan,alert selects the
+// types of the events
+func (s *server) eventStream(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	types := map[string]bool{}
+	if t := req.URL.Query().Get("types"); t != "" {
+		for _, name := range strings.Split(t, ",") {
+			types[strings.TrimSpace(name)] = true
+		}
+	}
+	events, cancel := s.ctrl.Subscribe(32)
+	defer cancel()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	lg.Debugf("Event stream for %s started", s.clientAddress(req))
+
+	keepAlive := time.NewTicker(EVENT_KEEPALIVE)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			lg.Debugf("Event stream for %s closed", s.clientAddress(req))
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if len(types) > 0 && !types[e.Type] {
+				continue
+			}
+			j, _ := json.Marshal(e)
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, j); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
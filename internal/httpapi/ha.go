@@ -0,0 +1,106 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aluedtke7/dew_point_fan/internal/controller"
+)
+
+// flat JSON shape for the RESTful sensor/switch integrations of Home Assistant
+type haState struct {
+	TempInside      float32 `json:"temp_i"`
+	TempOutside     float32 `json:"temp_o"`
+	HumInside       float32 `json:"hum_i"`
+	HumOutside      float32 `json:"hum_o"`
+	DewPointInside  float32 `json:"dewpoint_i"`
+	DewPointOutside float32 `json:"dewpoint_o"`
+	Venting         string  `json:"venting"`  // "ON" or "OFF", as expected by binary sensors
+	Override        string  `json:"override"` // "AUTO", "ON" or "OFF"
+	Source          string  `json:"source"`
+	BoostMinutes    int     `json:"boost_minutes"`
+	DiffMin         float32 `json:"diff_min"`
+	Hysteresis      float32 `json:"hysteresis"`
+	Update          string  `json:"update"`
+}
+
+func onOff(b bool) string {
+	if b {
+		return "ON"
+	}
+	return "OFF"
+}
+
+func newHaState(inf *controller.Info) haState {
+	st := haState{
+		Venting:      onOff(inf.Venting),
+		Override:     []string{"AUTO", "ON", "OFF"}[inf.RemoteOverride%3],
+		Source:       inf.Source,
+		BoostMinutes: (inf.Boost + 59) / 60,
+		DiffMin:      inf.DiffMin,
+		Hysteresis:   inf.Hysteresis,
+		Update:       inf.Update,
+	}
+	if len(inf.Sensors) == 2 {
+		st.TempInside, st.HumInside, st.DewPointInside = inf.Sensors[0].Temperature, inf.Sensors[0].Humidity, inf.Sensors[0].DewPoint
+		st.TempOutside, st.HumOutside, st.DewPointOutside = inf.Sensors[1].Temperature, inf.Sensors[1].Humidity, inf.Sensors[1].DewPoint
+	}
+	return st
+}
+
+// GET /api/v1/ha returns the flat state, with ?key=<attribute> only the plain value of this attribute
+func (s *server) ha(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	st := newHaState(s.ctrl.Info())
+	key := req.URL.Query().Get("key")
+	if key == "" {
+		j, _ := json.MarshalIndent(st, "", "  ")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(j)
+		return
+	}
+	var values map[string]interface{}
+	j, _ := json.Marshal(st)
+	_ = json.Unmarshal(j, &values)
+	v, ok := values[key]
+	if !ok {
+		http.Error(w, "unknown key", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = fmt.Fprint(w, v)
+}
+
+// GET /api/v1/ha/switch returns "ON" or "OFF" for the fan, POST with body "ON", "OFF" or "AUTO"
+// sets the remote override (RESTful switch of Home Assistant)
+func (s *server) haSwitch(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "GET":
+	case "POST":
+		body, err := io.ReadAll(io.LimitReader(req.Body, 64))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		value := strings.ToUpper(strings.TrimSpace(string(body)))
+		err = s.ctrl.Audited(controller.AUDIT_OVERRIDE, controller.VIA_HA, s.clientAddress(req), func() error {
+			return s.ctrl.ExecuteCommand("override", value)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lg.Infof("Home Assistant switch: %s", value)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = fmt.Fprint(w, onOff(s.ctrl.Info().Venting))
+}
@@ -0,0 +1,35 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+// returns the latest log lines, optional query parameters are lines (number of lines) and level (minimum level)
+func logs(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lines := 0
+	if l := req.URL.Query().Get("lines"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid number of lines", http.StatusBadRequest)
+			return
+		}
+		lines = n
+	}
+	minLevel := logger.LevelDebug
+	if l := req.URL.Query().Get("level"); l != "" {
+		lvl, err := logger.ParseLevel(l)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		minLevel = lvl
+	}
+	writeJson(w, logger.Recent(lines, minLevel))
+}
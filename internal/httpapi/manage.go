@@ -0,0 +1,96 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aluedtke7/dew_point_fan/internal/controller"
+)
+
+type pauseRequest struct {
+	Minutes int `json:"minutes"` // default 60, 0 resumes the automatic control
+}
+
+// authorized only calls the handler with the management token of the config, the management API
+// is disabled without a token
+func (s *server) authorized(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if s.ctrl.AccessTokens().Manage == "" {
+			http.Error(w, "management API disabled, set http.token", http.StatusForbidden)
+			return
+		}
+		if s.role(req) != ROLE_MANAGE {
+			lg.Warnf("Unauthorized call of %s from %s", req.URL.Path, s.clientAddress(req))
+			w.Header().Set("WWW-Authenticate", `Bearer realm="dew-point-fan"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h(w, req)
+	}
+}
+
+// POST restarts the program, the fan is switched to the safe state before
+func (s *server) restart(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = s.audited(req, controller.AUDIT_RESTART, func() error {
+		s.ctrl.Restart()
+		return nil
+	})
+	writeJson(w, map[string]string{"status": "restarting"})
+}
+
+// POST reads the config file again
+func (s *server) reload(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var resp controller.ReloadResponse
+	err := s.audited(req, controller.AUDIT_CONFIG, func() (err error) {
+		resp, err = s.ctrl.ReloadConfig()
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	writeJson(w, resp)
+}
+
+// POST pauses the automatic control, DELETE resumes it and GET returns the remaining time
+func (s *server) pause(w http.ResponseWriter, req *http.Request) {
+	var resp controller.PauseResponse
+	var err error
+	switch req.Method {
+	case "POST":
+		pr := &pauseRequest{Minutes: controller.DEF_PAUSE_MINUTES}
+		if req.ContentLength != 0 {
+			if err = json.NewDecoder(req.Body).Decode(pr); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		err = s.audited(req, controller.AUDIT_PAUSE, func() (err error) {
+			resp, err = s.ctrl.Pause(pr.Minutes)
+			return err
+		})
+	case "DELETE":
+		err = s.audited(req, controller.AUDIT_PAUSE, func() (err error) {
+			resp, err = s.ctrl.Pause(0)
+			return err
+		})
+	case "GET":
+		resp = s.ctrl.PauseState()
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJson(w, resp)
+}
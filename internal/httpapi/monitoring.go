@@ -0,0 +1,79 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aluedtke7/dew_point_fan/internal/controller"
+)
+
+// prefix of the service names of the Checkmk local checks
+const CHECKMK_PREFIX = "DPF "
+
+// a check of the Zabbix items, the metrics are keyed by name for simple JSONPath expressions
+type zabbixCheck struct {
+	State     int                `json:"state"`
+	StateName string             `json:"state_name"`
+	Text      string             `json:"text"`
+	Metrics   map[string]float64 `json:"metrics"`
+}
+
+type zabbixResponse struct {
+	Discovery []map[string]string    `json:"discovery"` // low-level discovery with the macro {#CHECK}
+	Checks    map[string]zabbixCheck `json:"checks"`
+}
+
+// GET returns the checks in the format of the Checkmk local checks, one service per line
+func (s *server) checkmk(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var b strings.Builder
+	for _, c := range s.ctrl.MonitorChecks() {
+		_, _ = fmt.Fprintf(&b, "%d \"%s%s\" %s %s\n", c.State, CHECKMK_PREFIX, c.Name, checkmkMetrics(c.Metrics),
+			strings.ReplaceAll(c.Text, "\n", " "))
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// name=value;warn;crit|name=value or "-" without metrics
+func checkmkMetrics(metrics []controller.MonitorMetric) string {
+	if len(metrics) == 0 {
+		return "-"
+	}
+	var parts []string
+	for _, m := range metrics {
+		p := m.Name + "=" + formatValue(m.Value)
+		if m.Warn != nil && m.Crit != nil {
+			p += ";" + formatValue(*m.Warn) + ";" + formatValue(*m.Crit)
+		}
+		parts = append(parts, p)
+	}
+	return strings.Join(parts, "|")
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// GET returns the discovery and the values of the checks for the HTTP agent items of Zabbix
+func (s *server) zabbix(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	res := zabbixResponse{Discovery: []map[string]string{}, Checks: map[string]zabbixCheck{}}
+	for _, c := range s.ctrl.MonitorChecks() {
+		res.Discovery = append(res.Discovery, map[string]string{"{#CHECK}": c.Name})
+		zc := zabbixCheck{State: c.State, StateName: c.StateName(), Text: c.Text, Metrics: map[string]float64{}}
+		for _, m := range c.Metrics {
+			zc.Metrics[m.Name] = m.Value
+		}
+		res.Checks[c.Name] = zc
+	}
+	writeJson(w, res)
+}
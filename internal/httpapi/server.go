@@ -0,0 +1,477 @@
+// Package httpapi serves the web page and the REST API of the controller.
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	d2r2log "github.com/d2r2/go-logger"
+
+	"github.com/aluedtke7/dew_point_fan/internal/controller"
+	"github.com/aluedtke7/dew_point_fan/internal/display"
+	"github.com/aluedtke7/dew_point_fan/internal/i18n"
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+	"github.com/aluedtke7/dew_point_fan/internal/sensor"
+	"github.com/aluedtke7/dew_point_fan/internal/storage"
+)
+
+var lg = d2r2log.NewPackageLogger("httpapi", d2r2log.InfoLevel)
+
+// Controller is the part of the controller that is used by the API
+type Controller interface {
+	Info() *controller.Info
+	EffectiveConfig() controller.EffectiveConfig
+	ExecuteCommand(command, value string) error
+	Decisions() []controller.Decision
+	Boost() controller.BoostResponse
+	StartBoost(minutes int) controller.BoostResponse
+	StopBoost() controller.BoostResponse
+	Maintenance() controller.MaintenanceResponse
+	StartMaintenance(minutes int) (controller.MaintenanceResponse, error)
+	StopMaintenance() controller.MaintenanceResponse
+	Stats() controller.StatsResponse
+	Runtime() controller.RuntimeResponse
+	ResetRuntime() controller.RuntimeResponse
+	Energy() controller.EnergyResponse
+	Progress() controller.ProgressResponse
+	Relay() controller.RelayResponse
+	ResetRelay() controller.RelayResponse
+	HasHistory() bool
+	History(from, to time.Time) ([]storage.Record, error)
+	LogLevel() controller.LogLevelResponse
+	SetLogLevel(lvl int, d time.Duration) controller.LogLevelResponse
+	Diag() controller.DiagResponse
+	Raw() controller.RawResponse
+	ActionBy(action, via, client string) error
+	Audited(change, via, client string, fn func() error) error
+	Audit() []controller.AuditEntry
+	MonitorChecks() []controller.MonitorCheck
+	Subscribe(size int) (<-chan controller.Event, func())
+	Display() display.Snapshot
+	Peer() sensor.PeerData
+	Dashboard() ([]byte, error)
+	AccessTokens() controller.AccessTokens
+	TrustedProxies() []*net.IPNet
+	Restart()
+	ReloadConfig() (controller.ReloadResponse, error)
+	Pause(minutes int) (controller.PauseResponse, error)
+	PauseState() controller.PauseResponse
+}
+
+type server struct {
+	ctrl    Controller
+	proxies []*net.IPNet // trusted reverse proxies
+}
+
+// the configuration is only part of /info, not of the MQTT state
+type infoResponse struct {
+	*controller.Info
+	Effective controller.EffectiveConfig `json:"effective"`
+}
+
+type remoteControl struct {
+	Override int `json:"override"`
+}
+
+type boostRequest struct {
+	Minutes int `json:"minutes"`
+}
+
+type actionRequest struct {
+	Action string `json:"action"`
+}
+
+type logLevelRequest struct {
+	Level   string `json:"level"`   // debug, info, warn or error
+	Minutes int    `json:"minutes"` // time until the level drops back to info, default 30
+}
+
+// New returns the handler for all routes of the API
+func New(ctrl Controller) http.Handler {
+	s := &server{ctrl: ctrl, proxies: ctrl.TrustedProxies()}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.web)
+	mux.HandleFunc("/info", s.info)
+	mux.HandleFunc("/control", s.control)
+	mux.HandleFunc("/display", s.display)
+	mux.HandleFunc("/override", s.override)
+	mux.HandleFunc("/api/v1/decisions", s.decisions)
+	mux.HandleFunc("/api/v1/boost", s.boost)
+	mux.HandleFunc("/api/v1/maintenance", s.maintenance)
+	mux.HandleFunc("/api/v1/stats", s.stats)
+	mux.HandleFunc("/api/v1/runtime", s.runtime)
+	mux.HandleFunc("/api/v1/runtime/reset", s.runtimeReset)
+	mux.HandleFunc("/api/v1/energy", s.energy)
+	mux.HandleFunc("/api/v1/progress", s.progress)
+	mux.HandleFunc("/api/v1/relay", s.relay)
+	mux.HandleFunc("/api/v1/peer", s.peer)
+	mux.HandleFunc("/api/v1/grafana", s.grafana)
+	mux.HandleFunc("/api/v1/relay/reset", s.relayReset)
+	mux.HandleFunc("/api/v1/ha", s.ha)
+	mux.HandleFunc("/api/v1/ha/switch", s.haSwitch)
+	mux.HandleFunc("/api/v1/loglevel", s.logLevel)
+	mux.HandleFunc("/api/v1/logs", logs)
+	mux.HandleFunc("/api/v1/diag", s.diag)
+	mux.HandleFunc("/api/v1/raw", s.raw)
+	mux.HandleFunc("/api/v1/action", s.action)
+	mux.HandleFunc("/api/v1/audit", s.audit)
+	mux.HandleFunc("/api/v1/events", s.eventStream)
+	mux.HandleFunc("/api/v1/checkmk", s.checkmk)
+	mux.HandleFunc("/api/v1/zabbix", s.zabbix)
+	mux.HandleFunc("/api/v1/manage/restart", s.authorized(s.restart))
+	mux.HandleFunc("/api/v1/manage/reload", s.authorized(s.reload))
+	mux.HandleFunc("/api/v1/manage/pause", s.authorized(s.pause))
+	if ctrl.HasHistory() {
+		mux.HandleFunc("/api/v1/history", s.history)
+		mux.HandleFunc("/chart", s.chart)
+	}
+	return s.access(mux)
+}
+
+func writeJson(w http.ResponseWriter, v interface{}) {
+	j, _ := json.MarshalIndent(v, "", "  ")
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(j)
+}
+
+func onOffText(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+// browser page with the values as plain text and the controls of the fan
+func (s *server) web(w http.ResponseWriter, req *http.Request) {
+	inf := s.ctrl.Info()
+	venting, fanIsOn := "---", "---"
+	if len(inf.Sensors) < 2 {
+		inf.Sensors = make([]controller.SensorData, 2)
+	} else {
+		venting, fanIsOn = i18n.T(onOffText(inf.Venting)), i18n.T(onOff(inf.FanStatus))
+	}
+	update := inf.Update
+	if t, err := time.ParseInLocation(controller.DATE_TIME_FORMAT, update, time.Local); err == nil {
+		update = i18n.DateTime(t)
+	}
+	paused := ""
+	if inf.Paused {
+		paused = i18n.T("Automatic venting paused (door/window open)")
+	}
+	if inf.Maintenance > 0 {
+		paused = i18n.T("Maintenance mode, the fan is forced off")
+	}
+	sensorLine := func(name string, s controller.SensorData) string {
+		return fmt.Sprintf("%-8s %s: %6.1f, %s: %5.1f°C, %s: %5.1f%%\n", name+":",
+			i18n.T("DP"), s.DewPoint, i18n.T("Temp"), s.Temperature, i18n.T("Humidity"), s.Humidity)
+	}
+	text := fmt.Sprintf("%-34s%s\n%s\n%s%s%-41s%s %s\n%s",
+		i18n.T("Dew Point Fan"), update,
+		"-----------------------------------------------------",
+		sensorLine(i18n.T("Inside"), inf.Sensors[0]),
+		sensorLine(i18n.T("Outside"), inf.Sensors[1]),
+		i18n.T("Fan should be")+" "+venting, i18n.T("Fan is"), fanIsOn, paused,
+	)
+	writeWebPage(w, req, text, inf, s.effectiveRole(req) >= ROLE_CONTROL)
+}
+
+// data in JSON format, including the configuration in use
+func (s *server) info(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "GET" {
+		writeJson(w, infoResponse{Info: s.ctrl.Info(), Effective: s.ctrl.EffectiveConfig()})
+	}
+}
+
+// POST handler for changing the remote override
+func (s *server) override(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "POST" {
+		lg.Info("POST API called")
+		remote := &remoteControl{}
+		if err := json.NewDecoder(req.Body).Decode(remote); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err := s.audited(req, controller.AUDIT_OVERRIDE, func() error {
+			return s.ctrl.ExecuteCommand("override", strconv.Itoa(remote.Override))
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJson(w, remote)
+	}
+}
+
+// the last venting decisions including their reason
+func (s *server) decisions(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "GET" {
+		writeJson(w, s.ctrl.Decisions())
+	}
+}
+
+// POST starts a boost, DELETE stops it and GET returns the remaining time
+func (s *server) boost(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "POST":
+		lg.Info("Boost API called")
+		br := &boostRequest{}
+		if req.ContentLength != 0 {
+			if err := json.NewDecoder(req.Body).Decode(br); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		var resp controller.BoostResponse
+		_ = s.audited(req, controller.AUDIT_BOOST, func() error {
+			resp = s.ctrl.StartBoost(br.Minutes)
+			return nil
+		})
+		writeJson(w, resp)
+	case "DELETE":
+		var resp controller.BoostResponse
+		_ = s.audited(req, controller.AUDIT_BOOST, func() error {
+			resp = s.ctrl.StopBoost()
+			return nil
+		})
+		writeJson(w, resp)
+	case "GET":
+		writeJson(w, s.ctrl.Boost())
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// POST starts the maintenance mode, DELETE ends it and GET returns the remaining time
+func (s *server) maintenance(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "POST":
+		lg.Info("Maintenance API called")
+		br := &boostRequest{}
+		if req.ContentLength != 0 {
+			if err := json.NewDecoder(req.Body).Decode(br); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		var resp controller.MaintenanceResponse
+		err := s.audited(req, controller.AUDIT_MAINTENANCE, func() (err error) {
+			resp, err = s.ctrl.StartMaintenance(br.Minutes)
+			return err
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJson(w, resp)
+	case "DELETE":
+		var resp controller.MaintenanceResponse
+		_ = s.audited(req, controller.AUDIT_MAINTENANCE, func() error {
+			resp = s.ctrl.StopMaintenance()
+			return nil
+		})
+		writeJson(w, resp)
+	case "GET":
+		writeJson(w, s.ctrl.Maintenance())
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// POST executes an action of the push buttons, e.g. {"action": "next_page"}
+func (s *server) action(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ar := &actionRequest{}
+	if err := json.NewDecoder(req.Body).Decode(ar); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.ctrl.ActionBy(ar.Action, controller.VIA_API, s.clientAddress(req)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJson(w, s.ctrl.Info())
+}
+
+func (s *server) stats(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "GET" {
+		writeJson(w, s.ctrl.Stats())
+	}
+}
+
+// GET returns the runtime of the fan
+func (s *server) runtime(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJson(w, s.ctrl.Runtime())
+}
+
+// POST resets the runtime after a maintenance
+func (s *server) runtimeReset(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var resp controller.RuntimeResponse
+	_ = s.audited(req, controller.AUDIT_RUNTIME_RESET, func() error {
+		resp = s.ctrl.ResetRuntime()
+		return nil
+	})
+	writeJson(w, resp)
+}
+
+// GET returns the switch counter of the relais
+func (s *server) relay(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJson(w, s.ctrl.Relay())
+}
+
+// POST resets the switch counter after the relais was replaced
+func (s *server) relayReset(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var resp controller.RelayResponse
+	_ = s.audited(req, controller.AUDIT_RELAY_RESET, func() error {
+		resp = s.ctrl.ResetRelay()
+		return nil
+	})
+	writeJson(w, resp)
+}
+
+// GET returns the readings of both sensors for other devices (sensor type "peer")
+func (s *server) peer(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJson(w, s.ctrl.Peer())
+}
+
+// GET returns a Grafana dashboard, ready for the import
+func (s *server) grafana(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	j, err := s.ctrl.Dashboard()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="dew-point-fan.json"`)
+	_, _ = w.Write(j)
+}
+
+func (s *server) energy(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "GET" {
+		writeJson(w, s.ctrl.Energy())
+	}
+}
+
+// GET returns the weekly drying progress
+func (s *server) progress(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJson(w, s.ctrl.Progress())
+}
+
+// returns the local history of the last n hours (query parameter 'hours', default 24, at most
+// HISTORY_MAX_HOURS)
+func (s *server) history(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	hours := 24
+	if h := req.URL.Query().Get("hours"); h != "" {
+		var err error
+		if hours, err = strconv.Atoi(h); err != nil || hours <= 0 || hours > HISTORY_MAX_HOURS {
+			http.Error(w, fmt.Sprintf("invalid value for hours (1...%d)", HISTORY_MAX_HOURS), http.StatusBadRequest)
+			return
+		}
+	}
+	now := time.Now()
+	records, err := s.ctrl.History(now.Add(-time.Duration(hours)*time.Hour), now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJson(w, records)
+}
+
+// PUT sets the log level, GET returns it
+func (s *server) logLevel(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case "PUT":
+		lr := &logLevelRequest{}
+		if err := json.NewDecoder(req.Body).Decode(lr); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lvl, err := logger.ParseLevel(lr.Level)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if lr.Minutes <= 0 {
+			lr.Minutes = controller.DEF_DEBUG_MINUTES
+		}
+		var resp controller.LogLevelResponse
+		_ = s.audited(req, controller.AUDIT_LOG_LEVEL, func() error {
+			resp = s.ctrl.SetLogLevel(lvl, time.Duration(lr.Minutes)*time.Minute)
+			return nil
+		})
+		writeJson(w, resp)
+	case "GET":
+		writeJson(w, s.ctrl.LogLevel())
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *server) diag(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJson(w, s.ctrl.Diag())
+}
+
+// raw and corrected readings of the last cycle, to check the calibration
+func (s *server) raw(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJson(w, s.ctrl.Raw())
+}
+
+// executes a change of the API and records it in the audit log with the address of the client
+func (s *server) audited(req *http.Request, change string, fn func() error) error {
+	return s.ctrl.Audited(change, controller.VIA_API, s.clientAddress(req), fn)
+}
+
+// GET returns the audit log of the changes, oldest first
+func (s *server) audit(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJson(w, s.ctrl.Audit())
+}
@@ -0,0 +1,157 @@
+package httpapi
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aluedtke7/dew_point_fan/internal/controller"
+	"github.com/aluedtke7/dew_point_fan/internal/i18n"
+)
+
+// a control of the web page, the question is asked before it's executed
+type webControl struct {
+	action   string
+	label    string
+	question string
+}
+
+var webControls = []webControl{
+	{"on", "Fan on", "Switch the fan on?"},
+	{"off", "Fan off", "Switch the fan off?"},
+	{"auto", "Automatic", "Return to the automatic control?"},
+	{"boost", "Boost", "Start a boost?"},
+	{"boost_stop", "Stop boost", "Stop the boost?"},
+}
+
+const webHead = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>%s</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+pre { overflow-x: auto; }
+.controls a, .controls button { display: inline-block; min-width: 7em; margin: 0.3em 0.3em 0.3em 0;
+  padding: 0.8em 1em; font-size: 1em; border: 1px solid #888; border-radius: 0.5em;
+  background: #eee; color: inherit; text-align: center; text-decoration: none; }
+.controls button { background: #d33; color: #fff; }
+</style>
+</head>
+<body>
+`
+
+func findControl(action string) (webControl, bool) {
+	for _, c := range webControls {
+		if c.action == action {
+			return c, true
+		}
+	}
+	return webControl{}, false
+}
+
+// adds the token of the query to the path of a link, the browser can't send it as header
+func withToken(path string, req *http.Request) string {
+	token := req.URL.Query().Get("token")
+	if token == "" {
+		return path
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + "token=" + url.QueryEscape(token)
+}
+
+// writes the page with the text of the values and the buttons, with ?confirm=<action> the buttons
+// are replaced by the question for the action. Without the control role there are no buttons.
+func writeWebPage(w http.ResponseWriter, req *http.Request, text string, inf *controller.Info, control bool) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = fmt.Fprintf(w, webHead, html.EscapeString(i18n.T("Dew Point Fan")))
+	_, _ = fmt.Fprintf(w, "<pre>%s</pre>\n", html.EscapeString(text))
+	if o := inf.OverrideBy; o != nil {
+		by := o.Via
+		if o.Client != "" {
+			by += ", " + o.Client
+		}
+		_, _ = fmt.Fprintf(w, "<p>%s: %s (%s, %s)</p>\n", html.EscapeString(i18n.T("Last change")),
+			html.EscapeString(i18n.T(findLabel(o.Action))), html.EscapeString(by), html.EscapeString(o.Time))
+	}
+	if c, ok := findControl(req.URL.Query().Get("confirm")); ok && control {
+		writeConfirmation(w, req, c)
+	} else if control {
+		writeControls(w, req, inf)
+	}
+	_, _ = fmt.Fprintf(w, "<p><a href=\"%s\">%s</a></p>\n", html.EscapeString(withToken("/display", req)),
+		html.EscapeString(i18n.T("Display")))
+	_, _ = io.WriteString(w, "</body>\n</html>\n")
+}
+
+func findLabel(action string) string {
+	if c, ok := findControl(action); ok {
+		return c.label
+	}
+	return action
+}
+
+// the buttons are links to the confirmation, a boost can be stopped while it's running
+func writeControls(w http.ResponseWriter, req *http.Request, inf *controller.Info) {
+	_, _ = io.WriteString(w, `<div class="controls">`+"\n")
+	for _, c := range webControls {
+		if c.action == "boost" && inf.Boost > 0 || c.action == "boost_stop" && inf.Boost == 0 {
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", html.EscapeString(withToken("/?confirm="+c.action, req)),
+			html.EscapeString(i18n.T(c.label)))
+	}
+	_, _ = io.WriteString(w, "</div>\n")
+}
+
+func writeConfirmation(w http.ResponseWriter, req *http.Request, c webControl) {
+	_, _ = fmt.Fprintf(w, `<form class="controls" method="post" action="%s">
+<p>%s</p>
+<input type="hidden" name="action" value="%s">
+<button type="submit">%s</button>
+<a href="%s">%s</a>
+</form>
+`, html.EscapeString(withToken("/control", req)), html.EscapeString(i18n.T(c.question)), c.action,
+		html.EscapeString(i18n.T("Yes")), html.EscapeString(withToken("/", req)), html.EscapeString(i18n.T("Cancel")))
+}
+
+// POST executes a confirmed control of the web page and returns to it
+func (s *server) control(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	action := req.FormValue("action")
+	change, fn := controller.AUDIT_OVERRIDE, func() error {
+		return s.ctrl.ExecuteCommand("override", action)
+	}
+	switch action {
+	case "on", "off", "auto":
+	case "boost":
+		change, fn = controller.AUDIT_BOOST, func() error {
+			s.ctrl.StartBoost(0)
+			return nil
+		}
+	case "boost_stop":
+		change, fn = controller.AUDIT_BOOST, func() error {
+			s.ctrl.StopBoost()
+			return nil
+		}
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+	lg.Infof("Web page: %s from %s", action, s.clientAddress(req))
+	if err := s.ctrl.Audited(change, controller.VIA_WEB, s.clientAddress(req), fn); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, req, withToken("/", req), http.StatusSeeOther)
+}
@@ -0,0 +1,138 @@
+// Package i18n translates the texts of the display and the web page. The English texts are
+// the keys, texts without a translation are shown in English.
+package i18n
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LANG_EN = "en"
+	LANG_DE = "de"
+)
+
+type language struct {
+	texts    map[string]string
+	date     string // layout of a date
+	dateTime string // layout of a date with time
+}
+
+var languages = map[string]language{
+	LANG_EN: {
+		date:     "2006-01-02",
+		dateTime: "2006-01-02 15:04:05",
+	},
+	LANG_DE: {
+		date:     "02.01.2006",
+		dateTime: "02.01.2006 15:04:05",
+		texts: map[string]string{
+			// display, the texts of the main page have the same length as the English ones,
+			// umlauts are not available in the character set of the LCD
+			"Starting...":   "Starte...",
+			"Version":       "Version",
+			"heater purge":  "Heizen",
+			"retried":       "Fehler",
+			"on":            "an",
+			"off":           "aus",
+			"ON ":           "AN ",
+			"ON":            "AN",
+			"OFF":           "AUS",
+			"PAU":           "PAU",
+			"LCK":           "SPR",
+			"MNT":           "WRT",
+			"Fan runtime":   "Laufzeit Luefter",
+			"since":         "seit",
+			"Zone":          "Zone",
+			"no data":       "keine Daten",
+			"sensor failed": "Sensor defekt",
+			"Fan":           "Luefter",
+			"(schedule)":    "(Zeitplan)",
+			"Quality":       "Qualitaet",
+			"weak signal":   "schwaches Signal",
+			"Today":         "Heute",
+			"Yesterday":     "Gestern",
+			// web page
+			"Dew Point Fan": "Taupunktlüftung",
+			"Inside":        "Innen",
+			"Outside":       "Außen",
+			"DP":            "TP",
+			"Temp":          "Temp",
+			"Humidity":      "Feuchte",
+			"Fan should be": "Lüfter soll",
+			"Fan is":        "Lüfter ist",
+			"Automatic venting paused (door/window open)": "Automatische Lüftung pausiert (Tür/Fenster offen)",
+			"Maintenance mode, the fan is forced off":     "Wartungsmodus, der Lüfter ist aus",
+			"Dew point inside":                            "Taupunkt innen",
+			"Dew point outside":                           "Taupunkt außen",
+			"Fan on":                                      "Lüfter an",
+			"Fan off":                                     "Lüfter aus",
+			"Automatic":                                   "Automatik",
+			"Boost":                                       "Boost",
+			"Stop boost":                                  "Boost beenden",
+			"Switch the fan on?":                          "Lüfter einschalten?",
+			"Switch the fan off?":                         "Lüfter ausschalten?",
+			"Return to the automatic control?":            "Zurück zur automatischen Steuerung?",
+			"Start a boost?":                              "Boost starten?",
+			"Stop the boost?":                             "Boost beenden?",
+			"Yes":                                         "Ja",
+			"Cancel":                                      "Abbrechen",
+			"Last change":                                 "Letzte Änderung",
+			"Page":                                        "Seite",
+			"Display":                                     "Anzeige",
+		},
+	},
+}
+
+var (
+	mu      sync.RWMutex
+	current = languages[LANG_EN]
+)
+
+// SetLanguage selects the language, an empty name selects English
+func SetLanguage(name string) error {
+	name = strings.ToLower(name)
+	if name == "" {
+		name = LANG_EN
+	}
+	l, ok := languages[name]
+	if !ok {
+		return fmt.Errorf("unknown language '%s'", name)
+	}
+	mu.Lock()
+	current = l
+	mu.Unlock()
+	return nil
+}
+
+// Supported returns true if there are texts for the language
+func Supported(name string) bool {
+	_, ok := languages[strings.ToLower(name)]
+	return ok || name == ""
+}
+
+// T returns the translation of the English text
+func T(text string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if t, ok := current.texts[text]; ok {
+		return t
+	}
+	return text
+}
+
+// Date formats the date in the selected language
+func Date(t time.Time) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return t.Format(current.date)
+}
+
+// DateTime formats the date and time in the selected language
+func DateTime(t time.Time) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return t.Format(current.dateTime)
+}
@@ -0,0 +1,138 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	DEF_FLUSH_INTERVAL = 600              // s
+	BUFFER_MAX_SIZE    = 256 * 1024       // the buffer is written earlier, if it gets larger
+	LOG_FILE           = "dpf.log"        // log file of the low-write mode
+	LOG_FILE_MAX_SIZE  = 2 * 1024 * 1024  // the log file is rotated, if it gets larger
+	LOG_FILE_BACKUPS   = 5                // number of rotated log files, dpf.log.1 is the newest
+	REPEAT_WINDOW      = 10 * time.Minute // identical messages are written once within this time
+)
+
+var levelLetters = "DIWE"
+
+// bufferedFile collects the log lines in memory and appends them to the log file periodically,
+// so the SD card is written every few minutes instead of every cycle
+type bufferedFile struct {
+	mu   sync.Mutex
+	path string
+	buf  bytes.Buffer
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newBufferedFile(dir string, interval time.Duration) (*bufferedFile, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	b := &bufferedFile{path: filepath.Join(dir, LOG_FILE), stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(b.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				b.flush()
+			case <-b.stop:
+				b.flush()
+				return
+			}
+		}
+	}()
+	return b, nil
+}
+
+// adds a line in the format of the log files of the normal mode
+func (b *bufferedFile) add(t time.Time, lvl int, function, msg string) {
+	b.mu.Lock()
+	fmt.Fprintf(&b.buf, "%c%s] %s: %s\n", levelLetters[lvl], t.Format("20060102 15:04:05.000"), filepath.Base(function), msg)
+	full := b.buf.Len() >= BUFFER_MAX_SIZE
+	b.mu.Unlock()
+	if full {
+		go b.flush()
+	}
+}
+
+// appends the buffer to the log file
+func (b *bufferedFile) flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.buf.Len() == 0 {
+		return
+	}
+	if st, err := os.Stat(b.path); err == nil && st.Size()+int64(b.buf.Len()) > LOG_FILE_MAX_SIZE {
+		rotate(b.path)
+	}
+	f, err := os.OpenFile(b.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		// the lines are kept until the next attempt, but not without limit
+		fmt.Fprintf(os.Stderr, "Couldn't write the log file: %s\n", err)
+		if b.buf.Len() > BUFFER_MAX_SIZE*4 {
+			b.buf.Reset()
+		}
+		return
+	}
+	_, err = b.buf.WriteTo(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't write the log file: %s\n", err)
+	}
+}
+
+// renames dpf.log to dpf.log.1, dpf.log.1 to dpf.log.2 and so on
+func rotate(path string) {
+	for i := LOG_FILE_BACKUPS - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+	}
+	_ = os.Rename(path, path+".1")
+}
+
+// writes the remaining lines and stops the periodic flush
+func (b *bufferedFile) close() {
+	close(b.stop)
+	<-b.done
+}
+
+// repeatFilter suppresses identical messages of the same function, e.g. the retries of a sensor
+// that fails every cycle. The number of suppressed messages is appended to the next one.
+type repeatFilter struct {
+	seen map[string]*repeatState
+}
+
+type repeatState struct {
+	first      time.Time
+	suppressed int
+}
+
+// returns false if the message is suppressed, otherwise the message to log
+func (r *repeatFilter) check(now time.Time, lvl int, function, msg string) (string, bool) {
+	key := fmt.Sprintf("%d|%s|%s", lvl, function, msg)
+	st, ok := r.seen[key]
+	if ok && now.Sub(st.first) < REPEAT_WINDOW {
+		st.suppressed++
+		return "", false
+	}
+	if ok && st.suppressed > 0 {
+		msg = fmt.Sprintf("%s (repeated %d times in %s)", msg, st.suppressed, now.Sub(st.first).Round(time.Second))
+	}
+	// forget messages that didn't appear again, the map must not grow without limit
+	for k, s := range r.seen {
+		if now.Sub(s.first) >= REPEAT_WINDOW {
+			delete(r.seen, k)
+		}
+	}
+	r.seen[key] = &repeatState{first: now}
+	return msg, true
+}
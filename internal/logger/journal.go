@@ -0,0 +1,82 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	JOURNAL_SOCKET      = "/run/systemd/journal/socket"
+	JOURNAL_IDENTIFIER  = "dew-point-fan"
+	JOURNAL_MAX_MESSAGE = 48 * 1024 // larger messages don't fit into a datagram
+)
+
+// journalWriter sends structured entries with the native protocol of systemd-journald
+type journalWriter struct {
+	conn *net.UnixConn
+	addr *net.UnixAddr
+}
+
+func newJournalWriter() (*journalWriter, error) {
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't connect to journald: %s", err)
+	}
+	return &journalWriter{conn: conn, addr: &net.UnixAddr{Name: JOURNAL_SOCKET, Net: "unixgram"}}, nil
+}
+
+// JournalAvailable returns true if systemd-journald is running
+func JournalAvailable() bool {
+	_, err := os.Stat(JOURNAL_SOCKET)
+	return err == nil
+}
+
+// syslog priorities of the log levels
+func journalPriority(lvl int) int {
+	switch lvl {
+	case LevelDebug:
+		return 7
+	case LevelInfo:
+		return 6
+	case LevelWarn:
+		return 4
+	}
+	return 3
+}
+
+func (j *journalWriter) send(lvl int, msg string, c caller) {
+	if len(msg) > JOURNAL_MAX_MESSAGE {
+		msg = msg[:JOURNAL_MAX_MESSAGE] + "..."
+	}
+	var buf bytes.Buffer
+	appendField(&buf, "MESSAGE", msg)
+	appendField(&buf, "PRIORITY", strconv.Itoa(journalPriority(lvl)))
+	appendField(&buf, "SYSLOG_IDENTIFIER", JOURNAL_IDENTIFIER)
+	appendField(&buf, "CODE_FUNC", c.function)
+	appendField(&buf, "CODE_FILE", filepath.Base(c.file))
+	appendField(&buf, "CODE_LINE", strconv.Itoa(c.line))
+	if _, err := j.conn.WriteToUnix(buf.Bytes(), j.addr); err != nil {
+		fmt.Fprintf(os.Stderr, "journald: %s: %s\n", err, msg)
+	}
+}
+
+func (j *journalWriter) close() {
+	_ = j.conn.Close()
+}
+
+// appends a field, values with line breaks are written with their length
+func appendField(buf *bytes.Buffer, key, value string) {
+	if !strings.Contains(value, "\n") {
+		buf.WriteString(key + "=" + value + "\n")
+		return
+	}
+	buf.WriteString(key + "\n")
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value + "\n")
+}
@@ -0,0 +1,226 @@
+// Package logger writes the log of the program to files, the console and/or systemd-journald.
+package logger
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	alog "github.com/antigloss/go/logger"
+)
+
+const (
+	LevelDebug = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// Config selects the log destinations
+type Config struct {
+	Dir     string `json:"-"`       // directory of the log files
+	File    bool   `json:"file"`    // write log files
+	Console bool   `json:"console"` // write to stdout
+	Journal bool   `json:"journal"` // send structured entries to systemd-journald
+	// low-write mode for SD cards: the log file is written every flush_interval s, identical
+	// messages only once in 10 minutes
+	LowWrite      bool `json:"low_write"`
+	FlushInterval int  `json:"flush_interval"` // in s, default 600
+}
+
+var (
+	mu      sync.Mutex
+	std     *alog.Logger
+	journal *journalWriter
+	buffer  *bufferedFile // log file of the low-write mode
+	repeats *repeatFilter // nil without the low-write mode
+	level   = LevelInfo
+)
+
+// Init (re)configures the log destinations
+func Init(cfg Config) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if std != nil {
+		_ = std.Close()
+		std = nil
+	}
+	if journal != nil {
+		journal.close()
+		journal = nil
+	}
+	if buffer != nil {
+		buffer.close()
+		buffer = nil
+	}
+	repeats = nil
+	var dest alog.LogDest
+	// the directory is created even for the console only, it may be read-only
+	dir := ""
+	if cfg.File && !cfg.LowWrite {
+		dest |= alog.LogDestFile
+		dir = cfg.Dir
+	}
+	if cfg.Console {
+		dest |= alog.LogDestConsole
+	}
+	var err error
+	if dest != alog.LogDestNone {
+		std, err = alog.New(&alog.Config{
+			LogDir:            dir,
+			LogFileMaxSize:    2,
+			LogFileMaxNum:     30,
+			LogFileNumToDel:   3,
+			LogDest:           dest,
+			LogFilenamePrefix: "dpf",
+			LogSymlinkPrefix:  "dpf",
+			Flag:              alog.ControlFlagLogDate,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.LowWrite {
+		repeats = &repeatFilter{seen: map[string]*repeatState{}}
+		if cfg.File {
+			interval := cfg.FlushInterval
+			if interval <= 0 {
+				interval = DEF_FLUSH_INTERVAL
+			}
+			if buffer, err = newBufferedFile(cfg.Dir, time.Duration(interval)*time.Second); err != nil {
+				return err
+			}
+		}
+	}
+	if cfg.Journal {
+		journal, err = newJournalWriter()
+	}
+	return err
+}
+
+// Flush writes the buffered lines of the low-write mode to the log file, e.g. before the exit
+func Flush() {
+	mu.Lock()
+	b := buffer
+	mu.Unlock()
+	if b != nil {
+		b.flush()
+	}
+}
+
+func Debug(args ...interface{}) {
+	output(LevelDebug, fmt.Sprint(args...))
+}
+
+func Debugf(format string, args ...interface{}) {
+	output(LevelDebug, fmt.Sprintf(format, args...))
+}
+
+func Info(args ...interface{}) {
+	output(LevelInfo, fmt.Sprint(args...))
+}
+
+func Infof(format string, args ...interface{}) {
+	output(LevelInfo, fmt.Sprintf(format, args...))
+}
+
+func Warn(args ...interface{}) {
+	output(LevelWarn, fmt.Sprint(args...))
+}
+
+func Warnf(format string, args ...interface{}) {
+	output(LevelWarn, fmt.Sprintf(format, args...))
+}
+
+func Error(args ...interface{}) {
+	output(LevelError, fmt.Sprint(args...))
+}
+
+func Errorf(format string, args ...interface{}) {
+	output(LevelError, fmt.Sprintf(format, args...))
+}
+
+// the function that called the log function
+type caller struct {
+	function string
+	file     string
+	line     int
+}
+
+func output(lvl int, msg string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if lvl < level {
+		return
+	}
+	c := caller{function: "???"}
+	if pc, file, line, ok := runtime.Caller(2); ok {
+		c.file, c.line = file, line
+		if f := runtime.FuncForPC(pc); f != nil {
+			c.function = f.Name()
+		}
+	}
+	remember(lvl, msg, c)
+	if repeats != nil {
+		var ok bool
+		if msg, ok = repeats.check(time.Now(), lvl, c.function, msg); !ok {
+			return
+		}
+	}
+	if buffer != nil {
+		buffer.add(time.Now(), lvl, c.function, msg)
+	}
+	if std != nil {
+		text := fmt.Sprintf("%s: %s", filepath.Base(c.function), msg)
+		switch lvl {
+		case LevelDebug:
+			std.Trace(text)
+		case LevelInfo:
+			std.Info(text)
+		case LevelWarn:
+			std.Warn(text)
+		default:
+			std.Error(text)
+		}
+	}
+	if journal != nil {
+		journal.send(lvl, msg, c)
+	}
+}
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// SetLevel suppresses all messages below the level
+func SetLevel(lvl int) {
+	mu.Lock()
+	defer mu.Unlock()
+	level = lvl
+}
+
+// GetLevel returns the current level
+func GetLevel() int {
+	mu.Lock()
+	defer mu.Unlock()
+	return level
+}
+
+// LevelName returns the name of a level, e.g. "debug"
+func LevelName(lvl int) string {
+	if lvl < 0 || lvl >= len(levelNames) {
+		return "unknown"
+	}
+	return levelNames[lvl]
+}
+
+// ParseLevel returns the level with the name
+func ParseLevel(name string) (int, error) {
+	for i, n := range levelNames {
+		if strings.EqualFold(n, name) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level '%s'", name)
+}
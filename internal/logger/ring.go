@@ -0,0 +1,49 @@
+package logger
+
+import "time"
+
+const RING_SIZE = 500
+
+// Entry is a log line kept in memory
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Level    string    `json:"level"`
+	Function string    `json:"function"`
+	Message  string    `json:"message"`
+}
+
+// the last RING_SIZE log lines, protected by mu
+var (
+	ring     = make([]Entry, RING_SIZE)
+	ringNext int
+	ringFull bool
+)
+
+func remember(lvl int, msg string, c caller) {
+	ring[ringNext] = Entry{Time: time.Now(), Level: LevelName(lvl), Function: c.function, Message: msg}
+	ringNext = (ringNext + 1) % RING_SIZE
+	if ringNext == 0 {
+		ringFull = true
+	}
+}
+
+// Recent returns up to n of the latest log lines with at least the given level, oldest first
+func Recent(n int, minLevel int) []Entry {
+	mu.Lock()
+	defer mu.Unlock()
+	var all []Entry
+	if ringFull {
+		all = append(all, ring[ringNext:]...)
+	}
+	all = append(all, ring[:ringNext]...)
+	result := make([]Entry, 0, len(all))
+	for _, e := range all {
+		if lvl, _ := ParseLevel(e.Level); lvl >= minLevel {
+			result = append(result, e)
+		}
+	}
+	if n > 0 && len(result) > n {
+		result = result[len(result)-n:]
+	}
+	return result
+}
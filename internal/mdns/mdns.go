@@ -0,0 +1,302 @@
+// Package mdns announces the HTTP API via multicast DNS (DNS-SD), so the controller can be found
+// without knowing its IP address. Only the records of this service are answered, a Pi running
+// avahi keeps answering its own hostname.
+package mdns
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	d2r2log "github.com/d2r2/go-logger"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	SERVICE      = "_dewpointfan._tcp"
+	DEF_HOSTNAME = "dewpointfan"
+	DEF_INSTANCE = "Dew Point Fan"
+	TTL          = 120 // s
+	// cache flush bit of the class of unique records
+	cacheFlush = 1 << 15
+)
+
+var (
+	lg    = d2r2log.NewPackageLogger("mdns", d2r2log.InfoLevel)
+	group = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+)
+
+type Config struct {
+	Enabled  bool   `json:"enabled"`
+	Hostname string `json:"hostname"` // announced as <hostname>.local, default "dewpointfan"
+	Instance string `json:"instance"` // name of the service shown by the browsers, default "Dew Point Fan"
+}
+
+// Responder answers the mDNS queries for the service and the hostname
+type Responder struct {
+	mu       sync.Mutex
+	conn     *net.UDPConn
+	port     uint16
+	txt      []string
+	host     dnsmessage.Name
+	service  dnsmessage.Name
+	instance dnsmessage.Name
+	services dnsmessage.Name
+	once     sync.Once
+	done     chan struct{}
+}
+
+// New starts the responder for the HTTP server on port, txt are the key=value pairs of the TXT record
+func New(cfg Config, port int, txt []string) (*Responder, error) {
+	if cfg.Hostname == "" {
+		cfg.Hostname = DEF_HOSTNAME
+	}
+	if cfg.Instance == "" {
+		cfg.Instance = DEF_INSTANCE
+	}
+	r := &Responder{port: uint16(port), txt: txt, done: make(chan struct{})}
+	var err error
+	names := []struct {
+		n *dnsmessage.Name
+		s string
+	}{
+		{&r.host, strings.ToLower(cfg.Hostname) + ".local."},
+		{&r.service, SERVICE + ".local."},
+		{&r.instance, cfg.Instance + "." + SERVICE + ".local."},
+		{&r.services, "_services._dns-sd._udp.local."},
+	}
+	for _, n := range names {
+		if *n.n, err = dnsmessage.NewName(n.s); err != nil {
+			return nil, err
+		}
+	}
+	if r.conn, err = net.ListenMulticastUDP("udp4", nil, group); err != nil {
+		return nil, err
+	}
+	go r.serve()
+	go r.announce()
+	return r, nil
+}
+
+// Host returns the announced hostname without the trailing dot
+func (r *Responder) Host() string {
+	return strings.TrimSuffix(r.host.String(), ".")
+}
+
+// Refresh is called after a change of the network: the multicast group is joined again on a new
+// socket (the membership may be lost after a reconnect) and the new addresses are announced
+func (r *Responder) Refresh() {
+	select {
+	case <-r.done:
+		return
+	default:
+	}
+	conn, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		lg.Warnf("Couldn't join the multicast group: %s", err)
+	} else {
+		r.mu.Lock()
+		old := r.conn
+		r.conn = conn
+		r.mu.Unlock()
+		_ = old.Close()
+	}
+	go r.announce()
+}
+
+// Close sends the goodbye packets and stops the responder
+func (r *Responder) Close() {
+	r.once.Do(func() {
+		close(r.done)
+		r.send(0, nil, r.all(0), nil, group)
+		_ = r.connection().Close()
+	})
+}
+
+func (r *Responder) connection() *net.UDPConn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.conn
+}
+
+// the announcement is repeated once, as recommended by RFC 6762
+func (r *Responder) announce() {
+	for i := 0; i < 2; i++ {
+		select {
+		case <-r.done:
+			return
+		default:
+		}
+		r.send(0, nil, r.all(TTL), nil, group)
+		time.Sleep(time.Second)
+	}
+}
+
+func (r *Responder) serve() {
+	buf := make([]byte, 9000)
+	for {
+		conn := r.connection()
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-r.done:
+				return
+			default:
+			}
+			if conn != r.connection() {
+				// replaced by Refresh
+				continue
+			}
+			lg.Warnf("Reading failed: %s", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		var p dnsmessage.Parser
+		h, err := p.Start(buf[:n])
+		if err != nil || h.Response {
+			continue
+		}
+		questions, err := p.AllQuestions()
+		if err != nil {
+			continue
+		}
+		var answers, extra []dnsmessage.Resource
+		// legacy resolvers don't use port 5353 and expect a unicast answer with their ID
+		unicast := src.Port != group.Port
+		for _, q := range questions {
+			a, e := r.answer(q)
+			answers = append(answers, a...)
+			extra = append(extra, e...)
+			if q.Class&cacheFlush != 0 {
+				unicast = true
+			}
+		}
+		if len(answers) == 0 {
+			continue
+		}
+		if unicast {
+			// the answer to a legacy resolver repeats the questions
+			r.send(h.ID, questions, answers, extra, src)
+		} else {
+			r.send(0, nil, answers, extra, group)
+		}
+	}
+}
+
+// returns the answers and the additional records for a question
+func (r *Responder) answer(q dnsmessage.Question) ([]dnsmessage.Resource, []dnsmessage.Resource) {
+	is := func(name dnsmessage.Name, types ...dnsmessage.Type) bool {
+		if !strings.EqualFold(q.Name.String(), name.String()) {
+			return false
+		}
+		for _, t := range types {
+			if q.Type == t || q.Type == dnsmessage.TypeALL {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case is(r.services, dnsmessage.TypePTR):
+		return []dnsmessage.Resource{r.ptr(r.services, r.service, TTL)}, nil
+	case is(r.service, dnsmessage.TypePTR):
+		return []dnsmessage.Resource{r.ptr(r.service, r.instance, TTL)},
+			append([]dnsmessage.Resource{r.srv(TTL), r.text(TTL)}, r.addresses(TTL)...)
+	case is(r.instance, dnsmessage.TypeSRV, dnsmessage.TypeTXT):
+		var answers []dnsmessage.Resource
+		if q.Type != dnsmessage.TypeTXT {
+			answers = append(answers, r.srv(TTL))
+		}
+		if q.Type != dnsmessage.TypeSRV {
+			answers = append(answers, r.text(TTL))
+		}
+		return answers, r.addresses(TTL)
+	case is(r.host, dnsmessage.TypeA, dnsmessage.TypeAAAA):
+		var answers []dnsmessage.Resource
+		for _, a := range r.addresses(TTL) {
+			if q.Type == a.Header.Type || q.Type == dnsmessage.TypeALL {
+				answers = append(answers, a)
+			}
+		}
+		return answers, nil
+	}
+	return nil, nil
+}
+
+// returns all records, used for the announcement and the goodbye (ttl 0)
+func (r *Responder) all(ttl uint32) []dnsmessage.Resource {
+	return append([]dnsmessage.Resource{r.ptr(r.service, r.instance, ttl), r.srv(ttl), r.text(ttl)}, r.addresses(ttl)...)
+}
+
+func (r *Responder) ptr(name, target dnsmessage.Name, ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.PTRResource{PTR: target},
+	}
+}
+
+func (r *Responder) srv(ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: r.instance, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET | cacheFlush, TTL: ttl},
+		Body:   &dnsmessage.SRVResource{Port: r.port, Target: r.host},
+	}
+}
+
+func (r *Responder) text(ttl uint32) dnsmessage.Resource {
+	txt := r.txt
+	if len(txt) == 0 {
+		// a TXT record must contain at least one string
+		txt = []string{""}
+	}
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: r.instance, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET | cacheFlush, TTL: ttl},
+		Body:   &dnsmessage.TXTResource{TXT: txt},
+	}
+}
+
+// returns an A or AAAA record for every address besides localhost
+func (r *Responder) addresses(ttl uint32) []dnsmessage.Resource {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		lg.Warnf("Couldn't get the addresses: %s", err)
+		return nil
+	}
+	var res []dnsmessage.Resource
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() {
+			continue
+		}
+		header := dnsmessage.ResourceHeader{Name: r.host, Class: dnsmessage.ClassINET | cacheFlush, TTL: ttl}
+		if ip4 := ipNet.IP.To4(); ip4 != nil {
+			var body dnsmessage.AResource
+			copy(body.A[:], ip4)
+			header.Type = dnsmessage.TypeA
+			res = append(res, dnsmessage.Resource{Header: header, Body: &body})
+		} else {
+			var body dnsmessage.AAAAResource
+			copy(body.AAAA[:], ipNet.IP.To16())
+			header.Type = dnsmessage.TypeAAAA
+			res = append(res, dnsmessage.Resource{Header: header, Body: &body})
+		}
+	}
+	return res
+}
+
+func (r *Responder) send(id uint16, questions []dnsmessage.Question, answers, extra []dnsmessage.Resource, dst *net.UDPAddr) {
+	m := dnsmessage.Message{
+		Header:      dnsmessage.Header{ID: id, Response: true, Authoritative: true},
+		Questions:   questions,
+		Answers:     answers,
+		Additionals: extra,
+	}
+	b, err := m.Pack()
+	if err != nil {
+		lg.Warnf("Couldn't pack the answer: %s", err)
+		return
+	}
+	if _, err = r.connection().WriteToUDP(b, dst); err != nil {
+		lg.Debugf("Sending to %s failed: %s", dst, err)
+	}
+}
@@ -0,0 +1,54 @@
+// Package modbus implements the small part of Modbus that the controller needs: reading the
+// registers of RH/T transmitters via Modbus RTU (RS485) and a Modbus TCP server that
+// provides the state of the controller to building automation systems.
+package modbus
+
+import (
+	"fmt"
+
+	d2r2log "github.com/d2r2/go-logger"
+)
+
+// function codes
+const (
+	FuncReadHolding = 0x03
+	FuncReadInput   = 0x04
+)
+
+// exception codes
+const (
+	ExIllegalFunction = 0x01
+	ExIllegalAddress  = 0x02
+	ExIllegalValue    = 0x03
+)
+
+// MAX_REGISTERS is the maximum number of registers of one read request
+const MAX_REGISTERS = 125
+
+var lg = d2r2log.NewPackageLogger("modbus", d2r2log.InfoLevel)
+
+// Exception is the error response of a device
+type Exception struct {
+	Function byte
+	Code     byte
+}
+
+func (e Exception) Error() string {
+	return fmt.Sprintf("modbus exception %d (function %#02x)", e.Code, e.Function)
+}
+
+// crc16 returns the CRC of an RTU frame (polynomial 0xA001, start value 0xFFFF)
+func crc16(data []byte) uint16 {
+	crc := uint16(0xffff)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xa001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,151 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	DEF_BAUD = 9600
+	// a frame is complete after 3.5 characters of silence, at least 1.75 ms
+	frameDelay = 5 * time.Millisecond
+	// read timeout of the serial port in 1/10 s
+	readTimeout = 10
+)
+
+var bauds = map[int]uint32{
+	1200: unix.B1200, 2400: unix.B2400, 4800: unix.B4800, 9600: unix.B9600,
+	19200: unix.B19200, 38400: unix.B38400, 57600: unix.B57600, 115200: unix.B115200,
+}
+
+var errTimeout = errors.New("no response")
+
+// Port is a serial port with an RS485 bus, the requests of all devices on the bus are serialized
+type Port struct {
+	mu     sync.Mutex
+	device string
+	fd     int
+}
+
+var (
+	portsMu sync.Mutex
+	ports   = map[string]*Port{}
+)
+
+// OpenRTU opens the serial port with 8 data bits and 1 stop bit, parity is "N" (default),
+// "E" or "O". Devices on the same bus share the port, the first one sets the parameters.
+func OpenRTU(device string, baud int, parity string) (*Port, error) {
+	portsMu.Lock()
+	defer portsMu.Unlock()
+	if p, ok := ports[device]; ok {
+		return p, nil
+	}
+	if baud == 0 {
+		baud = DEF_BAUD
+	}
+	speed, ok := bauds[baud]
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported baud rate %d", device, baud)
+	}
+	cflag := speed | unix.CS8 | unix.CREAD | unix.CLOCAL
+	switch strings.ToUpper(parity) {
+	case "", "N":
+	case "E":
+		cflag |= unix.PARENB
+	case "O":
+		cflag |= unix.PARENB | unix.PARODD
+	default:
+		return nil, fmt.Errorf("%s: unknown parity '%s'", device, parity)
+	}
+	fd, err := unix.Open(device, unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", device, err)
+	}
+	// raw mode, a read returns after readTimeout without data
+	t := unix.Termios{Cflag: cflag, Ispeed: speed, Ospeed: speed}
+	t.Cc[unix.VMIN] = 0
+	t.Cc[unix.VTIME] = readTimeout
+	if err = unix.IoctlSetTermios(fd, unix.TCSETS, &t); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("%s: %w", device, err)
+	}
+	p := &Port{device: device, fd: fd}
+	ports[device] = p
+	return p, nil
+}
+
+// ReadRegisters reads count input registers (function 4) or holding registers (function 3) of the device unit
+func (p *Port) ReadRegisters(unit byte, input bool, addr, count uint16) ([]uint16, error) {
+	if count == 0 || count > MAX_REGISTERS {
+		return nil, fmt.Errorf("invalid number of registers %d", count)
+	}
+	function := byte(FuncReadHolding)
+	if input {
+		function = FuncReadInput
+	}
+	req := []byte{unit, function, byte(addr >> 8), byte(addr), byte(count >> 8), byte(count)}
+	crc := crc16(req)
+	req = append(req, byte(crc), byte(crc>>8))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// discard the rest of an earlier answer
+	_ = unix.IoctlSetInt(p.fd, unix.TCFLSH, unix.TCIFLUSH)
+	time.Sleep(frameDelay)
+	if _, err := unix.Write(p.fd, req); err != nil {
+		return nil, err
+	}
+	// unit, function, byte count, data, CRC or unit, function | 0x80, exception code, CRC
+	resp, err := p.read(3)
+	if err != nil {
+		return nil, err
+	}
+	if resp[0] != unit || resp[1]&0x7f != function {
+		return nil, fmt.Errorf("unexpected response % x", resp)
+	}
+	size := 5
+	if resp[1]&0x80 == 0 {
+		size = 5 + int(resp[2])
+	}
+	rest, err := p.read(size - 3)
+	if err != nil {
+		return nil, err
+	}
+	resp = append(resp, rest...)
+	if crc16(resp[:size-2]) != binary.LittleEndian.Uint16(resp[size-2:]) {
+		return nil, errors.New("CRC error")
+	}
+	if resp[1]&0x80 != 0 {
+		return nil, Exception{function, resp[2]}
+	}
+	if int(resp[2]) != 2*int(count) {
+		return nil, fmt.Errorf("expected %d registers, got %d bytes", count, resp[2])
+	}
+	values := make([]uint16, count)
+	for i := range values {
+		values[i] = binary.BigEndian.Uint16(resp[3+2*i:])
+	}
+	return values, nil
+}
+
+// reads exactly n bytes
+func (p *Port) read(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	for got := 0; got < n; {
+		m, err := unix.Read(p.fd, buf[got:])
+		if err != nil {
+			return nil, err
+		}
+		if m == 0 {
+			return nil, errTimeout
+		}
+		got += m
+	}
+	return buf, nil
+}
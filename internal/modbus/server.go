@@ -0,0 +1,115 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// connections without a request for this time are closed
+const idleTimeout = 5 * time.Minute
+
+// Server is a read-only Modbus TCP server, the holding and the input registers are the same
+type Server struct {
+	ln        net.Listener
+	registers func() []uint16
+	mu        sync.Mutex
+	conns     map[net.Conn]bool
+}
+
+// Listen starts the server on addr (e.g. ":502"), registers returns the current values of
+// the registers starting at address 0
+func Listen(addr string, registers func() []uint16) (*Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{ln: ln, registers: registers, conns: map[net.Conn]bool{}}
+	go s.serve()
+	return s, nil
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				lg.Errorf("Modbus TCP: %s", err)
+			}
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+// Close stops the server and closes all connections
+func (s *Server) Close() {
+	_ = s.ln.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+}
+
+// handles the requests of a connection, each is an MBAP header (transaction id, protocol id 0,
+// length, unit id) followed by the PDU
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+	header := make([]byte, 7)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		length := int(binary.BigEndian.Uint16(header[4:]))
+		if binary.BigEndian.Uint16(header[2:]) != 0 || length < 2 || length > 254 {
+			return
+		}
+		pdu := make([]byte, length-1)
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			return
+		}
+		resp := s.respond(pdu)
+		binary.BigEndian.PutUint16(header[4:], uint16(len(resp)+1))
+		if _, err := conn.Write(append(header, resp...)); err != nil {
+			return
+		}
+	}
+}
+
+// returns the response PDU of a request PDU
+func (s *Server) respond(pdu []byte) []byte {
+	function := pdu[0]
+	if function != FuncReadHolding && function != FuncReadInput {
+		return []byte{function | 0x80, ExIllegalFunction}
+	}
+	if len(pdu) != 5 {
+		return []byte{function | 0x80, ExIllegalValue}
+	}
+	addr := int(binary.BigEndian.Uint16(pdu[1:]))
+	count := int(binary.BigEndian.Uint16(pdu[3:]))
+	if count == 0 || count > MAX_REGISTERS {
+		return []byte{function | 0x80, ExIllegalValue}
+	}
+	regs := s.registers()
+	if addr+count > len(regs) {
+		return []byte{function | 0x80, ExIllegalAddress}
+	}
+	resp := []byte{function, byte(2 * count)}
+	for _, v := range regs[addr : addr+count] {
+		resp = append(resp, byte(v>>8), byte(v))
+	}
+	return resp
+}
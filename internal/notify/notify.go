@@ -0,0 +1,131 @@
+package notify
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	d2r2log "github.com/d2r2/go-logger"
+)
+
+const (
+	PriorityLow    = -1
+	PriorityNormal = 0
+	PriorityHigh   = 1
+)
+
+var (
+	lg     = d2r2log.NewPackageLogger("notify", d2r2log.InfoLevel)
+	client = &http.Client{Timeout: 15 * time.Second}
+)
+
+// Message is sent to all configured notification backends
+type Message struct {
+	Key      string // kind of alert, set by Alert
+	Title    string
+	Text     string
+	Priority int
+	Channels []string // names of the backends to use, all if empty
+}
+
+// Interface definition for notification backends
+type Notifier interface {
+	Name() string
+	Send(m Message) error
+}
+
+// Dispatcher sends messages to all backends and suppresses repetitions of the same alert
+type Dispatcher struct {
+	notifiers []Notifier
+	repeat    time.Duration
+	mu        sync.Mutex
+	lastSent  map[string]time.Time
+}
+
+// NewDispatcher creates a dispatcher, an alert with the same key is sent at most once within repeat
+func NewDispatcher(repeat time.Duration, notifiers ...Notifier) *Dispatcher {
+	return &Dispatcher{notifiers: notifiers, repeat: repeat, lastSent: map[string]time.Time{}}
+}
+
+// Add adds a notification backend
+func (d *Dispatcher) Add(n Notifier) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.notifiers = append(d.notifiers, n)
+}
+
+// Alert sends the message, unless an alert with the same key was sent recently
+func (d *Dispatcher) Alert(key string, m Message) {
+	d.mu.Lock()
+	if last, ok := d.lastSent[key]; ok && time.Since(last) < d.repeat {
+		d.mu.Unlock()
+		return
+	}
+	d.lastSent[key] = time.Now()
+	m.Key = key
+	notifiers := append([]Notifier{}, d.notifiers...)
+	d.mu.Unlock()
+	lg.Infof("Alert %s: %s", key, m.Text)
+	go send(notifiers, m)
+}
+
+// Resolve resets the repetition suppression of an alert, so that it's sent immediately when it occurs again
+func (d *Dispatcher) Resolve(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.lastSent, key)
+}
+
+// Send sends the message immediately to all backends
+func (d *Dispatcher) Send(m Message) {
+	d.mu.Lock()
+	notifiers := append([]Notifier{}, d.notifiers...)
+	d.mu.Unlock()
+	go send(notifiers, m)
+}
+
+func send(notifiers []Notifier, m Message) {
+	for _, n := range notifiers {
+		if !useChannel(m.Channels, n.Name()) {
+			continue
+		}
+		if err := n.Send(m); err != nil {
+			lg.Errorf("%s: %s", n.Name(), err)
+		}
+	}
+}
+
+func useChannel(channels []string, name string) bool {
+	if len(channels) == 0 {
+		return true
+	}
+	for _, c := range channels {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// filtered passes only alerts with the given keys to a backend
+type filtered struct {
+	Notifier
+	keys []string
+}
+
+// Filter returns a backend that only sends the alerts with the given keys, all alerts if keys is empty
+func Filter(n Notifier, keys []string) Notifier {
+	if len(keys) == 0 {
+		return n
+	}
+	return &filtered{Notifier: n, keys: keys}
+}
+
+func (f *filtered) Send(m Message) error {
+	for _, k := range f.keys {
+		if k == m.Key {
+			return f.Notifier.Send(m)
+		}
+	}
+	return nil
+}
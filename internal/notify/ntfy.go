@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type NtfyConfig struct {
+	Server string `json:"server"` // default https://ntfy.sh
+	Topic  string `json:"topic"`
+	Token  string `json:"token"` // optional access token
+}
+
+// Ntfy sends messages via ntfy.sh or a self-hosted ntfy server
+type Ntfy struct {
+	cfg NtfyConfig
+}
+
+func NewNtfy(cfg NtfyConfig) *Ntfy {
+	if cfg.Server == "" {
+		cfg.Server = "https://ntfy.sh"
+	}
+	return &Ntfy{cfg: cfg}
+}
+
+func (n *Ntfy) Name() string {
+	return "ntfy"
+}
+
+func (n *Ntfy) Send(m Message) error {
+	req, err := http.NewRequest("POST", strings.TrimSuffix(n.cfg.Server, "/")+"/"+n.cfg.Topic, strings.NewReader(m.Text))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", m.Title)
+	// ntfy uses priorities 1 (min) to 5 (max), 3 is the default
+	req.Header.Set("Priority", fmt.Sprintf("%d", 3+m.Priority))
+	if n.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.cfg.Token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("ntfy: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+const pushoverUrl = "https://api.pushover.net/1/messages.json"
+
+type PushoverConfig struct {
+	Token string `json:"token"` // application token
+	User  string `json:"user"`  // user or group key
+}
+
+// Pushover sends messages via pushover.net
+type Pushover struct {
+	cfg PushoverConfig
+}
+
+func NewPushover(cfg PushoverConfig) *Pushover {
+	return &Pushover{cfg: cfg}
+}
+
+func (p *Pushover) Name() string {
+	return "pushover"
+}
+
+func (p *Pushover) Send(m Message) error {
+	resp, err := client.PostForm(pushoverUrl, url.Values{
+		"token":    {p.cfg.Token},
+		"user":     {p.cfg.User},
+		"title":    {m.Title},
+		"message":  {m.Text},
+		"priority": {strconv.Itoa(m.Priority)},
+	})
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("pushover: %s", resp.Status)
+	}
+	return nil
+}
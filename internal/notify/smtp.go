@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+type SmtpConfig struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"` // 587 (STARTTLS) or 465 (TLS)
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Rules    []string `json:"rules"` // alerts sent by email, empty for all alerts
+}
+
+// Smtp sends messages by email
+type Smtp struct {
+	cfg SmtpConfig
+}
+
+func NewSmtp(cfg SmtpConfig) *Smtp {
+	if cfg.Port == 0 {
+		cfg.Port = 587
+	}
+	return &Smtp{cfg: cfg}
+}
+
+func (s *Smtp) Name() string {
+	return "smtp"
+}
+
+func (s *Smtp) Send(m Message) error {
+	addr := net.JoinHostPort(s.cfg.Host, fmt.Sprintf("%d", s.cfg.Port))
+	var auth smtp.Auth
+	if s.cfg.Username != "" {
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+	}
+	msg := []byte(fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n"+
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		s.cfg.From, strings.Join(s.cfg.To, ", "), m.Title, time.Now().Format(time.RFC1123Z),
+		strings.ReplaceAll(m.Text, "\n", "\r\n")))
+	if s.cfg.Port != 465 {
+		// SendMail uses STARTTLS, if the server supports it
+		return smtp.SendMail(addr, auth, s.cfg.From, s.cfg.To, msg)
+	}
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: s.cfg.Host})
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = c.Close()
+	}()
+	if auth != nil {
+		if err = c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(s.cfg.From); err != nil {
+		return err
+	}
+	for _, to := range s.cfg.To {
+		if err = c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
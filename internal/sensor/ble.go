@@ -0,0 +1,201 @@
+package sensor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	defaultMinRssi = -90 // dBm, weaker advertisements are logged as weak signal
+	// HCI packets and commands, see the Bluetooth Core Specification Vol 4, Part E
+	hciFilter        = 2 // socket option
+	hciCommandPkt    = 0x01
+	hciEventPkt      = 0x04
+	evtLEMeta        = 0x3e
+	evtLEAdvReport   = 0x02
+	cmdLESetScanPar  = 0x200b
+	cmdLESetScanEnab = 0x200c
+	bleRetryInterval = 30 * time.Second
+)
+
+// bleSensor passively listens for the advertisements of a BLE hygrometer (Xiaomi LYWSD03MMC
+// with ATC/pvvx firmware, BTHome devices and Govee H5072/H5074/H5075), nothing is sent to it
+type bleSensor struct {
+	name        string
+	address     string
+	maxAge      time.Duration
+	minRssi     int
+	mu          sync.Mutex
+	temperature float32
+	humidity    float32
+	rssi        int
+	seen        time.Time
+	weak        bool
+}
+
+func newBleSensor(cfg Config) (*bleSensor, error) {
+	address := strings.ToUpper(strings.TrimSpace(cfg.Address))
+	if len(address) != 17 || strings.Count(address, ":") != 5 {
+		return nil, fmt.Errorf("%s: invalid BLE address '%s', e.g. A4:C1:38:12:34:56", cfg.Name, cfg.Address)
+	}
+	maxAge := cfg.MaxAge
+	if maxAge <= 0 {
+		maxAge = defaultMaxAge
+	}
+	minRssi := cfg.MinRssi
+	if minRssi == 0 {
+		minRssi = defaultMinRssi
+	}
+	s := &bleSensor{name: cfg.Name, address: address, maxAge: time.Duration(maxAge) * time.Second, minRssi: minRssi}
+	bleScannerFor(cfg.Adapter).add(address, s.onAdvertisement)
+	return s, nil
+}
+
+func (s *bleSensor) onAdvertisement(t, h float32, rssi int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.temperature, s.humidity, s.rssi, s.seen = t, h, rssi, time.Now()
+	weak := rssi < s.minRssi
+	if weak && !s.weak {
+		lg.Warnf("%s: weak signal (%d dBm)", s.name, rssi)
+	}
+	s.weak = weak
+}
+
+func (s *bleSensor) Name() string {
+	return s.name
+}
+
+// Read returns the values of the last advertisement, as long as it's not too old
+func (s *bleSensor) Read() (float32, float32, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seen.IsZero() {
+		return 0, 0, 0, errNoReading
+	}
+	if age := time.Since(s.seen); age > s.maxAge {
+		return 0, 0, 0, fmt.Errorf("last seen %s ago with %d dBm", age.Round(time.Second), s.rssi)
+	}
+	return s.temperature, s.humidity, 0, nil
+}
+
+// bleScanner scans with one adapter and passes the advertisements to the sensors
+type bleScanner struct {
+	adapter  int
+	mu       sync.Mutex
+	handlers map[string]func(t, h float32, rssi int)
+}
+
+var (
+	bleMu       sync.Mutex
+	bleScanners = map[int]*bleScanner{}
+)
+
+// returns the scanner of the adapter (hci0, hci1...), it's started with the first sensor
+func bleScannerFor(adapter int) *bleScanner {
+	bleMu.Lock()
+	defer bleMu.Unlock()
+	sc, ok := bleScanners[adapter]
+	if !ok {
+		sc = &bleScanner{adapter: adapter, handlers: map[string]func(t, h float32, rssi int){}}
+		bleScanners[adapter] = sc
+		go sc.run()
+	}
+	return sc
+}
+
+func (sc *bleScanner) add(address string, handler func(t, h float32, rssi int)) {
+	sc.mu.Lock()
+	sc.handlers[address] = handler
+	sc.mu.Unlock()
+}
+
+// scans until an error occurs and starts again after bleRetryInterval (e.g. adapter is down)
+func (sc *bleScanner) run() {
+	for {
+		if err := sc.scan(); err != nil {
+			lg.Errorf("BLE hci%d: %s", sc.adapter, err)
+		}
+		time.Sleep(bleRetryInterval)
+	}
+}
+
+// opens a raw HCI socket (needs CAP_NET_RAW and CAP_NET_ADMIN), enables a passive scan and
+// reads the advertising reports
+func (sc *bleScanner) scan() error {
+	fd, err := unix.Socket(unix.AF_BLUETOOTH, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.BTPROTO_HCI)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = unix.Close(fd)
+	}()
+	if err = unix.Bind(fd, &unix.SockaddrHCI{Dev: uint16(sc.adapter), Channel: unix.HCI_CHANNEL_RAW}); err != nil {
+		return err
+	}
+	// only LE meta events: type mask, event mask (2x32 bit), opcode
+	filter := make([]byte, 14)
+	binary.LittleEndian.PutUint32(filter[0:], 1<<hciEventPkt)
+	binary.LittleEndian.PutUint32(filter[8:], 1<<(evtLEMeta-32))
+	if err = unix.SetsockoptString(fd, unix.SOL_HCI, hciFilter, string(filter)); err != nil {
+		return err
+	}
+	// passive scan, interval and window 10 ms, public address, accept all advertisements
+	_ = hciCommand(fd, cmdLESetScanEnab, []byte{0x00, 0x00})
+	if err = hciCommand(fd, cmdLESetScanPar, []byte{0x00, 0x10, 0x00, 0x10, 0x00, 0x00, 0x00}); err != nil {
+		return err
+	}
+	if err = hciCommand(fd, cmdLESetScanEnab, []byte{0x01, 0x00}); err != nil {
+		return err
+	}
+	lg.Infof("BLE hci%d: scanning", sc.adapter)
+	buf := make([]byte, 260)
+	for {
+		n, err := unix.Read(fd, buf)
+		if err != nil {
+			return err
+		}
+		sc.onEvent(buf[:n])
+	}
+}
+
+func hciCommand(fd int, opcode uint16, params []byte) error {
+	pkt := []byte{hciCommandPkt, byte(opcode), byte(opcode >> 8), byte(len(params))}
+	_, err := unix.Write(fd, append(pkt, params...))
+	return err
+}
+
+// parses an LE advertising report event, each report is event type, address type,
+// address (reversed), data length, data and RSSI
+func (sc *bleScanner) onEvent(pkt []byte) {
+	if len(pkt) < 5 || pkt[0] != hciEventPkt || pkt[1] != evtLEMeta || pkt[3] != evtLEAdvReport {
+		return
+	}
+	reports := int(pkt[4])
+	p := pkt[5:]
+	for i := 0; i < reports && len(p) >= 10; i++ {
+		addr := fmt.Sprintf("%02X:%02X:%02X:%02X:%02X:%02X", p[7], p[6], p[5], p[4], p[3], p[2])
+		dataLen := int(p[8])
+		if len(p) < 10+dataLen {
+			return
+		}
+		data := p[9 : 9+dataLen]
+		rssi := int(int8(p[9+dataLen]))
+		p = p[10+dataLen:]
+
+		sc.mu.Lock()
+		handler, ok := sc.handlers[addr]
+		sc.mu.Unlock()
+		if !ok {
+			continue
+		}
+		if t, h, ok := decodeAdvertisement(data); ok {
+			handler(t, h, rssi)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package sensor
+
+import "encoding/binary"
+
+const (
+	adServiceData16 = 0x16
+	adManufacturer  = 0xff
+	uuidEnvSensing  = 0x181a // ATC1441 and pvvx firmware of the Xiaomi LYWSD03MMC
+	uuidBTHome      = 0xfcd2
+	companyGovee    = 0xec88
+)
+
+// decodeAdvertisement returns temperature and humidity of the advertising data of a supported
+// hygrometer. The data is a sequence of length, type and value.
+func decodeAdvertisement(data []byte) (float32, float32, bool) {
+	for len(data) > 1 {
+		n := int(data[0])
+		if n == 0 || len(data) < n+1 {
+			return 0, 0, false
+		}
+		typ, value := data[1], data[2:n+1]
+		data = data[n+1:]
+		var t, h float32
+		ok := false
+		switch {
+		case typ == adServiceData16 && len(value) >= 2:
+			switch binary.LittleEndian.Uint16(value) {
+			case uuidEnvSensing:
+				t, h, ok = decodeXiaomi(value[2:])
+			case uuidBTHome:
+				t, h, ok = decodeBTHome(value[2:])
+			}
+		case typ == adManufacturer && len(value) >= 2 && binary.LittleEndian.Uint16(value) == companyGovee:
+			t, h, ok = decodeGovee(value[2:])
+		}
+		if ok {
+			return t, h, true
+		}
+	}
+	return 0, 0, false
+}
+
+// the ATC1441 format has 13 bytes in big endian, the pvvx format 15 bytes in little endian
+func decodeXiaomi(v []byte) (float32, float32, bool) {
+	switch len(v) {
+	case 13:
+		return float32(int16(binary.BigEndian.Uint16(v[6:]))) / 10, float32(v[8]), true
+	case 15:
+		return float32(int16(binary.LittleEndian.Uint16(v[6:]))) / 100,
+			float32(binary.LittleEndian.Uint16(v[8:])) / 100, true
+	}
+	return 0, 0, false
+}
+
+// sizes of the BTHome v2 objects, an unknown object ends the parsing
+var btHomeSizes = map[byte]int{0x00: 1, 0x01: 1, 0x02: 2, 0x03: 2, 0x0c: 2, 0x2e: 1, 0x45: 2}
+
+// BTHome v2: device information, then object id and value, encrypted data is not supported
+func decodeBTHome(v []byte) (float32, float32, bool) {
+	if len(v) < 1 || v[0]&0x01 != 0 || v[0]>>5 != 2 {
+		return 0, 0, false
+	}
+	var t, h float32
+	hasT, hasH := false, false
+	for v = v[1:]; len(v) > 0; {
+		size, known := btHomeSizes[v[0]]
+		if !known || len(v) < size+1 {
+			break
+		}
+		val := v[1 : size+1]
+		switch v[0] {
+		case 0x02:
+			t, hasT = float32(int16(binary.LittleEndian.Uint16(val)))/100, true
+		case 0x45:
+			t, hasT = float32(int16(binary.LittleEndian.Uint16(val)))/10, true
+		case 0x03:
+			h, hasH = float32(binary.LittleEndian.Uint16(val))/100, true
+		case 0x2e:
+			h, hasH = float32(val[0]), true
+		}
+		v = v[size+1:]
+	}
+	return t, h, hasT && hasH
+}
+
+// Govee H5072/H5075 send temperature and humidity as one 24 bit number, H5074 as two
+// little endian numbers
+func decodeGovee(v []byte) (float32, float32, bool) {
+	switch len(v) {
+	case 6:
+		raw := int(v[1])<<16 | int(v[2])<<8 | int(v[3])
+		sign := float32(1)
+		if raw&0x800000 != 0 {
+			raw &^= 0x800000
+			sign = -1
+		}
+		return sign * float32(raw/1000) / 10, float32(raw%1000) / 10, true
+	case 7:
+		return float32(int16(binary.LittleEndian.Uint16(v[1:]))) / 100,
+			float32(binary.LittleEndian.Uint16(v[3:])) / 100, true
+	}
+	return 0, 0, false
+}
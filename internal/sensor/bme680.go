@@ -0,0 +1,261 @@
+package sensor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/d2r2/go-i2c"
+)
+
+const (
+	bme680ChipId      = 0x61
+	bme680RegChipId   = 0xD0
+	bme680RegReset    = 0xE0
+	bme680RegStatus   = 0x1D
+	bme680RegTemp     = 0x22
+	bme680RegCtrlGas0 = 0x70
+	bme680RegCtrlGas1 = 0x71
+	bme680RegCtrlHum  = 0x72
+	bme680RegCtrlMeas = 0x74
+	bme680RegResHeat0 = 0x5A
+	bme680RegGasWait0 = 0x64
+	bme680HeaterTemp  = 400  // °C, the maximum of the hot plate
+	bme680HeaterTime  = 2000 // ms, heating per measurement, a read mustn't block the I2C bus longer than TURN_TIMEOUT
+)
+
+var (
+	errBme680ChipId  = errors.New("bme680: unknown chip id")
+	errBme680Timeout = errors.New("bme680: measurement not ready")
+)
+
+// calibration values of the temperature and humidity, the pressure isn't used
+type bme680Calib struct {
+	t1             uint16
+	t2             int16
+	t3             int8
+	h1, h2         uint16
+	h3, h4, h5, h7 int8
+	h6             uint8
+	gh1, gh3       int8
+	gh2            int16
+	resHeatRange   uint8
+	resHeatVal     int8
+}
+
+type bme680 struct {
+	mu          sync.Mutex
+	name        string
+	key         string // bus and address for the read scheduler
+	bus         *i2c.I2C
+	retries     int
+	minInterval time.Duration
+	calib       bme680Calib
+	prepared    bool    // chip checked and calibration values read
+	heaterOn    bool    // the gas heater is used for a purge
+	lastTemp    float32 // ambient temperature for the heater setting
+}
+
+func newBME680(cfg Config) (*bme680, error) {
+	addr := cfg.I2CAddress
+	if addr == 0 {
+		addr = 0x77
+	}
+	busNum := cfg.I2CBus
+	if busNum == 0 {
+		busNum = 1
+	}
+	bus, err := i2c.NewI2C(addr, busNum)
+	if err != nil {
+		return nil, err
+	}
+	return &bme680{name: cfg.Name, key: fmt.Sprintf("i2c%d-%#x", busNum, addr), bus: bus, retries: cfg.Retries,
+		minInterval: cfg.ReadInterval(), lastTemp: 20}, nil
+}
+
+func (s *bme680) Name() string {
+	return s.name
+}
+
+func (s *bme680) Read() (temperature float32, humidity float32, retried int, err error) {
+	for retried = 0; ; retried++ {
+		var end func()
+		// a timed out read keeps running in the background, a hanging bus blocks the others at most for TURN_TIMEOUT
+		if end, err = schedule.begin(context.Background(), s.key, s.minInterval); err != nil {
+			return
+		}
+		temperature, humidity, err = s.measure()
+		end()
+		if err == nil || retried >= s.retries {
+			return
+		}
+	}
+}
+
+// prepare checks the chip and reads its calibration values, it's repeated after a failure
+func (s *bme680) prepare() error {
+	id, err := s.bus.ReadRegU8(bme680RegChipId)
+	if err != nil {
+		return err
+	}
+	if id != bme680ChipId {
+		return errBme680ChipId
+	}
+	if err = s.bus.WriteRegU8(bme680RegReset, 0xB6); err != nil {
+		return err
+	}
+	time.Sleep(10 * time.Millisecond)
+	c1, _, err := s.bus.ReadRegBytes(0x89, 25)
+	if err != nil {
+		return err
+	}
+	c2, _, err := s.bus.ReadRegBytes(0xE1, 16)
+	if err != nil {
+		return err
+	}
+	c := append(c1, c2...)
+	r, _, err := s.bus.ReadRegBytes(0x00, 3)
+	if err != nil {
+		return err
+	}
+	k := &s.calib
+	k.t1 = uint16(c[34])<<8 | uint16(c[33])
+	k.t2 = int16(uint16(c[2])<<8 | uint16(c[1]))
+	k.t3 = int8(c[3])
+	k.h1 = uint16(c[27])<<4 | uint16(c[26]&0x0F)
+	k.h2 = uint16(c[25])<<4 | uint16(c[26]>>4)
+	k.h3 = int8(c[28])
+	k.h4 = int8(c[29])
+	k.h5 = int8(c[30])
+	k.h6 = c[31]
+	k.h7 = int8(c[32])
+	k.gh1 = int8(c[37])
+	k.gh2 = int16(uint16(c[36])<<8 | uint16(c[35]))
+	k.gh3 = int8(c[38])
+	k.resHeatVal = int8(r[0])
+	k.resHeatRange = (r[2] & 0x30) >> 4
+	s.prepared = true
+	return nil
+}
+
+func (s *bme680) measure() (float32, float32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.prepared {
+		if err := s.prepare(); err != nil {
+			return 0, 0, err
+		}
+	}
+	t, h, err := s.forced()
+	if err != nil {
+		// the chip may have been reset, check it again with the next read
+		s.prepared = false
+		return 0, 0, err
+	}
+	s.lastTemp = t
+	return t, h, nil
+}
+
+// forced runs one measurement in forced mode
+func (s *bme680) forced() (float32, float32, error) {
+	wait := 200 * time.Millisecond
+	// the gas heater is only used for the purge, the gas resistance isn't evaluated
+	if s.heaterOn {
+		if err := s.writeRegs(bme680RegResHeat0, s.calib.resHeat(bme680HeaterTemp, float64(s.lastTemp)),
+			bme680RegGasWait0, bme680GasWait(bme680HeaterTime), bme680RegCtrlGas0, 0x00,
+			bme680RegCtrlGas1, 0x10); err != nil {
+			return 0, 0, err
+		}
+		wait += bme680HeaterTime * time.Millisecond
+	} else if err := s.writeRegs(bme680RegCtrlGas0, 0x08, bme680RegCtrlGas1, 0x00); err != nil {
+		return 0, 0, err
+	}
+	// humidity and temperature oversampling x2, no pressure, forced mode
+	if err := s.writeRegs(bme680RegCtrlHum, 0x02, bme680RegCtrlMeas, 0x41); err != nil {
+		return 0, 0, err
+	}
+	ready := false
+	for end := time.Now().Add(wait); !ready && time.Now().Before(end); {
+		time.Sleep(20 * time.Millisecond)
+		st, err := s.bus.ReadRegU8(bme680RegStatus)
+		if err != nil {
+			return 0, 0, err
+		}
+		ready = st&0x80 != 0
+	}
+	if !ready {
+		return 0, 0, errBme680Timeout
+	}
+	buf, _, err := s.bus.ReadRegBytes(bme680RegTemp, 5)
+	if err != nil {
+		return 0, 0, err
+	}
+	rawT := float64(uint32(buf[0])<<12 | uint32(buf[1])<<4 | uint32(buf[2])>>4)
+	rawH := float64(uint16(buf[3])<<8 | uint16(buf[4]))
+	t, h := s.calib.compensate(rawT, rawH)
+	return float32(t), float32(h), nil
+}
+
+func (s *bme680) writeRegs(pairs ...byte) error {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if err := s.bus.WriteRegU8(pairs[i], pairs[i+1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetHeater heats the gas hot plate during each measurement, the BME680 has no heater for the humidity
+func (s *bme680) SetHeater(on bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.heaterOn = on
+	if on || !s.prepared {
+		return nil
+	}
+	return s.writeRegs(bme680RegCtrlGas0, 0x08, bme680RegCtrlGas1, 0x00)
+}
+
+// compensate returns temperature (°C) and humidity (%) with the floating point formulas of the datasheet
+func (k *bme680Calib) compensate(rawT, rawH float64) (float64, float64) {
+	v1 := (rawT/16384 - float64(k.t1)/1024) * float64(k.t2)
+	v2 := (rawT/131072 - float64(k.t1)/8192) * (rawT/131072 - float64(k.t1)/8192) * float64(k.t3) * 16
+	t := (v1 + v2) / 5120
+
+	v1 = rawH - (float64(k.h1)*16 + float64(k.h3)/2*t)
+	v2 = v1 * (float64(k.h2) / 262144 * (1 + float64(k.h4)/16384*t + float64(k.h5)/1048576*t*t))
+	v3 := float64(k.h6) / 16384
+	v4 := float64(k.h7) / 2097152
+	h := v2 + (v3+v4*t)*v2*v2
+	if h > 100 {
+		h = 100
+	} else if h < 0 {
+		h = 0
+	}
+	return t, h
+}
+
+// resHeat returns the register value for the given hot plate temperature
+func (k *bme680Calib) resHeat(temp, ambient float64) byte {
+	v1 := float64(k.gh1)/16 + 49
+	v2 := float64(k.gh2)/32768*0.0005 + 0.00235
+	v3 := float64(k.gh3) / 1024
+	v4 := v1 * (1 + v2*temp)
+	v5 := v4 + v3*ambient
+	return byte(3.4 * (v5*(4/(4+float64(k.resHeatRange)))*(1/(1+float64(k.resHeatVal)*0.002)) - 25))
+}
+
+// bme680GasWait encodes the heating time in ms with a factor of 1, 4, 16 or 64
+func bme680GasWait(ms int) byte {
+	if ms >= 0xFC0 {
+		return 0xFF
+	}
+	factor := byte(0)
+	for ms > 0x3F {
+		ms /= 4
+		factor++
+	}
+	return byte(ms) + factor*64
+}
@@ -0,0 +1,95 @@
+package sensor
+
+import (
+	"fmt"
+	"sort"
+)
+
+// default rate limits of the spike filter, about the former limit of 1°C dew point per cycle of 15 s
+const (
+	DEF_MAX_TEMP_RATE = 4  // °C/min
+	DEF_MAX_HUM_RATE  = 20 // %/min
+)
+
+// CurvePoint is a reference point of a correction curve: at the raw temperature Temp the
+// correction Offset is added. Between the points the offset is interpolated linearly, below
+// the first and above the last point the offset of that point is used.
+type CurvePoint struct {
+	Temp   float32 `json:"temp"`   // raw temperature of the sensor in °C
+	Offset float32 `json:"offset"` // correction at this temperature
+}
+
+// Correct returns the corrected temperature and humidity
+func (cfg Config) Correct(t, h float32) (float32, float32) {
+	tOffset, hOffset := cfg.Offsets(t)
+	return t + tOffset, h + hOffset
+}
+
+// Offsets returns the corrections of the temperature and the humidity at the raw temperature t.
+// A curve replaces the constant offset, both curves depend on the raw temperature.
+func (cfg Config) Offsets(t float32) (float32, float32) {
+	tOffset, hOffset := cfg.TempOffset, cfg.HumOffset
+	if len(cfg.TempCurve) > 0 {
+		tOffset = interpolate(cfg.TempCurve, t)
+	}
+	if len(cfg.HumCurve) > 0 {
+		hOffset = interpolate(cfg.HumCurve, t)
+	}
+	return tOffset, hOffset
+}
+
+func interpolate(curve []CurvePoint, t float32) float32 {
+	if t <= curve[0].Temp {
+		return curve[0].Offset
+	}
+	for i := 1; i < len(curve); i++ {
+		p0, p1 := curve[i-1], curve[i]
+		if t <= p1.Temp {
+			return p0.Offset + (p1.Offset-p0.Offset)*(t-p0.Temp)/(p1.Temp-p0.Temp)
+		}
+	}
+	return curve[len(curve)-1].Offset
+}
+
+// RateLimits returns the maximum rate of change of the temperature (°C/min) and the humidity (%/min)
+func (cfg Config) RateLimits() (float32, float32) {
+	tempRate, humRate := cfg.MaxTempRate, cfg.MaxHumRate
+	if tempRate <= 0 {
+		tempRate = DEF_MAX_TEMP_RATE
+	}
+	if humRate <= 0 {
+		humRate = DEF_MAX_HUM_RATE
+	}
+	return tempRate, humRate
+}
+
+// ValidateCurves returns an error if the points of a curve are not in ascending order of the temperature
+func (cfg Config) ValidateCurves() error {
+	check := func(name string, curve []CurvePoint) error {
+		for i := 1; i < len(curve); i++ {
+			if curve[i].Temp <= curve[i-1].Temp {
+				return fmt.Errorf("%s: the temperatures must be ascending", name)
+			}
+		}
+		return nil
+	}
+	if err := check("temp_curve", cfg.TempCurve); err != nil {
+		return err
+	}
+	return check("hum_curve", cfg.HumCurve)
+}
+
+// SetCurvePoint adds the point to the curve or replaces the point with the same temperature
+func SetCurvePoint(curve []CurvePoint, p CurvePoint) []CurvePoint {
+	for i := range curve {
+		if curve[i].Temp == p.Temp {
+			curve[i] = p
+			return curve
+		}
+	}
+	curve = append(curve, p)
+	sort.Slice(curve, func(i, j int) bool {
+		return curve[i].Temp < curve[j].Temp
+	})
+	return curve
+}
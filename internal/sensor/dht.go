@@ -0,0 +1,58 @@
+package sensor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aluedtke7/go-dht"
+)
+
+type dht22 struct {
+	name        string
+	pin         int
+	retries     int
+	minInterval time.Duration
+}
+
+func newDHT22(cfg Config) *dht22 {
+	return &dht22{name: cfg.Name, pin: cfg.Pin, retries: cfg.Retries, minInterval: cfg.ReadInterval()}
+}
+
+func (d *dht22) Name() string {
+	return d.name
+}
+
+func (d *dht22) Read() (float32, float32, int, error) {
+	return d.ReadContext(context.Background())
+}
+
+// the retries are scheduled like every other read, so they keep the minimum interval
+// of the DHT22 and don't heat up the sensor. A single read takes only some ms, the
+// retries stop when the context is done. The driver can't be interrupted, so every
+// read runs in the background and a hanging read is abandoned (see ReadContext).
+func (d *dht22) ReadContext(ctx context.Context) (temperature float32, humidity float32, retried int, err error) {
+	key := fmt.Sprintf("gpio%d", d.pin)
+	for retried = 0; ; retried++ {
+		if err = ctx.Err(); err != nil {
+			return 0, 0, retried, err
+		}
+		end, err := schedule.begin(ctx, key, d.minInterval)
+		if err != nil {
+			return 0, 0, retried, err
+		}
+		temperature, humidity, _, err = abandonable(ctx, d, func() (float32, float32, int, error) {
+			t, h, err := dht.ReadDHTxx(dht.DHT22, d.pin, false)
+			return t, h, 0, err
+		})
+		end()
+		// no retries while the abandoned read is running
+		if err == ErrBusy || err == ErrHung || ctx.Err() != nil {
+			return 0, 0, retried, err
+		}
+		if err == nil || retried >= d.retries {
+			return temperature, humidity, retried, err
+		}
+		lg.Debugf("%s: %s", d.name, err)
+	}
+}
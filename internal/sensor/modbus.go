@@ -0,0 +1,105 @@
+package sensor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aluedtke7/dew_point_fan/internal/modbus"
+)
+
+const (
+	REGISTER_INPUT   = "input"
+	REGISTER_HOLDING = "holding"
+	// defaults of the common transmitters (XY-MD02, SHT20 RS485), values in 1/10 °C and %
+	defTempRegister = 1
+	defHumRegister  = 2
+	defScale        = 0.1
+	modbusRetryWait = 500 * time.Millisecond
+)
+
+// modbusSensor reads an industrial RH/T transmitter via Modbus RTU
+type modbusSensor struct {
+	name    string
+	port    *modbus.Port
+	unit    byte
+	input   bool
+	tempReg uint16
+	humReg  uint16
+	scale   float32
+	retries int
+}
+
+func newModbusSensor(cfg Config) (*modbusSensor, error) {
+	if cfg.Device == "" {
+		return nil, fmt.Errorf("%s: no serial device configured", cfg.Name)
+	}
+	s := &modbusSensor{
+		name:    cfg.Name,
+		unit:    byte(cfg.Unit),
+		tempReg: cfg.TempRegister,
+		humReg:  cfg.HumRegister,
+		scale:   cfg.Scale,
+		retries: cfg.Retries,
+	}
+	if s.unit == 0 {
+		s.unit = 1
+	}
+	if s.tempReg == 0 && s.humReg == 0 {
+		s.tempReg, s.humReg = defTempRegister, defHumRegister
+	}
+	if s.scale == 0 {
+		s.scale = defScale
+	}
+	switch strings.ToLower(cfg.RegisterType) {
+	case "", REGISTER_INPUT:
+		s.input = true
+	case REGISTER_HOLDING:
+	default:
+		return nil, fmt.Errorf("%s: unknown register type '%s'", cfg.Name, cfg.RegisterType)
+	}
+	var err error
+	if s.port, err = modbus.OpenRTU(cfg.Device, cfg.Baud, cfg.Parity); err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.Name, err)
+	}
+	return s, nil
+}
+
+func (s *modbusSensor) Name() string {
+	return s.name
+}
+
+func (s *modbusSensor) Read() (temperature float32, humidity float32, retried int, err error) {
+	for retried = 0; ; retried++ {
+		temperature, humidity, err = s.measure()
+		if err == nil || retried >= s.retries {
+			return
+		}
+		lg.Debugf("%s: %s", s.name, err)
+		time.Sleep(modbusRetryWait)
+	}
+}
+
+// reads both registers with one request, if they are adjacent
+func (s *modbusSensor) measure() (float32, float32, error) {
+	var t, h uint16
+	if s.humReg == s.tempReg+1 {
+		regs, err := s.port.ReadRegisters(s.unit, s.input, s.tempReg, 2)
+		if err != nil {
+			return 0, 0, err
+		}
+		t, h = regs[0], regs[1]
+	} else {
+		regs, err := s.port.ReadRegisters(s.unit, s.input, s.tempReg, 1)
+		if err != nil {
+			return 0, 0, err
+		}
+		t = regs[0]
+		if regs, err = s.port.ReadRegisters(s.unit, s.input, s.humReg, 1); err != nil {
+			return 0, 0, err
+		}
+		h = regs[0]
+	}
+	// the temperature is signed
+	return float32(int16(t)) * s.scale, float32(h) * s.scale, nil
+}
@@ -0,0 +1,178 @@
+package sensor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const defaultMaxAge = 300 // s
+
+var errNoReading = errors.New("no current reading received")
+
+// mqttSensor receives the readings of Tasmota or ESPHome nodes via MQTT
+type mqttSensor struct {
+	name        string
+	maxAge      time.Duration
+	client      mqtt.Client
+	mu          sync.Mutex
+	temperature float32
+	humidity    float32
+	tempTime    time.Time
+	humTime     time.Time
+	meta        Meta
+}
+
+func newMqttSensor(cfg Config) (*mqttSensor, error) {
+	if cfg.Broker == "" {
+		return nil, fmt.Errorf("%s: no MQTT broker configured", cfg.Name)
+	}
+	maxAge := cfg.MaxAge
+	if maxAge <= 0 {
+		maxAge = defaultMaxAge
+	}
+	s := &mqttSensor{name: cfg.Name, maxAge: time.Duration(maxAge) * time.Second}
+	subscriptions := map[string]mqtt.MessageHandler{}
+	switch strings.ToLower(cfg.Type) {
+	case TypeTasmota:
+		// tele/<device>/SENSOR: {"Time":"...","AM2301":{"Temperature":12.3,"Humidity":45.6},"TempUnit":"C"}
+		subscriptions[cfg.Topic] = s.onTasmota
+	case TypeESPHome:
+		// <node>/sensor/<name>/state with the plain value as payload
+		subscriptions[cfg.TemperatureTopic] = s.onValue(true)
+		subscriptions[cfg.HumidityTopic] = s.onValue(false)
+	case TypeZigbee2MQTT:
+		// zigbee2mqtt/<friendly name>: {"battery":97,"humidity":54.2,"linkquality":87,"temperature":21.3}
+		subscriptions[cfg.Topic] = s.onZigbee
+	}
+	s.client = connectMqtt(cfg, subscriptions)
+	return s, nil
+}
+
+// connects to the broker of the sensor, the topics are subscribed again after every reconnect
+func connectMqtt(cfg Config, subscriptions map[string]mqtt.MessageHandler) mqtt.Client {
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(fmt.Sprintf("dew-point-fan-%s-%d", strings.ToLower(cfg.Name), time.Now().Unix())).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(30 * time.Second).
+		SetOnConnectHandler(func(c mqtt.Client) {
+			lg.Infof("%s: MQTT connected to %s", cfg.Name, cfg.Broker)
+			for topic, handler := range subscriptions {
+				c.Subscribe(topic, 0, handler)
+			}
+		})
+	client := mqtt.NewClient(opts)
+	client.Connect()
+	return client
+}
+
+func (s *mqttSensor) onTasmota(_ mqtt.Client, msg mqtt.Message) {
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(msg.Payload(), &payload); err != nil {
+		lg.Warnf("%s: invalid Tasmota payload: %s", s.name, err)
+		return
+	}
+	fahrenheit := false
+	if unit, ok := payload["TempUnit"]; ok {
+		fahrenheit = strings.Contains(string(unit), "F")
+	}
+	// the key of the sensor object depends on the sensor type (AM2301, SI7021, BME280, SHT3X...)
+	for _, raw := range payload {
+		var values struct {
+			Temperature *float32
+			Humidity    *float32
+		}
+		if json.Unmarshal(raw, &values) != nil || values.Temperature == nil || values.Humidity == nil {
+			continue
+		}
+		t := *values.Temperature
+		if fahrenheit {
+			t = (t - 32) * 5 / 9
+		}
+		now := time.Now()
+		s.mu.Lock()
+		s.temperature, s.humidity = t, *values.Humidity
+		s.tempTime, s.humTime = now, now
+		s.mu.Unlock()
+		return
+	}
+}
+
+func (s *mqttSensor) onZigbee(_ mqtt.Client, msg mqtt.Message) {
+	var payload struct {
+		Temperature *float32
+		Humidity    *float32
+		Battery     *int
+		LinkQuality *int `json:"linkquality"`
+	}
+	if err := json.Unmarshal(msg.Payload(), &payload); err != nil {
+		lg.Warnf("%s: invalid Zigbee2MQTT payload: %s", s.name, err)
+		return
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// the payload may contain only some of the values, e.g. after a button press
+	if payload.Temperature != nil {
+		s.temperature, s.tempTime = *payload.Temperature, now
+	}
+	if payload.Humidity != nil {
+		s.humidity, s.humTime = *payload.Humidity, now
+	}
+	if payload.Battery != nil {
+		if *payload.Battery <= LOW_BATTERY && (s.meta.Battery == nil || *s.meta.Battery > LOW_BATTERY) {
+			lg.Warnf("%s: battery is low (%d%%)", s.name, *payload.Battery)
+		}
+		s.meta.Battery = payload.Battery
+	}
+	if payload.LinkQuality != nil {
+		s.meta.LinkQuality = payload.LinkQuality
+	}
+}
+
+func (s *mqttSensor) onValue(temperature bool) mqtt.MessageHandler {
+	return func(_ mqtt.Client, msg mqtt.Message) {
+		v, err := strconv.ParseFloat(strings.TrimSpace(string(msg.Payload())), 32)
+		if err != nil {
+			lg.Warnf("%s: invalid ESPHome payload on %s", s.name, msg.Topic())
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if temperature {
+			s.temperature, s.tempTime = float32(v), time.Now()
+		} else {
+			s.humidity, s.humTime = float32(v), time.Now()
+		}
+	}
+}
+
+func (s *mqttSensor) Name() string {
+	return s.name
+}
+
+func (s *mqttSensor) Meta() Meta {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.meta
+}
+
+// Read returns the last received values, as long as they are not too old
+func (s *mqttSensor) Read() (float32, float32, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.tempTime) > s.maxAge || time.Since(s.humTime) > s.maxAge {
+		return 0, 0, 0, errNoReading
+	}
+	return s.temperature, s.humidity, 0, nil
+}
@@ -0,0 +1,146 @@
+package sensor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	PEER_INSIDE  = "inside"
+	PEER_OUTSIDE = "outside"
+	peerTimeout  = 5 * time.Second
+)
+
+// PeerData is the measurement a dew point fan shares with other devices, via
+// GET /api/v1/peer or the MQTT topic <topic>/peer
+type PeerData struct {
+	Time    string                 `json:"time"`    // time of the measurement (RFC3339)
+	Age     float64                `json:"age"`     // age of the measurement in s, when it was sent
+	Sensors map[string]PeerReading `json:"sensors"` // "inside" and "outside"
+}
+
+// PeerReading is the corrected reading of one sensor, it's not valid if the reading failed
+type PeerReading struct {
+	Name        string  `json:"name"`
+	Temperature float32 `json:"temperature"`
+	Humidity    float32 `json:"humidity"`
+	Valid       bool    `json:"valid"`
+}
+
+// peerSensor uses a sensor of another dew point fan, e.g. one outside sensor for several devices
+type peerSensor struct {
+	name   string
+	url    string
+	peer   string
+	maxAge time.Duration
+	http   *http.Client
+	client mqtt.Client
+	mu     sync.Mutex
+	last   PeerData
+	recv   time.Time // time the last MQTT message was received
+}
+
+func newPeerSensor(cfg Config) (*peerSensor, error) {
+	if cfg.Url == "" && (cfg.Broker == "" || cfg.Topic == "") {
+		return nil, fmt.Errorf("%s: the peer needs either url or broker and topic", cfg.Name)
+	}
+	peer := strings.ToLower(cfg.Peer)
+	if peer == "" {
+		peer = PEER_OUTSIDE
+	}
+	if peer != PEER_INSIDE && peer != PEER_OUTSIDE {
+		return nil, fmt.Errorf("%s: unknown peer sensor '%s'", cfg.Name, cfg.Peer)
+	}
+	maxAge := cfg.MaxAge
+	if maxAge <= 0 {
+		maxAge = defaultMaxAge
+	}
+	s := &peerSensor{
+		name:   cfg.Name,
+		url:    cfg.Url,
+		peer:   peer,
+		maxAge: time.Duration(maxAge) * time.Second,
+		http:   &http.Client{Timeout: peerTimeout},
+	}
+	if s.url == "" {
+		s.client = connectMqtt(cfg, map[string]mqtt.MessageHandler{cfg.Topic: s.onMessage})
+	}
+	return s, nil
+}
+
+func (s *peerSensor) onMessage(_ mqtt.Client, msg mqtt.Message) {
+	var data PeerData
+	if err := json.Unmarshal(msg.Payload(), &data); err != nil {
+		lg.Warnf("%s: invalid peer payload: %s", s.name, err)
+		return
+	}
+	s.mu.Lock()
+	s.last, s.recv = data, time.Now()
+	s.mu.Unlock()
+}
+
+func (s *peerSensor) Name() string {
+	return s.name
+}
+
+// fetches the current measurement of the peer
+func (s *peerSensor) fetch(ctx context.Context) (PeerData, error) {
+	var data PeerData
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return data, err
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return data, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return data, fmt.Errorf("%s: peer returned %s", s.name, resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	return data, err
+}
+
+func (s *peerSensor) Read() (float32, float32, int, error) {
+	return s.ReadContext(context.Background())
+}
+
+// ReadContext returns the reading of the peer's sensor, as long as it's valid and not too old. The age
+// of an HTTP response is reported by the peer, MQTT messages use the time of the measurement
+// (they may be retained), so the clocks of both devices should be synchronized.
+func (s *peerSensor) ReadContext(ctx context.Context) (float32, float32, int, error) {
+	var data PeerData
+	var age time.Duration
+	if s.url != "" {
+		var err error
+		if data, err = s.fetch(ctx); err != nil {
+			return 0, 0, 0, err
+		}
+		age = time.Duration(data.Age * float64(time.Second))
+	} else {
+		s.mu.Lock()
+		data, age = s.last, time.Since(s.recv)
+		s.mu.Unlock()
+		if t, err := time.Parse(time.RFC3339, data.Time); err == nil {
+			age = time.Since(t)
+		}
+	}
+	r, ok := data.Sensors[s.peer]
+	if !ok || age > s.maxAge {
+		return 0, 0, 0, errNoReading
+	}
+	if !r.Valid {
+		return 0, 0, 0, fmt.Errorf("%s: the reading of the peer failed", s.name)
+	}
+	return r.Temperature, r.Humidity, 0, nil
+}
@@ -0,0 +1,121 @@
+package sensor
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PurgeConfig defines the weekly heater purge cycle for sensors with a built-in heater
+type PurgeConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Weekday  string `json:"weekday"`  // e.g. "sunday"
+	Time     string `json:"time"`     // local start time, e.g. "03:00"
+	Duration int    `json:"duration"` // heater on time in s
+	Settle   int    `json:"settle"`   // readings are suppressed for this time in s after the heater is switched off
+}
+
+// Purger runs the scheduled heater purge and tells whether a sensor's readings have to be suppressed
+type Purger struct {
+	cfg     PurgeConfig
+	weekday time.Weekday
+	hour    int
+	minute  int
+	heaters []Sensor
+	mu      sync.Mutex
+	active  bool
+	lastRun time.Time
+}
+
+// NewPurger checks the configuration and returns a purger for all given sensors that implement Heater
+func NewPurger(cfg PurgeConfig, sensors []Sensor) (*Purger, error) {
+	p := &Purger{cfg: cfg}
+	found := false
+	for i := time.Sunday; i <= time.Saturday; i++ {
+		if strings.EqualFold(i.String(), cfg.Weekday) {
+			p.weekday = i
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("invalid purge weekday '%s'", cfg.Weekday)
+	}
+	if _, err := fmt.Sscanf(cfg.Time, "%d:%d", &p.hour, &p.minute); err != nil {
+		return nil, fmt.Errorf("invalid purge time '%s': %w", cfg.Time, err)
+	}
+	for _, s := range sensors {
+		if _, ok := s.(Heater); ok {
+			p.heaters = append(p.heaters, s)
+		}
+	}
+	return p, nil
+}
+
+// Run checks the schedule periodically and should be started as goroutine
+func (p *Purger) Run() {
+	if !p.cfg.Enabled {
+		return
+	}
+	if len(p.heaters) == 0 {
+		lg.Warn("Heater purge is enabled, but no sensor with heater is configured")
+		return
+	}
+	for {
+		now := time.Now()
+		if p.isDue(now) {
+			p.purge()
+		}
+		time.Sleep(30 * time.Second)
+	}
+}
+
+func (p *Purger) isDue(now time.Time) bool {
+	if now.Weekday() != p.weekday || now.Hour() != p.hour || now.Minute() < p.minute {
+		return false
+	}
+	return now.Sub(p.lastRun) > time.Hour
+}
+
+func (p *Purger) purge() {
+	p.mu.Lock()
+	p.active = true
+	p.lastRun = time.Now()
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.active = false
+		p.mu.Unlock()
+	}()
+
+	lg.Infof("Heater purge started for %d sensor(s), duration %ds", len(p.heaters), p.cfg.Duration)
+	for _, s := range p.heaters {
+		if err := s.(Heater).SetHeater(true); err != nil {
+			lg.Errorf("%s: couldn't switch heater on: %s", s.Name(), err)
+		}
+	}
+	time.Sleep(time.Duration(p.cfg.Duration) * time.Second)
+	for _, s := range p.heaters {
+		if err := s.(Heater).SetHeater(false); err != nil {
+			lg.Errorf("%s: couldn't switch heater off: %s", s.Name(), err)
+		}
+	}
+	lg.Infof("Heater purge finished, readings suppressed for another %ds", p.cfg.Settle)
+	time.Sleep(time.Duration(p.cfg.Settle) * time.Second)
+	lg.Info("Heater purge cycle completed")
+}
+
+// Purging returns true while the readings of the given sensor are not usable because of a purge cycle
+func (p *Purger) Purging(s Sensor) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.active {
+		return false
+	}
+	for _, h := range p.heaters {
+		if h == s {
+			return true
+		}
+	}
+	return false
+}
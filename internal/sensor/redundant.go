@@ -0,0 +1,199 @@
+package sensor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+const (
+	VOTE_AVERAGE    = "average"
+	VOTE_HEALTHIEST = "healthiest"
+	// default differences between the sensors of a redundant sensor that are reported as divergence
+	DEF_MAX_TEMP_DIFF = 1.0 // °C
+	DEF_MAX_HUM_DIFF  = 5.0 // %
+	// weight of the newest read in the failure rate of a sensor
+	healthWeight = 0.1
+)
+
+// Diverger is implemented by sensors that consist of several sensors (redundant sensors)
+type Diverger interface {
+	// Diverged returns true, if the readings of the sensors differ more than allowed
+	Diverged() bool
+}
+
+// redundant reads several sensors at the same location and fuses their readings, so one
+// flaky sensor doesn't blind the controller
+type redundant struct {
+	name        string
+	vote        string
+	maxTempDiff float32
+	maxHumDiff  float32
+	sensors     []Sensor
+	cfgs        []Config
+	mu          sync.Mutex
+	failRate    []float64 // moving average of the failed reads of each sensor
+	diverged    bool
+}
+
+type memberReading struct {
+	readResult
+	index int
+}
+
+func newRedundant(cfg Config) (*redundant, error) {
+	if err := cfg.ValidateRedundant(); err != nil {
+		return nil, fmt.Errorf("%s: %s", cfg.Name, err)
+	}
+	r := &redundant{
+		name:        cfg.Name,
+		vote:        strings.ToLower(cfg.Vote),
+		maxTempDiff: cfg.MaxTempDiff,
+		maxHumDiff:  cfg.MaxHumDiff,
+		cfgs:        cfg.Sensors,
+		failRate:    make([]float64, len(cfg.Sensors)),
+	}
+	if r.vote == "" {
+		r.vote = VOTE_AVERAGE
+	}
+	if r.maxTempDiff <= 0 {
+		r.maxTempDiff = DEF_MAX_TEMP_DIFF
+	}
+	if r.maxHumDiff <= 0 {
+		r.maxHumDiff = DEF_MAX_HUM_DIFF
+	}
+	for _, sc := range cfg.Sensors {
+		s, err := New(sc)
+		if err != nil {
+			return nil, err
+		}
+		r.sensors = append(r.sensors, s)
+	}
+	return r, nil
+}
+
+// ValidateRedundant checks the sensors of a redundant sensor, other sensors are always valid
+func (cfg Config) ValidateRedundant() error {
+	if strings.ToLower(cfg.Type) != TypeRedundant {
+		return nil
+	}
+	if len(cfg.Sensors) < 2 {
+		return errors.New("a redundant sensor needs at least two sensors")
+	}
+	switch strings.ToLower(cfg.Vote) {
+	case "", VOTE_AVERAGE, VOTE_HEALTHIEST:
+	default:
+		return fmt.Errorf("unknown vote '%s'", cfg.Vote)
+	}
+	for _, sc := range cfg.Sensors {
+		if strings.ToLower(sc.Type) == TypeRedundant {
+			return errors.New("a redundant sensor can't contain another redundant sensor")
+		}
+		if err := sc.ValidateCurves(); err != nil {
+			return fmt.Errorf("%s: %s", sc.Name, err)
+		}
+	}
+	return nil
+}
+
+func (r *redundant) Name() string {
+	return r.name
+}
+
+func (r *redundant) Read() (float32, float32, int, error) {
+	return r.ReadContext(context.Background())
+}
+
+// ReadContext reads all sensors at the same time (the read scheduler keeps the reads apart)
+// and returns the fused corrected readings. It fails only, if all sensors fail.
+func (r *redundant) ReadContext(ctx context.Context) (float32, float32, int, error) {
+	results := make(chan memberReading, len(r.sensors))
+	for i, s := range r.sensors {
+		go func(i int, s Sensor) {
+			sctx, cancel := context.WithTimeout(ctx, r.cfgs[i].ReadTimeout())
+			defer cancel()
+			t, h, retried, err := ReadContext(sctx, s)
+			results <- memberReading{readResult{t, h, retried, err}, i}
+		}(i, s)
+	}
+	readings := make([]memberReading, len(r.sensors))
+	for range r.sensors {
+		m := <-results
+		readings[m.index] = m
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var good []memberReading
+	var errs []string
+	retried := 0
+	for i, m := range readings {
+		if m.retried > retried {
+			retried = m.retried
+		}
+		failed := 0.0
+		if m.err != nil {
+			failed = 1
+			errs = append(errs, fmt.Sprintf("%s: %s", r.sensors[i].Name(), m.err))
+		} else {
+			m.temperature, m.humidity = r.cfgs[i].Correct(m.temperature, m.humidity)
+			good = append(good, m)
+		}
+		r.failRate[i] = (1-healthWeight)*r.failRate[i] + healthWeight*failed
+	}
+	if len(good) == 0 {
+		return 0, 0, retried, errors.New(strings.Join(errs, ", "))
+	}
+	for _, e := range errs {
+		lg.Warnf("%s: %s, using the other sensors", r.name, e)
+	}
+	r.checkDivergence(good)
+
+	if r.vote == VOTE_HEALTHIEST {
+		best := good[0]
+		for _, m := range good[1:] {
+			if r.failRate[m.index] < r.failRate[best.index] ||
+				r.failRate[m.index] == r.failRate[best.index] && m.retried < best.retried {
+				best = m
+			}
+		}
+		return best.temperature, best.humidity, retried, nil
+	}
+	var sumT, sumH float32
+	for _, m := range good {
+		sumT += m.temperature
+		sumH += m.humidity
+	}
+	return sumT / float32(len(good)), sumH / float32(len(good)), retried, nil
+}
+
+// logs a calibration warning, when the readings start or stop to differ more than allowed
+func (r *redundant) checkDivergence(good []memberReading) {
+	if len(good) < 2 {
+		return
+	}
+	minT, maxT := good[0].temperature, good[0].temperature
+	minH, maxH := good[0].humidity, good[0].humidity
+	for _, m := range good[1:] {
+		minT = float32(math.Min(float64(minT), float64(m.temperature)))
+		maxT = float32(math.Max(float64(maxT), float64(m.temperature)))
+		minH = float32(math.Min(float64(minH), float64(m.humidity)))
+		maxH = float32(math.Max(float64(maxH), float64(m.humidity)))
+	}
+	diverged := maxT-minT > r.maxTempDiff || maxH-minH > r.maxHumDiff
+	if diverged && !r.diverged {
+		lg.Warnf("%s: the sensors differ by %.1f°C and %.1f%%, check their calibration", r.name, maxT-minT, maxH-minH)
+	} else if !diverged && r.diverged {
+		lg.Infof("%s: the sensors agree again", r.name)
+	}
+	r.diverged = diverged
+}
+
+func (r *redundant) Diverged() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.diverged
+}
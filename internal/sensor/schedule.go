@@ -0,0 +1,80 @@
+package sensor
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DHT22_MIN_INTERVAL = 2000 // ms, the DHT22 needs this time between two reads
+	READ_STAGGER       = 500 * time.Millisecond
+	TURN_TIMEOUT       = 5 * time.Second
+)
+
+// readScheduler enforces the minimum time between two reads of a sensor (including the
+// retries) and staggers the reads of different sensors, so two bit-banged or I2C
+// transactions never run at the same time or directly after each other
+type readScheduler struct {
+	turn    chan struct{} // held during a read
+	mu      sync.Mutex
+	last    map[string]time.Time // end of the last read of each sensor
+	lastAny time.Time
+}
+
+var schedule = &readScheduler{turn: make(chan struct{}, 1), last: map[string]time.Time{}}
+
+// waits for the turn of the sensor and returns the function that ends the read. A hanging
+// read of another sensor blocks the turn at most for TURN_TIMEOUT, then the read starts anyway.
+func (s *readScheduler) begin(ctx context.Context, key string, minInterval time.Duration) (func(), error) {
+	held := true
+	turnTimer := time.NewTimer(TURN_TIMEOUT)
+	defer turnTimer.Stop()
+	select {
+	case s.turn <- struct{}{}:
+	case <-turnTimer.C:
+		lg.Warnf("%s: the previous read is still running", key)
+		held = false
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	s.mu.Lock()
+	next := s.last[key].Add(minInterval)
+	if t := s.lastAny.Add(READ_STAGGER); t.After(next) {
+		next = t
+	}
+	s.mu.Unlock()
+	end := func() {
+		now := time.Now()
+		s.mu.Lock()
+		s.last[key] = now
+		s.lastAny = now
+		s.mu.Unlock()
+		if held {
+			<-s.turn
+		}
+	}
+	if wait := time.Until(next); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			if held {
+				<-s.turn
+			}
+			return nil, ctx.Err()
+		}
+	}
+	return end, nil
+}
+
+// ReadInterval returns the minimum time between two reads of the sensor
+func (cfg Config) ReadInterval() time.Duration {
+	if cfg.MinInterval > 0 {
+		return time.Duration(cfg.MinInterval) * time.Millisecond
+	}
+	if t := strings.ToLower(cfg.Type); t == "" || t == TypeDHT22 {
+		return DHT22_MIN_INTERVAL * time.Millisecond
+	}
+	return 0
+}
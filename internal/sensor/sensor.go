@@ -0,0 +1,121 @@
+package sensor
+
+import (
+	"fmt"
+	"strings"
+
+	d2r2log "github.com/d2r2/go-logger"
+)
+
+const (
+	TypeDHT22       = "dht22"
+	TypeSHT3x       = "sht3x"
+	TypeBME680      = "bme680"
+	TypeTasmota     = "tasmota"
+	TypeESPHome     = "esphome"
+	TypePeer        = "peer"
+	TypeRedundant   = "redundant"
+	TypeBLE         = "ble"
+	TypeZigbee2MQTT = "zigbee2mqtt"
+	TypeModbus      = "modbus"
+	LOW_BATTERY     = 10 // %, a lower battery level is logged
+)
+
+var lg = d2r2log.NewPackageLogger("sensor", d2r2log.InfoLevel)
+
+// Interface definition for temperature/humidity sensors
+type Sensor interface {
+	Name() string
+	// Read returns temperature (°C), humidity (%) and the number of retries needed
+	Read() (temperature float32, humidity float32, retried int, err error)
+}
+
+// Heater is implemented by sensors with a built-in heater (e.g. SHT3x, the gas heater of the BME680)
+type Heater interface {
+	SetHeater(on bool) error
+}
+
+// Meta is the additional information of a wireless sensor, missing values are nil
+type Meta struct {
+	Battery     *int `json:"battery,omitempty"`      // battery level in %
+	LinkQuality *int `json:"link_quality,omitempty"` // Zigbee link quality (0...255)
+}
+
+// MetaReporter is implemented by sensors that report their battery level or link quality
+type MetaReporter interface {
+	Meta() Meta
+}
+
+// Config describes one sensor in the configuration file
+type Config struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`        // "dht22", "sht3x", "bme680", "tasmota", "esphome", "zigbee2mqtt", "modbus", "peer", "redundant" or "ble"
+	Pin        int    `json:"pin"`         // GPIO number for DHT22
+	I2CBus     int    `json:"i2c_bus"`     // I2C bus for SHT3x and BME680
+	I2CAddress uint8  `json:"i2c_address"` // I2C address for SHT3x, 68 (0x44) or 69 (0x45), for BME680 119 (0x77) or 118 (0x76)
+	Retries    int    `json:"retries"`     // number of retries in case of read failures
+	Timeout    int    `json:"timeout"`     // maximum time in s for a read including the retries, default 20
+	// minimum time in ms between two reads including the retries, default 2000 for DHT22
+	MinInterval int `json:"min_interval"`
+	// correction values, each sensor is different, find your own values (see "calibrate" command)
+	TempOffset float32 `json:"temp_offset"` // added to the temperature in °C
+	HumOffset  float32 `json:"hum_offset"`  // added to the humidity in %
+	// readings that change faster are rejected as spikes
+	MaxTempRate float32 `json:"max_temp_rate"` // in °C/min, default 4
+	MaxHumRate  float32 `json:"max_hum_rate"`  // in %/min, default 20
+	// correction curves depending on the temperature, they replace the offsets
+	TempCurve []CurvePoint `json:"temp_curve,omitempty"`
+	HumCurve  []CurvePoint `json:"hum_curve,omitempty"`
+	// MQTT based sensors (Tasmota, ESPHome, Zigbee2MQTT)
+	Broker           string `json:"broker"`            // e.g. "tcp://192.168.0.22:1883"
+	Username         string `json:"username"`          // MQTT user
+	Password         string `json:"password"`          // MQTT password
+	Topic            string `json:"topic"`             // Tasmota telemetry topic, e.g. "tele/garden/SENSOR", or Zigbee2MQTT device topic
+	TemperatureTopic string `json:"temperature_topic"` // ESPHome state topic of the temperature
+	HumidityTopic    string `json:"humidity_topic"`    // ESPHome state topic of the humidity
+	MaxAge           int    `json:"max_age"`           // readings older than this time in s are rejected
+	// sensor of another dew point fan (peer), either via HTTP or via MQTT (broker and topic)
+	Url  string `json:"url"`  // e.g. "http://192.168.0.30:8080/api/v1/peer"
+	Peer string `json:"peer"` // "outside" (default) or "inside" sensor of the peer
+	// BLE hygrometer, the readings are taken from its advertisements
+	Address string `json:"address"`  // e.g. "A4:C1:38:12:34:56"
+	Adapter int    `json:"adapter"`  // number of the Bluetooth adapter, 0 for hci0
+	MinRssi int    `json:"min_rssi"` // weaker signals are logged, default -90 dBm
+	// RH/T transmitter with Modbus RTU
+	Device       string  `json:"device"`        // serial port, e.g. "/dev/ttyUSB0"
+	Baud         int     `json:"baud"`          // default 9600
+	Parity       string  `json:"parity"`        // "N" (default), "E" or "O"
+	Unit         int     `json:"unit"`          // address of the device on the bus, default 1
+	RegisterType string  `json:"register_type"` // "input" (default) or "holding"
+	TempRegister uint16  `json:"temp_register"` // default 1
+	HumRegister  uint16  `json:"hum_register"`  // default 2
+	Scale        float32 `json:"scale"`         // factor of the register values, default 0.1
+	// several sensors at the same location (redundant), each with its own corrections
+	Sensors     []Config `json:"sensors,omitempty"`
+	Vote        string   `json:"vote"`          // "average" (default) or "healthiest"
+	MaxTempDiff float32  `json:"max_temp_diff"` // larger differences are a calibration warning, default 1.0 °C
+	MaxHumDiff  float32  `json:"max_hum_diff"`  // default 5.0 %
+}
+
+// New creates a sensor according to the given configuration
+func New(cfg Config) (Sensor, error) {
+	switch strings.ToLower(cfg.Type) {
+	case "", TypeDHT22:
+		return newDHT22(cfg), nil
+	case TypeSHT3x:
+		return newSHT3x(cfg)
+	case TypeBME680:
+		return newBME680(cfg)
+	case TypeTasmota, TypeESPHome, TypeZigbee2MQTT:
+		return newMqttSensor(cfg)
+	case TypePeer:
+		return newPeerSensor(cfg)
+	case TypeRedundant:
+		return newRedundant(cfg)
+	case TypeBLE:
+		return newBleSensor(cfg)
+	case TypeModbus:
+		return newModbusSensor(cfg)
+	}
+	return nil, fmt.Errorf("unknown sensor type '%s'", cfg.Type)
+}
@@ -0,0 +1,114 @@
+package sensor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/d2r2/go-i2c"
+)
+
+var (
+	sht3xMeasure     = []byte{0x24, 0x00} // single shot, high repeatability, no clock stretching
+	sht3xHeaterOn    = []byte{0x30, 0x6D}
+	sht3xHeaterOff   = []byte{0x30, 0x66}
+	errSht3xCrc      = errors.New("sht3x: crc mismatch")
+	errSht3xTooShort = errors.New("sht3x: short read")
+)
+
+type sht3x struct {
+	mu          sync.Mutex
+	name        string
+	key         string // bus and address for the read scheduler
+	bus         *i2c.I2C
+	retries     int
+	minInterval time.Duration
+}
+
+func newSHT3x(cfg Config) (*sht3x, error) {
+	addr := cfg.I2CAddress
+	if addr == 0 {
+		addr = 0x44
+	}
+	busNum := cfg.I2CBus
+	if busNum == 0 {
+		busNum = 1
+	}
+	bus, err := i2c.NewI2C(addr, busNum)
+	if err != nil {
+		return nil, err
+	}
+	return &sht3x{name: cfg.Name, key: fmt.Sprintf("i2c%d-%#x", busNum, addr), bus: bus, retries: cfg.Retries,
+		minInterval: cfg.ReadInterval()}, nil
+}
+
+func (s *sht3x) Name() string {
+	return s.name
+}
+
+func (s *sht3x) Read() (temperature float32, humidity float32, retried int, err error) {
+	for retried = 0; ; retried++ {
+		var end func()
+		// a timed out read keeps running in the background, a hanging bus blocks the others at most for TURN_TIMEOUT
+		if end, err = schedule.begin(context.Background(), s.key, s.minInterval); err != nil {
+			return
+		}
+		temperature, humidity, err = s.measure()
+		end()
+		if err == nil || retried >= s.retries {
+			return
+		}
+	}
+}
+
+func (s *sht3x) measure() (float32, float32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.bus.WriteBytes(sht3xMeasure); err != nil {
+		return 0, 0, err
+	}
+	time.Sleep(20 * time.Millisecond)
+	buf := make([]byte, 6)
+	n, err := s.bus.ReadBytes(buf)
+	if err != nil {
+		return 0, 0, err
+	}
+	if n < len(buf) {
+		return 0, 0, errSht3xTooShort
+	}
+	if crc8(buf[0:2]) != buf[2] || crc8(buf[3:5]) != buf[5] {
+		return 0, 0, errSht3xCrc
+	}
+	rawT := float32(uint16(buf[0])<<8 | uint16(buf[1]))
+	rawH := float32(uint16(buf[3])<<8 | uint16(buf[4]))
+	return -45 + 175*rawT/65535, 100 * rawH / 65535, nil
+}
+
+func (s *sht3x) SetHeater(on bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cmd := sht3xHeaterOff
+	if on {
+		cmd = sht3xHeaterOn
+	}
+	_, err := s.bus.WriteBytes(cmd)
+	return err
+}
+
+// CRC-8 as used by Sensirion (polynomial 0x31, init 0xFF)
+func crc8(data []byte) byte {
+	crc := byte(0xFF)
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x31
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,106 @@
+package sensor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DEF_TIMEOUT is the default maximum time of a read including the retries in s
+const DEF_TIMEOUT = 20
+
+// HUNG_AFTER is the time after which an abandoned read that is still running counts as hung
+const HUNG_AFTER = 5 * time.Minute
+
+// ErrBusy is returned while an abandoned read of the sensor is still running
+var ErrBusy = errors.New("sensor is still busy with a timed out read")
+
+// ErrHung is returned while an abandoned read of the sensor runs longer than HUNG_AFTER, the driver
+// or the bus hangs and won't recover by itself
+var ErrHung = errors.New("sensor read hangs, the driver doesn't return")
+
+// ContextReader is implemented by sensors that abort a read themselves, when the context is done
+type ContextReader interface {
+	ReadContext(ctx context.Context) (temperature float32, humidity float32, retried int, err error)
+}
+
+// an abandoned read, that is still running
+type pendingRead struct {
+	start time.Time
+	busy  bool // ErrBusy was logged
+	hung  bool // ErrHung was logged
+}
+
+// sensors with a running read
+var (
+	pendingMu sync.Mutex
+	pending   = map[Sensor]*pendingRead{}
+)
+
+type readResult struct {
+	temperature float32
+	humidity    float32
+	retried     int
+	err         error
+}
+
+// ReadContext reads the sensor and gives up, when the context is done. A read that can't be
+// aborted keeps running in the background, until it's finished the sensor isn't read again and
+// ErrBusy is returned, after HUNG_AFTER ErrHung.
+func ReadContext(ctx context.Context, s Sensor) (float32, float32, int, error) {
+	if cr, ok := s.(ContextReader); ok {
+		return cr.ReadContext(ctx)
+	}
+	return abandonable(ctx, s, s.Read)
+}
+
+// runs read in the background and gives up, when the context is done. Only one read of the sensor
+// is running at a time, see ReadContext.
+func abandonable(ctx context.Context, s Sensor, read func() (float32, float32, int, error)) (float32, float32, int, error) {
+	pendingMu.Lock()
+	if p, running := pending[s]; running {
+		defer pendingMu.Unlock()
+		if d := time.Since(p.start); d >= HUNG_AFTER {
+			if !p.hung {
+				lg.Errorf("%s: the read hangs for %.0f s", s.Name(), d.Seconds())
+				p.hung = true
+			}
+			return 0, 0, 0, ErrHung
+		}
+		if !p.busy {
+			lg.Warnf("%s: %s", s.Name(), ErrBusy)
+			p.busy = true
+		}
+		return 0, 0, 0, ErrBusy
+	}
+	p := &pendingRead{start: time.Now()}
+	pending[s] = p
+	pendingMu.Unlock()
+	done := make(chan readResult, 1)
+	go func() {
+		t, h, r, err := read()
+		pendingMu.Lock()
+		if p.busy {
+			lg.Infof("%s: the timed out read returned after %.0f s", s.Name(), time.Since(p.start).Seconds())
+		}
+		delete(pending, s)
+		pendingMu.Unlock()
+		done <- readResult{t, h, r, err}
+	}()
+	select {
+	case r := <-done:
+		return r.temperature, r.humidity, r.retried, r.err
+	case <-ctx.Done():
+		lg.Warnf("%s: read aborted: %s", s.Name(), ctx.Err())
+		return 0, 0, 0, ctx.Err()
+	}
+}
+
+// ReadTimeout returns the maximum time of a read including the retries
+func (cfg Config) ReadTimeout() time.Duration {
+	if cfg.Timeout <= 0 {
+		return DEF_TIMEOUT * time.Second
+	}
+	return time.Duration(cfg.Timeout) * time.Second
+}
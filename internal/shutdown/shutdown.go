@@ -0,0 +1,64 @@
+// Package shutdown runs cleanup functions (e.g. switching the relay to a safe state) before the program exits.
+package shutdown
+
+import (
+	"os"
+	"sync"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+var (
+	exitMu       sync.Mutex
+	exitHandlers []func()
+	exitOnce     sync.Once
+)
+
+// OnExit registers a function that is called before the program exits
+func OnExit(fn func()) {
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	exitHandlers = append(exitHandlers, fn)
+}
+
+// Run calls the registered exit functions once, in the reverse order of their registration
+func Run() {
+	exitOnce.Do(func() {
+		exitMu.Lock()
+		handlers := append([]func(){}, exitHandlers...)
+		exitMu.Unlock()
+		for i := len(handlers) - 1; i >= 0; i-- {
+			func() {
+				defer func() {
+					if err := recover(); err != nil {
+						logger.Error("Panic in exit handler:", err)
+					}
+				}()
+				handlers[i]()
+			}()
+		}
+	})
+}
+
+// Exit calls the exit functions and exits the program with the code
+func Exit(code int) {
+	Run()
+	os.Exit(code)
+}
+
+// Recover exits the program after a panic, after the exit functions were called. It must be
+// deferred directly, e.g. at the start of a goroutine.
+func Recover() {
+	if err := recover(); err != nil {
+		logger.Error("Panic occurred:", err)
+		Exit(1)
+	}
+}
+
+// Go runs fn in a goroutine, a panic of fn exits the program after the exit functions were called
+func Go(fn func()) {
+	go func() {
+		defer Recover()
+		fn()
+	}()
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+
+	"github.com/aluedtke7/dew_point_fan/internal/logger"
+)
+
+// GraphiteWriter sends points in the Graphite plaintext protocol. Every field becomes its own
+// metric 'prefix.measurement.field', tags are appended in the Graphite 1.1 tag format.
+type GraphiteWriter struct {
+	address string
+	prefix  string
+}
+
+// NewGraphiteWriter creates a writer for the given address (host:port, usually port 2003)
+func NewGraphiteWriter(address, prefix string) *GraphiteWriter {
+	return &GraphiteWriter{address: address, prefix: prefix}
+}
+
+// WritePoint sends the points
+func (g *GraphiteWriter) WritePoint(ctx context.Context, points ...*write.Point) error {
+	lines := make([]string, 0, len(points))
+	for _, p := range points {
+		lines = append(lines, write.PointToLineProtocol(p, time.Nanosecond))
+	}
+	return g.WriteRecord(ctx, lines...)
+}
+
+// WriteRecord converts the lines in line protocol and sends them, lines that can't be converted
+// are logged and skipped, so they don't block the queue
+func (g *GraphiteWriter) WriteRecord(ctx context.Context, lines ...string) error {
+	var sb strings.Builder
+	for _, l := range lines {
+		metrics, err := g.convert(l)
+		if err != nil {
+			logger.Warnf("Line skipped: %s", err)
+			continue
+		}
+		for _, m := range metrics {
+			sb.WriteString(m)
+			sb.WriteString("\n")
+		}
+	}
+	if sb.Len() == 0 {
+		return nil
+	}
+	var d net.Dialer
+	dctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	conn, err := d.DialContext(dctx, "tcp", g.address)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	_ = conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err = conn.Write([]byte(sb.String()))
+	return err
+}
+
+// splits s at the separators, that aren't escaped with a backslash or within double quotes
+func splitLine(s string, sep byte) []string {
+	var parts []string
+	start, quoted := 0, false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// splits s at the first separator, that isn't escaped
+func splitPair(s string, sep byte) (string, string, bool) {
+	parts := splitLine(s, sep)
+	if len(parts) < 2 {
+		return s, "", false
+	}
+	return parts[0], s[len(parts[0])+1:], true
+}
+
+// removes the escaping backslashes
+func unescape(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// replaces the characters, that Graphite doesn't allow in names and tags
+var graphiteReplacer = strings.NewReplacer(" ", "_", ";", "_", "~", "_", "=", "_")
+
+// converts one line in line protocol to Graphite metrics, escaped characters in the names and
+// the tags are supported
+func (g *GraphiteWriter) convert(line string) ([]string, error) {
+	parts := splitLine(strings.TrimSpace(line), ' ')
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("graphite: unsupported line '%s'", line)
+	}
+	ns, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("graphite: invalid timestamp in line '%s'", line)
+	}
+	ts := ns / int64(time.Second)
+	head := splitLine(parts[0], ',')
+	var tags []string
+	for _, t := range head[1:] {
+		k, v, ok := splitPair(t, '=')
+		if !ok || k == "" || v == "" {
+			return nil, fmt.Errorf("graphite: invalid tag '%s' in line '%s'", t, line)
+		}
+		tags = append(tags, graphiteReplacer.Replace(unescape(k))+"="+graphiteReplacer.Replace(unescape(v)))
+	}
+	sort.Strings(tags)
+	suffix := ""
+	if len(tags) > 0 {
+		suffix = ";" + strings.Join(tags, ";")
+	}
+	measurement := graphiteReplacer.Replace(unescape(head[0]))
+	var metrics []string
+	for _, f := range splitLine(parts[1], ',') {
+		k, v, ok := splitPair(f, '=')
+		if !ok {
+			return nil, fmt.Errorf("graphite: invalid field '%s' in line '%s'", f, line)
+		}
+		value := strings.TrimSuffix(strings.TrimSuffix(v, "i"), "u")
+		if value == "true" {
+			value = "1"
+		} else if value == "false" {
+			value = "0"
+		} else if _, err := strconv.ParseFloat(value, 64); err != nil {
+			// strings can't be stored in Graphite
+			continue
+		}
+		name := measurement + "." + graphiteReplacer.Replace(unescape(k))
+		if g.prefix != "" {
+			name = g.prefix + "." + name
+		}
+		metrics = append(metrics, fmt.Sprintf("%s%s %s %d", name, suffix, value, ts))
+	}
+	return metrics, nil
+}
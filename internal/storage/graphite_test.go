@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+func TestGraphiteConvert(t *testing.T) {
+	g := NewGraphiteWriter("", "dpf")
+	ts := time.Unix(1700000000, 0)
+	tests := []struct {
+		name string
+		line string
+		want []string
+	}{
+		{"plain", "dp,version=1.2 temp_i=21.5,vent_val=1i 1700000000000000000",
+			[]string{"dpf.dp.temp_i;version=1.2 21.5 1700000000", "dpf.dp.vent_val;version=1.2 1 1700000000"}},
+		{"escaped tag value", `dp,zone=cellar\ room\ A,reason=a\,b temp_i=20 1700000000000000000`,
+			[]string{"dpf.dp.temp_i;reason=a,b;zone=cellar_room_A 20 1700000000"}},
+		{"escaped field key and string value", `dp plug\ x=1.5,note="a b, c" 1700000000000000000`,
+			[]string{"dpf.dp.plug_x 1.5 1700000000"}},
+		{"point", write.PointToLineProtocol(write.NewPoint("dp_event", map[string]string{"reason": "plugin night"},
+			map[string]interface{}{"venting": true}, ts), time.Nanosecond),
+			[]string{"dpf.dp_event.venting;reason=plugin_night 1 1700000000"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := g.convert(tt.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("convert(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphiteConvertInvalid(t *testing.T) {
+	g := NewGraphiteWriter("", "")
+	for _, line := range []string{"", "dp", "dp temp_i=1", "dp,zone temp_i=1 1", "dp temp_i=1 x"} {
+		if _, err := g.convert(line); err == nil {
+			t.Errorf("convert(%q) succeeded", line)
+		}
+	}
+}
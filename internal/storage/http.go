@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// HTTPLineWriter posts points in line protocol to an http endpoint, e.g. the /write
+// endpoint of VictoriaMetrics
+type HTTPLineWriter struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPLineWriter creates a writer for the given url
+func NewHTTPLineWriter(url string) *HTTPLineWriter {
+	return &HTTPLineWriter{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// WritePoint sends the points
+func (h *HTTPLineWriter) WritePoint(ctx context.Context, points ...*write.Point) error {
+	lines := make([]string, 0, len(points))
+	for _, p := range points {
+		lines = append(lines, write.PointToLineProtocol(p, time.Nanosecond))
+	}
+	return h.WriteRecord(ctx, lines...)
+}
+
+// WriteRecord sends lines in line protocol
+func (h *HTTPLineWriter) WriteRecord(ctx context.Context, lines ...string) error {
+	body := strings.Join(lines, "\n") + "\n"
+	req, err := http.NewRequestWithContext(ctx, "POST", h.url, bytes.NewBufferString(body))
+	if err != nil {
+		return err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: %s", h.url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucketRecords = []byte("records")
+
+// Record holds the readings and the fan state of one measurement cycle
+type Record struct {
+	Time            time.Time `json:"time"`
+	Valid           bool      `json:"valid"` // false if the readings of this cycle failed
+	TempInside      float32   `json:"temp_i"`
+	TempOutside     float32   `json:"temp_o"`
+	HumInside       float32   `json:"hum_i"`
+	HumOutside      float32   `json:"hum_o"`
+	DewPointInside  float32   `json:"dewpoint_i"`
+	DewPointOutside float32   `json:"dewpoint_o"`
+	Venting         bool      `json:"venting"`
+	FanStatus       bool      `json:"fan_status"`
+	Source          string    `json:"source"`
+	Maintenance     bool      `json:"maintenance,omitempty"` // recorded during the maintenance mode
+}
+
+// LocalStore keeps the measurement history in an embedded bbolt database
+type LocalStore struct {
+	db        *bolt.DB
+	retention time.Duration
+}
+
+// OpenLocal opens (or creates) the database file. Records older than retention are removed by Prune.
+func OpenLocal(path string, retention time.Duration) (*LocalStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketRecords)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &LocalStore{db: db, retention: retention}, nil
+}
+
+// keys are the big endian unix nano timestamps, so that they are sorted by time
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+// Add stores a record
+func (s *LocalStore) Add(r Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketRecords).Put(timeKey(r.Time), data)
+	})
+}
+
+// Range returns all records with from <= time < to, oldest first
+func (s *LocalStore) Range(from, to time.Time) ([]Record, error) {
+	records := make([]Record, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketRecords).Cursor()
+		end := timeKey(to)
+		for k, v := c.Seek(timeKey(from)); k != nil && string(k) < string(end); k, v = c.Next() {
+			var r Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			records = append(records, r)
+		}
+		return nil
+	})
+	return records, err
+}
+
+// Prune removes all records older than the retention time and returns their number
+func (s *LocalStore) Prune(now time.Time) (int, error) {
+	count := 0
+	limit := timeKey(now.Add(-s.retention))
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketRecords).Cursor()
+		for k, _ := c.First(); k != nil && string(k) < string(limit); k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Close closes the database
+func (s *LocalStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucketQueue = []byte("queue")
+
+// Queue is a disk backed FIFO for line protocol records that couldn't be written to InfluxDB
+type Queue struct {
+	db      *bolt.DB
+	maxSize int
+	mu      sync.Mutex // serializes the changes of the queue and its length
+	n       int        // number of queued lines, counting the bucket would be slow with a long queue
+}
+
+// OpenQueue opens (or creates) the queue file. If more than maxSize records are queued, the oldest are dropped.
+func OpenQueue(path string, maxSize int) (*Queue, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	q := &Queue{db: db, maxSize: maxSize}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketQueue)
+		if err != nil {
+			return err
+		}
+		q.n = b.Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+// Push appends the given lines to the queue
+func (q *Queue) Push(lines ...string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := q.n
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketQueue)
+		for _, l := range lines {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			key := make([]byte, 8)
+			binary.BigEndian.PutUint64(key, seq)
+			if err = b.Put(key, []byte(l)); err != nil {
+				return err
+			}
+			n++
+		}
+		// drop the oldest records if the queue is too long
+		c := b.Cursor()
+		for ; n > q.maxSize; n-- {
+			if k, _ := c.First(); k == nil {
+				break
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		q.n = n
+	}
+	return err
+}
+
+// Peek returns up to n of the oldest lines together with their keys, without removing them
+func (q *Queue) Peek(n int) (keys [][]byte, lines []string, err error) {
+	err = q.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketQueue).Cursor()
+		for k, v := c.First(); k != nil && len(keys) < n; k, v = c.Next() {
+			keys = append(keys, append([]byte{}, k...))
+			lines = append(lines, string(v))
+		}
+		return nil
+	})
+	return
+}
+
+// Remove deletes the given keys from the queue
+func (q *Queue) Remove(keys [][]byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	removed := 0
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketQueue)
+		for _, k := range keys {
+			// the key may be dropped already, if the queue was too long
+			if b.Get(k) == nil {
+				continue
+			}
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	if err == nil {
+		q.n -= removed
+	}
+	return err
+}
+
+// Len returns the number of queued lines
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.n
+}
+
+// Close closes the queue file
+func (q *Queue) Close() error {
+	return q.db.Close()
+}
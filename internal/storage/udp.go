@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// UDPWriter sends points in line protocol over UDP (fire and forget), as supported by InfluxDB 1.x,
+// Telegraf and VictoriaMetrics
+type UDPWriter struct {
+	conn net.Conn
+}
+
+// NewUDPWriter creates a writer for the given address (host:port)
+func NewUDPWriter(address string) (*UDPWriter, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &UDPWriter{conn: conn}, nil
+}
+
+// WritePoint sends the points, each point in its own datagram
+func (u *UDPWriter) WritePoint(ctx context.Context, points ...*write.Point) error {
+	lines := make([]string, 0, len(points))
+	for _, p := range points {
+		lines = append(lines, write.PointToLineProtocol(p, time.Nanosecond))
+	}
+	return u.WriteRecord(ctx, lines...)
+}
+
+// WriteRecord sends lines in line protocol
+func (u *UDPWriter) WriteRecord(_ context.Context, lines ...string) error {
+	for _, l := range lines {
+		if !strings.HasSuffix(l, "\n") {
+			l += "\n"
+		}
+		if _, err := u.conn.Write([]byte(l)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the connection
+func (u *UDPWriter) Close() error {
+	return u.conn.Close()
+}
@@ -0,0 +1,68 @@
+// Package version provides the version of the program. The values are set with
+//
+//	go build -ldflags "-X github.com/aluedtke7/dew_point_fan/internal/version.Version=1.2.0 ..."
+//
+// otherwise they are taken from the build info of the Go toolchain.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	Version   = ""
+	Commit    = ""
+	BuildDate = ""
+)
+
+func init() {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	if Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		Version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if Commit == "" {
+				Commit = s.Value
+			}
+		case "vcs.time":
+			if BuildDate == "" {
+				BuildDate = s.Value
+			}
+		}
+	}
+}
+
+// Short returns the version, "dev" if unknown
+func Short() string {
+	if Version == "" {
+		return "dev"
+	}
+	return Version
+}
+
+// ShortCommit returns the first 7 characters of the commit
+func ShortCommit() string {
+	if len(Commit) > 7 {
+		return Commit[:7]
+	}
+	return Commit
+}
+
+// String returns the version with commit, build date and Go version
+func String() string {
+	s := Short()
+	if c := ShortCommit(); c != "" {
+		s += " (" + c + ")"
+	}
+	if BuildDate != "" {
+		s += " built " + BuildDate
+	}
+	return fmt.Sprintf("%s, %s", s, runtime.Version())
+}